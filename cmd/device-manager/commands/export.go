@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"github.com/nalej/device-manager/internal/pkg/cli"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var exportConfig = cli.ExportConfig{}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the device inventory",
+	Long: `Export the inventory of the devices of an organization or device group in CSV, JSON Lines or
+Parquet format. API keys are only included if requested, and require administrator privileges.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		exporter := cli.NewExporter(exportConfig)
+		err := exporter.Run()
+		if err != nil {
+			log.Fatal().Str("err", err.DebugReport()).Msg("export failed")
+		}
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportConfig.DeviceManagerAddress, "deviceManagerAddress", "localhost:6010",
+		"Device Manager address (host:port)")
+	exportCmd.Flags().StringVar(&exportConfig.OrganizationId, "organizationId", "", "Organization identifier")
+	exportCmd.Flags().StringVar(&exportConfig.DeviceGroupId, "deviceGroupId", "", "Export only the devices of this device group")
+	exportCmd.Flags().StringVar(&exportConfig.LabelSelector, "labelSelector", "", "Export only the devices that match the label selector")
+	exportCmd.Flags().StringVar(&exportConfig.Format, "format", "csv", "Output format (csv, jsonl or parquet)")
+	exportCmd.Flags().StringVar(&exportConfig.Output, "output", "", "Output file, standard output if not set")
+	exportCmd.Flags().BoolVar(&exportConfig.IncludeApiKeys, "includeApiKeys", false, "Include the device API keys")
+	exportCmd.Flags().StringVar(&exportConfig.UserId, "userId", "device-manager-cli", "Identifier of the operator performing the export")
+	exportCmd.Flags().StringVar(&exportConfig.ActorSecret, "actorSecret", "", "Secret shared with the device manager to sign the identity of the operator")
+	exportCmd.Flags().DurationVar(&exportConfig.Timeout, "timeout", 10*time.Minute, "Timeout of the export operation")
+
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"github.com/nalej/device-manager/internal/pkg/cli"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var importConfig = cli.ImportConfig{}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import devices from a CSV or JSON Lines file",
+	Long: `Register the devices of a CSV or JSON Lines file in a device group. CSV files must contain a header
+with a device_id column, and optionally labels (key1=value1;key2=value2) and asset_info (JSON) columns.
+JSON Lines files contain one object per line with device_id, labels and asset_info.
+Devices that already exist are not registered again, so an import can be repeated.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		importer := cli.NewImporter(importConfig)
+		err := importer.Run()
+		if err != nil {
+			log.Fatal().Str("err", err.DebugReport()).Msg("import failed")
+		}
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importConfig.DeviceManagerAddress, "deviceManagerAddress", "localhost:6010",
+		"Device Manager address (host:port)")
+	importCmd.Flags().StringVar(&importConfig.OrganizationId, "organizationId", "", "Organization identifier")
+	importCmd.Flags().StringVar(&importConfig.DeviceGroupId, "deviceGroupId", "", "Device group identifier")
+	importCmd.Flags().StringVar(&importConfig.DeviceGroupApiKey, "deviceGroupApiKey", "", "Device group API key")
+	importCmd.Flags().StringVar(&importConfig.File, "file", "", "File with the devices to import")
+	importCmd.Flags().StringVar(&importConfig.Format, "format", "", "Format of the file (csv or jsonl), derived from the extension if not set")
+	importCmd.Flags().DurationVar(&importConfig.Timeout, "timeout", 10*time.Minute, "Timeout of the import operation")
+
+	rootCmd.AddCommand(importCmd)
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commands
+
+import (
+	"github.com/nalej/device-manager/internal/pkg/cli"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var reconcileConfig = cli.ReconcileConfig{}
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Find and fix inconsistencies between system model, authx and the latency store",
+	Long: `Compare the devices and device groups of an organization in system model with their credentials in authx
+and with the latencies stored by the device manager. Missing credentials, dangling credentials and latencies of
+removed devices are reported. The inconsistencies are only fixed if --apply is set.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		reconciler := cli.NewReconciler(reconcileConfig)
+		err := reconciler.Run()
+		if err != nil {
+			log.Fatal().Str("err", err.DebugReport()).Msg("reconciliation failed")
+		}
+	},
+}
+
+func init() {
+	reconcileCmd.Flags().StringVar(&reconcileConfig.DeviceManagerAddress, "deviceManagerAddress", "localhost:6010",
+		"Device Manager address (host:port)")
+	reconcileCmd.Flags().StringVar(&reconcileConfig.OrganizationId, "organizationId", "", "Organization identifier")
+	reconcileCmd.Flags().BoolVar(&reconcileConfig.Apply, "apply", false, "Fix the inconsistencies instead of only reporting them")
+	reconcileCmd.Flags().StringVar(&reconcileConfig.UserId, "userId", "device-manager-cli", "Identifier of the operator performing the reconciliation")
+	reconcileCmd.Flags().StringVar(&reconcileConfig.ActorSecret, "actorSecret", "", "Secret shared with the device manager to sign the identity of the operator")
+	reconcileCmd.Flags().DurationVar(&reconcileConfig.Timeout, "timeout", 10*time.Minute, "Timeout of the reconciliation")
+
+	rootCmd.AddCommand(reconcileCmd)
+}
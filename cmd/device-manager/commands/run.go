@@ -53,6 +53,15 @@ func init() {
 	runCmd.Flags().IntVar(&config.ScyllaDBPort, "scyllaDBPort", 9042, "port to connect to scylla database")
 	runCmd.Flags().StringVar(&config.KeySpace, "scyllaDBKeyspace", "measure", "keyspace of scylla database")
 	runCmd.Flags().DurationVar(&config.Threshold, "threshold", d, "Threshold between ping to decide if a device is offline/online")
+	runCmd.Flags().IntVar(&config.DefaultPageSize, "defaultPageSize", 100, "Number of elements returned by the listings if the page size is not set")
+	runCmd.Flags().IntVar(&config.MaxPageSize, "maxPageSize", 1000, "Maximum number of elements returned by the listings in a page")
+	runCmd.Flags().IntVar(&config.BulkConcurrency, "bulkConcurrency", 10, "Maximum number of devices processed concurrently by a bulk operation")
+	runCmd.Flags().DurationVar(&config.PendingDeviceExpiration, "pendingDeviceExpiration", 72*time.Hour, "Time a device registration can wait for approval before it is removed")
+	runCmd.Flags().DurationVar(&config.DeletedDeviceRetention, "deletedDeviceRetention", 30*24*time.Hour, "Time a deleted device can be restored before it is purged")
+	runCmd.Flags().DurationVar(&config.ReconcilePeriod, "reconcilePeriod", 24*time.Hour, "Time between two reconciliations of all the organizations, 0 to disable them")
+	runCmd.Flags().BoolVar(&config.ReconcileApply, "reconcileApply", false, "Fix the inconsistencies found by the periodic reconciliation instead of only logging them")
+	runCmd.Flags().StringSliceVar(&config.ReservedLabelPrefixes, "reservedLabelPrefixes", []string{"nalej.com/"}, "Prefixes of the label keys that only administrators can set")
+	runCmd.Flags().StringVar(&config.ActorSecret, "actorSecret", "", "Secret shared with the components that authenticate the users to sign their identity")
 
 	rootCmd.AddCommand(runCmd)
 }
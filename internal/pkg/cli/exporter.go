@@ -0,0 +1,302 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-authx-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/rs/zerolog/log"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportConfig contains the parameters of a device inventory export.
+type ExportConfig struct {
+	// DeviceManagerAddress with the host:port to connect to the device manager
+	DeviceManagerAddress string
+	// OrganizationId of the devices
+	OrganizationId string
+	// DeviceGroupId to limit the export to a single group
+	DeviceGroupId string
+	// LabelSelector to filter the devices
+	LabelSelector string
+	// Format of the output: csv, jsonl or parquet
+	Format string
+	// Output file. If empty, the inventory is written to the standard output
+	Output string
+	// IncludeApiKeys adds the device API keys to the inventory. Requires administrator privileges
+	IncludeApiKeys bool
+	// UserId of the operator performing the export
+	UserId string
+	// ActorSecret used to sign the identity of the operator
+	ActorSecret string
+	// Timeout of the export operation
+	Timeout time.Duration
+}
+
+func (conf *ExportConfig) Validate() derrors.Error {
+	if conf.DeviceManagerAddress == "" {
+		return derrors.NewInvalidArgumentError("deviceManagerAddress must be set")
+	}
+	if conf.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError("organizationId must be set")
+	}
+	if conf.IncludeApiKeys && conf.ActorSecret == "" {
+		return derrors.NewInvalidArgumentError("actorSecret must be set to include the API keys")
+	}
+	switch conf.Format {
+	case "csv", "jsonl":
+	case "parquet":
+		if conf.Output == "" {
+			return derrors.NewInvalidArgumentError("parquet format requires an output file")
+		}
+	default:
+		return derrors.NewInvalidArgumentError("format must be csv, jsonl or parquet").WithParams(conf.Format)
+	}
+	return nil
+}
+
+// inventoryWriter writes the inventory records in a given format.
+type inventoryWriter interface {
+	Write(record *grpc_device_manager_go.DeviceInventoryRecord) error
+	Close() error
+}
+
+// Exporter retrieves the device inventory from the device manager and writes it in the requested format.
+type Exporter struct {
+	Configuration ExportConfig
+}
+
+// NewExporter creates an Exporter with a given configuration.
+func NewExporter(conf ExportConfig) *Exporter {
+	return &Exporter{conf}
+}
+
+// Run the export.
+func (e *Exporter) Run() derrors.Error {
+	vErr := e.Configuration.Validate()
+	if vErr != nil {
+		return vErr
+	}
+	conn, err := grpc.Dial(e.Configuration.DeviceManagerAddress, grpc.WithInsecure())
+	if err != nil {
+		return derrors.AsError(err, "cannot create connection with the device manager")
+	}
+	defer conn.Close()
+	client := grpc_device_manager_go.NewDevicesClient(conn)
+
+	var output io.Writer = os.Stdout
+	if e.Configuration.Output != "" {
+		file, err := os.Create(e.Configuration.Output)
+		if err != nil {
+			return derrors.AsError(err, "cannot create output file")
+		}
+		defer file.Close()
+		output = file
+	}
+	w, err := e.newWriter(output)
+	if err != nil {
+		return derrors.AsError(err, "cannot create inventory writer")
+	}
+
+	ctx, cancel := context.WithTimeout(e.outgoingContext(), e.Configuration.Timeout)
+	defer cancel()
+	stream, err := client.ExportDevices(ctx, &grpc_device_manager_go.ExportDevicesRequest{
+		OrganizationId: e.Configuration.OrganizationId,
+		DeviceGroupId:  e.Configuration.DeviceGroupId,
+		LabelSelector:  e.Configuration.LabelSelector,
+		IncludeApiKeys: e.Configuration.IncludeApiKeys,
+	})
+	if err != nil {
+		return derrors.AsError(err, "cannot export devices")
+	}
+	exported := 0
+	for {
+		record, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return derrors.AsError(err, "cannot receive inventory record")
+		}
+		err = w.Write(record)
+		if err != nil {
+			return derrors.AsError(err, "cannot write inventory record")
+		}
+		exported++
+	}
+	err = w.Close()
+	if err != nil {
+		return derrors.AsError(err, "cannot close inventory writer")
+	}
+	log.Info().Int("devices", exported).Str("format", e.Configuration.Format).Msg("inventory exported")
+	return nil
+}
+
+// outgoingContext adds the identity of the operator to the request. The export command is intended to be used
+// by the operators of the management cluster, so API keys are requested as administrator.
+func (e *Exporter) outgoingContext() context.Context {
+	primitives := make([]string, 0)
+	if e.Configuration.IncludeApiKeys {
+		primitives = append(primitives, grpc_authx_go.AccessPrimitive_ORG.String())
+	}
+	md := entities.NewActorMetadata(e.Configuration.ActorSecret, e.Configuration.UserId, primitives, time.Now())
+	return metadata.NewOutgoingContext(context.Background(), md)
+}
+
+func (e *Exporter) newWriter(output io.Writer) (inventoryWriter, error) {
+	switch e.Configuration.Format {
+	case "csv":
+		return newCSVInventoryWriter(output, e.Configuration.IncludeApiKeys)
+	case "jsonl":
+		return &jsonInventoryWriter{encoder: json.NewEncoder(output)}, nil
+	case "parquet":
+		return newParquetInventoryWriter(output)
+	}
+	return nil, fmt.Errorf("unsupported format %s", e.Configuration.Format)
+}
+
+// inventoryRow is the flat representation of a record used by the CSV and Parquet formats.
+type inventoryRow struct {
+	OrganizationId       string `parquet:"name=organization_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	DeviceGroupId        string `parquet:"name=device_group_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	DeviceGroupName      string `parquet:"name=device_group_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	DeviceId             string `parquet:"name=device_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	RegisterSince        int64  `parquet:"name=register_since, type=INT64"`
+	Labels               string `parquet:"name=labels, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Geolocation          string `parquet:"name=geolocation, type=BYTE_ARRAY, convertedtype=UTF8"`
+	AssetInfo            string `parquet:"name=asset_info, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Enabled              bool   `parquet:"name=enabled, type=BOOLEAN"`
+	DeviceStatus         string `parquet:"name=device_status, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LastLatency          int32  `parquet:"name=last_latency, type=INT32"`
+	LastLatencyTimestamp int64  `parquet:"name=last_latency_timestamp, type=INT64"`
+	DeviceApiKey         string `parquet:"name=device_api_key, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+func newInventoryRow(record *grpc_device_manager_go.DeviceInventoryRecord) *inventoryRow {
+	row := &inventoryRow{
+		OrganizationId:       record.OrganizationId,
+		DeviceGroupId:        record.DeviceGroupId,
+		DeviceGroupName:      record.DeviceGroupName,
+		DeviceId:             record.DeviceId,
+		RegisterSince:        record.RegisterSince,
+		Labels:               formatLabels(record.Labels),
+		Enabled:              record.Enabled,
+		DeviceStatus:         record.DeviceStatus.String(),
+		LastLatency:          record.LastLatency,
+		LastLatencyTimestamp: record.LastLatencyTimestamp,
+		DeviceApiKey:         record.DeviceApiKey,
+	}
+	if record.Location != nil {
+		row.Geolocation = record.Location.Geolocation
+	}
+	if record.AssetInfo != nil {
+		raw, err := json.Marshal(record.AssetInfo)
+		if err == nil {
+			row.AssetInfo = string(raw)
+		}
+	}
+	return row
+}
+
+// formatLabels uses the same key1=value1;key2=value2 notation of the import files.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+type csvInventoryWriter struct {
+	writer         *csv.Writer
+	includeApiKeys bool
+}
+
+func newCSVInventoryWriter(output io.Writer, includeApiKeys bool) (*csvInventoryWriter, error) {
+	w := &csvInventoryWriter{writer: csv.NewWriter(output), includeApiKeys: includeApiKeys}
+	header := []string{"organization_id", "device_group_id", "device_group_name", "device_id", "register_since",
+		"labels", "geolocation", "asset_info", "enabled", "device_status", "last_latency", "last_latency_timestamp"}
+	if includeApiKeys {
+		header = append(header, "device_api_key")
+	}
+	return w, w.writer.Write(header)
+}
+
+func (w *csvInventoryWriter) Write(record *grpc_device_manager_go.DeviceInventoryRecord) error {
+	row := newInventoryRow(record)
+	values := []string{row.OrganizationId, row.DeviceGroupId, row.DeviceGroupName, row.DeviceId,
+		fmt.Sprintf("%d", row.RegisterSince), row.Labels, row.Geolocation, row.AssetInfo,
+		fmt.Sprintf("%t", row.Enabled), row.DeviceStatus, fmt.Sprintf("%d", row.LastLatency),
+		fmt.Sprintf("%d", row.LastLatencyTimestamp)}
+	if w.includeApiKeys {
+		values = append(values, row.DeviceApiKey)
+	}
+	return w.writer.Write(values)
+}
+
+func (w *csvInventoryWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type jsonInventoryWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonInventoryWriter) Write(record *grpc_device_manager_go.DeviceInventoryRecord) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *jsonInventoryWriter) Close() error {
+	return nil
+}
+
+type parquetInventoryWriter struct {
+	writer *writer.ParquetWriter
+}
+
+func newParquetInventoryWriter(output io.Writer) (*parquetInventoryWriter, error) {
+	pw, err := writer.NewParquetWriterFromWriter(output, new(inventoryRow), 4)
+	if err != nil {
+		return nil, err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	return &parquetInventoryWriter{writer: pw}, nil
+}
+
+func (w *parquetInventoryWriter) Write(record *grpc_device_manager_go.DeviceInventoryRecord) error {
+	return w.writer.Write(newInventoryRow(record))
+}
+
+func (w *parquetInventoryWriter) Close() error {
+	return w.writer.WriteStop()
+}
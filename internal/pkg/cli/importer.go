@@ -0,0 +1,146 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ImportConfig contains the parameters of a device import.
+type ImportConfig struct {
+	// DeviceManagerAddress with the host:port to connect to the device manager
+	DeviceManagerAddress string
+	// OrganizationId of the target device group
+	OrganizationId string
+	// DeviceGroupId of the target device group
+	DeviceGroupId string
+	// DeviceGroupApiKey used to register the devices
+	DeviceGroupApiKey string
+	// File with the devices to import
+	File string
+	// Format of the file (csv or jsonl). If empty, it is derived from the file extension
+	Format string
+	// Timeout of the import operation
+	Timeout time.Duration
+}
+
+func (conf *ImportConfig) Validate() derrors.Error {
+	if conf.DeviceManagerAddress == "" {
+		return derrors.NewInvalidArgumentError("deviceManagerAddress must be set")
+	}
+	if conf.OrganizationId == "" || conf.DeviceGroupId == "" || conf.DeviceGroupApiKey == "" {
+		return derrors.NewInvalidArgumentError("organizationId, deviceGroupId and deviceGroupApiKey must be set")
+	}
+	if conf.File == "" {
+		return derrors.NewInvalidArgumentError("file must be set")
+	}
+	_, err := conf.importFormat()
+	return err
+}
+
+// importFormat returns the format of the file.
+func (conf *ImportConfig) importFormat() (grpc_device_manager_go.ImportFormat, derrors.Error) {
+	format := strings.ToLower(conf.Format)
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(conf.File)), ".")
+	}
+	switch format {
+	case "csv":
+		return grpc_device_manager_go.ImportFormat_CSV, nil
+	case "jsonl", "ndjson":
+		return grpc_device_manager_go.ImportFormat_JSON_LINES, nil
+	}
+	return grpc_device_manager_go.ImportFormat_CSV, derrors.NewInvalidArgumentError("format must be csv or jsonl").WithParams(conf.Format)
+}
+
+// Importer sends the content of an import file to the device manager and prints the result.
+type Importer struct {
+	Configuration ImportConfig
+}
+
+// NewImporter creates an Importer with a given configuration.
+func NewImporter(conf ImportConfig) *Importer {
+	return &Importer{conf}
+}
+
+// Run the import.
+func (i *Importer) Run() derrors.Error {
+	vErr := i.Configuration.Validate()
+	if vErr != nil {
+		return vErr
+	}
+	format, _ := i.Configuration.importFormat()
+	content, err := ioutil.ReadFile(i.Configuration.File)
+	if err != nil {
+		return derrors.AsError(err, "cannot read import file")
+	}
+
+	conn, err := grpc.Dial(i.Configuration.DeviceManagerAddress, grpc.WithInsecure())
+	if err != nil {
+		return derrors.AsError(err, "cannot create connection with the device manager")
+	}
+	defer conn.Close()
+	client := grpc_device_manager_go.NewDevicesClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), i.Configuration.Timeout)
+	defer cancel()
+	log.Info().Str("file", i.Configuration.File).Str("format", format.String()).Msg("importing devices")
+	response, err := client.ImportDevices(ctx, &grpc_device_manager_go.ImportDevicesRequest{
+		OrganizationId:    i.Configuration.OrganizationId,
+		DeviceGroupId:     i.Configuration.DeviceGroupId,
+		DeviceGroupApiKey: i.Configuration.DeviceGroupApiKey,
+		Format:            format,
+		Content:           content,
+	})
+	if err != nil {
+		return derrors.AsError(err, "cannot import devices")
+	}
+	i.print(response)
+	return nil
+}
+
+func (i *Importer) print(response *grpc_device_manager_go.ImportDevicesResponse) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tDEVICE_ID\tSTATUS\tAPI_KEY/ERROR")
+	for _, r := range response.Results {
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(w, "%d\t%s\tFAILED\t%s\n", r.Line, r.DeviceId, r.Error)
+		case r.Created && r.ApprovalPending:
+			fmt.Fprintf(w, "%d\t%s\tCREATED_PENDING_APPROVAL\t%s\n", r.Line, r.DeviceId, r.DeviceApiKey)
+		case r.Created:
+			fmt.Fprintf(w, "%d\t%s\tCREATED\t%s\n", r.Line, r.DeviceId, r.DeviceApiKey)
+		case r.ApprovalPending:
+			fmt.Fprintf(w, "%d\t%s\tEXISTING_PENDING_APPROVAL\t%s\n", r.Line, r.DeviceId, r.DeviceApiKey)
+		default:
+			fmt.Fprintf(w, "%d\t%s\tEXISTING\t%s\n", r.Line, r.DeviceId, r.DeviceApiKey)
+		}
+	}
+	w.Flush()
+	fmt.Printf("\ncreated: %d existing: %d failed: %d\n", response.Created, response.Existing, response.Failed)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-authx-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// ReconcileConfig contains the parameters of a reconciliation.
+type ReconcileConfig struct {
+	// DeviceManagerAddress with the host:port to connect to the device manager
+	DeviceManagerAddress string
+	// OrganizationId to reconcile
+	OrganizationId string
+	// Apply fixes the inconsistencies. Otherwise they are only reported
+	Apply bool
+	// UserId of the operator performing the reconciliation
+	UserId string
+	// ActorSecret used to sign the identity of the operator
+	ActorSecret string
+	// Timeout of the reconciliation
+	Timeout time.Duration
+}
+
+func (conf *ReconcileConfig) Validate() derrors.Error {
+	if conf.DeviceManagerAddress == "" {
+		return derrors.NewInvalidArgumentError("deviceManagerAddress must be set")
+	}
+	if conf.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError("organizationId must be set")
+	}
+	if conf.Apply && conf.ActorSecret == "" {
+		return derrors.NewInvalidArgumentError("actorSecret must be set to fix the inconsistencies")
+	}
+	return nil
+}
+
+// Reconciler requests the reconciliation of an organization to the device manager and prints the result.
+type Reconciler struct {
+	Configuration ReconcileConfig
+}
+
+// NewReconciler creates a Reconciler with a given configuration.
+func NewReconciler(conf ReconcileConfig) *Reconciler {
+	return &Reconciler{conf}
+}
+
+// Run the reconciliation.
+func (r *Reconciler) Run() derrors.Error {
+	vErr := r.Configuration.Validate()
+	if vErr != nil {
+		return vErr
+	}
+	conn, err := grpc.Dial(r.Configuration.DeviceManagerAddress, grpc.WithInsecure())
+	if err != nil {
+		return derrors.AsError(err, "cannot create connection with the device manager")
+	}
+	defer conn.Close()
+	client := grpc_device_manager_go.NewDevicesClient(conn)
+
+	// fixing the inconsistencies requires administrator privileges
+	md := entities.NewActorMetadata(r.Configuration.ActorSecret, r.Configuration.UserId,
+		[]string{grpc_authx_go.AccessPrimitive_ORG.String()}, time.Now())
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(context.Background(), md), r.Configuration.Timeout)
+	defer cancel()
+	log.Info().Str("organizationID", r.Configuration.OrganizationId).Bool("apply", r.Configuration.Apply).Msg("reconciling organization")
+	response, err := client.ReconcileOrganization(ctx, &grpc_device_manager_go.ReconcileRequest{
+		OrganizationId: r.Configuration.OrganizationId,
+		Apply:          r.Configuration.Apply,
+	})
+	if err != nil {
+		return derrors.AsError(err, "cannot reconcile organization")
+	}
+	r.print(response)
+	return nil
+}
+
+func (r *Reconciler) print(response *grpc_device_manager_go.ReconcileResponse) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ISSUE\tDEVICE_GROUP_ID\tDEVICE_ID\tSTATUS")
+	fixed := 0
+	for _, issue := range response.Issues {
+		status := "FOUND"
+		switch {
+		case issue.Error != "":
+			status = fmt.Sprintf("FAILED: %s", issue.Error)
+		case issue.Fixed:
+			status = "FIXED"
+			fixed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", issue.Kind.String(), issue.DeviceGroupId, issue.DeviceId, status)
+	}
+	w.Flush()
+	fmt.Printf("\nissues: %d fixed: %d\n", len(response.Issues), fixed)
+	if !response.Apply && len(response.Issues) > 0 {
+		fmt.Println("dry-run: use --apply to fix the inconsistencies")
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-authx-go"
+	"google.golang.org/grpc/metadata"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata keys set by the components that authenticate the users before calling the device manager. The identity
+// is only trusted if it is signed with the secret shared with those components.
+const (
+	// UserIdMetadataKey contains the identifier of the user performing the request.
+	UserIdMetadataKey = "user_id"
+	// PrimitivesMetadataKey contains the comma separated access primitives of the user.
+	PrimitivesMetadataKey = "primitives"
+	// ActorTimestampMetadataKey contains the unix time when the identity was signed.
+	ActorTimestampMetadataKey = "actor_timestamp"
+	// ActorSignatureMetadataKey contains the HMAC-SHA256 of the identity and the timestamp.
+	ActorSignatureMetadataKey = "actor_signature"
+)
+
+// MaxActorSignatureAge is the maximum difference between the time a signed identity is received and the time it
+// was signed, so that captured signatures cannot be reused.
+const MaxActorSignatureAge = 5 * time.Minute
+
+// Actor contains the identity of the user performing a request.
+type Actor struct {
+	// UserId of the user, empty if the request does not contain it
+	UserId string
+	// Primitives granted to the user
+	Primitives []string
+}
+
+// NewAnonymousActor creates the actor of the requests without a verified identity.
+func NewAnonymousActor() *Actor {
+	return &Actor{Primitives: make([]string, 0)}
+}
+
+// VerifyActor extracts the actor from the metadata of an incoming request and checks its signature. Requests
+// without identity, or received when no secret is configured, are performed by an anonymous actor. If the identity
+// is not signed, or its signature has expired or does not match, the anonymous actor is returned together with the
+// reason why the identity is ignored.
+func VerifyActor(secret string, md metadata.MD, now time.Time) (*Actor, derrors.Error) {
+	userIDs := md.Get(UserIdMetadataKey)
+	values := md.Get(PrimitivesMetadataKey)
+	if len(userIDs) == 0 && len(values) == 0 || secret == "" {
+		return NewAnonymousActor(), nil
+	}
+
+	actor := NewAnonymousActor()
+	if len(userIDs) > 0 {
+		actor.UserId = userIDs[0]
+	}
+	for _, value := range values {
+		for _, primitive := range strings.Split(value, ",") {
+			if primitive = strings.TrimSpace(primitive); primitive != "" {
+				actor.Primitives = append(actor.Primitives, primitive)
+			}
+		}
+	}
+
+	timestamps := md.Get(ActorTimestampMetadataKey)
+	signatures := md.Get(ActorSignatureMetadataKey)
+	if len(timestamps) == 0 || len(signatures) == 0 {
+		return NewAnonymousActor(), derrors.NewUnauthenticatedError("actor identity is not signed").WithParams(actor.UserId)
+	}
+	timestamp, err := strconv.ParseInt(timestamps[0], 10, 64)
+	if err != nil {
+		return NewAnonymousActor(), derrors.NewUnauthenticatedError("invalid actor timestamp").WithParams(actor.UserId, timestamps[0])
+	}
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > MaxActorSignatureAge || age < -MaxActorSignatureAge {
+		return NewAnonymousActor(), derrors.NewUnauthenticatedError("actor signature has expired").WithParams(actor.UserId)
+	}
+	expected := SignActor(secret, actor.UserId, actor.Primitives, timestamp)
+	if !hmac.Equal([]byte(expected), []byte(signatures[0])) {
+		return NewAnonymousActor(), derrors.NewUnauthenticatedError("invalid actor signature").WithParams(actor.UserId)
+	}
+	return actor, nil
+}
+
+// SignActor returns the signature of an identity at a given time.
+func SignActor(secret string, userID string, primitives []string, timestamp int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%d", userID, strings.Join(primitives, ","), timestamp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewActorMetadata returns the signed metadata that identifies an actor in an outgoing request.
+func NewActorMetadata(secret string, userID string, primitives []string, now time.Time) metadata.MD {
+	timestamp := now.Unix()
+	return metadata.Pairs(UserIdMetadataKey, userID,
+		PrimitivesMetadataKey, strings.Join(primitives, ","),
+		ActorTimestampMetadataKey, strconv.FormatInt(timestamp, 10),
+		ActorSignatureMetadataKey, SignActor(secret, userID, primitives, timestamp))
+}
+
+// IsAdmin checks if the actor has the organization management primitive.
+func (a *Actor) IsAdmin() bool {
+	for _, primitive := range a.Primitives {
+		if primitive == grpc_authx_go.AccessPrimitive_ORG.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-authx-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/metadata"
+	"time"
+)
+
+var _ = ginkgo.Describe("Actor", func() {
+
+	admin := []string{grpc_authx_go.AccessPrimitive_ORG.String()}
+	now := time.Now()
+
+	ginkgo.It("should accept signed identities", func() {
+		actor, err := VerifyActor("secret", NewActorMetadata("secret", "user", admin, now), now)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(actor.UserId).Should(gomega.Equal("user"))
+		gomega.Expect(actor.IsAdmin()).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should ignore identities with an invalid or expired signature", func() {
+		expectAnonymous := func(actor *Actor, err error) {
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			gomega.Expect(actor.UserId).Should(gomega.BeEmpty())
+			gomega.Expect(actor.IsAdmin()).To(gomega.BeFalse())
+		}
+		expectAnonymous(VerifyActor("other", NewActorMetadata("secret", "user", admin, now), now))
+		expectAnonymous(VerifyActor("secret", NewActorMetadata("secret", "user", admin, now), now.Add(time.Hour)))
+
+		md := NewActorMetadata("secret", "user", nil, now)
+		md.Set(PrimitivesMetadataKey, admin...)
+		expectAnonymous(VerifyActor("secret", md, now))
+
+		expectAnonymous(VerifyActor("secret", metadata.Pairs(PrimitivesMetadataKey, admin[0]), now))
+	})
+
+	ginkgo.It("should not trust identities without a secret", func() {
+		actor, err := VerifyActor("", metadata.Pairs(UserIdMetadataKey, "user", PrimitivesMetadataKey, admin[0]), now)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(actor.UserId).Should(gomega.BeEmpty())
+		gomega.Expect(actor.IsAdmin()).To(gomega.BeFalse())
+	})
+})
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"time"
+)
+
+// ApprovalPolicy contains the registration settings of a device group.
+type ApprovalPolicy struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// ApprovalRequired indicates that the devices registered in the group must be approved by an operator
+	ApprovalRequired bool `json:"approval_required,omitempty"`
+}
+
+// PendingDevice contains a registration waiting for the approval of an operator.
+type PendingDevice struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// Labels sent in the registration request
+	Labels map[string]string `json:"labels,omitempty"`
+	// Requested contains the registration timestamp
+	Requested int64 `json:"requested,omitempty"`
+	// Expires contains the timestamp after which the registration is removed if it has not been approved
+	Expires int64 `json:"expires,omitempty"`
+}
+
+// NewPendingDevice creates a pending registration that expires after a given time.
+func NewPendingDevice(request *grpc_device_manager_go.RegisterDeviceRequest, expiration time.Duration) *PendingDevice {
+	now := time.Now()
+	return &PendingDevice{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+		Labels:         request.Labels,
+		Requested:      now.Unix(),
+		Expires:        now.Add(expiration).Unix(),
+	}
+}
+
+// IsExpired checks if the registration has expired at a given time.
+func (p *PendingDevice) IsExpired(now time.Time) bool {
+	return p.Expires <= now.Unix()
+}
+
+// ToGRPC converts the pending registration into its gRPC representation.
+func (p *PendingDevice) ToGRPC() *grpc_device_manager_go.PendingDevice {
+	return &grpc_device_manager_go.PendingDevice{
+		OrganizationId: p.OrganizationId,
+		DeviceGroupId:  p.DeviceGroupId,
+		DeviceId:       p.DeviceId,
+		Labels:         p.Labels,
+		Requested:      p.Requested,
+		Expires:        p.Expires,
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-inventory-go"
+)
+
+// MergeAssetInfo applies the sections of an update request to the current asset information of a device. Only the
+// sections marked for update are replaced; the network interfaces are part of the hardware information but are
+// updated independently, so updating the hardware keeps the current interfaces.
+func MergeAssetInfo(current *grpc_inventory_go.AssetInfo, request *grpc_device_manager_go.UpdateDeviceAssetInfoRequest) *grpc_inventory_go.AssetInfo {
+	result := &grpc_inventory_go.AssetInfo{}
+	if current != nil {
+		result = proto.Clone(current).(*grpc_inventory_go.AssetInfo)
+	}
+	if request.UpdateOs {
+		result.Os = request.Os
+	}
+	if request.UpdateHardware {
+		var interfaces []*grpc_inventory_go.NetworkingHardwareInfo
+		if result.Hardware != nil {
+			interfaces = result.Hardware.NetInterfaces
+		}
+		result.Hardware = &grpc_inventory_go.HardwareInfo{}
+		if request.Hardware != nil {
+			result.Hardware = proto.Clone(request.Hardware).(*grpc_inventory_go.HardwareInfo)
+		}
+		result.Hardware.NetInterfaces = interfaces
+	}
+	if request.UpdateNetwork {
+		if result.Hardware == nil {
+			result.Hardware = &grpc_inventory_go.HardwareInfo{}
+		}
+		result.Hardware.NetInterfaces = request.NetInterfaces
+	}
+	if request.UpdateStorage {
+		result.Storage = request.Storage
+	}
+	return result
+}
+
+// AssetInfoChange records a change of the asset information of a device. The fields are flattened as in the device
+// index, and only the fields that changed are stored. Fields that were removed are not part of Current.
+type AssetInfoChange struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// Timestamp of the change
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Previous values of the fields that changed
+	Previous map[string]string `json:"previous,omitempty"`
+	// Current values of the fields that changed
+	Current map[string]string `json:"current,omitempty"`
+}
+
+// NewAssetInfoChange compares two versions of the asset information of a device. It returns nil if there are no
+// differences.
+func NewAssetInfoChange(organizationID string, deviceGroupID string, deviceID string, previous *grpc_inventory_go.AssetInfo,
+	current *grpc_inventory_go.AssetInfo, timestamp int64) *AssetInfoChange {
+	changedPrevious, changedCurrent := DiffFields(FlattenFields(previous), FlattenFields(current))
+	if len(changedPrevious) == 0 && len(changedCurrent) == 0 {
+		return nil
+	}
+	return &AssetInfoChange{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Timestamp:      timestamp,
+		Previous:       changedPrevious,
+		Current:        changedCurrent,
+	}
+}
+
+// DiffFields compares two sets of flattened fields, and returns the previous and current values of the fields that
+// changed. Fields that were removed are not part of the current values.
+func DiffFields(before map[string]string, after map[string]string) (map[string]string, map[string]string) {
+	previous := make(map[string]string, 0)
+	current := make(map[string]string, 0)
+	for path, value := range before {
+		if updated, exists := after[path]; !exists || updated != value {
+			previous[path] = value
+		}
+	}
+	for path, value := range after {
+		if old, exists := before[path]; !exists || old != value {
+			current[path] = value
+		}
+	}
+	return previous, current
+}
+
+func (c *AssetInfoChange) ToGRPC() *grpc_device_manager_go.AssetInfoChange {
+	return &grpc_device_manager_go.AssetInfoChange{
+		OrganizationId: c.OrganizationId,
+		DeviceGroupId:  c.DeviceGroupId,
+		DeviceId:       c.DeviceId,
+		Timestamp:      c.Timestamp,
+		Previous:       c.Previous,
+		Current:        c.Current,
+	}
+}
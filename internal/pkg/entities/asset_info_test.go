@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-inventory-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Asset info", func() {
+
+	current := &grpc_inventory_go.AssetInfo{
+		Os: &grpc_inventory_go.OperatingSystemInfo{Name: "linux", Version: "4.19"},
+		Hardware: &grpc_inventory_go.HardwareInfo{
+			InstalledRam:  1024,
+			NetInterfaces: []*grpc_inventory_go.NetworkingHardwareInfo{{Type: "wifi", LinkCapacity: 100}},
+		},
+		Storage: []*grpc_inventory_go.StorageHardwareInfo{{Type: "ssd", TotalCapacity: 32}},
+	}
+
+	ginkgo.It("should only update the requested sections", func() {
+		merged := MergeAssetInfo(current, &grpc_device_manager_go.UpdateDeviceAssetInfoRequest{
+			UpdateOs: true,
+			Os:       &grpc_inventory_go.OperatingSystemInfo{Name: "linux", Version: "5.4"},
+			Storage:  []*grpc_inventory_go.StorageHardwareInfo{},
+		})
+		gomega.Expect(merged.Os.Version).Should(gomega.Equal("5.4"))
+		gomega.Expect(merged.Storage).To(gomega.HaveLen(1))
+		gomega.Expect(current.Os.Version).Should(gomega.Equal("4.19"))
+	})
+
+	ginkgo.It("should keep the network interfaces when the hardware is updated", func() {
+		merged := MergeAssetInfo(current, &grpc_device_manager_go.UpdateDeviceAssetInfoRequest{
+			UpdateHardware: true,
+			Hardware:       &grpc_inventory_go.HardwareInfo{InstalledRam: 2048},
+		})
+		gomega.Expect(merged.Hardware.InstalledRam).Should(gomega.Equal(int64(2048)))
+		gomega.Expect(merged.Hardware.NetInterfaces).To(gomega.HaveLen(1))
+
+		merged = MergeAssetInfo(nil, &grpc_device_manager_go.UpdateDeviceAssetInfoRequest{
+			UpdateNetwork: true,
+			NetInterfaces: []*grpc_inventory_go.NetworkingHardwareInfo{{Type: "ethernet"}},
+		})
+		gomega.Expect(merged.Hardware.NetInterfaces[0].Type).Should(gomega.Equal("ethernet"))
+	})
+
+	ginkgo.It("should record the fields that changed", func() {
+		merged := MergeAssetInfo(current, &grpc_device_manager_go.UpdateDeviceAssetInfoRequest{
+			UpdateOs:      true,
+			Os:            &grpc_inventory_go.OperatingSystemInfo{Name: "linux", Version: "5.4"},
+			UpdateStorage: true,
+		})
+		change := NewAssetInfoChange("org", "dg", "device", current, merged, 1000)
+		gomega.Expect(change).NotTo(gomega.BeNil())
+		gomega.Expect(change.Previous).Should(gomega.HaveKeyWithValue("os.version", "4.19"))
+		gomega.Expect(change.Current).Should(gomega.HaveKeyWithValue("os.version", "5.4"))
+		gomega.Expect(change.Previous).Should(gomega.HaveKey("storage.0.type"))
+		gomega.Expect(change.Current).ShouldNot(gomega.HaveKey("storage.0.type"))
+		gomega.Expect(change.Current).ShouldNot(gomega.HaveKey("os.name"))
+
+		gomega.Expect(NewAssetInfoChange("org", "dg", "device", current, current, 1000)).To(gomega.BeNil())
+	})
+})
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// AttributeType defines the type of the value of a device attribute.
+type AttributeType string
+
+const (
+	// StringAttribute contains a text.
+	StringAttribute AttributeType = "string"
+	// NumberAttribute contains a floating point number.
+	NumberAttribute AttributeType = "number"
+	// BoolAttribute contains a boolean.
+	BoolAttribute AttributeType = "bool"
+	// TimestampAttribute contains a timestamp in seconds.
+	TimestampAttribute AttributeType = "timestamp"
+)
+
+var attributeTypeFromGRPC = map[grpc_device_manager_go.AttributeType]AttributeType{
+	grpc_device_manager_go.AttributeType_STRING:    StringAttribute,
+	grpc_device_manager_go.AttributeType_NUMBER:    NumberAttribute,
+	grpc_device_manager_go.AttributeType_BOOL:      BoolAttribute,
+	grpc_device_manager_go.AttributeType_TIMESTAMP: TimestampAttribute,
+}
+
+var attributeTypeToGRPC = map[AttributeType]grpc_device_manager_go.AttributeType{
+	StringAttribute:    grpc_device_manager_go.AttributeType_STRING,
+	NumberAttribute:    grpc_device_manager_go.AttributeType_NUMBER,
+	BoolAttribute:      grpc_device_manager_go.AttributeType_BOOL,
+	TimestampAttribute: grpc_device_manager_go.AttributeType_TIMESTAMP,
+}
+
+// attributeNameRegex defines the valid names of an attribute, e.g. warranty_expiry or install.date
+var attributeNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.\-]{0,62}$`)
+
+// MaxAttributeValueLength is the maximum length of a string attribute.
+const MaxAttributeValueLength = 1024
+
+// ValidAttributeName checks the name of an attribute.
+func ValidAttributeName(name string) derrors.Error {
+	if !attributeNameRegex.MatchString(name) {
+		return derrors.NewInvalidArgumentError("invalid attribute name").WithParams(name)
+	}
+	return nil
+}
+
+// DeviceAttribute contains a typed custom attribute of a device. The value is stored in its canonical text
+// representation so that all the types share the same storage.
+type DeviceAttribute struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// Name of the attribute
+	Name string `json:"name,omitempty"`
+	// Type of the value
+	Type AttributeType `json:"type,omitempty"`
+	// Value in its canonical text representation
+	Value string `json:"value,omitempty"`
+	// Updated contains the timestamp of the last modification
+	Updated int64 `json:"updated,omitempty"`
+}
+
+// NewDeviceAttribute creates the attribute of a device from its gRPC representation.
+func NewDeviceAttribute(organizationID string, deviceGroupID string, deviceID string, attribute *grpc_device_manager_go.DeviceAttribute) (*DeviceAttribute, derrors.Error) {
+	err := ValidAttributeName(attribute.Name)
+	if err != nil {
+		return nil, err
+	}
+	attributeType, exists := attributeTypeFromGRPC[attribute.Type]
+	if !exists {
+		return nil, derrors.NewInvalidArgumentError("unsupported attribute type").WithParams(attribute.Name, attribute.Type.String())
+	}
+	var value string
+	switch attributeType {
+	case StringAttribute:
+		if len(attribute.StringValue) > MaxAttributeValueLength {
+			return nil, derrors.NewInvalidArgumentError("attribute value is too long").WithParams(attribute.Name)
+		}
+		value = attribute.StringValue
+	case NumberAttribute:
+		value = strconv.FormatFloat(attribute.NumberValue, 'g', -1, 64)
+	case BoolAttribute:
+		value = strconv.FormatBool(attribute.BoolValue)
+	case TimestampAttribute:
+		value = strconv.FormatInt(attribute.TimestampValue, 10)
+	}
+	return &DeviceAttribute{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Name:           attribute.Name,
+		Type:           attributeType,
+		Value:          value,
+		Updated:        time.Now().Unix(),
+	}, nil
+}
+
+// ToGRPC converts the attribute into its gRPC representation.
+func (a *DeviceAttribute) ToGRPC() *grpc_device_manager_go.DeviceAttribute {
+	result := &grpc_device_manager_go.DeviceAttribute{
+		Name:    a.Name,
+		Type:    attributeTypeToGRPC[a.Type],
+		Updated: a.Updated,
+	}
+	switch a.Type {
+	case StringAttribute:
+		result.StringValue = a.Value
+	case NumberAttribute:
+		result.NumberValue, _ = strconv.ParseFloat(a.Value, 64)
+	case BoolAttribute:
+		result.BoolValue, _ = strconv.ParseBool(a.Value)
+	case TimestampAttribute:
+		result.TimestampValue, _ = strconv.ParseInt(a.Value, 10, 64)
+	}
+	return result
+}
+
+// AttributeDefinition contains the definition of an attribute in the schema of an organization.
+type AttributeDefinition struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// Name of the attribute
+	Name string `json:"name,omitempty"`
+	// Type of the values of the attribute
+	Type AttributeType `json:"type,omitempty"`
+	// Description of the attribute
+	Description string `json:"description,omitempty"`
+}
+
+// NewAttributeDefinition creates an attribute definition from its gRPC representation.
+func NewAttributeDefinition(definition *grpc_device_manager_go.AttributeDefinition) (*AttributeDefinition, derrors.Error) {
+	err := ValidAttributeName(definition.Name)
+	if err != nil {
+		return nil, err
+	}
+	attributeType, exists := attributeTypeFromGRPC[definition.Type]
+	if !exists {
+		return nil, derrors.NewInvalidArgumentError("unsupported attribute type").WithParams(definition.Name, definition.Type.String())
+	}
+	return &AttributeDefinition{
+		OrganizationId: definition.OrganizationId,
+		Name:           definition.Name,
+		Type:           attributeType,
+		Description:    definition.Description,
+	}, nil
+}
+
+// ToGRPC converts the definition into its gRPC representation.
+func (d *AttributeDefinition) ToGRPC() *grpc_device_manager_go.AttributeDefinition {
+	return &grpc_device_manager_go.AttributeDefinition{
+		OrganizationId: d.OrganizationId,
+		Name:           d.Name,
+		Type:           attributeTypeToGRPC[d.Type],
+		Description:    d.Description,
+	}
+}
+
+// AttributeSchema contains the attribute definitions of an organization. Organizations without definitions
+// accept any attribute.
+type AttributeSchema map[string]*AttributeDefinition
+
+// NewAttributeSchema creates the schema of an organization from its definitions.
+func NewAttributeSchema(definitions []*AttributeDefinition) AttributeSchema {
+	schema := make(AttributeSchema, len(definitions))
+	for _, d := range definitions {
+		schema[d.Name] = d
+	}
+	return schema
+}
+
+// Check verifies that an attribute is defined in the schema with the same type.
+func (s AttributeSchema) Check(attribute *DeviceAttribute) derrors.Error {
+	if len(s) == 0 {
+		return nil
+	}
+	definition, exists := s[attribute.Name]
+	if !exists {
+		return derrors.NewInvalidArgumentError("attribute is not defined in the organization schema").WithParams(attribute.Name)
+	}
+	if definition.Type != attribute.Type {
+		return derrors.NewInvalidArgumentError(
+			fmt.Sprintf("attribute must be of type %s", definition.Type)).WithParams(attribute.Name, string(attribute.Type))
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/derrors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AttributeOperator defines the type of comparison of an attribute filter requirement.
+type AttributeOperator string
+
+const (
+	// AttributeExists matches devices that have the attribute.
+	AttributeExists AttributeOperator = "exists"
+	// AttributeDoesNotExist matches devices that do not have the attribute.
+	AttributeDoesNotExist AttributeOperator = "!exists"
+	// AttributeEquals matches attributes with the given value.
+	AttributeEquals AttributeOperator = "="
+	// AttributeNotEquals matches devices where the attribute is missing or has a different value.
+	AttributeNotEquals AttributeOperator = "!="
+	// AttributeLess matches attributes lower than the given value.
+	AttributeLess AttributeOperator = "<"
+	// AttributeLessOrEqual matches attributes lower than or equal to the given value.
+	AttributeLessOrEqual AttributeOperator = "<="
+	// AttributeGreater matches attributes greater than the given value.
+	AttributeGreater AttributeOperator = ">"
+	// AttributeGreaterOrEqual matches attributes greater than or equal to the given value.
+	AttributeGreaterOrEqual AttributeOperator = ">="
+)
+
+// attributeComparisons contains the comparison operators ordered so that the two character operators
+// are found before their prefixes.
+var attributeComparisons = []AttributeOperator{
+	AttributeNotEquals, AttributeLessOrEqual, AttributeGreaterOrEqual, AttributeEquals, AttributeLess, AttributeGreater,
+}
+
+// AttributeRequirement contains a single condition of an attribute filter.
+type AttributeRequirement struct {
+	// Name of the attribute
+	Name string
+	// Operator to apply
+	Operator AttributeOperator
+	// Value to compare with. Empty for AttributeExists and AttributeDoesNotExist.
+	Value string
+}
+
+// Matches checks if a set of attributes satisfies the requirement. The value of the requirement is
+// interpreted using the type of the attribute of the device.
+func (r *AttributeRequirement) Matches(attributes map[string]*DeviceAttribute) bool {
+	attribute, exists := attributes[r.Name]
+	switch r.Operator {
+	case AttributeExists:
+		return exists
+	case AttributeDoesNotExist:
+		return !exists
+	case AttributeNotEquals:
+		if !exists {
+			return true
+		}
+		result, ok := compareAttribute(attribute, r.Value)
+		return !ok || result != 0
+	}
+	if !exists {
+		return false
+	}
+	result, ok := compareAttribute(attribute, r.Value)
+	if !ok {
+		return false
+	}
+	switch r.Operator {
+	case AttributeEquals:
+		return result == 0
+	case AttributeLess:
+		return result < 0
+	case AttributeLessOrEqual:
+		return result <= 0
+	case AttributeGreater:
+		return result > 0
+	case AttributeGreaterOrEqual:
+		return result >= 0
+	}
+	return false
+}
+
+// compareAttribute compares the value of an attribute with the value of a requirement. The second result
+// is false if the values cannot be compared.
+func compareAttribute(attribute *DeviceAttribute, value string) (int, bool) {
+	switch attribute.Type {
+	case StringAttribute:
+		return strings.Compare(attribute.Value, value), true
+	case NumberAttribute:
+		current, err := strconv.ParseFloat(attribute.Value, 64)
+		if err != nil {
+			return 0, false
+		}
+		expected, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, false
+		}
+		return compareFloat(current, expected), true
+	case BoolAttribute:
+		current, err := strconv.ParseBool(attribute.Value)
+		if err != nil {
+			return 0, false
+		}
+		expected, err := strconv.ParseBool(value)
+		if err != nil {
+			return 0, false
+		}
+		if current == expected {
+			return 0, true
+		}
+		if !current {
+			return -1, true
+		}
+		return 1, true
+	case TimestampAttribute:
+		current, err := strconv.ParseInt(attribute.Value, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		expected, ok := parseFilterTimestamp(value)
+		if !ok {
+			return 0, false
+		}
+		return compareFloat(float64(current), float64(expected)), true
+	}
+	return 0, false
+}
+
+func compareFloat(current float64, expected float64) int {
+	if current < expected {
+		return -1
+	} else if current > expected {
+		return 1
+	}
+	return 0
+}
+
+// parseFilterTimestamp accepts timestamps in seconds or with the RFC 3339 format.
+func parseFilterTimestamp(value string) (int64, bool) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return seconds, true
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, false
+	}
+	return parsed.Unix(), true
+}
+
+// AttributeFilter is a set of requirements that must be satisfied by the attributes of a device, e.g.
+// battery_level<20,firmware=1.2.0,!decommissioned
+type AttributeFilter struct {
+	Requirements []AttributeRequirement
+}
+
+// Empty checks if the filter has no requirements, and therefore matches every device.
+func (f *AttributeFilter) Empty() bool {
+	return f == nil || len(f.Requirements) == 0
+}
+
+// Matches checks if a set of attributes satisfies all the requirements of the filter.
+func (f *AttributeFilter) Matches(attributes map[string]*DeviceAttribute) bool {
+	if f.Empty() {
+		return true
+	}
+	for _, r := range f.Requirements {
+		if !r.Matches(attributes) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAttributeFilter parses an attribute filter expression. An empty expression produces a filter that
+// matches every device.
+func ParseAttributeFilter(expression string) (*AttributeFilter, derrors.Error) {
+	filter := &AttributeFilter{Requirements: make([]AttributeRequirement, 0)}
+	if strings.TrimSpace(expression) == "" {
+		return filter, nil
+	}
+	for _, term := range strings.Split(expression, ",") {
+		requirement, err := parseAttributeRequirement(strings.TrimSpace(term))
+		if err != nil {
+			return nil, err.WithParams(expression)
+		}
+		filter.Requirements = append(filter.Requirements, *requirement)
+	}
+	return filter, nil
+}
+
+func parseAttributeRequirement(term string) (*AttributeRequirement, derrors.Error) {
+	if term == "" {
+		return nil, derrors.NewInvalidArgumentError("attribute filter contains an empty requirement")
+	}
+	index := strings.IndexAny(term, "!=<>")
+	if index == -1 || (index == 0 && term[0] == '!' && !strings.ContainsAny(term[1:], "!=<>")) {
+		operator := AttributeExists
+		name := term
+		if index == 0 {
+			operator = AttributeDoesNotExist
+			name = strings.TrimSpace(term[1:])
+		}
+		if err := ValidAttributeName(name); err != nil {
+			return nil, err
+		}
+		return &AttributeRequirement{Name: name, Operator: operator}, nil
+	}
+	name := strings.TrimSpace(term[:index])
+	if err := ValidAttributeName(name); err != nil {
+		return nil, err
+	}
+	for _, operator := range attributeComparisons {
+		if strings.HasPrefix(term[index:], string(operator)) {
+			value := strings.TrimSpace(term[index+len(operator):])
+			if value == "" {
+				return nil, derrors.NewInvalidArgumentError("attribute filter requirement must have a value").WithParams(term)
+			}
+			return &AttributeRequirement{Name: name, Operator: operator, Value: value}, nil
+		}
+	}
+	return nil, derrors.NewInvalidArgumentError("attribute filter contains an invalid operator").WithParams(term)
+}
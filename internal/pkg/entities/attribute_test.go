@@ -0,0 +1,107 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Device attributes", func() {
+
+	ginkgo.It("should convert typed values to and from gRPC", func() {
+		attribute, err := NewDeviceAttribute("org", "dg", "device", &grpc_device_manager_go.DeviceAttribute{
+			Name:        "battery_level",
+			Type:        grpc_device_manager_go.AttributeType_NUMBER,
+			NumberValue: 42.5,
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(attribute.Type).Should(gomega.Equal(NumberAttribute))
+		gomega.Expect(attribute.Value).Should(gomega.Equal("42.5"))
+		gomega.Expect(attribute.ToGRPC().NumberValue).Should(gomega.Equal(42.5))
+	})
+
+	ginkgo.It("should reject invalid names", func() {
+		_, err := NewDeviceAttribute("org", "dg", "device", &grpc_device_manager_go.DeviceAttribute{
+			Name: "battery level",
+			Type: grpc_device_manager_go.AttributeType_NUMBER,
+		})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should check the attributes against the schema", func() {
+		attribute := &DeviceAttribute{Name: "installed", Type: TimestampAttribute, Value: "1500000000"}
+		gomega.Expect(NewAttributeSchema(nil).Check(attribute)).To(gomega.Succeed())
+
+		schema := NewAttributeSchema([]*AttributeDefinition{{Name: "installed", Type: TimestampAttribute}})
+		gomega.Expect(schema.Check(attribute)).To(gomega.Succeed())
+		gomega.Expect(schema.Check(&DeviceAttribute{Name: "installed", Type: StringAttribute})).NotTo(gomega.Succeed())
+		gomega.Expect(schema.Check(&DeviceAttribute{Name: "owner", Type: StringAttribute})).NotTo(gomega.Succeed())
+	})
+})
+
+var _ = ginkgo.Describe("Attribute filter", func() {
+
+	attributes := map[string]*DeviceAttribute{
+		"battery_level": {Name: "battery_level", Type: NumberAttribute, Value: "15"},
+		"firmware":      {Name: "firmware", Type: StringAttribute, Value: "1.2.0"},
+		"outdoor":       {Name: "outdoor", Type: BoolAttribute, Value: "true"},
+		"installed":     {Name: "installed", Type: TimestampAttribute, Value: "1500000000"},
+	}
+
+	ginkgo.It("should match everything with an empty filter", func() {
+		filter, err := ParseAttributeFilter("")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(filter.Matches(attributes)).Should(gomega.BeTrue())
+		gomega.Expect(filter.Matches(nil)).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should compare the values using the type of the attribute", func() {
+		matching := []string{
+			"battery_level<20", "battery_level>=15", "battery_level=15.0", "firmware=1.2.0", "firmware!=1.3.0",
+			"outdoor=true", "installed<2020-01-01T00:00:00Z", "installed>1000", "owner!=admin",
+		}
+		for _, expression := range matching {
+			filter, err := ParseAttributeFilter(expression)
+			gomega.Expect(err).To(gomega.Succeed(), expression)
+			gomega.Expect(filter.Matches(attributes)).Should(gomega.BeTrue(), expression)
+		}
+		notMatching := []string{"battery_level>20", "battery_level=abc", "outdoor=false", "owner=admin", "installed>2020-01-01T00:00:00Z"}
+		for _, expression := range notMatching {
+			filter, err := ParseAttributeFilter(expression)
+			gomega.Expect(err).To(gomega.Succeed(), expression)
+			gomega.Expect(filter.Matches(attributes)).Should(gomega.BeFalse(), expression)
+		}
+	})
+
+	ginkgo.It("should support existence requirements", func() {
+		filter, err := ParseAttributeFilter("firmware, !decommissioned")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(filter.Requirements).Should(gomega.HaveLen(2))
+		gomega.Expect(filter.Matches(attributes)).Should(gomega.BeTrue())
+		gomega.Expect(filter.Matches(map[string]*DeviceAttribute{})).Should(gomega.BeFalse())
+	})
+
+	ginkgo.It("should reject malformed filters", func() {
+		malformed := []string{"firmware=", "battery_level<20,", "=15", "!", "firmware!1.2", "battery level>1"}
+		for _, expression := range malformed {
+			_, err := ParseAttributeFilter(expression)
+			gomega.Expect(err).NotTo(gomega.Succeed(), expression)
+		}
+	})
+})
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/grpc-device-manager-go"
+)
+
+// AuditOutcome defines the result of an audited operation.
+type AuditOutcome string
+
+const (
+	// AuditSuccess is the outcome of the operations that completed.
+	AuditSuccess AuditOutcome = "success"
+	// AuditFailure is the outcome of the operations that returned an error.
+	AuditFailure AuditOutcome = "failure"
+)
+
+var auditOutcomeToGRPC = map[AuditOutcome]grpc_device_manager_go.AuditOutcome{
+	AuditSuccess: grpc_device_manager_go.AuditOutcome_SUCCESS,
+	AuditFailure: grpc_device_manager_go.AuditOutcome_FAILURE,
+}
+
+// AuditEntry records an operation that modifies the devices or the device groups of an organization. The target is a
+// device group, or a device if DeviceId is set. The fields of the target are flattened as in the asset info history,
+// and only the fields that changed are stored.
+type AuditEntry struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// EntryId is the identifier of the entry
+	EntryId string `json:"entry_id,omitempty"`
+	// Timestamp of the operation
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Actor is the identifier of the user that performed the operation, empty if the request did not contain it
+	Actor string `json:"actor,omitempty"`
+	// Operation is the name of the method called, e.g. UpdateDevice
+	Operation string `json:"operation,omitempty"`
+	// device_group identifier of the target
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier of the target
+	DeviceId string `json:"device_id,omitempty"`
+	// Previous values of the fields that changed
+	Previous map[string]string `json:"previous,omitempty"`
+	// Current values of the fields that changed
+	Current map[string]string `json:"current,omitempty"`
+	// Outcome of the operation
+	Outcome AuditOutcome `json:"outcome,omitempty"`
+	// Error returned by the operation
+	Error string `json:"error,omitempty"`
+}
+
+// NewAuditEntry creates the entry of an operation that has not completed yet.
+func NewAuditEntry(organizationID string, deviceGroupID string, deviceID string, actor *Actor, operation string, timestamp int64) *AuditEntry {
+	return &AuditEntry{
+		OrganizationId: organizationID,
+		EntryId:        uuid.New().String(),
+		Timestamp:      timestamp,
+		Actor:          actor.UserId,
+		Operation:      operation,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Previous:       make(map[string]string, 0),
+		Current:        make(map[string]string, 0),
+	}
+}
+
+// Complete sets the changes and the outcome of the operation, comparing the flattened fields of the target before
+// and after the operation.
+func (e *AuditEntry) Complete(before map[string]string, after map[string]string, err error) {
+	e.Previous, e.Current = DiffFields(before, after)
+	if err != nil {
+		e.Outcome = AuditFailure
+		e.Error = err.Error()
+	} else {
+		e.Outcome = AuditSuccess
+	}
+}
+
+func (e *AuditEntry) ToGRPC() *grpc_device_manager_go.AuditEntry {
+	return &grpc_device_manager_go.AuditEntry{
+		OrganizationId: e.OrganizationId,
+		EntryId:        e.EntryId,
+		Timestamp:      e.Timestamp,
+		Actor:          e.Actor,
+		Operation:      e.Operation,
+		DeviceGroupId:  e.DeviceGroupId,
+		DeviceId:       e.DeviceId,
+		Previous:       e.Previous,
+		Current:        e.Current,
+		Outcome:        auditOutcomeToGRPC[e.Outcome],
+		Error:          e.Error,
+	}
+}
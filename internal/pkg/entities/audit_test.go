@@ -0,0 +1,51 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Audit entries", func() {
+
+	actor := &Actor{UserId: "user"}
+
+	ginkgo.It("should record the fields that changed", func() {
+		entry := NewAuditEntry("org", "dg", "device", actor, "UpdateDevice", 1000)
+		gomega.Expect(entry.EntryId).NotTo(gomega.BeEmpty())
+		gomega.Expect(entry.Actor).Should(gomega.Equal("user"))
+
+		entry.Complete(map[string]string{"labels.env": "dev", "name": "device"},
+			map[string]string{"labels.env": "prod", "name": "device", "location.geolocation": "40.4,-3.7"}, nil)
+		gomega.Expect(entry.Outcome).Should(gomega.Equal(AuditSuccess))
+		gomega.Expect(entry.Previous).Should(gomega.Equal(map[string]string{"labels.env": "dev"}))
+		gomega.Expect(entry.Current).Should(gomega.Equal(map[string]string{"labels.env": "prod", "location.geolocation": "40.4,-3.7"}))
+	})
+
+	ginkgo.It("should record the failed operations", func() {
+		entry := NewAuditEntry("org", "dg", "", &Actor{}, "RemoveDeviceGroup", 1000)
+		entry.Complete(map[string]string{"name": "group"}, map[string]string{"name": "group"},
+			derrors.NewNotFoundError("device group not found"))
+		gomega.Expect(entry.Outcome).Should(gomega.Equal(AuditFailure))
+		gomega.Expect(entry.Error).ShouldNot(gomega.BeEmpty())
+		gomega.Expect(entry.Actor).Should(gomega.BeEmpty())
+		gomega.Expect(entry.Previous).Should(gomega.BeEmpty())
+		gomega.Expect(entry.Current).Should(gomega.BeEmpty())
+	})
+})
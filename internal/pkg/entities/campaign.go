@@ -0,0 +1,417 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"sort"
+	"time"
+)
+
+// FirmwareUpdateCommand is the name of the command queued for the devices of a rollout campaign. Its payload is a
+// JSON object with the campaign_id and the artifact to install.
+const FirmwareUpdateCommand = "firmware-update"
+
+// DefaultMaxOfflinePercentage is the percentage of unhealthy updated devices that halts a campaign if the request
+// does not set it.
+const DefaultMaxOfflinePercentage = 10
+
+// DefaultObservationPeriod is the time the updated devices of a batch must stay healthy before the next batch
+// starts if the request does not set it.
+const DefaultObservationPeriod = 10 * time.Minute
+
+// CampaignStatus defines the state of a rollout campaign.
+type CampaignStatus string
+
+const (
+	// CampaignRunning is the status of a campaign that advances automatically.
+	CampaignRunning CampaignStatus = "running"
+	// CampaignPaused is the status of a campaign paused by an operator.
+	CampaignPaused CampaignStatus = "paused"
+	// CampaignHalted is the status of a campaign stopped because the updated devices are not healthy.
+	CampaignHalted CampaignStatus = "halted"
+	// CampaignAborted is the status of a campaign aborted by an operator.
+	CampaignAborted CampaignStatus = "aborted"
+	// CampaignCompleted is the status of a campaign whose batches have been updated.
+	CampaignCompleted CampaignStatus = "completed"
+)
+
+var campaignStatusToGRPC = map[CampaignStatus]grpc_device_manager_go.CampaignStatus{
+	CampaignRunning:   grpc_device_manager_go.CampaignStatus_RUNNING,
+	CampaignPaused:    grpc_device_manager_go.CampaignStatus_PAUSED,
+	CampaignHalted:    grpc_device_manager_go.CampaignStatus_HALTED,
+	CampaignAborted:   grpc_device_manager_go.CampaignStatus_ABORTED,
+	CampaignCompleted: grpc_device_manager_go.CampaignStatus_COMPLETED,
+}
+
+// CampaignDeviceStatus defines the progress of a device in a rollout campaign.
+type CampaignDeviceStatus string
+
+const (
+	// CampaignDevicePending is the status of a device whose batch has not started.
+	CampaignDevicePending CampaignDeviceStatus = "pending"
+	// CampaignDeviceUpdating is the status of a device that has received the update command.
+	CampaignDeviceUpdating CampaignDeviceStatus = "updating"
+	// CampaignDeviceSucceeded is the status of a device that installed the artifact.
+	CampaignDeviceSucceeded CampaignDeviceStatus = "succeeded"
+	// CampaignDeviceFailed is the status of a device that could not install the artifact.
+	CampaignDeviceFailed CampaignDeviceStatus = "failed"
+)
+
+var campaignDeviceStatusToGRPC = map[CampaignDeviceStatus]grpc_device_manager_go.CampaignDeviceStatus{
+	CampaignDevicePending:   grpc_device_manager_go.CampaignDeviceStatus_PENDING,
+	CampaignDeviceUpdating:  grpc_device_manager_go.CampaignDeviceStatus_UPDATING,
+	CampaignDeviceSucceeded: grpc_device_manager_go.CampaignDeviceStatus_SUCCEEDED,
+	CampaignDeviceFailed:    grpc_device_manager_go.CampaignDeviceStatus_FAILED,
+}
+
+// Campaign contains a staged rollout of an artifact to the devices of a group. The devices are split in batches
+// that are updated one after the other, and each batch starts once the devices updated so far have been healthy
+// during the observation period.
+type Campaign struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// campaign identifier
+	CampaignId string `json:"campaign_id,omitempty"`
+	// Name of the campaign
+	Name string `json:"name,omitempty"`
+	// Artifact with the reference of the firmware to install
+	Artifact string `json:"artifact,omitempty"`
+	// LabelSelector with the devices of the group included in the campaign, empty for the whole group
+	LabelSelector string `json:"label_selector,omitempty"`
+	// BatchSize with the number of devices of each batch
+	BatchSize int `json:"batch_size,omitempty"`
+	// BatchPercentages with the cumulative percentage of devices updated at the end of each batch
+	BatchPercentages []int `json:"batch_percentages,omitempty"`
+	// MaxOfflinePercentage with the percentage of unhealthy updated devices that halts the campaign
+	MaxOfflinePercentage int `json:"max_offline_percentage,omitempty"`
+	// MaxLatency in milliseconds of a healthy device, 0 to only check the online status
+	MaxLatency int `json:"max_latency,omitempty"`
+	// ObservationPeriod in seconds that the updated devices must be healthy before the next batch
+	ObservationPeriod int64 `json:"observation_period,omitempty"`
+	// UpdateTimeout in seconds after which a device that has not reported the result of the update fails
+	UpdateTimeout int64 `json:"update_timeout,omitempty"`
+	// Status of the campaign
+	Status CampaignStatus `json:"status,omitempty"`
+	// Batches with the number of batches
+	Batches int `json:"batches,omitempty"`
+	// CurrentBatch with the index of the batch being updated
+	CurrentBatch int `json:"current_batch,omitempty"`
+	// BatchStarted contains the timestamp when the current batch started, 0 if it has not started
+	BatchStarted int64 `json:"batch_started,omitempty"`
+	// Devices with the number of devices of the campaign
+	Devices int `json:"devices,omitempty"`
+	// Message with the reason of the last change of status
+	Message string `json:"message,omitempty"`
+	// Created contains the creation timestamp
+	Created int64 `json:"created,omitempty"`
+	// Updated contains the timestamp of the last change
+	Updated int64 `json:"updated,omitempty"`
+	// Revision is increased on each update to detect concurrent changes
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// CampaignDevice contains the progress of a device in a rollout campaign.
+type CampaignDevice struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// campaign identifier
+	CampaignId string `json:"campaign_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// Batch with the index of the batch of the device
+	Batch int `json:"batch,omitempty"`
+	// Status of the update of the device
+	Status CampaignDeviceStatus `json:"status,omitempty"`
+	// CommandId with the update command sent to the device
+	CommandId string `json:"command_id,omitempty"`
+	// Updated contains the timestamp of the last change
+	Updated int64 `json:"updated,omitempty"`
+	// Error reported by the device if the update failed
+	Error string `json:"error,omitempty"`
+}
+
+// firmwareUpdate is the payload of the update command.
+type firmwareUpdate struct {
+	CampaignId string `json:"campaign_id"`
+	Artifact   string `json:"artifact"`
+}
+
+// NewCampaign creates a running campaign for a set of devices, which are assigned to the batches in the order of
+// their identifiers.
+func NewCampaign(request *grpc_device_manager_go.CreateCampaignRequest, deviceIDs []string, now time.Time) (*Campaign, []*CampaignDevice) {
+	percentages := make([]int, 0, len(request.BatchPercentages))
+	for _, p := range request.BatchPercentages {
+		percentages = append(percentages, int(p))
+	}
+	campaign := &Campaign{
+		OrganizationId:       request.OrganizationId,
+		DeviceGroupId:        request.DeviceGroupId,
+		CampaignId:           uuid.New().String(),
+		Name:                 request.Name,
+		Artifact:             request.Artifact,
+		LabelSelector:        request.LabelSelector,
+		BatchSize:            int(request.BatchSize),
+		BatchPercentages:     percentages,
+		MaxOfflinePercentage: int(request.MaxOfflinePercentage),
+		MaxLatency:           int(request.MaxLatency),
+		ObservationPeriod:    request.ObservationPeriod,
+		UpdateTimeout:        request.UpdateTimeout,
+		Status:               CampaignRunning,
+		Devices:              len(deviceIDs),
+		Created:              now.Unix(),
+		Updated:              now.Unix(),
+	}
+	if campaign.MaxOfflinePercentage == 0 {
+		campaign.MaxOfflinePercentage = DefaultMaxOfflinePercentage
+	}
+	if campaign.ObservationPeriod == 0 {
+		campaign.ObservationPeriod = int64(DefaultObservationPeriod.Seconds())
+	}
+	if campaign.UpdateTimeout == 0 {
+		campaign.UpdateTimeout = int64(DefaultCommandTTL.Seconds())
+	}
+
+	sorted := make([]string, len(deviceIDs))
+	copy(sorted, deviceIDs)
+	sort.Strings(sorted)
+	sizes := campaign.batchSizes()
+	campaign.Batches = len(sizes)
+	devices := make([]*CampaignDevice, 0, len(sorted))
+	batch := 0
+	for _, deviceID := range sorted {
+		for sizes[batch] == 0 {
+			batch++
+		}
+		sizes[batch]--
+		devices = append(devices, &CampaignDevice{
+			OrganizationId: campaign.OrganizationId,
+			DeviceGroupId:  campaign.DeviceGroupId,
+			CampaignId:     campaign.CampaignId,
+			DeviceId:       deviceID,
+			Batch:          batch,
+			Status:         CampaignDevicePending,
+			Updated:        now.Unix(),
+		})
+	}
+	return campaign, devices
+}
+
+// batchSizes returns the number of devices of each batch. The percentages are cumulative and the last batch
+// always completes the devices, so a campaign without batch size or percentages has a single batch.
+func (c *Campaign) batchSizes() []int {
+	sizes := make([]int, 0)
+	if c.BatchSize > 0 {
+		for remaining := c.Devices; remaining > 0; remaining -= c.BatchSize {
+			if remaining < c.BatchSize {
+				sizes = append(sizes, remaining)
+			} else {
+				sizes = append(sizes, c.BatchSize)
+			}
+		}
+		return sizes
+	}
+	assigned := 0
+	for _, p := range c.BatchPercentages {
+		// round up so that small percentages update at least one device
+		end := (c.Devices*p + 99) / 100
+		if end > assigned {
+			sizes = append(sizes, end-assigned)
+			assigned = end
+		}
+	}
+	if assigned < c.Devices || len(sizes) == 0 {
+		sizes = append(sizes, c.Devices-assigned)
+	}
+	return sizes
+}
+
+// UpdatePayload returns the payload of the update command sent to the devices.
+func (c *Campaign) UpdatePayload() string {
+	payload, _ := json.Marshal(firmwareUpdate{
+		CampaignId: c.CampaignId,
+		Artifact:   c.Artifact,
+	})
+	return string(payload)
+}
+
+// IsFinal checks if the campaign cannot change anymore.
+func (c *Campaign) IsFinal() bool {
+	return c.Status == CampaignAborted || c.Status == CampaignCompleted
+}
+
+func (c *Campaign) setStatus(status CampaignStatus, message string, now time.Time) {
+	c.Status = status
+	c.Message = message
+	c.Updated = now.Unix()
+}
+
+// Pause stops a running campaign. The devices that have received the update continue reporting their progress.
+func (c *Campaign) Pause(message string, now time.Time) derrors.Error {
+	if c.Status != CampaignRunning {
+		return derrors.NewFailedPreconditionError("only running campaigns can be paused").WithParams(c.CampaignId, string(c.Status))
+	}
+	c.setStatus(CampaignPaused, message, now)
+	return nil
+}
+
+// Resume continues a paused or halted campaign. Halted campaigns stop again if the devices are still unhealthy.
+func (c *Campaign) Resume(message string, now time.Time) derrors.Error {
+	if c.Status != CampaignPaused && c.Status != CampaignHalted {
+		return derrors.NewFailedPreconditionError("only paused or halted campaigns can be resumed").WithParams(c.CampaignId, string(c.Status))
+	}
+	c.setStatus(CampaignRunning, message, now)
+	return nil
+}
+
+// Abort stops a campaign permanently.
+func (c *Campaign) Abort(message string, now time.Time) derrors.Error {
+	if c.IsFinal() {
+		return derrors.NewFailedPreconditionError("campaign has finished").WithParams(c.CampaignId, string(c.Status))
+	}
+	c.setStatus(CampaignAborted, message, now)
+	return nil
+}
+
+// Halt stops a running campaign because the updated devices are not healthy.
+func (c *Campaign) Halt(message string, now time.Time) {
+	c.setStatus(CampaignHalted, message, now)
+}
+
+// StartBatch records that the devices of the current batch have received the update.
+func (c *Campaign) StartBatch(now time.Time) {
+	c.BatchStarted = now.Unix()
+	c.Updated = now.Unix()
+}
+
+// NextBatch moves the campaign to the next batch, completing it after the last one.
+func (c *Campaign) NextBatch(now time.Time) {
+	c.CurrentBatch++
+	c.BatchStarted = 0
+	c.Updated = now.Unix()
+	if c.CurrentBatch >= c.Batches {
+		c.setStatus(CampaignCompleted, "all the batches have been updated", now)
+	}
+}
+
+// ExceedsOfflineRate checks if the unhealthy devices exceed the percentage of the checked devices allowed by the
+// campaign.
+func (c *Campaign) ExceedsOfflineRate(unhealthy int, checked int) bool {
+	return checked > 0 && unhealthy*100 > c.MaxOfflinePercentage*checked
+}
+
+// ToGRPC converts the campaign to its gRPC representation, including the number of devices in each status.
+func (c *Campaign) ToGRPC(devices []*CampaignDevice) *grpc_device_manager_go.Campaign {
+	percentages := make([]int32, 0, len(c.BatchPercentages))
+	for _, p := range c.BatchPercentages {
+		percentages = append(percentages, int32(p))
+	}
+	result := &grpc_device_manager_go.Campaign{
+		OrganizationId:       c.OrganizationId,
+		DeviceGroupId:        c.DeviceGroupId,
+		CampaignId:           c.CampaignId,
+		Name:                 c.Name,
+		Artifact:             c.Artifact,
+		LabelSelector:        c.LabelSelector,
+		BatchSize:            int32(c.BatchSize),
+		BatchPercentages:     percentages,
+		MaxOfflinePercentage: int32(c.MaxOfflinePercentage),
+		MaxLatency:           int32(c.MaxLatency),
+		ObservationPeriod:    c.ObservationPeriod,
+		UpdateTimeout:        c.UpdateTimeout,
+		Status:               campaignStatusToGRPC[c.Status],
+		Batches:              int32(c.Batches),
+		CurrentBatch:         int32(c.CurrentBatch),
+		Devices:              int32(c.Devices),
+		Message:              c.Message,
+		Created:              c.Created,
+		Updated:              c.Updated,
+	}
+	for _, d := range devices {
+		switch d.Status {
+		case CampaignDevicePending:
+			result.Pending++
+		case CampaignDeviceUpdating:
+			result.Updating++
+		case CampaignDeviceSucceeded:
+			result.Succeeded++
+		case CampaignDeviceFailed:
+			result.Failed++
+		}
+	}
+	return result
+}
+
+// IsFinal checks if the update of the device has finished.
+func (d *CampaignDevice) IsFinal() bool {
+	return d.Status == CampaignDeviceSucceeded || d.Status == CampaignDeviceFailed
+}
+
+// Start records the update command sent to the device.
+func (d *CampaignDevice) Start(commandID string, now time.Time) {
+	d.Status = CampaignDeviceUpdating
+	d.CommandId = commandID
+	d.Updated = now.Unix()
+}
+
+// Fail marks the update of the device as failed.
+func (d *CampaignDevice) Fail(reason string, now time.Time) {
+	d.Status = CampaignDeviceFailed
+	d.Error = reason
+	d.Updated = now.Unix()
+}
+
+// Complete updates the progress of the device with the status of its update command, using the time when the
+// command finished. It returns whether the status changed.
+func (d *CampaignDevice) Complete(command *DeviceCommand) bool {
+	if d.Status != CampaignDeviceUpdating || !command.IsFinal() {
+		return false
+	}
+	completed := time.Unix(command.Completed, 0)
+	switch command.Status {
+	case CommandSucceeded:
+		d.Status = CampaignDeviceSucceeded
+		d.Updated = command.Completed
+	case CommandFailed:
+		d.Fail(command.Error, completed)
+	default:
+		d.Fail("update command "+string(command.Status), completed)
+	}
+	return true
+}
+
+// ToGRPC converts the progress of the device to its gRPC representation.
+func (d *CampaignDevice) ToGRPC() *grpc_device_manager_go.CampaignDevice {
+	return &grpc_device_manager_go.CampaignDevice{
+		OrganizationId: d.OrganizationId,
+		DeviceGroupId:  d.DeviceGroupId,
+		CampaignId:     d.CampaignId,
+		DeviceId:       d.DeviceId,
+		Batch:          int32(d.Batch),
+		Status:         campaignDeviceStatusToGRPC[d.Status],
+		CommandId:      d.CommandId,
+		Updated:        d.Updated,
+		Error:          d.Error,
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+var _ = ginkgo.Describe("Rollout campaigns", func() {
+
+	now := time.Unix(1000000, 0)
+	devices := []string{"d4", "d2", "d0", "d3", "d1", "d5", "d6", "d7", "d8", "d9"}
+
+	batchesOf := func(devices []*CampaignDevice) map[string]int {
+		result := make(map[string]int, 0)
+		for _, d := range devices {
+			result[d.DeviceId] = d.Batch
+		}
+		return result
+	}
+
+	ginkgo.It("should split the devices in batches of a fixed size", func() {
+		campaign, campaignDevices := NewCampaign(&grpc_device_manager_go.CreateCampaignRequest{
+			OrganizationId: "org",
+			DeviceGroupId:  "dg",
+			Artifact:       "firmware:1.2",
+			BatchSize:      4,
+		}, devices, now)
+		gomega.Expect(campaign.Batches).Should(gomega.Equal(3))
+		gomega.Expect(campaign.Status).Should(gomega.Equal(CampaignRunning))
+		gomega.Expect(campaign.MaxOfflinePercentage).Should(gomega.Equal(DefaultMaxOfflinePercentage))
+		gomega.Expect(campaignDevices).To(gomega.HaveLen(len(devices)))
+		batches := batchesOf(campaignDevices)
+		gomega.Expect(batches["d0"]).Should(gomega.Equal(0))
+		gomega.Expect(batches["d3"]).Should(gomega.Equal(0))
+		gomega.Expect(batches["d4"]).Should(gomega.Equal(1))
+		gomega.Expect(batches["d9"]).Should(gomega.Equal(2))
+	})
+
+	ginkgo.It("should split the devices in percentage steps", func() {
+		campaign, campaignDevices := NewCampaign(&grpc_device_manager_go.CreateCampaignRequest{
+			OrganizationId:   "org",
+			DeviceGroupId:    "dg",
+			Artifact:         "firmware:1.2",
+			BatchPercentages: []int32{5, 50},
+		}, devices, now)
+		// 5% rounds up to one device, and the last batch completes the devices
+		gomega.Expect(campaign.Batches).Should(gomega.Equal(3))
+		batches := batchesOf(campaignDevices)
+		gomega.Expect(batches["d0"]).Should(gomega.Equal(0))
+		gomega.Expect(batches["d1"]).Should(gomega.Equal(1))
+		gomega.Expect(batches["d4"]).Should(gomega.Equal(1))
+		gomega.Expect(batches["d5"]).Should(gomega.Equal(2))
+	})
+
+	ginkgo.It("should use a single batch by default", func() {
+		campaign, _ := NewCampaign(&grpc_device_manager_go.CreateCampaignRequest{
+			OrganizationId: "org",
+			DeviceGroupId:  "dg",
+			Artifact:       "firmware:1.2",
+		}, devices, now)
+		gomega.Expect(campaign.Batches).Should(gomega.Equal(1))
+		campaign.NextBatch(now)
+		gomega.Expect(campaign.Status).Should(gomega.Equal(CampaignCompleted))
+	})
+
+	ginkgo.It("should control the status of the campaign", func() {
+		campaign, _ := NewCampaign(&grpc_device_manager_go.CreateCampaignRequest{
+			OrganizationId: "org",
+			DeviceGroupId:  "dg",
+			Artifact:       "firmware:1.2",
+		}, devices, now)
+		gomega.Expect(campaign.Resume("", now)).NotTo(gomega.Succeed())
+		gomega.Expect(campaign.Pause("", now)).To(gomega.Succeed())
+		gomega.Expect(campaign.Pause("", now)).NotTo(gomega.Succeed())
+		gomega.Expect(campaign.Resume("", now)).To(gomega.Succeed())
+		campaign.Halt("devices offline", now)
+		gomega.Expect(campaign.Resume("", now)).To(gomega.Succeed())
+		gomega.Expect(campaign.Abort("", now)).To(gomega.Succeed())
+		gomega.Expect(campaign.IsFinal()).To(gomega.BeTrue())
+		gomega.Expect(campaign.Abort("", now)).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should check the offline rate", func() {
+		campaign := &Campaign{MaxOfflinePercentage: 20}
+		gomega.Expect(campaign.ExceedsOfflineRate(2, 10)).To(gomega.BeFalse())
+		gomega.Expect(campaign.ExceedsOfflineRate(3, 10)).To(gomega.BeTrue())
+		gomega.Expect(campaign.ExceedsOfflineRate(0, 0)).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should follow the result of the update command", func() {
+		device := &CampaignDevice{DeviceId: "d0", Status: CampaignDevicePending}
+		command := NewDeviceCommand("org", "dg", "d0", FirmwareUpdateCommand, "", time.Hour, now)
+		device.Start(command.CommandId, now)
+		gomega.Expect(device.Complete(command)).To(gomega.BeFalse())
+		gomega.Expect(command.Acknowledge(false, "", "checksum mismatch", now.Add(time.Minute))).To(gomega.Succeed())
+		gomega.Expect(device.Complete(command)).To(gomega.BeTrue())
+		gomega.Expect(device.Status).Should(gomega.Equal(CampaignDeviceFailed))
+		gomega.Expect(device.Error).Should(gomega.Equal("checksum mismatch"))
+		gomega.Expect(device.Updated).Should(gomega.Equal(now.Add(time.Minute).Unix()))
+	})
+})
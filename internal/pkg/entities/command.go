@@ -0,0 +1,184 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"time"
+)
+
+// DefaultCommandTTL is the time a command can be delivered if the request does not set a TTL.
+const DefaultCommandTTL = 24 * time.Hour
+
+// MaxCommandTTL is the maximum time a command can wait to be delivered.
+const MaxCommandTTL = 30 * 24 * time.Hour
+
+// MaxCommandPayloadSize is the maximum size in bytes of the payload of a command.
+const MaxCommandPayloadSize = 16 * 1024
+
+// CommandStatus defines the state of a command sent to a device.
+type CommandStatus string
+
+const (
+	// CommandPending is the status of a command that has not been delivered.
+	CommandPending CommandStatus = "pending"
+	// CommandDelivered is the status of a command that has been sent to the device but not acknowledged.
+	CommandDelivered CommandStatus = "delivered"
+	// CommandSucceeded is the status of a command that the device executed successfully.
+	CommandSucceeded CommandStatus = "succeeded"
+	// CommandFailed is the status of a command that the device could not execute.
+	CommandFailed CommandStatus = "failed"
+	// CommandExpired is the status of a command that was not acknowledged before its expiration.
+	CommandExpired CommandStatus = "expired"
+	// CommandCancelled is the status of a command cancelled by an operator.
+	CommandCancelled CommandStatus = "cancelled"
+)
+
+var commandStatusToGRPC = map[CommandStatus]grpc_device_manager_go.CommandStatus{
+	CommandPending:   grpc_device_manager_go.CommandStatus_PENDING,
+	CommandDelivered: grpc_device_manager_go.CommandStatus_DELIVERED,
+	CommandSucceeded: grpc_device_manager_go.CommandStatus_SUCCEEDED,
+	CommandFailed:    grpc_device_manager_go.CommandStatus_FAILED,
+	CommandExpired:   grpc_device_manager_go.CommandStatus_EXPIRED,
+	CommandCancelled: grpc_device_manager_go.CommandStatus_CANCELLED,
+}
+
+// DeviceCommand contains a command queued for a device by an operator and, once acknowledged, its result.
+type DeviceCommand struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// command identifier
+	CommandId string `json:"command_id,omitempty"`
+	// Name of the command, e.g. reboot
+	Name string `json:"name,omitempty"`
+	// Payload with the arguments of the command
+	Payload string `json:"payload,omitempty"`
+	// Status of the command
+	Status CommandStatus `json:"status,omitempty"`
+	// Created contains the timestamp when the command was queued
+	Created int64 `json:"created,omitempty"`
+	// Expires contains the timestamp after which the command is not delivered
+	Expires int64 `json:"expires,omitempty"`
+	// Delivered contains the timestamp of the first delivery
+	Delivered int64 `json:"delivered,omitempty"`
+	// Completed contains the timestamp when the command reached a final status
+	Completed int64 `json:"completed,omitempty"`
+	// Result reported by the device
+	Result string `json:"result,omitempty"`
+	// Error reported by the device if the command failed
+	Error string `json:"error,omitempty"`
+}
+
+// NewDeviceCommand creates a pending command for a device. A zero TTL uses DefaultCommandTTL.
+func NewDeviceCommand(organizationID string, deviceGroupID string, deviceID string, name string, payload string,
+	ttl time.Duration, now time.Time) *DeviceCommand {
+	if ttl == 0 {
+		ttl = DefaultCommandTTL
+	}
+	return &DeviceCommand{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		CommandId:      uuid.New().String(),
+		Name:           name,
+		Payload:        payload,
+		Status:         CommandPending,
+		Created:        now.Unix(),
+		Expires:        now.Add(ttl).Unix(),
+	}
+}
+
+// IsFinal checks if the command cannot change anymore.
+func (c *DeviceCommand) IsFinal() bool {
+	return c.Status != CommandPending && c.Status != CommandDelivered
+}
+
+// Expire marks the command as expired if it has not been acknowledged before its expiration. It returns whether
+// the status changed.
+func (c *DeviceCommand) Expire(now time.Time) bool {
+	if c.IsFinal() || now.Unix() <= c.Expires {
+		return false
+	}
+	c.Status = CommandExpired
+	c.Completed = now.Unix()
+	return true
+}
+
+// Deliver marks a pending command as delivered. Commands that have been delivered but not acknowledged are
+// delivered again, keeping the time of the first delivery.
+func (c *DeviceCommand) Deliver(now time.Time) derrors.Error {
+	if c.IsFinal() {
+		return derrors.NewFailedPreconditionError("command cannot be delivered").WithParams(c.CommandId, string(c.Status))
+	}
+	if c.Status == CommandPending {
+		c.Status = CommandDelivered
+		c.Delivered = now.Unix()
+	}
+	return nil
+}
+
+// Acknowledge records the result of a command executed by the device.
+func (c *DeviceCommand) Acknowledge(success bool, result string, errorMessage string, now time.Time) derrors.Error {
+	if c.IsFinal() {
+		return derrors.NewFailedPreconditionError("command cannot be acknowledged").WithParams(c.CommandId, string(c.Status))
+	}
+	if c.Delivered == 0 {
+		c.Delivered = now.Unix()
+	}
+	c.Status = CommandSucceeded
+	if !success {
+		c.Status = CommandFailed
+	}
+	c.Result = result
+	c.Error = errorMessage
+	c.Completed = now.Unix()
+	return nil
+}
+
+// Cancel prevents a command that has not been acknowledged from being delivered.
+func (c *DeviceCommand) Cancel(now time.Time) derrors.Error {
+	if c.IsFinal() {
+		return derrors.NewFailedPreconditionError("command cannot be cancelled").WithParams(c.CommandId, string(c.Status))
+	}
+	c.Status = CommandCancelled
+	c.Completed = now.Unix()
+	return nil
+}
+
+func (c *DeviceCommand) ToGRPC() *grpc_device_manager_go.DeviceCommand {
+	return &grpc_device_manager_go.DeviceCommand{
+		OrganizationId: c.OrganizationId,
+		DeviceGroupId:  c.DeviceGroupId,
+		DeviceId:       c.DeviceId,
+		CommandId:      c.CommandId,
+		Name:           c.Name,
+		Payload:        c.Payload,
+		Status:         commandStatusToGRPC[c.Status],
+		Created:        c.Created,
+		Expires:        c.Expires,
+		Delivered:      c.Delivered,
+		Completed:      c.Completed,
+		Result:         c.Result,
+		Error:          c.Error,
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+var _ = ginkgo.Describe("Device commands", func() {
+
+	now := time.Unix(1000000, 0)
+
+	ginkgo.It("should use the default TTL", func() {
+		command := NewDeviceCommand("org", "dg", "device", "reboot", "", 0, now)
+		gomega.Expect(command.Status).Should(gomega.Equal(CommandPending))
+		gomega.Expect(command.Expires).Should(gomega.Equal(now.Add(DefaultCommandTTL).Unix()))
+	})
+
+	ginkgo.It("should keep the first delivery of a command", func() {
+		command := NewDeviceCommand("org", "dg", "device", "reboot", "", time.Hour, now)
+		gomega.Expect(command.Deliver(now)).To(gomega.Succeed())
+		gomega.Expect(command.Deliver(now.Add(time.Minute))).To(gomega.Succeed())
+		gomega.Expect(command.Status).Should(gomega.Equal(CommandDelivered))
+		gomega.Expect(command.Delivered).Should(gomega.Equal(now.Unix()))
+	})
+
+	ginkgo.It("should record the result of a command", func() {
+		command := NewDeviceCommand("org", "dg", "device", "diagnostics", "", time.Hour, now)
+		gomega.Expect(command.Deliver(now)).To(gomega.Succeed())
+		gomega.Expect(command.Acknowledge(false, "", "disk not found", now.Add(time.Minute))).To(gomega.Succeed())
+		gomega.Expect(command.Status).Should(gomega.Equal(CommandFailed))
+		gomega.Expect(command.Error).Should(gomega.Equal("disk not found"))
+		gomega.Expect(command.IsFinal()).To(gomega.BeTrue())
+		gomega.Expect(command.Acknowledge(true, "", "", now)).NotTo(gomega.Succeed())
+		gomega.Expect(command.Cancel(now)).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should expire commands that are not acknowledged", func() {
+		command := NewDeviceCommand("org", "dg", "device", "reboot", "", time.Hour, now)
+		gomega.Expect(command.Expire(now.Add(time.Minute))).To(gomega.BeFalse())
+		gomega.Expect(command.Deliver(now)).To(gomega.Succeed())
+		gomega.Expect(command.Expire(now.Add(2 * time.Hour))).To(gomega.BeTrue())
+		gomega.Expect(command.Status).Should(gomega.Equal(CommandExpired))
+		gomega.Expect(command.Deliver(now)).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should not cancel a command twice", func() {
+		command := NewDeviceCommand("org", "dg", "device", "rotate-key", "", time.Hour, now)
+		gomega.Expect(command.Cancel(now)).To(gomega.Succeed())
+		gomega.Expect(command.ToGRPC().Status.String()).Should(gomega.Equal("CANCELLED"))
+		gomega.Expect(command.Cancel(now)).NotTo(gomega.Succeed())
+	})
+})
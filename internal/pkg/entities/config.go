@@ -0,0 +1,163 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+)
+
+// MaxConfigSize is the maximum size in bytes of a configuration document or overlay.
+const MaxConfigSize = 64 * 1024
+
+// MaxConfigOverlays is the maximum number of overlays of a configuration version.
+const MaxConfigOverlays = 32
+
+// DeviceConfig contains a version of the configuration of the devices of a group. The configuration is a JSON
+// object, and each overlay is a JSON merge patch applied to the devices whose labels match its selector. The
+// overlays are stored as two lists with the selectors and their contents.
+type DeviceConfig struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// Version of the configuration, starting at 1
+	Version int64 `json:"version,omitempty"`
+	// Content with the base configuration
+	Content string `json:"content,omitempty"`
+	// OverlaySelectors contains the label selector of each overlay
+	OverlaySelectors []string `json:"overlay_selectors,omitempty"`
+	// OverlayContents contains the patch of each overlay
+	OverlayContents []string `json:"overlay_contents,omitempty"`
+	// Description of the changes of the version
+	Description string `json:"description,omitempty"`
+	// Created contains the publication timestamp
+	Created int64 `json:"created,omitempty"`
+}
+
+// NewDeviceConfig creates a configuration version from a publish request.
+func NewDeviceConfig(request *grpc_device_manager_go.PublishConfigRequest, version int64, created int64) *DeviceConfig {
+	config := &DeviceConfig{
+		OrganizationId:   request.OrganizationId,
+		DeviceGroupId:    request.DeviceGroupId,
+		Version:          version,
+		Content:          request.Content,
+		OverlaySelectors: make([]string, 0, len(request.Overlays)),
+		OverlayContents:  make([]string, 0, len(request.Overlays)),
+		Description:      request.Description,
+		Created:          created,
+	}
+	for _, o := range request.Overlays {
+		config.OverlaySelectors = append(config.OverlaySelectors, o.LabelSelector)
+		config.OverlayContents = append(config.OverlayContents, o.Content)
+	}
+	return config
+}
+
+// ParseConfigDocument parses a configuration document or overlay, which must be a JSON object.
+func ParseConfigDocument(document string) (map[string]interface{}, derrors.Error) {
+	if len(document) > MaxConfigSize {
+		return nil, derrors.NewInvalidArgumentError("configuration is too large").WithParams(len(document), MaxConfigSize)
+	}
+	return parseJSONObject("configuration", document)
+}
+
+// Effective returns the configuration of a device with the given labels, applying the matching overlays in order,
+// and its ETag.
+func (c *DeviceConfig) Effective(labels map[string]string) (string, string, derrors.Error) {
+	document, err := ParseConfigDocument(c.Content)
+	if err != nil {
+		return "", "", err
+	}
+	for i, expression := range c.OverlaySelectors {
+		selector, err := ParseLabelSelector(expression)
+		if err != nil {
+			return "", "", err
+		}
+		if !selector.Matches(labels) {
+			continue
+		}
+		overlay, err := ParseConfigDocument(c.OverlayContents[i])
+		if err != nil {
+			return "", "", err
+		}
+		document = mergeJSONPatch(document, overlay)
+	}
+	// the keys are sorted when encoded, so the same configuration always produces the same ETag
+	content, jErr := json.Marshal(document)
+	if jErr != nil {
+		return "", "", derrors.NewInternalError("cannot encode configuration", jErr)
+	}
+	return string(content), ConfigETag(c.Version, string(content)), nil
+}
+
+// ConfigETag identifies the effective configuration of a device.
+func ConfigETag(version int64, content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return fmt.Sprintf("%d-%x", version, sum[:8])
+}
+
+func (c *DeviceConfig) ToGRPC(active bool) *grpc_device_manager_go.DeviceConfig {
+	overlays := make([]*grpc_device_manager_go.ConfigOverlay, 0, len(c.OverlaySelectors))
+	for i, selector := range c.OverlaySelectors {
+		overlays = append(overlays, &grpc_device_manager_go.ConfigOverlay{
+			LabelSelector: selector,
+			Content:       c.OverlayContents[i],
+		})
+	}
+	return &grpc_device_manager_go.DeviceConfig{
+		OrganizationId: c.OrganizationId,
+		DeviceGroupId:  c.DeviceGroupId,
+		Version:        c.Version,
+		Content:        c.Content,
+		Overlays:       overlays,
+		Description:    c.Description,
+		Created:        c.Created,
+		Active:         active,
+	}
+}
+
+// ConfigAcknowledgement records the last configuration applied by a device.
+type ConfigAcknowledgement struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// Version of the configuration
+	Version int64 `json:"version,omitempty"`
+	// ETag of the effective configuration
+	Etag string `json:"etag,omitempty"`
+	// Acknowledged contains the timestamp of the acknowledgement
+	Acknowledged int64 `json:"acknowledged,omitempty"`
+}
+
+func (a *ConfigAcknowledgement) ToGRPC(current bool) *grpc_device_manager_go.ConfigAcknowledgement {
+	return &grpc_device_manager_go.ConfigAcknowledgement{
+		OrganizationId: a.OrganizationId,
+		DeviceGroupId:  a.DeviceGroupId,
+		DeviceId:       a.DeviceId,
+		Version:        a.Version,
+		Etag:           a.Etag,
+		Acknowledged:   a.Acknowledged,
+		Current:        current,
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Device configuration", func() {
+
+	request := &grpc_device_manager_go.PublishConfigRequest{
+		OrganizationId: "org",
+		DeviceGroupId:  "dg",
+		Content:        `{"log": {"level": "info", "file": "/var/log/app"}, "interval": 60}`,
+		Overlays: []*grpc_device_manager_go.ConfigOverlay{
+			{LabelSelector: "env=dev", Content: `{"log": {"level": "debug"}}`},
+			{LabelSelector: "env in (dev,test)", Content: `{"interval": 10, "log": {"file": null}}`},
+		},
+	}
+
+	ginkgo.It("should apply the matching overlays in order", func() {
+		config := NewDeviceConfig(request, 1, 1000)
+		content, _, err := config.Effective(map[string]string{"env": "dev"})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(content).Should(gomega.MatchJSON(`{"log": {"level": "debug"}, "interval": 10}`))
+
+		content, _, err = config.Effective(map[string]string{"env": "prod"})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(content).Should(gomega.MatchJSON(request.Content))
+	})
+
+	ginkgo.It("should produce the same ETag for the same configuration", func() {
+		config := NewDeviceConfig(request, 1, 1000)
+		_, etag, err := config.Effective(map[string]string{"env": "prod"})
+		gomega.Expect(err).To(gomega.Succeed())
+		_, other, err := config.Effective(nil)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(other).Should(gomega.Equal(etag))
+
+		_, other, err = config.Effective(map[string]string{"env": "dev"})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(other).ShouldNot(gomega.Equal(etag))
+
+		_, other, err = NewDeviceConfig(request, 2, 1000).Effective(nil)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(other).ShouldNot(gomega.Equal(etag))
+	})
+
+	ginkgo.It("should only accept JSON objects", func() {
+		_, err := ParseConfigDocument(`["a"]`)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = ParseConfigDocument(`{}`)
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+})
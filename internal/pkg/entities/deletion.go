@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"time"
+)
+
+// DeletedDevice contains a device that has been removed by a user and can be restored until it is purged.
+type DeletedDevice struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// Deleted contains the removal timestamp
+	Deleted int64 `json:"deleted,omitempty"`
+	// PurgeAfter contains the timestamp after which the device is permanently removed
+	PurgeAfter int64 `json:"purge_after,omitempty"`
+	// CredentialsEnabled indicates if the credentials of the device were enabled before the removal
+	CredentialsEnabled bool `json:"credentials_enabled,omitempty"`
+}
+
+// NewDeletedDevice creates the removal record of a device that is kept for a given time.
+func NewDeletedDevice(deviceID *grpc_device_go.DeviceId, credentialsEnabled bool, retention time.Duration) *DeletedDevice {
+	now := time.Now()
+	return &DeletedDevice{
+		OrganizationId:     deviceID.OrganizationId,
+		DeviceGroupId:      deviceID.DeviceGroupId,
+		DeviceId:           deviceID.DeviceId,
+		Deleted:            now.Unix(),
+		PurgeAfter:         now.Add(retention).Unix(),
+		CredentialsEnabled: credentialsEnabled,
+	}
+}
+
+// IsExpired checks if the device must be purged at a given time.
+func (d *DeletedDevice) IsExpired(now time.Time) bool {
+	return d.PurgeAfter <= now.Unix()
+}
+
+// ToGRPC converts the removal record into its gRPC representation.
+func (d *DeletedDevice) ToGRPC() *grpc_device_manager_go.DeletedDevice {
+	return &grpc_device_manager_go.DeletedDevice{
+		OrganizationId: d.OrganizationId,
+		DeviceGroupId:  d.DeviceGroupId,
+		DeviceId:       d.DeviceId,
+		Deleted:        d.Deleted,
+		PurgeAfter:     d.PurgeAfter,
+	}
+}
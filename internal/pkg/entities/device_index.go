@@ -0,0 +1,162 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"strings"
+)
+
+// DeviceIndexEntry contains the searchable information of a device.
+type DeviceIndexEntry struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// RegisterSince contains the registration timestamp
+	RegisterSince int64 `json:"register_since,omitempty"`
+	// Labels of the device
+	Labels map[string]string `json:"labels,omitempty"`
+	// AssetInfo contains the asset information flattened as path -> value, e.g. os.name -> linux
+	AssetInfo map[string]string `json:"asset_info,omitempty"`
+}
+
+// NewDeviceIndexEntry creates the index entry of a device retrieved from system model.
+func NewDeviceIndexEntry(device *grpc_device_go.Device) *DeviceIndexEntry {
+	return &DeviceIndexEntry{
+		OrganizationId: device.OrganizationId,
+		DeviceGroupId:  device.DeviceGroupId,
+		DeviceId:       device.DeviceId,
+		RegisterSince:  device.RegisterSince,
+		Labels:         device.Labels,
+		AssetInfo:      FlattenFields(device.AssetInfo),
+	}
+}
+
+// ToDevice returns the system model view of the indexed information.
+func (e *DeviceIndexEntry) ToDevice() *grpc_device_go.Device {
+	return &grpc_device_go.Device{
+		OrganizationId: e.OrganizationId,
+		DeviceGroupId:  e.DeviceGroupId,
+		DeviceId:       e.DeviceId,
+		RegisterSince:  e.RegisterSince,
+		Labels:         e.Labels,
+	}
+}
+
+// FlattenFields transforms a structure into a map of paths and values, so that any field can be searched or
+// compared without depending on the structure of the value, such as the asset information of a device.
+func FlattenFields(value interface{}) map[string]string {
+	result := make(map[string]string, 0)
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return result
+	}
+	var decoded interface{}
+	err = json.Unmarshal(raw, &decoded)
+	if err != nil {
+		return result
+	}
+	flatten("", decoded, result)
+	return result
+}
+
+func flatten(prefix string, value interface{}, result map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flatten(joinPath(prefix, key), child, result)
+		}
+	case []interface{}:
+		for index, child := range v {
+			flatten(joinPath(prefix, fmt.Sprintf("%d", index)), child, result)
+		}
+	case nil:
+		return
+	default:
+		result[prefix] = fmt.Sprintf("%v", v)
+	}
+}
+
+func joinPath(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return fmt.Sprintf("%s.%s", prefix, key)
+}
+
+// DeviceSearchQuery contains the conditions of a device search. Empty conditions are ignored.
+type DeviceSearchQuery struct {
+	// OrganizationId of the devices
+	OrganizationId string
+	// DeviceIdPrefix that the device identifier must start with
+	DeviceIdPrefix string
+	// LabelSelector that the labels of the device must match
+	LabelSelector *LabelSelector
+	// AssetInfo contains a text that must be contained by any of the asset information fields
+	AssetInfo string
+	// FilterByStatus indicates that only devices with DeviceStatus are returned
+	FilterByStatus bool
+	// DeviceStatus of the devices if FilterByStatus is set
+	DeviceStatus grpc_device_manager_go.DeviceStatus
+}
+
+// NewDeviceSearchQuery creates a query from a search request.
+func NewDeviceSearchQuery(request *grpc_device_manager_go.SearchDevicesRequest) (*DeviceSearchQuery, derrors.Error) {
+	selector, err := ParseLabelSelector(request.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceSearchQuery{
+		OrganizationId: request.OrganizationId,
+		DeviceIdPrefix: request.DeviceIdPrefix,
+		LabelSelector:  selector,
+		AssetInfo:      request.AssetInfo,
+		FilterByStatus: request.FilterByStatus,
+		DeviceStatus:   request.DeviceStatus,
+	}, nil
+}
+
+// Matches checks the conditions of the query that can be evaluated with the indexed information. The device
+// status depends on the latency measures and it is checked by the caller.
+func (q *DeviceSearchQuery) Matches(entry *DeviceIndexEntry) bool {
+	if entry.OrganizationId != q.OrganizationId {
+		return false
+	}
+	if !strings.HasPrefix(entry.DeviceId, q.DeviceIdPrefix) {
+		return false
+	}
+	if !q.LabelSelector.Matches(entry.Labels) {
+		return false
+	}
+	if q.AssetInfo == "" {
+		return true
+	}
+	text := strings.ToLower(q.AssetInfo)
+	for _, value := range entry.AssetInfo {
+		if strings.Contains(strings.ToLower(value), text) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+)
+
+// DynamicGroup is a saved view of the devices of an organization, in any device group, that match a label selector,
+// an attribute filter and a status. The members are evaluated when the group is queried; dynamic groups have no
+// credentials and do not change the device groups of the devices.
+type DynamicGroup struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// DynamicGroupId is the identifier of the dynamic group
+	DynamicGroupId string `json:"dynamic_group_id,omitempty"`
+	// Name of the dynamic group
+	Name string `json:"name,omitempty"`
+	// LabelSelector that the labels of the members must match
+	LabelSelector string `json:"label_selector,omitempty"`
+	// AttributeFilter that the attributes of the members must match
+	AttributeFilter string `json:"attribute_filter,omitempty"`
+	// DeviceStatus of the members, empty to include any status
+	DeviceStatus string `json:"device_status,omitempty"`
+	// Created timestamp
+	Created int64 `json:"created,omitempty"`
+	// Updated timestamp
+	Updated int64 `json:"updated,omitempty"`
+}
+
+// NewDynamicGroup creates a dynamic group from a validated request.
+func NewDynamicGroup(request *grpc_device_manager_go.AddDynamicGroupRequest, now int64) *DynamicGroup {
+	return &DynamicGroup{
+		OrganizationId:  request.OrganizationId,
+		DynamicGroupId:  uuid.New().String(),
+		Name:            request.Name,
+		LabelSelector:   request.LabelSelector,
+		AttributeFilter: request.AttributeFilter,
+		DeviceStatus:    dynamicGroupStatus(request.FilterByStatus, request.DeviceStatus),
+		Created:         now,
+		Updated:         now,
+	}
+}
+
+// Update replaces the name and the definition of the dynamic group with the ones of a validated request.
+func (g *DynamicGroup) Update(request *grpc_device_manager_go.UpdateDynamicGroupRequest, now int64) {
+	g.Name = request.Name
+	g.LabelSelector = request.LabelSelector
+	g.AttributeFilter = request.AttributeFilter
+	g.DeviceStatus = dynamicGroupStatus(request.FilterByStatus, request.DeviceStatus)
+	g.Updated = now
+}
+
+func dynamicGroupStatus(filterByStatus bool, status grpc_device_manager_go.DeviceStatus) string {
+	if !filterByStatus {
+		return ""
+	}
+	return status.String()
+}
+
+// Criteria parses the label selector and the attribute filter of the dynamic group.
+func (g *DynamicGroup) Criteria() (*LabelSelector, *AttributeFilter, derrors.Error) {
+	selector, err := ParseLabelSelector(g.LabelSelector)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter, err := ParseAttributeFilter(g.AttributeFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return selector, filter, nil
+}
+
+// FilterByStatus checks if the members of the dynamic group depend on their status.
+func (g *DynamicGroup) FilterByStatus() bool {
+	return g.DeviceStatus != ""
+}
+
+// MatchesStatus checks if a device with the given status can be a member of the dynamic group.
+func (g *DynamicGroup) MatchesStatus(status grpc_device_manager_go.DeviceStatus) bool {
+	return !g.FilterByStatus() || status.String() == g.DeviceStatus
+}
+
+func (g *DynamicGroup) ToGRPC() *grpc_device_manager_go.DynamicGroup {
+	return &grpc_device_manager_go.DynamicGroup{
+		OrganizationId:  g.OrganizationId,
+		DynamicGroupId:  g.DynamicGroupId,
+		Name:            g.Name,
+		LabelSelector:   g.LabelSelector,
+		AttributeFilter: g.AttributeFilter,
+		FilterByStatus:  g.FilterByStatus(),
+		DeviceStatus:    grpc_device_manager_go.DeviceStatus(grpc_device_manager_go.DeviceStatus_value[g.DeviceStatus]),
+		Created:         g.Created,
+		Updated:         g.Updated,
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Dynamic groups", func() {
+
+	ginkgo.It("should require at least one criterion", func() {
+		request := &grpc_device_manager_go.AddDynamicGroupRequest{OrganizationId: "org", Name: "x200"}
+		gomega.Expect(ValidAddDynamicGroupRequest(request)).NotTo(gomega.Succeed())
+		request.LabelSelector = "model=x200"
+		gomega.Expect(ValidAddDynamicGroupRequest(request)).To(gomega.Succeed())
+		request.AttributeFilter = "battery_level<"
+		gomega.Expect(ValidAddDynamicGroupRequest(request)).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should only match the status when it is filtered", func() {
+		group := NewDynamicGroup(&grpc_device_manager_go.AddDynamicGroupRequest{
+			OrganizationId: "org",
+			Name:           "x200",
+			LabelSelector:  "model=x200",
+		}, 1000)
+		gomega.Expect(group.DynamicGroupId).NotTo(gomega.BeEmpty())
+		gomega.Expect(group.MatchesStatus(grpc_device_manager_go.DeviceStatus_OFFLINE)).To(gomega.BeTrue())
+
+		group.Update(&grpc_device_manager_go.UpdateDynamicGroupRequest{
+			OrganizationId: "org",
+			DynamicGroupId: group.DynamicGroupId,
+			Name:           "online x200",
+			LabelSelector:  "model=x200",
+			FilterByStatus: true,
+			DeviceStatus:   grpc_device_manager_go.DeviceStatus_ONLINE,
+		}, 2000)
+		gomega.Expect(group.Updated).Should(gomega.Equal(int64(2000)))
+		gomega.Expect(group.MatchesStatus(grpc_device_manager_go.DeviceStatus_ONLINE)).To(gomega.BeTrue())
+		gomega.Expect(group.MatchesStatus(grpc_device_manager_go.DeviceStatus_OFFLINE)).To(gomega.BeFalse())
+		gomega.Expect(group.ToGRPC().DeviceStatus).Should(gomega.Equal(grpc_device_manager_go.DeviceStatus_ONLINE))
+	})
+
+	ginkgo.It("should not allow bulk operations that change credentials", func() {
+		request := &grpc_device_manager_go.DynamicGroupBulkOperationRequest{
+			OrganizationId: "org",
+			DynamicGroupId: "group",
+			Operation:      grpc_device_manager_go.BulkOperation_DISABLE,
+		}
+		gomega.Expect(ValidDynamicGroupBulkOperationRequest(request)).NotTo(gomega.Succeed())
+		request.Operation = grpc_device_manager_go.BulkOperation_REMOVE
+		gomega.Expect(ValidDynamicGroupBulkOperationRequest(request)).NotTo(gomega.Succeed())
+		request.Operation = grpc_device_manager_go.BulkOperation_ADD_LABELS
+		request.Labels = map[string]string{"rollout": "wave-1"}
+		gomega.Expect(ValidDynamicGroupBulkOperationRequest(request)).To(gomega.Succeed())
+	})
+})
@@ -0,0 +1,428 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadius is the mean radius of the Earth in meters.
+const EarthRadius = 6371008.8
+
+// GeohashPrecision is the number of characters of the geohashes stored in the location index, about 5 meters.
+const GeohashPrecision = 9
+
+// GeohashMaxCells is the maximum number of geohash cells used to cover the region of a query. Larger regions are
+// covered with shorter geohashes.
+const GeohashMaxCells = 32
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// MinPolygonVertices is the minimum number of vertices of a polygon.
+const MinPolygonVertices = 3
+
+// GeoPoint contains a position in decimal degrees.
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// NewGeoPoint creates a point from its gRPC representation.
+func NewGeoPoint(point *grpc_device_manager_go.GeoPoint) (*GeoPoint, derrors.Error) {
+	if point == nil {
+		return nil, derrors.NewInvalidArgumentError("point cannot be empty")
+	}
+	result := &GeoPoint{Latitude: point.Latitude, Longitude: point.Longitude}
+	err := result.Valid()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ParseGeolocation parses the geolocation of a device, with the form latitude,longitude in decimal degrees,
+// e.g. 40.4168,-3.7038
+func ParseGeolocation(geolocation string) (*GeoPoint, derrors.Error) {
+	parts := strings.Split(geolocation, ",")
+	if len(parts) != 2 {
+		return nil, derrors.NewInvalidArgumentError("geolocation must have the form latitude,longitude").WithParams(geolocation)
+	}
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("geolocation latitude is not a number").WithParams(geolocation)
+	}
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("geolocation longitude is not a number").WithParams(geolocation)
+	}
+	point := &GeoPoint{Latitude: latitude, Longitude: longitude}
+	vErr := point.Valid()
+	if vErr != nil {
+		return nil, vErr.WithParams(geolocation)
+	}
+	return point, nil
+}
+
+// Valid checks that the coordinates are in range.
+func (p *GeoPoint) Valid() derrors.Error {
+	if math.IsNaN(p.Latitude) || p.Latitude < -90 || p.Latitude > 90 {
+		return derrors.NewInvalidArgumentError("latitude must be between -90 and 90")
+	}
+	if math.IsNaN(p.Longitude) || p.Longitude < -180 || p.Longitude > 180 {
+		return derrors.NewInvalidArgumentError("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// ToGRPC converts the point into its gRPC representation.
+func (p *GeoPoint) ToGRPC() *grpc_device_manager_go.GeoPoint {
+	return &grpc_device_manager_go.GeoPoint{Latitude: p.Latitude, Longitude: p.Longitude}
+}
+
+// DistanceTo returns the great-circle distance in meters to another point.
+func (p *GeoPoint) DistanceTo(other GeoPoint) float64 {
+	lat1 := toRadians(p.Latitude)
+	lat2 := toRadians(other.Latitude)
+	dLat := lat2 - lat1
+	dLng := toRadians(other.Longitude - p.Longitude)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func toDegrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+// EncodeGeohash returns the geohash of a point with the given number of characters.
+func EncodeGeohash(point GeoPoint, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLng, maxLng := -180.0, 180.0
+	var result strings.Builder
+	bit, value := 0, 0
+	even := true
+	for result.Len() < precision {
+		if even {
+			middle := (minLng + maxLng) / 2
+			if point.Longitude >= middle {
+				value = value<<1 | 1
+				minLng = middle
+			} else {
+				value = value << 1
+				maxLng = middle
+			}
+		} else {
+			middle := (minLat + maxLat) / 2
+			if point.Latitude >= middle {
+				value = value<<1 | 1
+				minLat = middle
+			} else {
+				value = value << 1
+				maxLat = middle
+			}
+		}
+		even = !even
+		bit++
+		if bit == 5 {
+			result.WriteByte(geohashAlphabet[value])
+			bit, value = 0, 0
+		}
+	}
+	return result.String()
+}
+
+// geohashCellSize returns the height and width in degrees of the cells of a geohash precision.
+func geohashCellSize(precision int) (float64, float64) {
+	bits := 5 * precision
+	lngBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lngBits))
+}
+
+// BoundingBox contains the region between two parallels and two meridians. Boxes that cross the antimeridian have
+// a minimum longitude greater than the maximum one.
+type BoundingBox struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// NewBoundingBox creates a box from its south-west and north-east corners.
+func NewBoundingBox(southWest *grpc_device_manager_go.GeoPoint, northEast *grpc_device_manager_go.GeoPoint) (*BoundingBox, derrors.Error) {
+	sw, err := NewGeoPoint(southWest)
+	if err != nil {
+		return nil, err
+	}
+	ne, err := NewGeoPoint(northEast)
+	if err != nil {
+		return nil, err
+	}
+	if sw.Latitude > ne.Latitude {
+		return nil, derrors.NewInvalidArgumentError("south_west latitude cannot be greater than north_east latitude")
+	}
+	return &BoundingBox{MinLatitude: sw.Latitude, MinLongitude: sw.Longitude, MaxLatitude: ne.Latitude, MaxLongitude: ne.Longitude}, nil
+}
+
+// Contains checks if a point is inside the box.
+func (b *BoundingBox) Contains(point GeoPoint) bool {
+	if point.Latitude < b.MinLatitude || point.Latitude > b.MaxLatitude {
+		return false
+	}
+	if b.MinLongitude <= b.MaxLongitude {
+		return point.Longitude >= b.MinLongitude && point.Longitude <= b.MaxLongitude
+	}
+	return point.Longitude >= b.MinLongitude || point.Longitude <= b.MaxLongitude
+}
+
+// BoundingBoxes splits the box in two if it crosses the antimeridian.
+func (b *BoundingBox) BoundingBoxes() []BoundingBox {
+	if b.MinLongitude <= b.MaxLongitude {
+		return []BoundingBox{*b}
+	}
+	return []BoundingBox{
+		{MinLatitude: b.MinLatitude, MinLongitude: b.MinLongitude, MaxLatitude: b.MaxLatitude, MaxLongitude: 180},
+		{MinLatitude: b.MinLatitude, MinLongitude: -180, MaxLatitude: b.MaxLatitude, MaxLongitude: b.MaxLongitude},
+	}
+}
+
+// GeoRegion is an area used to search devices by location.
+type GeoRegion interface {
+	// Contains checks if a point is inside the region
+	Contains(point GeoPoint) bool
+	// BoundingBoxes returns a set of boxes that contain the region, none of them crossing the antimeridian
+	BoundingBoxes() []BoundingBox
+}
+
+// Circle contains the points within a distance of a center.
+type Circle struct {
+	Center GeoPoint
+	// Radius in meters
+	Radius float64
+}
+
+// NewCircle creates a circle from its center and its radius in meters.
+func NewCircle(center *grpc_device_manager_go.GeoPoint, radius float64) (*Circle, derrors.Error) {
+	point, err := NewGeoPoint(center)
+	if err != nil {
+		return nil, err
+	}
+	if radius <= 0 || math.IsNaN(radius) || math.IsInf(radius, 0) {
+		return nil, derrors.NewInvalidArgumentError("radius must be positive")
+	}
+	return &Circle{Center: *point, Radius: radius}, nil
+}
+
+// Contains checks if a point is inside the circle.
+func (c *Circle) Contains(point GeoPoint) bool {
+	return c.Center.DistanceTo(point) <= c.Radius
+}
+
+// BoundingBoxes returns the boxes that contain the circle. Circles that contain a pole cover all the longitudes.
+func (c *Circle) BoundingBoxes() []BoundingBox {
+	angle := toDegrees(c.Radius / EarthRadius)
+	minLat := c.Center.Latitude - angle
+	maxLat := c.Center.Latitude + angle
+	if minLat <= -90 || maxLat >= 90 {
+		return []BoundingBox{{
+			MinLatitude: math.Max(minLat, -90), MinLongitude: -180, MaxLatitude: math.Min(maxLat, 90), MaxLongitude: 180,
+		}}
+	}
+	lngAngle := toDegrees(math.Asin(math.Sin(c.Radius/EarthRadius) / math.Cos(toRadians(c.Center.Latitude))))
+	box := &BoundingBox{
+		MinLatitude:  minLat,
+		MinLongitude: normalizeLongitude(c.Center.Longitude - lngAngle),
+		MaxLatitude:  maxLat,
+		MaxLongitude: normalizeLongitude(c.Center.Longitude + lngAngle),
+	}
+	if lngAngle >= 180 || math.IsNaN(lngAngle) {
+		box.MinLongitude, box.MaxLongitude = -180, 180
+	}
+	return box.BoundingBoxes()
+}
+
+func normalizeLongitude(longitude float64) float64 {
+	if longitude > 180 {
+		return longitude - 360
+	}
+	if longitude < -180 {
+		return longitude + 360
+	}
+	return longitude
+}
+
+// Polygon contains the points inside a closed line. The edges are straight lines in the latitude/longitude plane
+// and the polygon cannot cross the antimeridian.
+type Polygon struct {
+	Vertices []GeoPoint
+}
+
+// NewPolygon creates a polygon from its vertices.
+func NewPolygon(vertices []*grpc_device_manager_go.GeoPoint) (*Polygon, derrors.Error) {
+	if len(vertices) < MinPolygonVertices {
+		return nil, derrors.NewInvalidArgumentError(fmt.Sprintf("polygon must have at least %d vertices", MinPolygonVertices))
+	}
+	polygon := &Polygon{Vertices: make([]GeoPoint, 0, len(vertices))}
+	for _, v := range vertices {
+		point, err := NewGeoPoint(v)
+		if err != nil {
+			return nil, err
+		}
+		polygon.Vertices = append(polygon.Vertices, *point)
+	}
+	return polygon, nil
+}
+
+// Contains checks if a point is inside the polygon using the ray casting algorithm.
+func (p *Polygon) Contains(point GeoPoint) bool {
+	inside := false
+	for i, j := 0, len(p.Vertices)-1; i < len(p.Vertices); j, i = i, i+1 {
+		vi, vj := p.Vertices[i], p.Vertices[j]
+		if (vi.Latitude > point.Latitude) != (vj.Latitude > point.Latitude) {
+			longitude := (vj.Longitude-vi.Longitude)*(point.Latitude-vi.Latitude)/(vj.Latitude-vi.Latitude) + vi.Longitude
+			if point.Longitude < longitude {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// BoundingBoxes returns the box that contains all the vertices.
+func (p *Polygon) BoundingBoxes() []BoundingBox {
+	box := BoundingBox{MinLatitude: 90, MinLongitude: 180, MaxLatitude: -90, MaxLongitude: -180}
+	for _, v := range p.Vertices {
+		box.MinLatitude = math.Min(box.MinLatitude, v.Latitude)
+		box.MaxLatitude = math.Max(box.MaxLatitude, v.Latitude)
+		box.MinLongitude = math.Min(box.MinLongitude, v.Longitude)
+		box.MaxLongitude = math.Max(box.MaxLongitude, v.Longitude)
+	}
+	return []BoundingBox{box}
+}
+
+// GeohashCover returns the geohash prefixes that cover a region. It uses the longest prefixes that cover the
+// region with at most GeohashMaxCells cells.
+func GeohashCover(region GeoRegion) []string {
+	boxes := region.BoundingBoxes()
+	precision := GeohashPrecision
+	for ; precision > 1; precision-- {
+		count := 0
+		for _, b := range boxes {
+			latFrom, latTo, lngFrom, lngTo := geohashCellRange(b, precision)
+			count += (latTo - latFrom + 1) * (lngTo - lngFrom + 1)
+		}
+		if count <= GeohashMaxCells {
+			break
+		}
+	}
+	height, width := geohashCellSize(precision)
+	cells := make(map[string]bool, 0)
+	result := make([]string, 0)
+	for _, b := range boxes {
+		latFrom, latTo, lngFrom, lngTo := geohashCellRange(b, precision)
+		for i := latFrom; i <= latTo; i++ {
+			for j := lngFrom; j <= lngTo; j++ {
+				center := GeoPoint{Latitude: -90 + (float64(i)+0.5)*height, Longitude: -180 + (float64(j)+0.5)*width}
+				cell := EncodeGeohash(center, precision)
+				if !cells[cell] {
+					cells[cell] = true
+					result = append(result, cell)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// geohashCellRange returns the indexes of the first and last rows and columns of the cells that cover a box.
+func geohashCellRange(box BoundingBox, precision int) (int, int, int, int) {
+	height, width := geohashCellSize(precision)
+	rows := int(math.Round(180 / height))
+	columns := int(math.Round(360 / width))
+	index := func(value float64, size float64, count int) int {
+		i := int(math.Floor(value / size))
+		if i < 0 {
+			return 0
+		}
+		if i >= count {
+			return count - 1
+		}
+		return i
+	}
+	return index(box.MinLatitude+90, height, rows), index(box.MaxLatitude+90, height, rows),
+		index(box.MinLongitude+180, width, columns), index(box.MaxLongitude+180, width, columns)
+}
+
+// DeviceLocation contains the last known position of a device in the location index.
+type DeviceLocation struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// Latitude in decimal degrees
+	Latitude float64 `json:"latitude"`
+	// Longitude in decimal degrees
+	Longitude float64 `json:"longitude"`
+	// Geohash of the position with GeohashPrecision characters
+	Geohash string `json:"geohash,omitempty"`
+	// Updated contains the timestamp of the last update
+	Updated int64 `json:"updated,omitempty"`
+}
+
+// NewDeviceLocation creates the entry of a device in the location index.
+func NewDeviceLocation(organizationID string, deviceGroupID string, deviceID string, point GeoPoint, updated int64) *DeviceLocation {
+	return &DeviceLocation{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Latitude:       point.Latitude,
+		Longitude:      point.Longitude,
+		Geohash:        EncodeGeohash(point, GeohashPrecision),
+		Updated:        updated,
+	}
+}
+
+// Point returns the position of the device.
+func (l *DeviceLocation) Point() GeoPoint {
+	return GeoPoint{Latitude: l.Latitude, Longitude: l.Longitude}
+}
+
+// ToGRPC converts the location into its gRPC representation with the distance to a reference point, if any.
+func (l *DeviceLocation) ToGRPC(reference *GeoPoint) *grpc_device_manager_go.DeviceLocation {
+	point := l.Point()
+	result := &grpc_device_manager_go.DeviceLocation{
+		OrganizationId: l.OrganizationId,
+		DeviceGroupId:  l.DeviceGroupId,
+		DeviceId:       l.DeviceId,
+		Location:       point.ToGRPC(),
+		Updated:        l.Updated,
+	}
+	if reference != nil {
+		result.DistanceMeters = reference.DistanceTo(point)
+	}
+	return result
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = ginkgo.Describe("Geolocation", func() {
+
+	ginkgo.It("should parse coordinates", func() {
+		point, err := ParseGeolocation(" 40.4168, -3.7038")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(point.Latitude).To(gomega.Equal(40.4168))
+		gomega.Expect(point.Longitude).To(gomega.Equal(-3.7038))
+	})
+
+	ginkgo.It("should reject invalid coordinates", func() {
+		invalid := []string{"", "Madrid", "40.4168", "40.4168,-3.7038,0", "91,0", "0,-181", "NaN,0"}
+		for _, geolocation := range invalid {
+			_, err := ParseGeolocation(geolocation)
+			gomega.Expect(err).NotTo(gomega.Succeed(), geolocation)
+		}
+	})
+
+	ginkgo.It("should encode geohashes", func() {
+		gomega.Expect(EncodeGeohash(GeoPoint{Latitude: 57.64911, Longitude: 10.40744}, 11)).To(gomega.Equal("u4pruydqqvj"))
+	})
+})
+
+var _ = ginkgo.Describe("Geo regions", func() {
+
+	covered := func(region GeoRegion, point GeoPoint) bool {
+		geohash := EncodeGeohash(point, GeohashPrecision)
+		for _, prefix := range GeohashCover(region) {
+			if strings.HasPrefix(geohash, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ginkgo.It("should search within a radius", func() {
+		circle, err := NewCircle(&grpc_device_manager_go.GeoPoint{Latitude: 40.4168, Longitude: -3.7038}, 1000)
+		gomega.Expect(err).To(gomega.Succeed())
+		inside := GeoPoint{Latitude: 40.42, Longitude: -3.70}
+		gomega.Expect(circle.Contains(inside)).To(gomega.BeTrue())
+		gomega.Expect(covered(circle, inside)).To(gomega.BeTrue())
+		gomega.Expect(circle.Contains(GeoPoint{Latitude: 40.45, Longitude: -3.70})).To(gomega.BeFalse())
+		gomega.Expect(len(GeohashCover(circle))).To(gomega.BeNumerically("<=", GeohashMaxCells))
+	})
+
+	ginkgo.It("should search within a box crossing the antimeridian", func() {
+		box, err := NewBoundingBox(&grpc_device_manager_go.GeoPoint{Latitude: -10, Longitude: 170},
+			&grpc_device_manager_go.GeoPoint{Latitude: 10, Longitude: -170})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(box.BoundingBoxes()).To(gomega.HaveLen(2))
+		for _, p := range []GeoPoint{{Latitude: 0, Longitude: 179}, {Latitude: 5, Longitude: -175}} {
+			gomega.Expect(box.Contains(p)).To(gomega.BeTrue())
+			gomega.Expect(covered(box, p)).To(gomega.BeTrue())
+		}
+		gomega.Expect(box.Contains(GeoPoint{Latitude: 0, Longitude: 0})).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should search within a polygon", func() {
+		polygon, err := NewPolygon([]*grpc_device_manager_go.GeoPoint{
+			{Latitude: 0, Longitude: 0}, {Latitude: 0, Longitude: 10}, {Latitude: 10, Longitude: 0}})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(polygon.Contains(GeoPoint{Latitude: 2, Longitude: 2})).To(gomega.BeTrue())
+		gomega.Expect(covered(polygon, GeoPoint{Latitude: 2, Longitude: 2})).To(gomega.BeTrue())
+		gomega.Expect(polygon.Contains(GeoPoint{Latitude: 8, Longitude: 8})).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should reject invalid regions", func() {
+		_, err := NewCircle(&grpc_device_manager_go.GeoPoint{}, 0)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = NewBoundingBox(&grpc_device_manager_go.GeoPoint{Latitude: 10}, &grpc_device_manager_go.GeoPoint{Latitude: -10})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = NewPolygon([]*grpc_device_manager_go.GeoPoint{{Latitude: 0, Longitude: 0}, {Latitude: 1, Longitude: 1}})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+})
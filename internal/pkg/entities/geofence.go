@@ -0,0 +1,292 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"math"
+	"time"
+)
+
+// MaxGeofenceVertices is the maximum number of vertices of a polygon geofence.
+const MaxGeofenceVertices = 1000
+
+// LocationRecord contains an entry of the location history of a device.
+type LocationRecord struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// Timestamp of the location update
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Latitude in decimal degrees
+	Latitude float64 `json:"latitude"`
+	// Longitude in decimal degrees
+	Longitude float64 `json:"longitude"`
+}
+
+// NewLocationRecord creates an entry of the location history of a device.
+func NewLocationRecord(organizationID string, deviceGroupID string, deviceID string, point GeoPoint, timestamp int64) *LocationRecord {
+	return &LocationRecord{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Timestamp:      timestamp,
+		Latitude:       point.Latitude,
+		Longitude:      point.Longitude,
+	}
+}
+
+// Point returns the position of the record.
+func (r *LocationRecord) Point() GeoPoint {
+	return GeoPoint{Latitude: r.Latitude, Longitude: r.Longitude}
+}
+
+func (r *LocationRecord) ToGRPC() *grpc_device_manager_go.LocationRecord {
+	point := r.Point()
+	return &grpc_device_manager_go.LocationRecord{
+		OrganizationId: r.OrganizationId,
+		DeviceGroupId:  r.DeviceGroupId,
+		DeviceId:       r.DeviceId,
+		Timestamp:      r.Timestamp,
+		Location:       point.ToGRPC(),
+	}
+}
+
+// GeofenceShape defines the shape of a geofence.
+type GeofenceShape string
+
+const (
+	// CircleGeofence contains the points within a radius of its only vertex.
+	CircleGeofence GeofenceShape = "circle"
+	// PolygonGeofence contains the points inside its vertices.
+	PolygonGeofence GeofenceShape = "polygon"
+)
+
+var geofenceShapeFromGRPC = map[grpc_device_manager_go.GeofenceShape]GeofenceShape{
+	grpc_device_manager_go.GeofenceShape_CIRCLE:  CircleGeofence,
+	grpc_device_manager_go.GeofenceShape_POLYGON: PolygonGeofence,
+}
+
+var geofenceShapeToGRPC = map[GeofenceShape]grpc_device_manager_go.GeofenceShape{
+	CircleGeofence:  grpc_device_manager_go.GeofenceShape_CIRCLE,
+	PolygonGeofence: grpc_device_manager_go.GeofenceShape_POLYGON,
+}
+
+// Geofence contains an area of a device group. Location updates of the devices of the group are checked against
+// the geofences to detect when a device enters or leaves them. The vertices are stored as two lists of coordinates.
+type Geofence struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// geofence identifier
+	GeofenceId string `json:"geofence_id,omitempty"`
+	// Name of the geofence
+	Name string `json:"name,omitempty"`
+	// Shape of the geofence
+	Shape GeofenceShape `json:"shape,omitempty"`
+	// Latitudes of the vertices, or of the center of a circle
+	Latitudes []float64 `json:"latitudes,omitempty"`
+	// Longitudes of the vertices, or of the center of a circle
+	Longitudes []float64 `json:"longitudes,omitempty"`
+	// Radius of a circle in meters
+	Radius float64 `json:"radius,omitempty"`
+	// Created contains the creation timestamp
+	Created int64 `json:"created,omitempty"`
+}
+
+// NewGeofence creates a geofence from an add request.
+func NewGeofence(request *grpc_device_manager_go.AddGeofenceRequest) (*Geofence, derrors.Error) {
+	shape, exists := geofenceShapeFromGRPC[request.Shape]
+	if !exists {
+		return nil, derrors.NewInvalidArgumentError("unsupported geofence shape").WithParams(request.Shape.String())
+	}
+	fence := &Geofence{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		GeofenceId:     uuid.New().String(),
+		Name:           request.Name,
+		Shape:          shape,
+		Latitudes:      make([]float64, 0),
+		Longitudes:     make([]float64, 0),
+		Created:        time.Now().Unix(),
+	}
+	switch shape {
+	case CircleGeofence:
+		circle, err := NewCircle(request.Center, request.RadiusMeters)
+		if err != nil {
+			return nil, err
+		}
+		fence.Latitudes = append(fence.Latitudes, circle.Center.Latitude)
+		fence.Longitudes = append(fence.Longitudes, circle.Center.Longitude)
+		fence.Radius = circle.Radius
+	case PolygonGeofence:
+		if len(request.Vertices) > MaxGeofenceVertices {
+			return nil, derrors.NewInvalidArgumentError("too many geofence vertices").WithParams(len(request.Vertices))
+		}
+		polygon, err := NewPolygon(request.Vertices)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range polygon.Vertices {
+			fence.Latitudes = append(fence.Latitudes, v.Latitude)
+			fence.Longitudes = append(fence.Longitudes, v.Longitude)
+		}
+	}
+	return fence, nil
+}
+
+// Region returns the area of the geofence.
+func (g *Geofence) Region() GeoRegion {
+	if g.Shape == CircleGeofence && len(g.Latitudes) > 0 && len(g.Longitudes) > 0 {
+		return &Circle{Center: GeoPoint{Latitude: g.Latitudes[0], Longitude: g.Longitudes[0]}, Radius: g.Radius}
+	}
+	polygon := &Polygon{Vertices: make([]GeoPoint, 0, len(g.Latitudes))}
+	for i := 0; i < len(g.Latitudes) && i < len(g.Longitudes); i++ {
+		polygon.Vertices = append(polygon.Vertices, GeoPoint{Latitude: g.Latitudes[i], Longitude: g.Longitudes[i]})
+	}
+	return polygon
+}
+
+func (g *Geofence) ToGRPC() *grpc_device_manager_go.Geofence {
+	result := &grpc_device_manager_go.Geofence{
+		OrganizationId: g.OrganizationId,
+		DeviceGroupId:  g.DeviceGroupId,
+		GeofenceId:     g.GeofenceId,
+		Name:           g.Name,
+		Shape:          geofenceShapeToGRPC[g.Shape],
+		Created:        g.Created,
+	}
+	switch region := g.Region().(type) {
+	case *Circle:
+		result.Center = region.Center.ToGRPC()
+		result.RadiusMeters = region.Radius
+	case *Polygon:
+		for _, v := range region.Vertices {
+			result.Vertices = append(result.Vertices, v.ToGRPC())
+		}
+	}
+	return result
+}
+
+// GeofenceEventType defines the transitions of a device with respect to a geofence.
+type GeofenceEventType string
+
+const (
+	// GeofenceEnter is produced when a device moves into a geofence.
+	GeofenceEnter GeofenceEventType = "enter"
+	// GeofenceExit is produced when a device moves out of a geofence.
+	GeofenceExit GeofenceEventType = "exit"
+)
+
+var geofenceEventTypeToGRPC = map[GeofenceEventType]grpc_device_manager_go.GeofenceEventType{
+	GeofenceEnter: grpc_device_manager_go.GeofenceEventType_ENTER,
+	GeofenceExit:  grpc_device_manager_go.GeofenceEventType_EXIT,
+}
+
+// GeofenceEvent records a device entering or leaving a geofence.
+type GeofenceEvent struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// Timestamp of the location update that produced the event
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// geofence identifier
+	GeofenceId string `json:"geofence_id,omitempty"`
+	// EventType with the transition
+	EventType GeofenceEventType `json:"event_type,omitempty"`
+	// Latitude of the device in decimal degrees
+	Latitude float64 `json:"latitude"`
+	// Longitude of the device in decimal degrees
+	Longitude float64 `json:"longitude"`
+}
+
+// NewGeofenceEvents compares the previous location of a device, if any, with the new one and returns the
+// events produced in a geofence.
+func NewGeofenceEvents(fence *Geofence, previous *LocationRecord, current *LocationRecord) []*GeofenceEvent {
+	region := fence.Region()
+	wasInside := previous != nil && region.Contains(previous.Point())
+	isInside := region.Contains(current.Point())
+	if wasInside == isInside {
+		return nil
+	}
+	eventType := GeofenceExit
+	if isInside {
+		eventType = GeofenceEnter
+	}
+	return []*GeofenceEvent{{
+		OrganizationId: current.OrganizationId,
+		DeviceGroupId:  current.DeviceGroupId,
+		Timestamp:      current.Timestamp,
+		DeviceId:       current.DeviceId,
+		GeofenceId:     fence.GeofenceId,
+		EventType:      eventType,
+		Latitude:       current.Latitude,
+		Longitude:      current.Longitude,
+	}}
+}
+
+func (e *GeofenceEvent) ToGRPC() *grpc_device_manager_go.GeofenceEvent {
+	point := GeoPoint{Latitude: e.Latitude, Longitude: e.Longitude}
+	return &grpc_device_manager_go.GeofenceEvent{
+		OrganizationId: e.OrganizationId,
+		DeviceGroupId:  e.DeviceGroupId,
+		Timestamp:      e.Timestamp,
+		DeviceId:       e.DeviceId,
+		GeofenceId:     e.GeofenceId,
+		EventType:      geofenceEventTypeToGRPC[e.EventType],
+		Location:       point.ToGRPC(),
+	}
+}
+
+// TimeRange contains the bounds of a query on timestamps. A zero To means no upper bound.
+type TimeRange struct {
+	From int64
+	To   int64
+}
+
+// NewTimeRange creates a range from the bounds of a request.
+func NewTimeRange(from int64, to int64) (*TimeRange, derrors.Error) {
+	if from < 0 || to < 0 {
+		return nil, derrors.NewInvalidArgumentError("time range bounds cannot be less than zero")
+	}
+	if to != 0 && to < from {
+		return nil, derrors.NewInvalidArgumentError("time range end cannot be before its start").WithParams(from, to)
+	}
+	return &TimeRange{From: from, To: to}, nil
+}
+
+// Contains checks if a timestamp is in the range.
+func (r *TimeRange) Contains(timestamp int64) bool {
+	return timestamp >= r.From && (r.To == 0 || timestamp <= r.To)
+}
+
+// Upper returns the upper bound of the range.
+func (r *TimeRange) Upper() int64 {
+	if r.To == 0 {
+		return math.MaxInt64
+	}
+	return r.To
+}
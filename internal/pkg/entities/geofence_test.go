@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Geofences", func() {
+
+	madrid := &grpc_device_manager_go.GeoPoint{Latitude: 40.4168, Longitude: -3.7038}
+
+	record := func(latitude float64, longitude float64, timestamp int64) *LocationRecord {
+		return NewLocationRecord("org", "dg", "device", GeoPoint{Latitude: latitude, Longitude: longitude}, timestamp)
+	}
+
+	ginkgo.It("should create circle and polygon geofences", func() {
+		circle, err := NewGeofence(&grpc_device_manager_go.AddGeofenceRequest{
+			OrganizationId: "org",
+			DeviceGroupId:  "dg",
+			Name:           "center",
+			Shape:          grpc_device_manager_go.GeofenceShape_CIRCLE,
+			Center:         madrid,
+			RadiusMeters:   1000,
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(circle.ToGRPC().Center).Should(gomega.Equal(madrid))
+
+		polygon, err := NewGeofence(&grpc_device_manager_go.AddGeofenceRequest{
+			OrganizationId: "org",
+			DeviceGroupId:  "dg",
+			Name:           "area",
+			Shape:          grpc_device_manager_go.GeofenceShape_POLYGON,
+			Vertices:       []*grpc_device_manager_go.GeoPoint{{Latitude: 0, Longitude: 0}, {Latitude: 0, Longitude: 1}, {Latitude: 1, Longitude: 0}},
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(polygon.ToGRPC().Vertices).To(gomega.HaveLen(3))
+	})
+
+	ginkgo.It("should reject invalid geofences", func() {
+		_, err := NewGeofence(&grpc_device_manager_go.AddGeofenceRequest{
+			Shape:        grpc_device_manager_go.GeofenceShape_CIRCLE,
+			Center:       madrid,
+			RadiusMeters: -1,
+		})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = NewGeofence(&grpc_device_manager_go.AddGeofenceRequest{
+			Shape:    grpc_device_manager_go.GeofenceShape_POLYGON,
+			Vertices: []*grpc_device_manager_go.GeoPoint{madrid},
+		})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should produce events when a device enters or leaves a geofence", func() {
+		fence, err := NewGeofence(&grpc_device_manager_go.AddGeofenceRequest{
+			Shape:        grpc_device_manager_go.GeofenceShape_CIRCLE,
+			Center:       madrid,
+			RadiusMeters: 1000,
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		inside := record(40.4170, -3.7040, 2)
+		outside := record(40.5, -3.7, 3)
+
+		events := NewGeofenceEvents(fence, nil, inside)
+		gomega.Expect(events).To(gomega.HaveLen(1))
+		gomega.Expect(events[0].EventType).Should(gomega.Equal(GeofenceEnter))
+		gomega.Expect(NewGeofenceEvents(fence, nil, outside)).To(gomega.BeEmpty())
+		gomega.Expect(NewGeofenceEvents(fence, inside, record(40.4169, -3.7039, 3))).To(gomega.BeEmpty())
+		events = NewGeofenceEvents(fence, inside, outside)
+		gomega.Expect(events).To(gomega.HaveLen(1))
+		gomega.Expect(events[0].EventType).Should(gomega.Equal(GeofenceExit))
+		gomega.Expect(events[0].Timestamp).Should(gomega.Equal(int64(3)))
+	})
+
+	ginkgo.It("should validate time ranges", func() {
+		_, err := NewTimeRange(10, 5)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		timeRange, err := NewTimeRange(10, 0)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(timeRange.Contains(1000)).Should(gomega.BeTrue())
+		gomega.Expect(timeRange.Contains(5)).Should(gomega.BeFalse())
+	})
+})
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"time"
+)
+
+// HealthMetricType defines the health metrics that devices can report with their heartbeats.
+type HealthMetricType string
+
+const (
+	// BatteryLevel is the percentage of battery charge.
+	BatteryLevel HealthMetricType = "battery_level"
+	// CPUUsage is the percentage of CPU in use.
+	CPUUsage HealthMetricType = "cpu_usage"
+	// MemoryUsage is the percentage of memory in use.
+	MemoryUsage HealthMetricType = "memory_usage"
+	// DiskUsage is the percentage of disk in use.
+	DiskUsage HealthMetricType = "disk_usage"
+	// SignalStrength is the strength of the wireless signal in dBm.
+	SignalStrength HealthMetricType = "signal_strength"
+)
+
+// healthMetricTypes contains the metrics in the order they are returned.
+var healthMetricTypes = []HealthMetricType{BatteryLevel, CPUUsage, MemoryUsage, DiskUsage, SignalStrength}
+
+var healthMetricTypeFromGRPC = map[grpc_device_manager_go.HealthMetricType]HealthMetricType{
+	grpc_device_manager_go.HealthMetricType_BATTERY_LEVEL:   BatteryLevel,
+	grpc_device_manager_go.HealthMetricType_CPU_USAGE:       CPUUsage,
+	grpc_device_manager_go.HealthMetricType_MEMORY_USAGE:    MemoryUsage,
+	grpc_device_manager_go.HealthMetricType_DISK_USAGE:      DiskUsage,
+	grpc_device_manager_go.HealthMetricType_SIGNAL_STRENGTH: SignalStrength,
+}
+
+var healthMetricTypeToGRPC = map[HealthMetricType]grpc_device_manager_go.HealthMetricType{
+	BatteryLevel:   grpc_device_manager_go.HealthMetricType_BATTERY_LEVEL,
+	CPUUsage:       grpc_device_manager_go.HealthMetricType_CPU_USAGE,
+	MemoryUsage:    grpc_device_manager_go.HealthMetricType_MEMORY_USAGE,
+	DiskUsage:      grpc_device_manager_go.HealthMetricType_DISK_USAGE,
+	SignalStrength: grpc_device_manager_go.HealthMetricType_SIGNAL_STRENGTH,
+}
+
+// healthMetricBounds contains the valid range of values of each metric.
+var healthMetricBounds = map[HealthMetricType][2]float64{
+	BatteryLevel:   {0, 100},
+	CPUUsage:       {0, 100},
+	MemoryUsage:    {0, 100},
+	DiskUsage:      {0, 100},
+	SignalStrength: {-150, 0},
+}
+
+// ValidHealthMetrics checks that the metrics of a heartbeat are known, are in range and are not repeated.
+func ValidHealthMetrics(metrics []*grpc_device_manager_go.HealthMetric) derrors.Error {
+	reported := make(map[HealthMetricType]bool, len(metrics))
+	for _, metric := range metrics {
+		metricType, known := healthMetricTypeFromGRPC[metric.Type]
+		if !known {
+			return derrors.NewInvalidArgumentError("unknown health metric").WithParams(metric.Type)
+		}
+		if reported[metricType] {
+			return derrors.NewInvalidArgumentError("health metric is repeated").WithParams(string(metricType))
+		}
+		reported[metricType] = true
+		bounds := healthMetricBounds[metricType]
+		if metric.Value < bounds[0] || metric.Value > bounds[1] {
+			return derrors.NewInvalidArgumentError("health metric is out of range").WithParams(string(metricType),
+				metric.Value, bounds[0], bounds[1])
+		}
+	}
+	return nil
+}
+
+// NewHeartbeatFromGRPC creates a latency measure with the health metrics of a heartbeat.
+func NewHeartbeatFromGRPC(request *grpc_device_manager_go.RegisterHeartbeatRequest) *Latency {
+	metrics := make(map[string]float64, len(request.Metrics))
+	for _, metric := range request.Metrics {
+		metrics[string(healthMetricTypeFromGRPC[metric.Type])] = metric.Value
+	}
+	return &Latency{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+		Latency:        int(request.Latency),
+		Inserted:       time.Now().Unix(),
+		Metrics:        metrics,
+	}
+}
+
+// ToHeartbeatGRPC converts a latency measure and its health metrics to a heartbeat.
+func (l *Latency) ToHeartbeatGRPC() *grpc_device_manager_go.Heartbeat {
+	metrics := make([]*grpc_device_manager_go.HealthMetric, 0, len(l.Metrics))
+	for _, metricType := range healthMetricTypes {
+		value, exists := l.Metrics[string(metricType)]
+		if exists {
+			metrics = append(metrics, &grpc_device_manager_go.HealthMetric{
+				Type:  healthMetricTypeToGRPC[metricType],
+				Value: value,
+			})
+		}
+	}
+	return &grpc_device_manager_go.Heartbeat{
+		Latency:   int32(l.Latency),
+		Metrics:   metrics,
+		Timestamp: l.Inserted,
+	}
+}
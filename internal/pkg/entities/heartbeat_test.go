@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Heartbeats", func() {
+
+	ginkgo.It("should check the health metrics", func() {
+		gomega.Expect(ValidHealthMetrics([]*grpc_device_manager_go.HealthMetric{
+			{Type: grpc_device_manager_go.HealthMetricType_BATTERY_LEVEL, Value: 0},
+			{Type: grpc_device_manager_go.HealthMetricType_SIGNAL_STRENGTH, Value: -70},
+		})).To(gomega.Succeed())
+		gomega.Expect(ValidHealthMetrics([]*grpc_device_manager_go.HealthMetric{
+			{Type: grpc_device_manager_go.HealthMetricType_CPU_USAGE, Value: 101},
+		})).NotTo(gomega.Succeed())
+		gomega.Expect(ValidHealthMetrics([]*grpc_device_manager_go.HealthMetric{
+			{Type: grpc_device_manager_go.HealthMetricType_SIGNAL_STRENGTH, Value: 10},
+		})).NotTo(gomega.Succeed())
+		gomega.Expect(ValidHealthMetrics([]*grpc_device_manager_go.HealthMetric{
+			{Type: grpc_device_manager_go.HealthMetricType_DISK_USAGE, Value: 10},
+			{Type: grpc_device_manager_go.HealthMetricType_DISK_USAGE, Value: 20},
+		})).NotTo(gomega.Succeed())
+		gomega.Expect(ValidHealthMetrics([]*grpc_device_manager_go.HealthMetric{
+			{Type: grpc_device_manager_go.HealthMetricType(99), Value: 10},
+		})).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should keep the metrics of a heartbeat", func() {
+		heartbeat := NewHeartbeatFromGRPC(&grpc_device_manager_go.RegisterHeartbeatRequest{
+			OrganizationId: "org",
+			DeviceGroupId:  "dg",
+			DeviceId:       "device",
+			Latency:        25,
+			Metrics: []*grpc_device_manager_go.HealthMetric{
+				{Type: grpc_device_manager_go.HealthMetricType_MEMORY_USAGE, Value: 42.5},
+				{Type: grpc_device_manager_go.HealthMetricType_BATTERY_LEVEL, Value: 80},
+			},
+		})
+		gomega.Expect(heartbeat.Metrics).Should(gomega.HaveKeyWithValue(string(MemoryUsage), 42.5))
+
+		converted := heartbeat.ToHeartbeatGRPC()
+		gomega.Expect(converted.Latency).Should(gomega.Equal(int32(25)))
+		gomega.Expect(converted.Metrics).To(gomega.HaveLen(2))
+		gomega.Expect(converted.Metrics[0].Type).Should(gomega.Equal(grpc_device_manager_go.HealthMetricType_BATTERY_LEVEL))
+		gomega.Expect(converted.Metrics[1].Value).Should(gomega.Equal(42.5))
+	})
+})
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"io"
+	"strings"
+)
+
+// CSV columns of an import file. The first line of the file must contain the header.
+const (
+	importColumnDeviceId  = "device_id"
+	importColumnLabels    = "labels"
+	importColumnAssetInfo = "asset_info"
+)
+
+// DeviceImportRow contains the registration request built from a line of an import file.
+type DeviceImportRow struct {
+	// Line of the file, starting at 1
+	Line int
+	// Request to register the device
+	Request *grpc_device_manager_go.RegisterDeviceRequest
+	// Error found parsing or validating the line
+	Error derrors.Error
+}
+
+// jsonImportRow is the structure of each line of a JSON Lines import file.
+type jsonImportRow struct {
+	DeviceId  string            `json:"device_id"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	AssetInfo json.RawMessage   `json:"asset_info,omitempty"`
+}
+
+// ParseDeviceImport reads the rows of an import file and builds the registration requests for the target
+// device group. Errors that affect a single row are reported in the row so that the rest of the file can be
+// processed, errors that affect the whole file are returned.
+func ParseDeviceImport(request *grpc_device_manager_go.ImportDevicesRequest) ([]*DeviceImportRow, derrors.Error) {
+	var rows []*DeviceImportRow
+	var err derrors.Error
+	switch request.Format {
+	case grpc_device_manager_go.ImportFormat_CSV:
+		rows, err = parseCSVImport(request)
+	case grpc_device_manager_go.ImportFormat_JSON_LINES:
+		rows, err = parseJSONImport(request)
+	default:
+		return nil, derrors.NewInvalidArgumentError("unsupported import format").WithParams(request.Format.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+	// validate the rows and detect duplicated devices
+	lines := make(map[string]int, 0)
+	for _, row := range rows {
+		if row.Error != nil {
+			continue
+		}
+		row.Error = ValidRegisterDeviceRequest(row.Request)
+		if row.Error != nil {
+			continue
+		}
+		if previous, exists := lines[row.Request.DeviceId]; exists {
+			row.Error = derrors.NewInvalidArgumentError(fmt.Sprintf("device_id already defined in line %d", previous)).WithParams(row.Request.DeviceId)
+			continue
+		}
+		lines[row.Request.DeviceId] = row.Line
+	}
+	return rows, nil
+}
+
+func newImportRow(request *grpc_device_manager_go.ImportDevicesRequest, line int, deviceID string, labels map[string]string) *DeviceImportRow {
+	return &DeviceImportRow{
+		Line: line,
+		Request: &grpc_device_manager_go.RegisterDeviceRequest{
+			OrganizationId:    request.OrganizationId,
+			DeviceGroupId:     request.DeviceGroupId,
+			DeviceGroupApiKey: request.DeviceGroupApiKey,
+			DeviceId:          deviceID,
+			Labels:            labels,
+		},
+	}
+}
+
+func parseCSVImport(request *grpc_device_manager_go.ImportDevicesRequest) ([]*DeviceImportRow, derrors.Error) {
+	reader := csv.NewReader(bytes.NewReader(request.Content))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot read the header of the CSV file", err)
+	}
+	columns := make(map[string]int, 0)
+	for index, name := range header {
+		columns[strings.TrimSpace(name)] = index
+	}
+	if _, exists := columns[importColumnDeviceId]; !exists {
+		return nil, derrors.NewInvalidArgumentError("CSV file must contain a device_id column")
+	}
+	rows := make([]*DeviceImportRow, 0)
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rows = append(rows, &DeviceImportRow{Line: line, Error: derrors.NewInvalidArgumentError("cannot parse line", err)})
+			continue
+		}
+		column := func(name string) string {
+			index, exists := columns[name]
+			if !exists || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+		labels, lErr := parseImportLabels(column(importColumnLabels))
+		row := newImportRow(request, line, column(importColumnDeviceId), labels)
+		if lErr != nil {
+			row.Error = lErr
+		} else if assetInfo := column(importColumnAssetInfo); assetInfo != "" {
+			if err := json.Unmarshal([]byte(assetInfo), &row.Request.AssetInfo); err != nil {
+				row.Error = derrors.NewInvalidArgumentError("asset_info must be a JSON document", err)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseImportLabels parses the labels of a CSV row with the form key1=value1;key2=value2
+func parseImportLabels(value string) (map[string]string, derrors.Error) {
+	labels := make(map[string]string, 0)
+	if value == "" {
+		return labels, nil
+	}
+	for _, pair := range strings.Split(value, ";") {
+		split := strings.SplitN(pair, "=", 2)
+		if len(split) != 2 || strings.TrimSpace(split[0]) == "" {
+			return nil, derrors.NewInvalidArgumentError("labels must have the form key1=value1;key2=value2").WithParams(value)
+		}
+		labels[strings.TrimSpace(split[0])] = strings.TrimSpace(split[1])
+	}
+	return labels, nil
+}
+
+func parseJSONImport(request *grpc_device_manager_go.ImportDevicesRequest) ([]*DeviceImportRow, derrors.Error) {
+	rows := make([]*DeviceImportRow, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(request.Content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var parsed jsonImportRow
+		err := json.Unmarshal([]byte(text), &parsed)
+		if err != nil {
+			rows = append(rows, &DeviceImportRow{Line: line, Error: derrors.NewInvalidArgumentError("cannot parse line", err)})
+			continue
+		}
+		row := newImportRow(request, line, parsed.DeviceId, parsed.Labels)
+		if len(parsed.AssetInfo) > 0 {
+			if err := json.Unmarshal(parsed.AssetInfo, &row.Request.AssetInfo); err != nil {
+				row.Error = derrors.NewInvalidArgumentError("asset_info is not valid", err)
+			}
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot read the JSON Lines file", err)
+	}
+	return rows, nil
+}
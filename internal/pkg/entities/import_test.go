@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Device import", func() {
+
+	newRequest := func(format grpc_device_manager_go.ImportFormat, content string) *grpc_device_manager_go.ImportDevicesRequest {
+		return &grpc_device_manager_go.ImportDevicesRequest{
+			OrganizationId:    "org",
+			DeviceGroupId:     "dg",
+			DeviceGroupApiKey: "key",
+			Format:            format,
+			Content:           []byte(content),
+		}
+	}
+
+	ginkgo.It("should parse a CSV file", func() {
+		content := "device_id,labels,asset_info\n" +
+			"d1,env=prod;tier=edge,\n" +
+			"d2,,\"{\"\"os\"\":{\"\"name\"\":\"\"linux\"\"}}\"\n" +
+			",env=prod,\n" +
+			"d1,,\n" +
+			"d3,invalid,\n"
+		rows, err := ParseDeviceImport(newRequest(grpc_device_manager_go.ImportFormat_CSV, content))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(rows).Should(gomega.HaveLen(5))
+		gomega.Expect(rows[0].Error).To(gomega.BeNil())
+		gomega.Expect(rows[0].Request.Labels).Should(gomega.HaveLen(2))
+		gomega.Expect(rows[0].Request.DeviceGroupApiKey).Should(gomega.Equal("key"))
+		gomega.Expect(rows[1].Error).To(gomega.BeNil())
+		gomega.Expect(rows[1].Request.AssetInfo).NotTo(gomega.BeNil())
+		// empty device id
+		gomega.Expect(rows[2].Error).NotTo(gomega.BeNil())
+		// duplicated device id
+		gomega.Expect(rows[3].Error).NotTo(gomega.BeNil())
+		gomega.Expect(rows[3].Line).Should(gomega.Equal(5))
+		// invalid labels
+		gomega.Expect(rows[4].Error).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("should reject a CSV file without device_id column", func() {
+		_, err := ParseDeviceImport(newRequest(grpc_device_manager_go.ImportFormat_CSV, "id,labels\nd1,\n"))
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should parse a JSON Lines file", func() {
+		content := `{"device_id": "d1", "labels": {"env": "prod"}}` + "\n\n" +
+			`{"device_id": "d2", "asset_info": {"os": {"name": "linux"}}}` + "\n" +
+			`{"device_id": ` + "\n"
+		rows, err := ParseDeviceImport(newRequest(grpc_device_manager_go.ImportFormat_JSON_LINES, content))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(rows).Should(gomega.HaveLen(3))
+		gomega.Expect(rows[0].Error).To(gomega.BeNil())
+		gomega.Expect(rows[0].Request.Labels["env"]).Should(gomega.Equal("prod"))
+		gomega.Expect(rows[1].Error).To(gomega.BeNil())
+		gomega.Expect(rows[1].Line).Should(gomega.Equal(3))
+		gomega.Expect(rows[2].Error).NotTo(gomega.BeNil())
+	})
+})
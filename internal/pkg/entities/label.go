@@ -0,0 +1,176 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The syntax of the labels follows the Kubernetes labels: keys are formed by an optional DNS subdomain prefix and a
+// name separated by a slash, e.g. nalej.com/managed-by, and values are empty or follow the syntax of the names.
+const (
+	// MaxLabelNameLength is the maximum length of the name of a label key and of a label value.
+	MaxLabelNameLength = 63
+	// MaxLabelPrefixLength is the maximum length of the prefix of a label key.
+	MaxLabelPrefixLength = 253
+)
+
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?$`)
+var labelPrefixRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// ValidLabelKey checks the syntax of a label key.
+func ValidLabelKey(key string) derrors.Error {
+	if key == "" {
+		return derrors.NewInvalidArgumentError("label key cannot be empty")
+	}
+	name := key
+	if index := strings.LastIndex(key, "/"); index != -1 {
+		prefix := key[:index]
+		name = key[index+1:]
+		if prefix == "" {
+			return derrors.NewInvalidArgumentError("label key prefix cannot be empty").WithParams(key)
+		}
+		if len(prefix) > MaxLabelPrefixLength {
+			return derrors.NewInvalidArgumentError(
+				fmt.Sprintf("label key prefix must be %d characters or less", MaxLabelPrefixLength)).WithParams(key)
+		}
+		if !labelPrefixRegex.MatchString(prefix) {
+			return derrors.NewInvalidArgumentError(
+				"label key prefix must be a DNS subdomain: lowercase alphanumeric characters, '-' or '.'").WithParams(key)
+		}
+	}
+	if name == "" {
+		return derrors.NewInvalidArgumentError("label key name cannot be empty").WithParams(key)
+	}
+	if len(name) > MaxLabelNameLength {
+		return derrors.NewInvalidArgumentError(
+			fmt.Sprintf("label key name must be %d characters or less", MaxLabelNameLength)).WithParams(key)
+	}
+	if !labelNameRegex.MatchString(name) {
+		return derrors.NewInvalidArgumentError(
+			"label key name must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character").WithParams(key)
+	}
+	return nil
+}
+
+// ValidLabelValue checks the syntax of the value of a label.
+func ValidLabelValue(key string, value string) derrors.Error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > MaxLabelNameLength {
+		return derrors.NewInvalidArgumentError(
+			fmt.Sprintf("label value must be %d characters or less", MaxLabelNameLength)).WithParams(key)
+	}
+	if !labelNameRegex.MatchString(value) {
+		return derrors.NewInvalidArgumentError(
+			"label value must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character").WithParams(key, value)
+	}
+	return nil
+}
+
+// ValidLabels checks the syntax of a set of labels. The keys are checked in order so that the same request always
+// reports the same error.
+func ValidLabels(labels map[string]string) derrors.Error {
+	for _, key := range sortedLabelKeys(labels) {
+		err := ValidLabelKey(key)
+		if err != nil {
+			return err
+		}
+		err = ValidLabelValue(key, labels[key])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LabelPolicy contains the label keys that can be used by the devices and device groups of an organization.
+type LabelPolicy struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// AllowedKeys contains the label keys that can be set, empty to allow any key
+	AllowedKeys []string `json:"allowed_keys,omitempty"`
+}
+
+// NewLabelPolicy creates the label policy of an organization from its gRPC representation.
+func NewLabelPolicy(policy *grpc_device_manager_go.LabelPolicy) (*LabelPolicy, derrors.Error) {
+	for _, key := range policy.AllowedKeys {
+		err := ValidLabelKey(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &LabelPolicy{
+		OrganizationId: policy.OrganizationId,
+		AllowedKeys:    policy.AllowedKeys,
+	}, nil
+}
+
+// ToGRPC converts the policy into its gRPC representation.
+func (p *LabelPolicy) ToGRPC() *grpc_device_manager_go.LabelPolicy {
+	return &grpc_device_manager_go.LabelPolicy{
+		OrganizationId: p.OrganizationId,
+		AllowedKeys:    p.AllowedKeys,
+	}
+}
+
+// Check verifies that a set of labels can be set by an actor. Keys with a reserved prefix can only be set by
+// administrators and are not restricted by the allowed keys, as they are managed by the platform.
+func (p *LabelPolicy) Check(labels map[string]string, reservedPrefixes []string, admin bool) derrors.Error {
+	allowed := make(map[string]bool, len(p.AllowedKeys))
+	for _, key := range p.AllowedKeys {
+		allowed[key] = true
+	}
+	for _, key := range sortedLabelKeys(labels) {
+		reserved := reservedLabelPrefix(key, reservedPrefixes)
+		if reserved != "" {
+			if !admin {
+				return derrors.NewPermissionDeniedError(
+					fmt.Sprintf("label keys with the reserved prefix %s can only be set by administrators", reserved)).WithParams(key)
+			}
+			continue
+		}
+		if len(allowed) > 0 && !allowed[key] {
+			return derrors.NewInvalidArgumentError("label key is not in the allowed keys of the organization").WithParams(key)
+		}
+	}
+	return nil
+}
+
+func reservedLabelPrefix(key string, reservedPrefixes []string) string {
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
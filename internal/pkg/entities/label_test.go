@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = ginkgo.Describe("Labels", func() {
+
+	ginkgo.It("should accept valid labels", func() {
+		labels := map[string]string{
+			"env":                  "prod",
+			"nalej.com/managed-by": "operator",
+			"tier":                 "",
+			"app.kubernetes.io/v1": "1.2.0_rc1",
+		}
+		gomega.Expect(ValidLabels(labels)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject invalid keys", func() {
+		invalid := []string{"", "/env", "nalej.com/", "-env", "env-", "env name", "Nalej.com/env", strings.Repeat("a", 64),
+			strings.Repeat("a", 254) + "/env"}
+		for _, key := range invalid {
+			gomega.Expect(ValidLabelKey(key)).NotTo(gomega.Succeed(), key)
+		}
+	})
+
+	ginkgo.It("should reject invalid values", func() {
+		gomega.Expect(ValidLabels(map[string]string{"env": strings.Repeat("a", 2048)})).NotTo(gomega.Succeed())
+		gomega.Expect(ValidLabels(map[string]string{"env": "prod env"})).NotTo(gomega.Succeed())
+		gomega.Expect(ValidLabels(map[string]string{"env": "-prod"})).NotTo(gomega.Succeed())
+	})
+})
+
+var _ = ginkgo.Describe("Label policy", func() {
+
+	reserved := []string{"nalej.com/"}
+
+	ginkgo.It("should only allow administrators to set reserved keys", func() {
+		policy := &LabelPolicy{OrganizationId: "org"}
+		labels := map[string]string{"nalej.com/managed-by": "operator"}
+		gomega.Expect(policy.Check(labels, reserved, false)).NotTo(gomega.Succeed())
+		gomega.Expect(policy.Check(labels, reserved, true)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should only accept the allowed keys", func() {
+		policy := &LabelPolicy{OrganizationId: "org", AllowedKeys: []string{"env", "tier"}}
+		gomega.Expect(policy.Check(map[string]string{"env": "prod"}, reserved, false)).To(gomega.Succeed())
+		gomega.Expect(policy.Check(map[string]string{"owner": "me"}, reserved, true)).NotTo(gomega.Succeed())
+		gomega.Expect(policy.Check(map[string]string{"nalej.com/managed-by": "operator"}, reserved, true)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should accept any key without allowed keys", func() {
+		policy := &LabelPolicy{OrganizationId: "org"}
+		gomega.Expect(policy.Check(map[string]string{"owner": "me"}, reserved, false)).To(gomega.Succeed())
+	})
+})
@@ -32,6 +32,8 @@ type Latency struct {
 	Latency int `json:"latency,omitempty"`
 	// timestamp
 	Inserted int64 `json:"inserted, omitempty"`
+	// Metrics with the health metrics reported in a heartbeat, indexed by HealthMetricType
+	Metrics map[string]float64 `json:"metrics,omitempty"`
 }
 
 func NewEmptyLatency() *Latency {
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"math"
+	"regexp"
+)
+
+// MaxMetricSamples is the maximum number of samples that can be added in a request.
+const MaxMetricSamples = 1000
+
+// metricNameRegex defines the names of the metrics, e.g. engine.temperature or modbus:holding_register_7.
+var metricNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.:\-]{0,127}$`)
+
+// MetricSample contains a value of a custom metric of a device.
+type MetricSample struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// Name of the metric
+	Name string `json:"name,omitempty"`
+	// Timestamp of the sample
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Value of the sample
+	Value float64 `json:"value"`
+}
+
+// ValidMetricName checks that a metric name starts with a letter or an underscore and contains up to 128 letters,
+// digits, '_', '.', ':' or '-'.
+func ValidMetricName(name string) derrors.Error {
+	if !metricNameRegex.MatchString(name) {
+		return derrors.NewInvalidArgumentError("invalid metric name").WithParams(name)
+	}
+	return nil
+}
+
+// ValidMetricValues checks the names and values of the samples of a request.
+func ValidMetricValues(values []*grpc_device_manager_go.MetricValue) derrors.Error {
+	if len(values) > MaxMetricSamples {
+		return derrors.NewInvalidArgumentError("too many metric samples").WithParams(len(values), MaxMetricSamples)
+	}
+	for _, value := range values {
+		err := ValidMetricName(value.Name)
+		if err != nil {
+			return err
+		}
+		if math.IsNaN(value.Value) || math.IsInf(value.Value, 0) {
+			return derrors.NewInvalidArgumentError("metric value must be a finite number").WithParams(value.Name)
+		}
+		if value.Timestamp < 0 {
+			return derrors.NewInvalidArgumentError("metric timestamp cannot be less than zero").WithParams(value.Name)
+		}
+	}
+	return nil
+}
+
+// NewMetricSamplesFromGRPC creates the samples of a request. Samples without timestamp are taken at now.
+func NewMetricSamplesFromGRPC(request *grpc_device_manager_go.AddMetricSamplesRequest, now int64) []*MetricSample {
+	samples := make([]*MetricSample, 0, len(request.Samples))
+	for _, value := range request.Samples {
+		timestamp := value.Timestamp
+		if timestamp == 0 {
+			timestamp = now
+		}
+		samples = append(samples, &MetricSample{
+			OrganizationId: request.OrganizationId,
+			DeviceGroupId:  request.DeviceGroupId,
+			DeviceId:       request.DeviceId,
+			Name:           value.Name,
+			Timestamp:      timestamp,
+			Value:          value.Value,
+		})
+	}
+	return samples
+}
+
+// IsNewer checks if a sample replaces another one as the last value of a metric. Samples with the same timestamp
+// replace each other, as in the database.
+func (s *MetricSample) IsNewer(other *MetricSample) bool {
+	return other == nil || s.Timestamp >= other.Timestamp
+}
+
+func (s *MetricSample) ToGRPC() *grpc_device_manager_go.MetricSample {
+	return &grpc_device_manager_go.MetricSample{
+		OrganizationId: s.OrganizationId,
+		DeviceGroupId:  s.DeviceGroupId,
+		DeviceId:       s.DeviceId,
+		Name:           s.Name,
+		Timestamp:      s.Timestamp,
+		Value:          s.Value,
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"math"
+	"strings"
+)
+
+var _ = ginkgo.Describe("Metrics", func() {
+
+	ginkgo.It("should check the metric names", func() {
+		gomega.Expect(ValidMetricName("engine.temperature")).To(gomega.Succeed())
+		gomega.Expect(ValidMetricName("modbus:holding_register-7")).To(gomega.Succeed())
+		gomega.Expect(ValidMetricName("_internal")).To(gomega.Succeed())
+		gomega.Expect(ValidMetricName("")).NotTo(gomega.Succeed())
+		gomega.Expect(ValidMetricName("7up")).NotTo(gomega.Succeed())
+		gomega.Expect(ValidMetricName("engine temperature")).NotTo(gomega.Succeed())
+		gomega.Expect(ValidMetricName(strings.Repeat("a", 129))).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject values that are not finite", func() {
+		gomega.Expect(ValidMetricValues([]*grpc_device_manager_go.MetricValue{{Name: "rpm", Value: 1200}})).To(gomega.Succeed())
+		gomega.Expect(ValidMetricValues([]*grpc_device_manager_go.MetricValue{{Name: "rpm", Value: math.NaN()}})).NotTo(gomega.Succeed())
+		gomega.Expect(ValidMetricValues([]*grpc_device_manager_go.MetricValue{{Name: "rpm", Value: math.Inf(1)}})).NotTo(gomega.Succeed())
+		gomega.Expect(ValidMetricValues(make([]*grpc_device_manager_go.MetricValue, MaxMetricSamples+1))).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should take the samples without timestamp at the current time", func() {
+		samples := NewMetricSamplesFromGRPC(&grpc_device_manager_go.AddMetricSamplesRequest{
+			OrganizationId: "org",
+			DeviceGroupId:  "dg",
+			DeviceId:       "device",
+			Samples: []*grpc_device_manager_go.MetricValue{
+				{Name: "rpm", Value: 1200, Timestamp: 1000},
+				{Name: "rpm", Value: 1300},
+			},
+		}, 2000)
+		gomega.Expect(samples).To(gomega.HaveLen(2))
+		gomega.Expect(samples[0].Timestamp).Should(gomega.Equal(int64(1000)))
+		gomega.Expect(samples[1].Timestamp).Should(gomega.Equal(int64(2000)))
+		gomega.Expect(samples[1].IsNewer(samples[0])).To(gomega.BeTrue())
+		gomega.Expect(samples[0].IsNewer(samples[1])).To(gomega.BeFalse())
+	})
+})
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/derrors"
+	"hash/fnv"
+)
+
+// SortField defines the field used to sort a listing.
+type SortField string
+
+const (
+	// SortByID sorts by the identifier of the entity.
+	SortByID SortField = "id"
+	// SortByRegistration sorts by the registration or creation time of the entity.
+	SortByRegistration SortField = "registration"
+	// SortByStatus sorts devices by their online status.
+	SortByStatus SortField = "status"
+	// SortByLatency sorts devices by their last latency.
+	SortByLatency SortField = "latency"
+)
+
+// DeviceSortFields contains the fields that can be used to sort devices.
+var DeviceSortFields = []SortField{SortByID, SortByRegistration, SortByStatus, SortByLatency}
+
+// DeviceGroupSortFields contains the fields that can be used to sort device groups.
+var DeviceGroupSortFields = []SortField{SortByID, SortByRegistration}
+
+// PaginationConfig contains the page sizes applied to the listings.
+type PaginationConfig struct {
+	// DefaultPageSize is used when the request does not specify a page size.
+	DefaultPageSize int
+	// MaxPageSize is the maximum number of elements returned in a page.
+	MaxPageSize int
+}
+
+// PageSize returns the effective size of a page given the requested one.
+func (pc PaginationConfig) PageSize(requested int) int {
+	if requested <= 0 {
+		return pc.DefaultPageSize
+	}
+	if pc.MaxPageSize > 0 && requested > pc.MaxPageSize {
+		return pc.MaxPageSize
+	}
+	return requested
+}
+
+// PageRequest contains the information required to retrieve a page of a listing.
+type PageRequest struct {
+	// Size of the page, zero means the default size.
+	Size int
+	// Offset of the first element of the page.
+	Offset int
+	// SortBy contains the field used to sort the listing.
+	SortBy SortField
+	// Descending reverses the sorting order.
+	Descending bool
+	// query is the fingerprint of the listing parameters, used to reject tokens issued for another listing.
+	query string
+}
+
+// pageToken is the content of the opaque token returned to the clients.
+type pageToken struct {
+	Offset int    `json:"offset"`
+	Query  string `json:"query"`
+}
+
+// NewPageRequest builds a PageRequest from the parameters received in a listing request. The scope identifies the
+// rest of the parameters of the listing (organization, group, selector) so that a token cannot be reused on a
+// different listing.
+func NewPageRequest(pageSize int32, token string, sortBy string, descending bool, scope string) (*PageRequest, derrors.Error) {
+	if pageSize < 0 {
+		return nil, derrors.NewInvalidArgumentError(invalidPageSize)
+	}
+	field := SortField(sortBy)
+	if field == "" {
+		field = SortByID
+	}
+	request := &PageRequest{
+		Size:       int(pageSize),
+		SortBy:     field,
+		Descending: descending,
+	}
+	request.query = request.fingerprint(scope)
+	if token == "" {
+		return request, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError(invalidPageToken, err)
+	}
+	var decoded pageToken
+	err = json.Unmarshal(raw, &decoded)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError(invalidPageToken, err)
+	}
+	if decoded.Query != request.query || decoded.Offset < 0 {
+		return nil, derrors.NewInvalidArgumentError("page token does not belong to this listing")
+	}
+	request.Offset = decoded.Offset
+	return request, nil
+}
+
+func (p *PageRequest) fingerprint(scope string) string {
+	h := fnv.New64a()
+	h.Write([]byte(fmt.Sprintf("%s|%s|%t", scope, p.SortBy, p.Descending)))
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// Bounds returns the range [start, end) of elements of the page given the total number of elements.
+func (p *PageRequest) Bounds(size int, total int) (int, int) {
+	start := p.Offset
+	if start > total {
+		start = total
+	}
+	end := start + size
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// NextToken returns the token to retrieve the page that starts at the given position, or an empty string if
+// there are no more elements.
+func (p *PageRequest) NextToken(end int, total int) string {
+	if end >= total {
+		return ""
+	}
+	raw, _ := json.Marshal(pageToken{Offset: end, Query: p.query})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// ValidSortField checks that a listing can be sorted by the given field.
+func ValidSortField(sortBy string, allowed []SortField) derrors.Error {
+	if sortBy == "" {
+		return nil
+	}
+	for _, field := range allowed {
+		if SortField(sortBy) == field {
+			return nil
+		}
+	}
+	return derrors.NewInvalidArgumentError(invalidSortField).WithParams(sortBy)
+}
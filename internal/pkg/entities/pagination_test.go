@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Pagination", func() {
+
+	config := PaginationConfig{DefaultPageSize: 10, MaxPageSize: 50}
+
+	ginkgo.It("should apply the default and maximum page sizes", func() {
+		gomega.Expect(config.PageSize(0)).Should(gomega.Equal(10))
+		gomega.Expect(config.PageSize(20)).Should(gomega.Equal(20))
+		gomega.Expect(config.PageSize(200)).Should(gomega.Equal(50))
+	})
+
+	ginkgo.It("should iterate through the pages using the tokens", func() {
+		total := 25
+		page, err := NewPageRequest(10, "", "", false, "org")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(page.SortBy).Should(gomega.Equal(SortByID))
+		retrieved := 0
+		for {
+			start, end := page.Bounds(config.PageSize(page.Size), total)
+			retrieved += end - start
+			token := page.NextToken(end, total)
+			if token == "" {
+				break
+			}
+			page, err = NewPageRequest(10, token, "", false, "org")
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		gomega.Expect(retrieved).Should(gomega.Equal(total))
+	})
+
+	ginkgo.It("should reject tokens from a different listing", func() {
+		page, err := NewPageRequest(10, "", string(SortByStatus), false, "org")
+		gomega.Expect(err).To(gomega.Succeed())
+		token := page.NextToken(10, 20)
+		gomega.Expect(token).ShouldNot(gomega.BeEmpty())
+
+		_, err = NewPageRequest(10, token, string(SortByStatus), false, "other")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = NewPageRequest(10, token, string(SortByID), false, "org")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = NewPageRequest(10, "not-a-token", string(SortByStatus), false, "org")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should validate the sort fields", func() {
+		gomega.Expect(ValidSortField("", DeviceGroupSortFields)).To(gomega.Succeed())
+		gomega.Expect(ValidSortField("latency", DeviceSortFields)).To(gomega.Succeed())
+		gomega.Expect(ValidSortField("latency", DeviceGroupSortFields)).NotTo(gomega.Succeed())
+	})
+})
@@ -0,0 +1,127 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+)
+
+// ReconcileIssueKind identifies the type of inconsistency found between the components that store the device
+// information.
+type ReconcileIssueKind string
+
+const (
+	// MissingDeviceGroupCredentials is reported for a device group of system model without authx credentials
+	MissingDeviceGroupCredentials ReconcileIssueKind = "missing_device_group_credentials"
+	// MissingDeviceCredentials is reported for a device of system model without authx credentials
+	MissingDeviceCredentials ReconcileIssueKind = "missing_device_credentials"
+	// DanglingDeviceGroupCredentials is reported for authx credentials of a device group that is not in system model
+	DanglingDeviceGroupCredentials ReconcileIssueKind = "dangling_device_group_credentials"
+	// DanglingDeviceCredentials is reported for authx credentials of a device that is not in system model
+	DanglingDeviceCredentials ReconcileIssueKind = "dangling_device_credentials"
+	// OrphanLatency is reported for latencies of a device that is not in system model
+	OrphanLatency ReconcileIssueKind = "orphan_latency"
+)
+
+var reconcileIssueKindToGRPC = map[ReconcileIssueKind]grpc_device_manager_go.ReconcileIssueKind{
+	MissingDeviceGroupCredentials:  grpc_device_manager_go.ReconcileIssueKind_MISSING_DEVICE_GROUP_CREDENTIALS,
+	MissingDeviceCredentials:       grpc_device_manager_go.ReconcileIssueKind_MISSING_DEVICE_CREDENTIALS,
+	DanglingDeviceGroupCredentials: grpc_device_manager_go.ReconcileIssueKind_DANGLING_DEVICE_GROUP_CREDENTIALS,
+	DanglingDeviceCredentials:      grpc_device_manager_go.ReconcileIssueKind_DANGLING_DEVICE_CREDENTIALS,
+	OrphanLatency:                  grpc_device_manager_go.ReconcileIssueKind_ORPHAN_LATENCY,
+}
+
+// ReconcileIssue contains an inconsistency found by the reconciler.
+type ReconcileIssue struct {
+	// Kind of inconsistency
+	Kind ReconcileIssueKind `json:"kind,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier, empty for the issues of a device group
+	DeviceId string `json:"device_id,omitempty"`
+	// Fixed indicates that the inconsistency has been fixed
+	Fixed bool `json:"fixed,omitempty"`
+	// Error returned by the fix, if any
+	Error string `json:"error,omitempty"`
+}
+
+// ReconcileReport contains the inconsistencies found in an organization.
+type ReconcileReport struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// Apply indicates that the inconsistencies have been fixed. Otherwise they are only reported
+	Apply bool `json:"apply,omitempty"`
+	// Issues found in the organization
+	Issues []*ReconcileIssue `json:"issues,omitempty"`
+}
+
+// NewReconcileReport creates an empty report of an organization.
+func NewReconcileReport(organizationID string, apply bool) *ReconcileReport {
+	return &ReconcileReport{
+		OrganizationId: organizationID,
+		Apply:          apply,
+		Issues:         make([]*ReconcileIssue, 0),
+	}
+}
+
+// AddIssue adds an inconsistency to the report. The fix is applied if the report is in apply mode.
+func (r *ReconcileReport) AddIssue(kind ReconcileIssueKind, deviceGroupID string, deviceID string, fix func() error) {
+	issue := &ReconcileIssue{
+		Kind:          kind,
+		DeviceGroupId: deviceGroupID,
+		DeviceId:      deviceID,
+	}
+	if r.Apply {
+		err := fix()
+		if err != nil {
+			issue.Error = err.Error()
+		} else {
+			issue.Fixed = true
+		}
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// Fixed returns the number of inconsistencies that have been fixed.
+func (r *ReconcileReport) Fixed() int {
+	fixed := 0
+	for _, issue := range r.Issues {
+		if issue.Fixed {
+			fixed++
+		}
+	}
+	return fixed
+}
+
+// ToGRPC converts the report into its gRPC representation.
+func (r *ReconcileReport) ToGRPC() *grpc_device_manager_go.ReconcileResponse {
+	issues := make([]*grpc_device_manager_go.ReconcileIssue, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		issues = append(issues, &grpc_device_manager_go.ReconcileIssue{
+			Kind:          reconcileIssueKindToGRPC[issue.Kind],
+			DeviceGroupId: issue.DeviceGroupId,
+			DeviceId:      issue.DeviceId,
+			Fixed:         issue.Fixed,
+			Error:         issue.Error,
+		})
+	}
+	return &grpc_device_manager_go.ReconcileResponse{
+		OrganizationId: r.OrganizationId,
+		Apply:          r.Apply,
+		Issues:         issues,
+	}
+}
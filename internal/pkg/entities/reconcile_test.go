@@ -0,0 +1,47 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"fmt"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Reconcile report", func() {
+
+	ginkgo.It("should not apply the fixes in dry-run mode", func() {
+		report := NewReconcileReport("org", false)
+		applied := false
+		report.AddIssue(MissingDeviceCredentials, "dg", "device", func() error {
+			applied = true
+			return nil
+		})
+		gomega.Expect(applied).Should(gomega.BeFalse())
+		gomega.Expect(report.Issues).Should(gomega.HaveLen(1))
+		gomega.Expect(report.Fixed()).Should(gomega.Equal(0))
+	})
+
+	ginkgo.It("should record the result of the fixes in apply mode", func() {
+		report := NewReconcileReport("org", true)
+		report.AddIssue(DanglingDeviceCredentials, "dg", "d1", func() error { return nil })
+		report.AddIssue(OrphanLatency, "dg", "d2", func() error { return fmt.Errorf("unavailable") })
+		gomega.Expect(report.Issues).Should(gomega.HaveLen(2))
+		gomega.Expect(report.Fixed()).Should(gomega.Equal(1))
+		gomega.Expect(report.Issues[1].Error).Should(gomega.Equal("unavailable"))
+	})
+})
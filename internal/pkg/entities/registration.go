@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+)
+
+// MatchesRegistration checks if an existing device contains the data of a registration request, so that a
+// repeated registration can be considered the same one.
+func MatchesRegistration(device *grpc_device_go.Device, request *grpc_device_manager_go.RegisterDeviceRequest) bool {
+	if device.OrganizationId != request.OrganizationId || device.DeviceGroupId != request.DeviceGroupId ||
+		device.DeviceId != request.DeviceId {
+		return false
+	}
+	if len(device.Labels) != len(request.Labels) {
+		return false
+	}
+	for key, value := range request.Labels {
+		if current, exists := device.Labels[key]; !exists || current != value {
+			return false
+		}
+	}
+	if device.AssetInfo == nil || request.AssetInfo == nil {
+		return device.AssetInfo == nil && request.AssetInfo == nil
+	}
+	return proto.Equal(device.AssetInfo, request.AssetInfo)
+}
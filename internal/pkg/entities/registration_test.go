@@ -0,0 +1,56 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Device registration", func() {
+
+	device := &grpc_device_go.Device{
+		OrganizationId: "org",
+		DeviceGroupId:  "dg",
+		DeviceId:       "device",
+		Labels:         map[string]string{"env": "prod"},
+	}
+
+	ginkgo.It("should match a repeated registration", func() {
+		request := &grpc_device_manager_go.RegisterDeviceRequest{
+			OrganizationId: "org",
+			DeviceGroupId:  "dg",
+			DeviceId:       "device",
+			Labels:         map[string]string{"env": "prod"},
+		}
+		gomega.Expect(MatchesRegistration(device, request)).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should not match a registration with different data", func() {
+		request := &grpc_device_manager_go.RegisterDeviceRequest{
+			OrganizationId: "org",
+			DeviceGroupId:  "dg",
+			DeviceId:       "device",
+			Labels:         map[string]string{"env": "dev"},
+		}
+		gomega.Expect(MatchesRegistration(device, request)).Should(gomega.BeFalse())
+		request.Labels = nil
+		gomega.Expect(MatchesRegistration(device, request)).Should(gomega.BeFalse())
+	})
+})
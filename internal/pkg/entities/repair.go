@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// RepairOperation defines the action required to fix an inconsistent state between the components.
+type RepairOperation string
+
+const (
+	// RemoveDeviceOperation removes a device from system model.
+	RemoveDeviceOperation RepairOperation = "remove_device"
+	// RemoveDeviceCredentialsOperation removes the credentials of a device from authx.
+	RemoveDeviceCredentialsOperation RepairOperation = "remove_device_credentials"
+	// RemoveDeviceLatencyOperation removes the latency measures of a device.
+	RemoveDeviceLatencyOperation RepairOperation = "remove_device_latency"
+	// RemoveDeviceGroupOperation removes a device group from system model.
+	RemoveDeviceGroupOperation RepairOperation = "remove_device_group"
+	// RemoveDeviceGroupCredentialsOperation removes the credentials of a device group from authx.
+	RemoveDeviceGroupCredentialsOperation RepairOperation = "remove_device_group_credentials"
+	// EnableDeviceCredentialsOperation enables the credentials of a device in authx.
+	EnableDeviceCredentialsOperation RepairOperation = "enable_device_credentials"
+)
+
+// RepairBaseDelay is the time to wait before the first retry of a repair task.
+const RepairBaseDelay = time.Minute
+
+// RepairMaxDelay is the maximum time between two retries of a repair task.
+const RepairMaxDelay = time.Hour
+
+// RepairTask contains an operation that could not be completed and must be retried in the background.
+type RepairTask struct {
+	// task identifier
+	TaskId string `json:"task_id,omitempty"`
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier, empty for device group operations
+	DeviceId string `json:"device_id,omitempty"`
+	// Operation to be executed
+	Operation RepairOperation `json:"operation,omitempty"`
+	// Created contains the timestamp when the task was queued
+	Created int64 `json:"created,omitempty"`
+	// Attempts is the number of failed executions
+	Attempts int32 `json:"attempts,omitempty"`
+	// LastError contains the error of the last execution
+	LastError string `json:"last_error,omitempty"`
+	// NextAttempt contains the timestamp of the next execution
+	NextAttempt int64 `json:"next_attempt,omitempty"`
+}
+
+// NewDeviceRepairTask creates a task that operates on a device.
+func NewDeviceRepairTask(operation RepairOperation, organizationID string, deviceGroupID string, deviceID string) *RepairTask {
+	return &RepairTask{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Operation:      operation,
+	}
+}
+
+// NewDeviceGroupRepairTask creates a task that operates on a device group.
+func NewDeviceGroupRepairTask(operation RepairOperation, organizationID string, deviceGroupID string) *RepairTask {
+	return &RepairTask{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		Operation:      operation,
+	}
+}
+
+// Queued prepares the task to be stored in the repair queue after a failure.
+func (t *RepairTask) Queued(cause error, now time.Time) {
+	t.TaskId = uuid.New().String()
+	t.Created = now.Unix()
+	t.Attempts = 0
+	t.NextAttempt = now.Unix()
+	if cause != nil {
+		t.LastError = cause.Error()
+	}
+}
+
+// Failed records a failed execution and schedules the next one with an exponential backoff.
+func (t *RepairTask) Failed(cause error, now time.Time) {
+	t.Attempts++
+	if cause != nil {
+		t.LastError = cause.Error()
+	}
+	delay := RepairBaseDelay
+	for i := int32(1); i < t.Attempts && delay < RepairMaxDelay; i++ {
+		delay = delay * 2
+	}
+	if delay > RepairMaxDelay {
+		delay = RepairMaxDelay
+	}
+	t.NextAttempt = now.Add(delay).Unix()
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"fmt"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+var _ = ginkgo.Describe("Repair tasks", func() {
+
+	ginkgo.It("should be executed as soon as they are queued", func() {
+		now := time.Now()
+		task := NewDeviceRepairTask(RemoveDeviceOperation, "org", "dg", "device")
+		task.Queued(fmt.Errorf("unavailable"), now)
+		gomega.Expect(task.TaskId).ShouldNot(gomega.BeEmpty())
+		gomega.Expect(task.NextAttempt).Should(gomega.Equal(now.Unix()))
+		gomega.Expect(task.LastError).Should(gomega.Equal("unavailable"))
+	})
+
+	ginkgo.It("should be retried with an exponential backoff", func() {
+		now := time.Now()
+		task := NewDeviceGroupRepairTask(RemoveDeviceGroupOperation, "org", "dg")
+		task.Queued(nil, now)
+		task.Failed(fmt.Errorf("unavailable"), now)
+		gomega.Expect(task.NextAttempt).Should(gomega.Equal(now.Add(RepairBaseDelay).Unix()))
+		task.Failed(fmt.Errorf("unavailable"), now)
+		gomega.Expect(task.NextAttempt).Should(gomega.Equal(now.Add(2 * RepairBaseDelay).Unix()))
+		for i := 0; i < 20; i++ {
+			task.Failed(fmt.Errorf("unavailable"), now)
+		}
+		gomega.Expect(task.NextAttempt).Should(gomega.Equal(now.Add(RepairMaxDelay).Unix()))
+		gomega.Expect(task.Attempts).Should(gomega.Equal(int32(22)))
+	})
+})
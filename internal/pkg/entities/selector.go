@@ -0,0 +1,248 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"fmt"
+	"github.com/nalej/derrors"
+	"strings"
+)
+
+// SelectorOperator defines the type of comparison of a selector requirement.
+type SelectorOperator int
+
+const (
+	// SelectorExists matches labels that contain the key.
+	SelectorExists SelectorOperator = iota
+	// SelectorDoesNotExist matches labels that do not contain the key.
+	SelectorDoesNotExist
+	// SelectorEquals matches labels where the key has the given value.
+	SelectorEquals
+	// SelectorNotEquals matches labels where the key is missing or has a different value.
+	SelectorNotEquals
+	// SelectorIn matches labels where the key has one of the given values.
+	SelectorIn
+	// SelectorNotIn matches labels where the key is missing or has none of the given values.
+	SelectorNotIn
+)
+
+// SelectorRequirement contains a single condition of a label selector.
+type SelectorRequirement struct {
+	// Key of the label
+	Key string
+	// Operator to apply
+	Operator SelectorOperator
+	// Values to compare with. Empty for SelectorExists and SelectorDoesNotExist.
+	Values []string
+}
+
+// Matches checks if a set of labels satisfies the requirement.
+func (r *SelectorRequirement) Matches(labels map[string]string) bool {
+	value, exists := labels[r.Key]
+	switch r.Operator {
+	case SelectorExists:
+		return exists
+	case SelectorDoesNotExist:
+		return !exists
+	case SelectorEquals, SelectorIn:
+		return exists && r.hasValue(value)
+	case SelectorNotEquals, SelectorNotIn:
+		return !exists || !r.hasValue(value)
+	}
+	return false
+}
+
+func (r *SelectorRequirement) hasValue(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// LabelSelector is a set of requirements that must be satisfied by the labels of an entity. The
+// syntax follows the Kubernetes label selectors: env=prod,tier in (edge,core),!deprecated
+type LabelSelector struct {
+	Requirements []SelectorRequirement
+}
+
+// Empty checks if the selector has no requirements, and therefore matches everything.
+func (s *LabelSelector) Empty() bool {
+	return s == nil || len(s.Requirements) == 0
+}
+
+// Matches checks if a set of labels satisfies all the requirements of the selector.
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	if s.Empty() {
+		return true
+	}
+	for _, r := range s.Requirements {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabelSelector parses a label selector expression. An empty expression produces a selector
+// that matches every set of labels.
+func ParseLabelSelector(expression string) (*LabelSelector, derrors.Error) {
+	selector := &LabelSelector{Requirements: make([]SelectorRequirement, 0)}
+	if strings.TrimSpace(expression) == "" {
+		return selector, nil
+	}
+	terms, err := splitSelectorTerms(expression)
+	if err != nil {
+		return nil, err
+	}
+	for _, term := range terms {
+		requirement, err := parseSelectorRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		selector.Requirements = append(selector.Requirements, *requirement)
+	}
+	return selector, nil
+}
+
+// splitSelectorTerms splits the expression by the commas that are not part of a set of values.
+func splitSelectorTerms(expression string) ([]string, derrors.Error) {
+	terms := make([]string, 0)
+	depth := 0
+	start := 0
+	for i, c := range expression {
+		switch c {
+		case '(':
+			depth++
+			if depth > 1 {
+				return nil, derrors.NewInvalidArgumentError("label selector contains nested parenthesis").WithParams(expression)
+			}
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, derrors.NewInvalidArgumentError("label selector contains unbalanced parenthesis").WithParams(expression)
+			}
+		case ',':
+			if depth == 0 {
+				terms = append(terms, strings.TrimSpace(expression[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, derrors.NewInvalidArgumentError("label selector contains unbalanced parenthesis").WithParams(expression)
+	}
+	terms = append(terms, strings.TrimSpace(expression[start:]))
+	for _, term := range terms {
+		if term == "" {
+			return nil, derrors.NewInvalidArgumentError("label selector contains an empty requirement").WithParams(expression)
+		}
+	}
+	return terms, nil
+}
+
+func parseSelectorRequirement(term string) (*SelectorRequirement, derrors.Error) {
+	if strings.HasPrefix(term, "!") {
+		key := strings.TrimSpace(term[1:])
+		if err := validSelectorKey(key); err != nil {
+			return nil, err
+		}
+		return &SelectorRequirement{Key: key, Operator: SelectorDoesNotExist}, nil
+	}
+	if index := strings.Index(term, "!="); index != -1 {
+		return newSelectorComparison(term[:index], SelectorNotEquals, term[index+2:])
+	}
+	if index := strings.Index(term, "=="); index != -1 {
+		return newSelectorComparison(term[:index], SelectorEquals, term[index+2:])
+	}
+	if index := strings.Index(term, "="); index != -1 {
+		return newSelectorComparison(term[:index], SelectorEquals, term[index+1:])
+	}
+	if open := strings.Index(term, "("); open != -1 {
+		return parseSelectorSet(term, open)
+	}
+	key := strings.TrimSpace(term)
+	if err := validSelectorKey(key); err != nil {
+		return nil, err
+	}
+	return &SelectorRequirement{Key: key, Operator: SelectorExists}, nil
+}
+
+func newSelectorComparison(key string, operator SelectorOperator, value string) (*SelectorRequirement, derrors.Error) {
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+	if err := validSelectorKey(key); err != nil {
+		return nil, err
+	}
+	if err := validSelectorValue(value); err != nil {
+		return nil, err
+	}
+	return &SelectorRequirement{Key: key, Operator: operator, Values: []string{value}}, nil
+}
+
+// parseSelectorSet parses the requirements with the form key in (v1,v2) and key notin (v1,v2).
+func parseSelectorSet(term string, open int) (*SelectorRequirement, derrors.Error) {
+	if !strings.HasSuffix(term, ")") {
+		return nil, derrors.NewInvalidArgumentError("set of values must end with a parenthesis").WithParams(term)
+	}
+	fields := strings.Fields(term[:open])
+	if len(fields) != 2 {
+		return nil, derrors.NewInvalidArgumentError("invalid set based requirement").WithParams(term)
+	}
+	var operator SelectorOperator
+	switch fields[1] {
+	case "in":
+		operator = SelectorIn
+	case "notin":
+		operator = SelectorNotIn
+	default:
+		return nil, derrors.NewInvalidArgumentError(fmt.Sprintf("unknown set operator %s", fields[1])).WithParams(term)
+	}
+	if err := validSelectorKey(fields[0]); err != nil {
+		return nil, err
+	}
+	values := make([]string, 0)
+	for _, value := range strings.Split(term[open+1:len(term)-1], ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, derrors.NewInvalidArgumentError("set of values contains an empty value").WithParams(term)
+		}
+		if err := validSelectorValue(value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return &SelectorRequirement{Key: fields[0], Operator: operator, Values: values}, nil
+}
+
+func validSelectorKey(key string) derrors.Error {
+	if key == "" {
+		return derrors.NewInvalidArgumentError("label selector key cannot be empty")
+	}
+	if strings.ContainsAny(key, " \t!=(),") {
+		return derrors.NewInvalidArgumentError("label selector key contains invalid characters").WithParams(key)
+	}
+	return nil
+}
+
+func validSelectorValue(value string) derrors.Error {
+	if strings.ContainsAny(value, " \t!=(),") {
+		return derrors.NewInvalidArgumentError("label selector value contains invalid characters").WithParams(value)
+	}
+	return nil
+}
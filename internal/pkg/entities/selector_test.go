@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Label selector", func() {
+
+	labels := map[string]string{"env": "prod", "tier": "edge"}
+
+	ginkgo.It("should match everything with an empty selector", func() {
+		selector, err := ParseLabelSelector("")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(selector.Matches(labels)).Should(gomega.BeTrue())
+		gomega.Expect(selector.Matches(nil)).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should support equality based requirements", func() {
+		selector, err := ParseLabelSelector("env=prod, tier==edge")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(selector.Requirements).Should(gomega.HaveLen(2))
+		gomega.Expect(selector.Matches(labels)).Should(gomega.BeTrue())
+
+		selector, err = ParseLabelSelector("env!=prod")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(selector.Matches(labels)).Should(gomega.BeFalse())
+		gomega.Expect(selector.Matches(map[string]string{})).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should support set based requirements", func() {
+		selector, err := ParseLabelSelector("tier in (edge, core),env notin (dev)")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(selector.Requirements).Should(gomega.HaveLen(2))
+		gomega.Expect(selector.Matches(labels)).Should(gomega.BeTrue())
+		gomega.Expect(selector.Matches(map[string]string{"tier": "cloud"})).Should(gomega.BeFalse())
+	})
+
+	ginkgo.It("should support existence requirements", func() {
+		selector, err := ParseLabelSelector("env,!deprecated")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(selector.Matches(labels)).Should(gomega.BeTrue())
+		gomega.Expect(selector.Matches(map[string]string{"env": "prod", "deprecated": "true"})).Should(gomega.BeFalse())
+	})
+
+	ginkgo.It("should reject malformed selectors", func() {
+		malformed := []string{"env=prod,", "tier in (edge", "tier in ()", "tier among (edge)", "=prod", "!", "tier in ((edge))"}
+		for _, expression := range malformed {
+			_, err := ParseLabelSelector(expression)
+			gomega.Expect(err).NotTo(gomega.Succeed(), expression)
+		}
+	})
+})
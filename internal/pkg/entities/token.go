@@ -0,0 +1,141 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// tokenSeparator separates the token identifier from the secret in the value given to the installers.
+const tokenSeparator = "."
+
+const invalidRegistrationToken = "registration token is not valid"
+
+// RegistrationToken contains a credential that allows to register devices in a device group without sharing the
+// device group API key. Only the hash of the secret is stored.
+type RegistrationToken struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// token identifier
+	TokenId string `json:"token_id,omitempty"`
+	// SecretHash contains the SHA-256 of the secret
+	SecretHash string `json:"secret_hash,omitempty"`
+	// Created contains the creation timestamp
+	Created int64 `json:"created,omitempty"`
+	// Expires contains the timestamp after which the token cannot be used
+	Expires int64 `json:"expires,omitempty"`
+	// MaxUses is the maximum number of devices that can be registered with the token, zero means unlimited
+	MaxUses int32 `json:"max_uses,omitempty"`
+	// Uses is the number of devices registered with the token
+	Uses int32 `json:"uses,omitempty"`
+	// DeviceIdPattern is a regular expression that the device identifiers must match, empty means any
+	DeviceIdPattern string `json:"device_id_pattern,omitempty"`
+	// Revoked indicates that the token cannot be used anymore
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// NewRegistrationToken creates a token for a device group. It returns the token and the value that must be given
+// to the installers, which is not stored.
+func NewRegistrationToken(request *grpc_device_manager_go.AddRegistrationTokenRequest) (*RegistrationToken, string, derrors.Error) {
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return nil, "", derrors.NewInternalError("cannot generate registration token", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+	token := &RegistrationToken{
+		OrganizationId:  request.OrganizationId,
+		DeviceGroupId:   request.DeviceGroupId,
+		TokenId:         uuid.New().String(),
+		SecretHash:      hashSecret(secret),
+		Created:         time.Now().Unix(),
+		Expires:         request.Expires,
+		MaxUses:         request.MaxUses,
+		DeviceIdPattern: request.DeviceIdPattern,
+	}
+	return token, fmt.Sprintf("%s%s%s", token.TokenId, tokenSeparator, secret), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseRegistrationToken splits the value given to the installers into the token identifier and the secret.
+func ParseRegistrationToken(value string) (string, string, derrors.Error) {
+	split := strings.SplitN(value, tokenSeparator, 2)
+	if len(split) != 2 || split[0] == "" || split[1] == "" {
+		return "", "", derrors.NewUnauthenticatedError(invalidRegistrationToken)
+	}
+	return split[0], split[1], nil
+}
+
+// CanRegister checks that the token allows to register a device with the given secret at a given time.
+func (t *RegistrationToken) CanRegister(secret string, deviceID string, now time.Time) derrors.Error {
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(t.SecretHash)) != 1 {
+		return derrors.NewUnauthenticatedError(invalidRegistrationToken)
+	}
+	if t.Revoked {
+		return derrors.NewUnauthenticatedError("registration token has been revoked").WithParams(t.TokenId)
+	}
+	if t.Expires <= now.Unix() {
+		return derrors.NewUnauthenticatedError("registration token has expired").WithParams(t.TokenId)
+	}
+	if t.MaxUses > 0 && t.Uses >= t.MaxUses {
+		return derrors.NewFailedPreconditionError("registration token has reached its maximum number of uses").WithParams(t.TokenId)
+	}
+	if t.DeviceIdPattern != "" {
+		matched, err := regexp.MatchString(anchorPattern(t.DeviceIdPattern), deviceID)
+		if err != nil || !matched {
+			return derrors.NewPermissionDeniedError("device_id is not allowed by the registration token").WithParams(deviceID)
+		}
+	}
+	return nil
+}
+
+// anchorPattern forces the pattern to match the whole device identifier.
+func anchorPattern(pattern string) string {
+	return fmt.Sprintf("^(?:%s)$", pattern)
+}
+
+// ToGRPC converts the token into its gRPC representation. The secret is never included.
+func (t *RegistrationToken) ToGRPC() *grpc_device_manager_go.RegistrationToken {
+	return &grpc_device_manager_go.RegistrationToken{
+		OrganizationId:  t.OrganizationId,
+		DeviceGroupId:   t.DeviceGroupId,
+		TokenId:         t.TokenId,
+		Created:         t.Created,
+		Expires:         t.Expires,
+		MaxUses:         t.MaxUses,
+		Uses:            t.Uses,
+		DeviceIdPattern: t.DeviceIdPattern,
+		Revoked:         t.Revoked,
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+var _ = ginkgo.Describe("Registration tokens", func() {
+
+	newToken := func(maxUses int32, pattern string) (*RegistrationToken, string) {
+		token, value, err := NewRegistrationToken(&grpc_device_manager_go.AddRegistrationTokenRequest{
+			OrganizationId:  "org",
+			DeviceGroupId:   "dg",
+			Expires:         time.Now().Add(time.Hour).Unix(),
+			MaxUses:         maxUses,
+			DeviceIdPattern: pattern,
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		tokenID, secret, err := ParseRegistrationToken(value)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(tokenID).Should(gomega.Equal(token.TokenId))
+		return token, secret
+	}
+
+	ginkgo.It("should not store the secret", func() {
+		token, secret := newToken(0, "")
+		gomega.Expect(token.SecretHash).ShouldNot(gomega.Equal(secret))
+		gomega.Expect(token.CanRegister(secret, "device", time.Now())).To(gomega.Succeed())
+		gomega.Expect(token.CanRegister("other", "device", time.Now())).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject malformed tokens", func() {
+		_, _, err := ParseRegistrationToken("no-separator")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should apply the limits of the token", func() {
+		token, secret := newToken(2, "sensor-[0-9]+")
+		gomega.Expect(token.CanRegister(secret, "sensor-1", time.Now())).To(gomega.Succeed())
+		gomega.Expect(token.CanRegister(secret, "camera-1", time.Now())).NotTo(gomega.Succeed())
+		gomega.Expect(token.CanRegister(secret, "sensor-1-extra", time.Now())).NotTo(gomega.Succeed())
+		gomega.Expect(token.CanRegister(secret, "sensor-1", time.Now().Add(2*time.Hour))).NotTo(gomega.Succeed())
+		token.Uses = 2
+		gomega.Expect(token.CanRegister(secret, "sensor-1", time.Now())).NotTo(gomega.Succeed())
+		token.Uses = 0
+		token.Revoked = true
+		gomega.Expect(token.CanRegister(secret, "sensor-1", time.Now())).NotTo(gomega.Succeed())
+	})
+})
@@ -0,0 +1,212 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"encoding/json"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-device-manager-go"
+	"reflect"
+)
+
+// MaxTwinDocumentSize is the maximum size in bytes of the desired and reported documents of a device twin.
+const MaxTwinDocumentSize = 32 * 1024
+
+// EmptyTwinDocument is the document of a twin that has not been set.
+const EmptyTwinDocument = "{}"
+
+// DeviceTwin contains the desired properties set by the operators for a device and the properties reported by
+// the device. Both documents are JSON objects with their own version, which is increased on every change.
+type DeviceTwin struct {
+	// organization identifier
+	OrganizationId string `json:"organization_id,omitempty"`
+	// device_group identifier
+	DeviceGroupId string `json:"device_group_id,omitempty"`
+	// device identifier
+	DeviceId string `json:"device_id,omitempty"`
+	// Desired properties document
+	Desired string `json:"desired,omitempty"`
+	// DesiredVersion is the version of the desired document
+	DesiredVersion int64 `json:"desired_version,omitempty"`
+	// DesiredUpdated is the timestamp of the last change of the desired document
+	DesiredUpdated int64 `json:"desired_updated,omitempty"`
+	// Reported properties document
+	Reported string `json:"reported,omitempty"`
+	// ReportedVersion is the version of the reported document
+	ReportedVersion int64 `json:"reported_version,omitempty"`
+	// ReportedUpdated is the timestamp of the last change of the reported document
+	ReportedUpdated int64 `json:"reported_updated,omitempty"`
+}
+
+// NewDeviceTwin creates the twin of a device with empty documents.
+func NewDeviceTwin(organizationID string, deviceGroupID string, deviceID string) *DeviceTwin {
+	return &DeviceTwin{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Desired:        EmptyTwinDocument,
+		Reported:       EmptyTwinDocument,
+	}
+}
+
+// ParseTwinDocument parses a twin document or a patch, which must be a JSON object.
+func ParseTwinDocument(document string) (map[string]interface{}, derrors.Error) {
+	if len(document) > MaxTwinDocumentSize {
+		return nil, derrors.NewInvalidArgumentError("twin document is too large").WithParams(len(document), MaxTwinDocumentSize)
+	}
+	return parseJSONObject("twin document", document)
+}
+
+// parseJSONObject parses a document that must be a JSON object.
+func parseJSONObject(name string, document string) (map[string]interface{}, derrors.Error) {
+	var result map[string]interface{}
+	err := json.Unmarshal([]byte(document), &result)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError(name+" is not a valid JSON object", err)
+	}
+	if result == nil {
+		return nil, derrors.NewInvalidArgumentError(name + " must be a JSON object")
+	}
+	return result, nil
+}
+
+// PatchDesired applies a JSON merge patch to the desired document. The version is only increased if the document
+// changes. It returns whether the document has changed.
+func (t *DeviceTwin) PatchDesired(patch string, timestamp int64) (bool, derrors.Error) {
+	document, changed, err := applyTwinPatch(t.Desired, patch)
+	if err != nil || !changed {
+		return false, err
+	}
+	t.Desired = document
+	t.DesiredVersion++
+	t.DesiredUpdated = timestamp
+	return true, nil
+}
+
+// PatchReported applies a JSON merge patch to the reported document. The version is only increased if the document
+// changes. It returns whether the document has changed.
+func (t *DeviceTwin) PatchReported(patch string, timestamp int64) (bool, derrors.Error) {
+	document, changed, err := applyTwinPatch(t.Reported, patch)
+	if err != nil || !changed {
+		return false, err
+	}
+	t.Reported = document
+	t.ReportedVersion++
+	t.ReportedUpdated = timestamp
+	return true, nil
+}
+
+// Delta returns the desired properties that are missing or have a different value in the reported document.
+func (t *DeviceTwin) Delta() (string, derrors.Error) {
+	desired, err := ParseTwinDocument(t.Desired)
+	if err != nil {
+		return "", err
+	}
+	reported, err := ParseTwinDocument(t.Reported)
+	if err != nil {
+		return "", err
+	}
+	delta, jErr := json.Marshal(twinDelta(desired, reported))
+	if jErr != nil {
+		return "", derrors.NewInternalError("cannot encode twin delta", jErr)
+	}
+	return string(delta), nil
+}
+
+func (t *DeviceTwin) ToGRPC() *grpc_device_manager_go.DeviceTwin {
+	delta, err := t.Delta()
+	if err != nil {
+		delta = EmptyTwinDocument
+	}
+	return &grpc_device_manager_go.DeviceTwin{
+		OrganizationId:  t.OrganizationId,
+		DeviceGroupId:   t.DeviceGroupId,
+		DeviceId:        t.DeviceId,
+		Desired:         t.Desired,
+		DesiredVersion:  t.DesiredVersion,
+		DesiredUpdated:  t.DesiredUpdated,
+		Reported:        t.Reported,
+		ReportedVersion: t.ReportedVersion,
+		ReportedUpdated: t.ReportedUpdated,
+		Delta:           delta,
+	}
+}
+
+// applyTwinPatch applies a JSON merge patch (RFC 7386) to a document: the properties of the patch replace those
+// of the document, objects are merged recursively and null values remove the property.
+func applyTwinPatch(document string, patch string) (string, bool, derrors.Error) {
+	current, err := ParseTwinDocument(document)
+	if err != nil {
+		return "", false, err
+	}
+	changes, err := ParseTwinDocument(patch)
+	if err != nil {
+		return "", false, err
+	}
+	merged := mergeJSONPatch(current, changes)
+	original, _ := ParseTwinDocument(document)
+	if reflect.DeepEqual(original, merged) {
+		return document, false, nil
+	}
+	result, jErr := json.Marshal(merged)
+	if jErr != nil {
+		return "", false, derrors.NewInternalError("cannot encode twin document", jErr)
+	}
+	if len(result) > MaxTwinDocumentSize {
+		return "", false, derrors.NewInvalidArgumentError("twin document is too large").WithParams(len(result), MaxTwinDocumentSize)
+	}
+	return string(result), true, nil
+}
+
+// mergeJSONPatch applies a JSON merge patch to a parsed document.
+func mergeJSONPatch(target map[string]interface{}, patch map[string]interface{}) map[string]interface{} {
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		if patchObject, ok := value.(map[string]interface{}); ok {
+			targetObject, ok := target[key].(map[string]interface{})
+			if !ok {
+				targetObject = make(map[string]interface{}, 0)
+			}
+			target[key] = mergeJSONPatch(targetObject, patchObject)
+			continue
+		}
+		target[key] = value
+	}
+	return target
+}
+
+func twinDelta(desired map[string]interface{}, reported map[string]interface{}) map[string]interface{} {
+	delta := make(map[string]interface{}, 0)
+	for key, value := range desired {
+		desiredObject, isObject := value.(map[string]interface{})
+		reportedObject, reportedIsObject := reported[key].(map[string]interface{})
+		if isObject && reportedIsObject {
+			nested := twinDelta(desiredObject, reportedObject)
+			if len(nested) > 0 {
+				delta[key] = nested
+			}
+			continue
+		}
+		if !reflect.DeepEqual(value, reported[key]) {
+			delta[key] = value
+		}
+	}
+	return delta
+}
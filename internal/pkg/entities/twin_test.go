@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = ginkgo.Describe("Device twin", func() {
+
+	ginkgo.It("should only accept JSON objects", func() {
+		_, err := ParseTwinDocument(`{"fan": {"speed": 3}}`)
+		gomega.Expect(err).To(gomega.Succeed())
+		for _, document := range []string{`[1, 2]`, `"on"`, `null`, `{"fan":`} {
+			_, err = ParseTwinDocument(document)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		}
+		_, err = ParseTwinDocument(`{"data": "` + strings.Repeat("x", MaxTwinDocumentSize) + `"}`)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should merge patches and remove null properties", func() {
+		twin := NewDeviceTwin("org", "dg", "device")
+		changed, err := twin.PatchDesired(`{"fan": {"speed": 3, "mode": "auto"}, "led": true}`, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(changed).To(gomega.BeTrue())
+		changed, err = twin.PatchDesired(`{"fan": {"mode": null}, "led": null}`, 20)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(changed).To(gomega.BeTrue())
+		gomega.Expect(twin.Desired).Should(gomega.MatchJSON(`{"fan": {"speed": 3}}`))
+		gomega.Expect(twin.DesiredVersion).Should(gomega.Equal(int64(2)))
+		gomega.Expect(twin.DesiredUpdated).Should(gomega.Equal(int64(20)))
+		gomega.Expect(twin.ReportedVersion).Should(gomega.Equal(int64(0)))
+	})
+
+	ginkgo.It("should not change the version if the patch does not change the document", func() {
+		twin := NewDeviceTwin("org", "dg", "device")
+		_, err := twin.PatchReported(`{"firmware": "1.0"}`, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		changed, err := twin.PatchReported(`{"firmware": "1.0", "missing": null}`, 20)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(changed).To(gomega.BeFalse())
+		gomega.Expect(twin.ReportedVersion).Should(gomega.Equal(int64(1)))
+		gomega.Expect(twin.ReportedUpdated).Should(gomega.Equal(int64(10)))
+	})
+
+	ginkgo.It("should compute the delta between the desired and reported documents", func() {
+		twin := NewDeviceTwin("org", "dg", "device")
+		_, err := twin.PatchDesired(`{"fan": {"speed": 3, "mode": "auto"}, "firmware": "2.0", "led": true}`, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = twin.PatchReported(`{"fan": {"speed": 3, "mode": "manual"}, "firmware": "1.0", "led": true, "uptime": 10}`, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		delta, err := twin.Delta()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(delta).Should(gomega.MatchJSON(`{"fan": {"mode": "auto"}, "firmware": "2.0"}`))
+		gomega.Expect(twin.ToGRPC().Delta).Should(gomega.MatchJSON(delta))
+	})
+})
@@ -22,6 +22,8 @@ import (
 	"github.com/nalej/grpc-device-go"
 	"github.com/nalej/grpc-device-manager-go"
 	"github.com/nalej/grpc-organization-go"
+	"regexp"
+	"time"
 )
 
 const emptyOrganizationId = "organization_id cannot be empty"
@@ -32,6 +34,29 @@ const emptyDeviceGroupApiKey = "device_group_api_key cannot be empty"
 const emptyLabels = "labels cannot be empty"
 const invalidLatency = "latency cannot be less than zero"
 const emptyLocation = "location cannot be empty"
+const invalidPageSize = "page_size cannot be less than zero"
+const invalidPageToken = "page_token is not valid"
+const invalidSortField = "sort_by field is not supported"
+const emptyBulkTarget = "either device_ids or label_selector must be set"
+const emptyRegistrationCredentials = "either device_group_api_key or registration_token must be set"
+const emptyTokenId = "token_id cannot be empty"
+const emptyAttributes = "attributes cannot be empty"
+const emptyAttributeNames = "names cannot be empty"
+const invalidLimit = "limit cannot be less than zero"
+const emptyGeofenceId = "geofence_id cannot be empty"
+const emptyAssetInfoUpdate = "at least one of update_os, update_hardware, update_storage or update_network must be set"
+const emptyDeviceApiKey = "device_api_key cannot be empty"
+const emptyTwinPatch = "patch cannot be empty"
+const emptyCommandId = "command_id cannot be empty"
+const emptyCommandName = "name cannot be empty"
+const emptyConfigContent = "content cannot be empty"
+const invalidConfigVersion = "version must be greater than zero"
+const emptyArtifact = "artifact cannot be empty"
+const emptyCampaignId = "campaign_id cannot be empty"
+const emptyMetricSamples = "samples cannot be empty"
+const auditDeviceWithoutGroup = "device_group_id must be set to filter by device_id"
+const emptyDynamicGroupId = "dynamic_group_id cannot be empty"
+const emptyDynamicGroupCriteria = "at least one of label_selector, attribute_filter or filter_by_status must be set"
 
 func ValidOrganizationID(organizationID *grpc_organization_go.OrganizationId) derrors.Error {
 	if organizationID.OrganizationId == "" {
@@ -70,7 +95,7 @@ func ValidAddDeviceGroupRequest(request *grpc_device_manager_go.AddDeviceGroupRe
 	if request.Name == "" {
 		return derrors.NewInvalidArgumentError(emptyName)
 	}
-	return nil
+	return ValidLabels(request.Labels)
 }
 
 func ValidUpdateDeviceGroupRequest(request *grpc_device_manager_go.UpdateDeviceGroupRequest) derrors.Error {
@@ -93,13 +118,187 @@ func ValidRegisterDeviceRequest(request *grpc_device_manager_go.RegisterDeviceRe
 	if request.DeviceGroupId == "" {
 		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
 	}
-	if request.DeviceGroupApiKey == "" {
-		return derrors.NewInvalidArgumentError(emptyDeviceGroupApiKey)
+	if request.DeviceGroupApiKey == "" && request.RegistrationToken == "" {
+		return derrors.NewInvalidArgumentError(emptyRegistrationCredentials)
 	}
 	if request.DeviceId == "" {
 		return derrors.NewInvalidArgumentError(emptyDeviceId)
 	}
 
+	return ValidLabels(request.Labels)
+}
+
+func ValidAddRegistrationTokenRequest(request *grpc_device_manager_go.AddRegistrationTokenRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.Expires <= time.Now().Unix() {
+		return derrors.NewInvalidArgumentError("expires must be in the future")
+	}
+	if request.MaxUses < 0 {
+		return derrors.NewInvalidArgumentError("max_uses cannot be less than zero")
+	}
+	if request.DeviceIdPattern != "" {
+		_, err := regexp.Compile(anchorPattern(request.DeviceIdPattern))
+		if err != nil {
+			return derrors.NewInvalidArgumentError("device_id_pattern is not a valid regular expression", err)
+		}
+	}
+	return nil
+}
+
+func ValidRegistrationTokenId(tokenID *grpc_device_manager_go.RegistrationTokenId) derrors.Error {
+	if tokenID.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if tokenID.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if tokenID.TokenId == "" {
+		return derrors.NewInvalidArgumentError(emptyTokenId)
+	}
+	return nil
+}
+
+func ValidListDevicesRequest(request *grpc_device_manager_go.ListDevicesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.PageSize < 0 {
+		return derrors.NewInvalidArgumentError(invalidPageSize)
+	}
+	err := ValidSortField(request.SortBy, DeviceSortFields)
+	if err != nil {
+		return err
+	}
+	_, err = ParseLabelSelector(request.LabelSelector)
+	if err != nil {
+		return err
+	}
+	_, err = ParseAttributeFilter(request.AttributeFilter)
+	return err
+}
+
+func ValidListOrganizationDevicesRequest(request *grpc_device_manager_go.ListOrganizationDevicesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.PageSize < 0 {
+		return derrors.NewInvalidArgumentError(invalidPageSize)
+	}
+	err := ValidSortField(request.SortBy, DeviceSortFields)
+	if err != nil {
+		return err
+	}
+	_, err = ParseLabelSelector(request.LabelSelector)
+	if err != nil {
+		return err
+	}
+	_, err = ParseAttributeFilter(request.AttributeFilter)
+	return err
+}
+
+func ValidListDeviceGroupsRequest(request *grpc_device_manager_go.ListDeviceGroupsRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.PageSize < 0 {
+		return derrors.NewInvalidArgumentError(invalidPageSize)
+	}
+	return ValidSortField(request.SortBy, DeviceGroupSortFields)
+}
+
+func ValidSearchDevicesRequest(request *grpc_device_manager_go.SearchDevicesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.PageSize < 0 {
+		return derrors.NewInvalidArgumentError(invalidPageSize)
+	}
+	err := ValidSortField(request.SortBy, DeviceSortFields)
+	if err != nil {
+		return err
+	}
+	_, err = ParseLabelSelector(request.LabelSelector)
+	return err
+}
+
+func ValidBulkDeviceOperationRequest(request *grpc_device_manager_go.BulkDeviceOperationRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if len(request.DeviceIds) == 0 && request.LabelSelector == "" {
+		return derrors.NewInvalidArgumentError(emptyBulkTarget)
+	}
+	if len(request.DeviceIds) > 0 && request.LabelSelector != "" {
+		return derrors.NewInvalidArgumentError("device_ids and label_selector cannot be set at the same time")
+	}
+	for _, deviceID := range request.DeviceIds {
+		if deviceID == "" {
+			return derrors.NewInvalidArgumentError(emptyDeviceId)
+		}
+	}
+	_, err := ParseLabelSelector(request.LabelSelector)
+	if err != nil {
+		return err
+	}
+	switch request.Operation {
+	case grpc_device_manager_go.BulkOperation_ADD_LABELS:
+		if len(request.Labels) == 0 {
+			return derrors.NewInvalidArgumentError(emptyLabels)
+		}
+		return ValidLabels(request.Labels)
+	case grpc_device_manager_go.BulkOperation_REMOVE_LABELS:
+		if len(request.Labels) == 0 {
+			return derrors.NewInvalidArgumentError(emptyLabels)
+		}
+	case grpc_device_manager_go.BulkOperation_UPDATE_LOCATION:
+		if request.Location == nil || request.Location.Geolocation == "" {
+			return derrors.NewInvalidArgumentError(emptyLocation)
+		}
+		_, err := ParseGeolocation(request.Location.Geolocation)
+		return err
+	}
+	return nil
+}
+
+func ValidImportDevicesRequest(request *grpc_device_manager_go.ImportDevicesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceGroupApiKey == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupApiKey)
+	}
+	if len(request.Content) == 0 {
+		return derrors.NewInvalidArgumentError("content cannot be empty")
+	}
+	return nil
+}
+
+func ValidExportDevicesRequest(request *grpc_device_manager_go.ExportDevicesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	_, err := ParseLabelSelector(request.LabelSelector)
+	return err
+}
+
+func ValidReconcileRequest(request *grpc_device_manager_go.ReconcileRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
 	return nil
 }
 
@@ -120,6 +319,23 @@ func ValidDeviceLabelRequest(request *grpc_device_manager_go.DeviceLabelRequest)
 	return nil
 }
 
+// ValidAddDeviceLabelRequest checks the labels to add to a device. Labels are not checked when they are removed, so
+// that labels created before the validation rules can still be removed.
+func ValidAddDeviceLabelRequest(request *grpc_device_manager_go.DeviceLabelRequest) derrors.Error {
+	err := ValidDeviceLabelRequest(request)
+	if err != nil {
+		return err
+	}
+	return ValidLabels(request.Labels)
+}
+
+func ValidLabelPolicy(policy *grpc_device_manager_go.LabelPolicy) derrors.Error {
+	if policy.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	return nil
+}
+
 func ValidUpdateDeviceRequest(request *grpc_device_manager_go.UpdateDeviceRequest) derrors.Error {
 	if request.OrganizationId == "" {
 		return derrors.NewInvalidArgumentError(emptyOrganizationId)
@@ -144,10 +360,447 @@ func ValidUpdateDeviceLocationRequest(request *grpc_device_manager_go.UpdateDevi
 	if request.DeviceId == "" {
 		return derrors.NewInvalidArgumentError(emptyDeviceId)
 	}
-	if request.Location != nil && request.Location.Geolocation == "" {
-		return derrors.NewInvalidArgumentError(emptyLocation)
+	if request.Location != nil {
+		if request.Location.Geolocation == "" {
+			return derrors.NewInvalidArgumentError(emptyLocation)
+		}
+		_, err := ParseGeolocation(request.Location.Geolocation)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ValidListDevicesInRadiusRequest(request *grpc_device_manager_go.ListDevicesInRadiusRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.Limit < 0 {
+		return derrors.NewInvalidArgumentError(invalidLimit)
+	}
+	_, err := NewCircle(request.Center, request.RadiusMeters)
+	return err
+}
+
+func ValidListDevicesInBoundingBoxRequest(request *grpc_device_manager_go.ListDevicesInBoundingBoxRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.Limit < 0 {
+		return derrors.NewInvalidArgumentError(invalidLimit)
+	}
+	_, err := NewBoundingBox(request.SouthWest, request.NorthEast)
+	return err
+}
+
+func ValidListDevicesInPolygonRequest(request *grpc_device_manager_go.ListDevicesInPolygonRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.Limit < 0 {
+		return derrors.NewInvalidArgumentError(invalidLimit)
+	}
+	_, err := NewPolygon(request.Vertices)
+	return err
+}
+
+func ValidLocationHistoryRequest(request *grpc_device_manager_go.LocationHistoryRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if request.Limit < 0 {
+		return derrors.NewInvalidArgumentError(invalidLimit)
+	}
+	_, err := NewTimeRange(request.From, request.To)
+	return err
+}
+
+func ValidAddGeofenceRequest(request *grpc_device_manager_go.AddGeofenceRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.Name == "" {
+		return derrors.NewInvalidArgumentError(emptyName)
+	}
+	_, err := NewGeofence(request)
+	return err
+}
+
+func ValidGeofenceId(geofenceID *grpc_device_manager_go.GeofenceId) derrors.Error {
+	if geofenceID.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if geofenceID.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if geofenceID.GeofenceId == "" {
+		return derrors.NewInvalidArgumentError(emptyGeofenceId)
+	}
+	return nil
+}
+
+func ValidGeofenceEventsRequest(request *grpc_device_manager_go.GeofenceEventsRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.Limit < 0 {
+		return derrors.NewInvalidArgumentError(invalidLimit)
+	}
+	_, err := NewTimeRange(request.From, request.To)
+	return err
+}
+
+func ValidUpdateDeviceAssetInfoRequest(request *grpc_device_manager_go.UpdateDeviceAssetInfoRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if !request.UpdateOs && !request.UpdateHardware && !request.UpdateStorage && !request.UpdateNetwork {
+		return derrors.NewInvalidArgumentError(emptyAssetInfoUpdate)
+	}
+	return nil
+}
+
+func ValidAssetInfoHistoryRequest(request *grpc_device_manager_go.AssetInfoHistoryRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if request.Limit < 0 {
+		return derrors.NewInvalidArgumentError(invalidLimit)
+	}
+	_, err := NewTimeRange(request.From, request.To)
+	return err
+}
+
+func ValidPatchDesiredStateRequest(request *grpc_device_manager_go.PatchDesiredStateRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if request.Patch == "" {
+		return derrors.NewInvalidArgumentError(emptyTwinPatch)
+	}
+	_, err := ParseTwinDocument(request.Patch)
+	return err
+}
+
+func ValidReportDeviceStateRequest(request *grpc_device_manager_go.ReportDeviceStateRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if request.DeviceApiKey == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceApiKey)
+	}
+	if request.Patch == "" {
+		return derrors.NewInvalidArgumentError(emptyTwinPatch)
+	}
+	_, err := ParseTwinDocument(request.Patch)
+	return err
+}
+
+func ValidEnqueueCommandRequest(request *grpc_device_manager_go.EnqueueCommandRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if len(request.DeviceIds) > 0 && request.LabelSelector != "" {
+		return derrors.NewInvalidArgumentError("device_ids and label_selector cannot be set at the same time")
+	}
+	for _, deviceID := range request.DeviceIds {
+		if deviceID == "" {
+			return derrors.NewInvalidArgumentError(emptyDeviceId)
+		}
+	}
+	_, err := ParseLabelSelector(request.LabelSelector)
+	if err != nil {
+		return err
+	}
+	if request.Name == "" {
+		return derrors.NewInvalidArgumentError(emptyCommandName)
+	}
+	if len(request.Payload) > MaxCommandPayloadSize {
+		return derrors.NewInvalidArgumentError("payload is too large").WithParams(len(request.Payload), MaxCommandPayloadSize)
+	}
+	if request.Ttl < 0 || time.Duration(request.Ttl)*time.Second > MaxCommandTTL {
+		return derrors.NewInvalidArgumentError("ttl is not valid").WithParams(request.Ttl, MaxCommandTTL.String())
+	}
+	return nil
+}
+
+func ValidCommandId(commandID *grpc_device_manager_go.CommandId) derrors.Error {
+	if commandID.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if commandID.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if commandID.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if commandID.CommandId == "" {
+		return derrors.NewInvalidArgumentError(emptyCommandId)
+	}
+	return nil
+}
+
+func ValidPollCommandsRequest(request *grpc_device_manager_go.PollCommandsRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if request.DeviceApiKey == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceApiKey)
+	}
+	if request.Limit < 0 {
+		return derrors.NewInvalidArgumentError(invalidLimit)
+	}
+	return nil
+}
+
+func ValidAcknowledgeCommandRequest(request *grpc_device_manager_go.AcknowledgeCommandRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if request.DeviceApiKey == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceApiKey)
+	}
+	if request.CommandId == "" {
+		return derrors.NewInvalidArgumentError(emptyCommandId)
+	}
+	return nil
+}
+
+func ValidPublishConfigRequest(request *grpc_device_manager_go.PublishConfigRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.Content == "" {
+		return derrors.NewInvalidArgumentError(emptyConfigContent)
+	}
+	_, err := ParseConfigDocument(request.Content)
+	if err != nil {
+		return err
+	}
+	if len(request.Overlays) > MaxConfigOverlays {
+		return derrors.NewInvalidArgumentError("too many overlays").WithParams(len(request.Overlays), MaxConfigOverlays)
+	}
+	for _, overlay := range request.Overlays {
+		if overlay.LabelSelector == "" {
+			return derrors.NewInvalidArgumentError("overlay label_selector cannot be empty")
+		}
+		_, err = ParseLabelSelector(overlay.LabelSelector)
+		if err != nil {
+			return err
+		}
+		_, err = ParseConfigDocument(overlay.Content)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidConfigVersionId(versionID *grpc_device_manager_go.ConfigVersionId) derrors.Error {
+	if versionID.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if versionID.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if versionID.Version <= 0 {
+		return derrors.NewInvalidArgumentError(invalidConfigVersion)
+	}
+	return nil
+}
+
+func ValidGetEffectiveConfigRequest(request *grpc_device_manager_go.GetEffectiveConfigRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if request.DeviceApiKey == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceApiKey)
+	}
+	return nil
+}
+
+func ValidAcknowledgeConfigRequest(request *grpc_device_manager_go.AcknowledgeConfigRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if request.DeviceApiKey == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceApiKey)
 	}
+	if request.Version <= 0 {
+		return derrors.NewInvalidArgumentError(invalidConfigVersion)
+	}
+	return nil
+}
 
+func ValidCreateCampaignRequest(request *grpc_device_manager_go.CreateCampaignRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.Artifact == "" {
+		return derrors.NewInvalidArgumentError(emptyArtifact)
+	}
+	_, err := ParseLabelSelector(request.LabelSelector)
+	if err != nil {
+		return err
+	}
+	if request.BatchSize < 0 {
+		return derrors.NewInvalidArgumentError("batch_size cannot be less than zero")
+	}
+	if request.BatchSize > 0 && len(request.BatchPercentages) > 0 {
+		return derrors.NewInvalidArgumentError("batch_size and batch_percentages cannot be set at the same time")
+	}
+	previous := int32(0)
+	for _, p := range request.BatchPercentages {
+		if p <= previous || p > 100 {
+			return derrors.NewInvalidArgumentError("batch_percentages must be increasing percentages").WithParams(request.BatchPercentages)
+		}
+		previous = p
+	}
+	if request.MaxOfflinePercentage < 0 || request.MaxOfflinePercentage > 100 {
+		return derrors.NewInvalidArgumentError("max_offline_percentage is not valid").WithParams(request.MaxOfflinePercentage)
+	}
+	if request.MaxLatency < 0 {
+		return derrors.NewInvalidArgumentError(invalidLatency)
+	}
+	if request.ObservationPeriod < 0 {
+		return derrors.NewInvalidArgumentError("observation_period cannot be less than zero")
+	}
+	if request.UpdateTimeout < 0 || time.Duration(request.UpdateTimeout)*time.Second > MaxCommandTTL {
+		return derrors.NewInvalidArgumentError("update_timeout is not valid").WithParams(request.UpdateTimeout, MaxCommandTTL.String())
+	}
+	return nil
+}
+
+func ValidCampaignId(campaignID *grpc_device_manager_go.CampaignId) derrors.Error {
+	if campaignID.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if campaignID.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if campaignID.CampaignId == "" {
+		return derrors.NewInvalidArgumentError(emptyCampaignId)
+	}
+	return nil
+}
+
+func ValidSetDeviceAttributesRequest(request *grpc_device_manager_go.SetDeviceAttributesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if len(request.Attributes) == 0 {
+		return derrors.NewInvalidArgumentError(emptyAttributes)
+	}
+	return nil
+}
+
+func ValidRemoveDeviceAttributesRequest(request *grpc_device_manager_go.RemoveDeviceAttributesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if len(request.Names) == 0 {
+		return derrors.NewInvalidArgumentError(emptyAttributeNames)
+	}
+	return nil
+}
+
+func ValidAttributeDefinition(definition *grpc_device_manager_go.AttributeDefinition) derrors.Error {
+	if definition.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	return ValidAttributeName(definition.Name)
+}
+
+func ValidAttributeDefinitionId(definitionID *grpc_device_manager_go.AttributeDefinitionId) derrors.Error {
+	if definitionID.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if definitionID.Name == "" {
+		return derrors.NewInvalidArgumentError(emptyName)
+	}
 	return nil
 }
 
@@ -166,3 +819,203 @@ func ValidRegisterLatencyRequest(request *grpc_device_controller_go.RegisterLate
 	}
 	return nil
 }
+
+func ValidRegisterHeartbeatRequest(request *grpc_device_manager_go.RegisterHeartbeatRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if request.Latency <= 0 {
+		return derrors.NewInvalidArgumentError(invalidLatency)
+	}
+	return ValidHealthMetrics(request.Metrics)
+}
+
+func ValidHeartbeatHistoryRequest(request *grpc_device_manager_go.HeartbeatHistoryRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if request.Limit < 0 {
+		return derrors.NewInvalidArgumentError(invalidLimit)
+	}
+	_, err := NewTimeRange(request.From, request.To)
+	return err
+}
+
+func ValidAddMetricSamplesRequest(request *grpc_device_manager_go.AddMetricSamplesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	if len(request.Samples) == 0 {
+		return derrors.NewInvalidArgumentError(emptyMetricSamples)
+	}
+	return ValidMetricValues(request.Samples)
+}
+
+func ValidMetricSamplesRequest(request *grpc_device_manager_go.MetricSamplesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	err := ValidMetricName(request.Name)
+	if err != nil {
+		return err
+	}
+	if request.Limit < 0 {
+		return derrors.NewInvalidArgumentError(invalidLimit)
+	}
+	_, err = NewTimeRange(request.From, request.To)
+	return err
+}
+
+func ValidLastMetricValuesRequest(request *grpc_device_manager_go.LastMetricValuesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceGroupId)
+	}
+	if request.DeviceId == "" {
+		return derrors.NewInvalidArgumentError(emptyDeviceId)
+	}
+	for _, name := range request.Names {
+		err := ValidMetricName(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidAuditEntriesRequest(request *grpc_device_manager_go.AuditEntriesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DeviceId != "" && request.DeviceGroupId == "" {
+		return derrors.NewInvalidArgumentError(auditDeviceWithoutGroup)
+	}
+	if request.Limit < 0 {
+		return derrors.NewInvalidArgumentError(invalidLimit)
+	}
+	_, err := NewTimeRange(request.From, request.To)
+	return err
+}
+
+// validDynamicGroupDefinition checks the name and the criteria of a dynamic group. At least one criterion is required,
+// so a dynamic group never contains all the devices of an organization by mistake.
+func validDynamicGroupDefinition(name string, labelSelector string, attributeFilter string, filterByStatus bool,
+	status grpc_device_manager_go.DeviceStatus) derrors.Error {
+	if name == "" {
+		return derrors.NewInvalidArgumentError(emptyName)
+	}
+	if labelSelector == "" && attributeFilter == "" && !filterByStatus {
+		return derrors.NewInvalidArgumentError(emptyDynamicGroupCriteria)
+	}
+	_, err := ParseLabelSelector(labelSelector)
+	if err != nil {
+		return err
+	}
+	_, err = ParseAttributeFilter(attributeFilter)
+	if err != nil {
+		return err
+	}
+	if _, exists := grpc_device_manager_go.DeviceStatus_name[int32(status)]; filterByStatus && !exists {
+		return derrors.NewInvalidArgumentError("unknown device status").WithParams(status)
+	}
+	return nil
+}
+
+func ValidAddDynamicGroupRequest(request *grpc_device_manager_go.AddDynamicGroupRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	return validDynamicGroupDefinition(request.Name, request.LabelSelector, request.AttributeFilter,
+		request.FilterByStatus, request.DeviceStatus)
+}
+
+func ValidUpdateDynamicGroupRequest(request *grpc_device_manager_go.UpdateDynamicGroupRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DynamicGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDynamicGroupId)
+	}
+	return validDynamicGroupDefinition(request.Name, request.LabelSelector, request.AttributeFilter,
+		request.FilterByStatus, request.DeviceStatus)
+}
+
+func ValidDynamicGroupId(dynamicGroupID *grpc_device_manager_go.DynamicGroupId) derrors.Error {
+	if dynamicGroupID.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if dynamicGroupID.DynamicGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDynamicGroupId)
+	}
+	return nil
+}
+
+func ValidListDynamicGroupDevicesRequest(request *grpc_device_manager_go.ListDynamicGroupDevicesRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DynamicGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDynamicGroupId)
+	}
+	if request.PageSize < 0 {
+		return derrors.NewInvalidArgumentError(invalidPageSize)
+	}
+	return ValidSortField(request.SortBy, DeviceSortFields)
+}
+
+// ValidDynamicGroupBulkOperationRequest checks a bulk operation on the members of a dynamic group. Dynamic groups
+// never change the credentials of their members, so only the label and location operations are supported.
+func ValidDynamicGroupBulkOperationRequest(request *grpc_device_manager_go.DynamicGroupBulkOperationRequest) derrors.Error {
+	if request.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError(emptyOrganizationId)
+	}
+	if request.DynamicGroupId == "" {
+		return derrors.NewInvalidArgumentError(emptyDynamicGroupId)
+	}
+	switch request.Operation {
+	case grpc_device_manager_go.BulkOperation_ADD_LABELS:
+		if len(request.Labels) == 0 {
+			return derrors.NewInvalidArgumentError(emptyLabels)
+		}
+		return ValidLabels(request.Labels)
+	case grpc_device_manager_go.BulkOperation_REMOVE_LABELS:
+		if len(request.Labels) == 0 {
+			return derrors.NewInvalidArgumentError(emptyLabels)
+		}
+	case grpc_device_manager_go.BulkOperation_UPDATE_LOCATION:
+		if request.Location == nil || request.Location.Geolocation == "" {
+			return derrors.NewInvalidArgumentError(emptyLocation)
+		}
+		_, err := ParseGeolocation(request.Location.Geolocation)
+		return err
+	default:
+		return derrors.NewInvalidArgumentError("bulk operation is not supported on dynamic groups").WithParams(request.Operation.String())
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package approval
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// policies indexed by organization_id + device_group_id
+	policies map[string]*entities.ApprovalPolicy
+	// pending registrations indexed by organization_id + device_group_id, device_id
+	pending map[string]map[string]*entities.PendingDevice
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		policies: make(map[string]*entities.ApprovalPolicy, 0),
+		pending:  make(map[string]map[string]*entities.PendingDevice, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string) string {
+	return organizationID + "/" + deviceGroupID
+}
+
+func (m *MockupProvider) SetApprovalPolicy(policy entities.ApprovalPolicy) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.policies[m.getKey(policy.OrganizationId, policy.DeviceGroupId)] = &policy
+	return nil
+}
+
+func (m *MockupProvider) GetApprovalPolicy(organizationID string, deviceGroupID string) (*entities.ApprovalPolicy, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	policy, exists := m.policies[m.getKey(organizationID, deviceGroupID)]
+	if !exists {
+		return &entities.ApprovalPolicy{OrganizationId: organizationID, DeviceGroupId: deviceGroupID}, nil
+	}
+	return policy, nil
+}
+
+func (m *MockupProvider) RemoveApprovalPolicy(organizationID string, deviceGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.policies, m.getKey(organizationID, deviceGroupID))
+	return nil
+}
+
+func (m *MockupProvider) AddPendingDevice(pending entities.PendingDevice) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(pending.OrganizationId, pending.DeviceGroupId)
+	group, exists := m.pending[key]
+	if !exists {
+		group = make(map[string]*entities.PendingDevice, 0)
+		m.pending[key] = group
+	}
+	group[pending.DeviceId] = &pending
+	return nil
+}
+
+func (m *MockupProvider) GetPendingDevice(organizationID string, deviceGroupID string, deviceID string) (*entities.PendingDevice, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	pending, exists := m.pending[m.getKey(organizationID, deviceGroupID)][deviceID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("pending device").WithParams(organizationID, deviceGroupID, deviceID)
+	}
+	return pending, nil
+}
+
+func (m *MockupProvider) ExistsPendingDevice(organizationID string, deviceGroupID string, deviceID string) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	_, exists := m.pending[m.getKey(organizationID, deviceGroupID)][deviceID]
+	return exists, nil
+}
+
+func (m *MockupProvider) ListPendingDevices(organizationID string, deviceGroupID string) ([]*entities.PendingDevice, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.PendingDevice, 0)
+	for _, pending := range m.pending[m.getKey(organizationID, deviceGroupID)] {
+		result = append(result, pending)
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) ListExpiredPendingDevices(timestamp int64) ([]*entities.PendingDevice, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.PendingDevice, 0)
+	for _, group := range m.pending {
+		for _, pending := range group {
+			if pending.Expires <= timestamp {
+				result = append(result, pending)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) RemovePendingDevice(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(organizationID, deviceGroupID)
+	if _, exists := m.pending[key][deviceID]; !exists {
+		return derrors.NewNotFoundError("pending device").WithParams(organizationID, deviceGroupID, deviceID)
+	}
+	delete(m.pending[key], deviceID)
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package approval
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the registration approval workflow.
+type Provider interface {
+	// SetApprovalPolicy adds or replaces the approval policy of a device group
+	SetApprovalPolicy(policy entities.ApprovalPolicy) derrors.Error
+
+	// GetApprovalPolicy returns the approval policy of a device group. Groups without a policy do not require
+	// approval
+	GetApprovalPolicy(organizationID string, deviceGroupID string) (*entities.ApprovalPolicy, derrors.Error)
+
+	// RemoveApprovalPolicy removes the approval policy of a device group
+	RemoveApprovalPolicy(organizationID string, deviceGroupID string) derrors.Error
+
+	// AddPendingDevice adds a registration waiting for approval
+	AddPendingDevice(pending entities.PendingDevice) derrors.Error
+
+	// GetPendingDevice returns a registration waiting for approval
+	GetPendingDevice(organizationID string, deviceGroupID string, deviceID string) (*entities.PendingDevice, derrors.Error)
+
+	// ExistsPendingDevice checks if a device is waiting for approval
+	ExistsPendingDevice(organizationID string, deviceGroupID string, deviceID string) (bool, derrors.Error)
+
+	// ListPendingDevices returns the registrations of a device group waiting for approval
+	ListPendingDevices(organizationID string, deviceGroupID string) ([]*entities.PendingDevice, derrors.Error)
+
+	// ListExpiredPendingDevices returns the registrations of all the groups that expired before a given timestamp
+	ListExpiredPendingDevices(timestamp int64) ([]*entities.PendingDevice, derrors.Error)
+
+	// RemovePendingDevice removes a registration waiting for approval
+	RemovePendingDevice(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+}
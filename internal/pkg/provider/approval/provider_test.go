@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package approval
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createPendingDevice(organizationID string, deviceGroupID string, expires int64) *entities.PendingDevice {
+	return &entities.PendingDevice{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       uuid.New().String(),
+		Labels:         map[string]string{"env": "prod"},
+		Requested:      time.Now().Unix(),
+		Expires:        expires,
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.Context("approval policies", func() {
+		ginkgo.It("Should not require approval if the group has no policy", func() {
+			policy, err := provider.GetApprovalPolicy(uuid.New().String(), uuid.New().String())
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(policy.ApprovalRequired).To(gomega.BeFalse())
+		})
+		ginkgo.It("Should be able to set and remove a policy", func() {
+			policy := entities.ApprovalPolicy{
+				OrganizationId:   uuid.New().String(),
+				DeviceGroupId:    uuid.New().String(),
+				ApprovalRequired: true,
+			}
+			err := provider.SetApprovalPolicy(policy)
+			gomega.Expect(err).To(gomega.Succeed())
+			retrieved, err := provider.GetApprovalPolicy(policy.OrganizationId, policy.DeviceGroupId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.ApprovalRequired).To(gomega.BeTrue())
+
+			err = provider.RemoveApprovalPolicy(policy.OrganizationId, policy.DeviceGroupId)
+			gomega.Expect(err).To(gomega.Succeed())
+			retrieved, err = provider.GetApprovalPolicy(policy.OrganizationId, policy.DeviceGroupId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.ApprovalRequired).To(gomega.BeFalse())
+		})
+	})
+
+	ginkgo.Context("pending devices", func() {
+		ginkgo.It("Should be able to add and retrieve a pending device", func() {
+			pending := createPendingDevice(uuid.New().String(), uuid.New().String(), time.Now().Add(time.Hour).Unix())
+			err := provider.AddPendingDevice(*pending)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			exists, err := provider.ExistsPendingDevice(pending.OrganizationId, pending.DeviceGroupId, pending.DeviceId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(exists).To(gomega.BeTrue())
+
+			retrieved, err := provider.GetPendingDevice(pending.OrganizationId, pending.DeviceGroupId, pending.DeviceId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.Labels).To(gomega.Equal(pending.Labels))
+			gomega.Expect(retrieved.Expires).To(gomega.Equal(pending.Expires))
+		})
+		ginkgo.It("Should not be able to retrieve a non existing pending device", func() {
+			_, err := provider.GetPendingDevice(uuid.New().String(), uuid.New().String(), uuid.New().String())
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("Should be able to list the pending devices of a group", func() {
+			organizationID := uuid.New().String()
+			deviceGroupID := uuid.New().String()
+			for i := 0; i < 3; i++ {
+				err := provider.AddPendingDevice(*createPendingDevice(organizationID, deviceGroupID, time.Now().Add(time.Hour).Unix()))
+				gomega.Expect(err).To(gomega.Succeed())
+			}
+			err := provider.AddPendingDevice(*createPendingDevice(organizationID, uuid.New().String(), time.Now().Add(time.Hour).Unix()))
+			gomega.Expect(err).To(gomega.Succeed())
+
+			list, err := provider.ListPendingDevices(organizationID, deviceGroupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(list)).To(gomega.Equal(3))
+		})
+		ginkgo.It("Should be able to list the expired pending devices", func() {
+			expired := createPendingDevice(uuid.New().String(), uuid.New().String(), time.Now().Add(-time.Minute).Unix())
+			err := provider.AddPendingDevice(*expired)
+			gomega.Expect(err).To(gomega.Succeed())
+			valid := createPendingDevice(expired.OrganizationId, expired.DeviceGroupId, time.Now().Add(time.Hour).Unix())
+			err = provider.AddPendingDevice(*valid)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			list, err := provider.ListExpiredPendingDevices(time.Now().Unix())
+			gomega.Expect(err).To(gomega.Succeed())
+			ids := make([]string, 0)
+			for _, p := range list {
+				ids = append(ids, p.DeviceId)
+			}
+			gomega.Expect(ids).To(gomega.ContainElement(expired.DeviceId))
+			gomega.Expect(ids).NotTo(gomega.ContainElement(valid.DeviceId))
+		})
+		ginkgo.It("Should be able to remove a pending device", func() {
+			pending := createPendingDevice(uuid.New().String(), uuid.New().String(), time.Now().Add(time.Hour).Unix())
+			err := provider.AddPendingDevice(*pending)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			err = provider.RemovePendingDevice(pending.OrganizationId, pending.DeviceGroupId, pending.DeviceId)
+			gomega.Expect(err).To(gomega.Succeed())
+			exists, err := provider.ExistsPendingDevice(pending.OrganizationId, pending.DeviceGroupId, pending.DeviceId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(exists).To(gomega.BeFalse())
+		})
+		ginkgo.It("Should not be able to remove a non existing pending device", func() {
+			err := provider.RemovePendingDevice(uuid.New().String(), uuid.New().String(), uuid.New().String())
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package approval
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+func (sp *ScyllaProvider) SetApprovalPolicy(policy entities.ApprovalPolicy) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("approval_policy").Columns("organization_id", "device_group_id", "approval_required").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(policy)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot set approval policy")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) GetApprovalPolicy(organizationID string, deviceGroupID string) (*entities.ApprovalPolicy, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	var policy entities.ApprovalPolicy
+	stmt, names := qb.Get("approval_policy").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+
+	cqlErr := q.GetRelease(&policy)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return &entities.ApprovalPolicy{OrganizationId: organizationID, DeviceGroupId: deviceGroupID}, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve approval policy")
+	}
+
+	return &policy, nil
+}
+
+func (sp *ScyllaProvider) RemoveApprovalPolicy(organizationID string, deviceGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("approval_policy").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove approval policy")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) AddPendingDevice(pending entities.PendingDevice) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("pending_device").Columns("organization_id", "device_group_id", "device_id",
+		"labels", "requested", "expires").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(pending)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add pending device")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) unsafeGetPendingDevice(organizationID string, deviceGroupID string, deviceID string) (*entities.PendingDevice, derrors.Error) {
+	var pending entities.PendingDevice
+	stmt, names := qb.Get("pending_device").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := q.GetRelease(&pending)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return nil, derrors.NewNotFoundError("pending device").WithParams(organizationID, deviceGroupID, deviceID)
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve pending device")
+	}
+
+	return &pending, nil
+}
+
+func (sp *ScyllaProvider) GetPendingDevice(organizationID string, deviceGroupID string, deviceID string) (*entities.PendingDevice, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	return sp.unsafeGetPendingDevice(organizationID, deviceGroupID, deviceID)
+}
+
+func (sp *ScyllaProvider) unsafeExistsPendingDevice(organizationID string, deviceGroupID string, deviceID string) (bool, derrors.Error) {
+	var count int
+	stmt, names := qb.Select("pending_device").CountAll().Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := q.GetRelease(&count)
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot determine if the device is pending")
+	}
+
+	return count == 1, nil
+}
+
+func (sp *ScyllaProvider) ExistsPendingDevice(organizationID string, deviceGroupID string, deviceID string) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	return sp.unsafeExistsPendingDevice(organizationID, deviceGroupID, deviceID)
+}
+
+func (sp *ScyllaProvider) ListPendingDevices(organizationID string, deviceGroupID string) ([]*entities.PendingDevice, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]*entities.PendingDevice, 0)
+	stmt, names := qb.Select("pending_device").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+
+	cqlErr := gocqlx.Select(&pending, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return pending, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list pending devices")
+	}
+
+	return pending, nil
+}
+
+// ListExpiredPendingDevices reads all the pending registrations. The table only contains the registrations
+// waiting for an operator, so it is expected to be small.
+func (sp *ScyllaProvider) ListExpiredPendingDevices(timestamp int64) ([]*entities.PendingDevice, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]*entities.PendingDevice, 0)
+	stmt, names := qb.Select("pending_device").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names)
+
+	cqlErr := gocqlx.Select(&pending, q.Query)
+	if cqlErr != nil && cqlErr.Error() != rowNotFound {
+		return nil, derrors.AsError(cqlErr, "cannot list expired pending devices")
+	}
+
+	result := make([]*entities.PendingDevice, 0)
+	for _, p := range pending {
+		if p.Expires <= timestamp {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (sp *ScyllaProvider) RemovePendingDevice(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExistsPendingDevice(organizationID, deviceGroupID, deviceID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return derrors.NewNotFoundError("pending device").WithParams(organizationID, deviceGroupID, deviceID)
+	}
+
+	stmt, _ := qb.Delete("pending_device").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove pending device")
+	}
+
+	return nil
+}
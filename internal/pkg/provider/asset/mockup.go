@@ -0,0 +1,83 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package asset
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sort"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// changes indexed by organization_id + device_group_id + device_id, sorted by timestamp
+	changes map[string][]*entities.AssetInfoChange
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		changes: make(map[string][]*entities.AssetInfoChange, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string, deviceID string) string {
+	return organizationID + "/" + deviceGroupID + "/" + deviceID
+}
+
+func (m *MockupProvider) AddChange(change entities.AssetInfoChange) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(change.OrganizationId, change.DeviceGroupId, change.DeviceId)
+	changes := m.changes[key]
+	// entries with the same timestamp are replaced as in the database
+	for i, c := range changes {
+		if c.Timestamp == change.Timestamp {
+			changes[i] = &change
+			return nil
+		}
+	}
+	changes = append(changes, &change)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Timestamp < changes[j].Timestamp
+	})
+	m.changes[key] = changes
+	return nil
+}
+
+func (m *MockupProvider) ListChanges(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.AssetInfoChange, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.AssetInfoChange, 0)
+	changes := m.changes[m.getKey(organizationID, deviceGroupID, deviceID)]
+	for i := len(changes) - 1; i >= 0 && len(result) < limit; i-- {
+		if timeRange.Contains(changes[i].Timestamp) {
+			result = append(result, changes[i])
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) RemoveDeviceChanges(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.changes, m.getKey(organizationID, deviceGroupID, deviceID))
+	return nil
+}
@@ -0,0 +1,34 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package asset
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the history of changes of the asset information of the devices.
+type Provider interface {
+	// AddChange adds a change to the history of a device
+	AddChange(change entities.AssetInfoChange) derrors.Error
+
+	// ListChanges returns up to limit changes of a device in a time range, the most recent first
+	ListChanges(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.AssetInfoChange, derrors.Error)
+
+	// RemoveDeviceChanges removes the history of a device
+	RemoveDeviceChanges(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package asset
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+func createChange(organizationID string, deviceGroupID string, deviceID string, timestamp int64) *entities.AssetInfoChange {
+	return &entities.AssetInfoChange{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Timestamp:      timestamp,
+		Previous:       map[string]string{"os.version": "4.19"},
+		Current:        map[string]string{"os.version": "5.4"},
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add a change to the history", func() {
+		change := createChange(uuid.New().String(), uuid.New().String(), uuid.New().String(), 1000)
+		err := provider.AddChange(*change)
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to list the changes of a device in a time range", func() {
+		change := createChange(uuid.New().String(), uuid.New().String(), uuid.New().String(), 1000)
+		for timestamp := int64(1000); timestamp <= 5000; timestamp += 1000 {
+			err := provider.AddChange(*createChange(change.OrganizationId, change.DeviceGroupId, change.DeviceId, timestamp))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		changes, err := provider.ListChanges(change.OrganizationId, change.DeviceGroupId, change.DeviceId,
+			entities.TimeRange{From: 2000, To: 4000}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(changes)).Should(gomega.Equal(3))
+		gomega.Expect(changes[0].Timestamp).Should(gomega.Equal(int64(4000)))
+		gomega.Expect(changes[0].Current).Should(gomega.Equal(change.Current))
+
+		changes, err = provider.ListChanges(change.OrganizationId, change.DeviceGroupId, change.DeviceId, entities.TimeRange{}, 2)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(changes)).Should(gomega.Equal(2))
+		gomega.Expect(changes[0].Timestamp).Should(gomega.Equal(int64(5000)))
+	})
+	ginkgo.It("Should be able to remove the history of a device", func() {
+		change := createChange(uuid.New().String(), uuid.New().String(), uuid.New().String(), 1000)
+		err := provider.AddChange(*change)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveDeviceChanges(change.OrganizationId, change.DeviceGroupId, change.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		changes, err := provider.ListChanges(change.OrganizationId, change.DeviceGroupId, change.DeviceId, entities.TimeRange{}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(changes).To(gomega.BeEmpty())
+	})
+}
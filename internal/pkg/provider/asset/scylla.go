@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package asset
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+func (sp *ScyllaProvider) AddChange(change entities.AssetInfoChange) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("device_asset_history").Columns("organization_id", "device_group_id", "device_id",
+		"timestamp", "previous", "current").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(change)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add asset info change")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) ListChanges(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.AssetInfoChange, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*entities.AssetInfoChange, 0)
+	stmt, names := qb.Select("device_asset_history").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).Where(qb.GtOrEqNamed("timestamp", "from")).Where(qb.LtOrEqNamed("timestamp", "to")).
+		Limit(uint(limit)).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+		"from":            timeRange.From,
+		"to":              timeRange.Upper(),
+	})
+
+	cqlErr := gocqlx.Select(&changes, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return changes, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list asset info changes")
+	}
+
+	return changes, nil
+}
+
+func (sp *ScyllaProvider) RemoveDeviceChanges(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_asset_history").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove asset info changes")
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package attribute
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// attributes indexed by organization_id + device_group_id, device_id, name
+	attributes map[string]map[string]map[string]*entities.DeviceAttribute
+	// definitions indexed by organization_id, name
+	definitions map[string]map[string]*entities.AttributeDefinition
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		attributes:  make(map[string]map[string]map[string]*entities.DeviceAttribute, 0),
+		definitions: make(map[string]map[string]*entities.AttributeDefinition, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string) string {
+	return organizationID + "/" + deviceGroupID
+}
+
+func (m *MockupProvider) SetAttribute(attribute entities.DeviceAttribute) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(attribute.OrganizationId, attribute.DeviceGroupId)
+	group, exists := m.attributes[key]
+	if !exists {
+		group = make(map[string]map[string]*entities.DeviceAttribute, 0)
+		m.attributes[key] = group
+	}
+	device, exists := group[attribute.DeviceId]
+	if !exists {
+		device = make(map[string]*entities.DeviceAttribute, 0)
+		group[attribute.DeviceId] = device
+	}
+	device[attribute.Name] = &attribute
+	return nil
+}
+
+func (m *MockupProvider) GetDeviceAttributes(organizationID string, deviceGroupID string, deviceID string) ([]*entities.DeviceAttribute, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.DeviceAttribute, 0)
+	for _, attribute := range m.attributes[m.getKey(organizationID, deviceGroupID)][deviceID] {
+		result = append(result, attribute)
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) GetGroupAttributes(organizationID string, deviceGroupID string) ([]*entities.DeviceAttribute, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.DeviceAttribute, 0)
+	for _, device := range m.attributes[m.getKey(organizationID, deviceGroupID)] {
+		for _, attribute := range device {
+			result = append(result, attribute)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) RemoveAttribute(organizationID string, deviceGroupID string, deviceID string, name string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	device := m.attributes[m.getKey(organizationID, deviceGroupID)][deviceID]
+	if _, exists := device[name]; !exists {
+		return derrors.NewNotFoundError("device attribute").WithParams(organizationID, deviceGroupID, deviceID, name)
+	}
+	delete(device, name)
+	return nil
+}
+
+func (m *MockupProvider) RemoveDeviceAttributes(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.attributes[m.getKey(organizationID, deviceGroupID)], deviceID)
+	return nil
+}
+
+func (m *MockupProvider) SetDefinition(definition entities.AttributeDefinition) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	organization, exists := m.definitions[definition.OrganizationId]
+	if !exists {
+		organization = make(map[string]*entities.AttributeDefinition, 0)
+		m.definitions[definition.OrganizationId] = organization
+	}
+	organization[definition.Name] = &definition
+	return nil
+}
+
+func (m *MockupProvider) ListDefinitions(organizationID string) ([]*entities.AttributeDefinition, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.AttributeDefinition, 0)
+	for _, definition := range m.definitions[organizationID] {
+		result = append(result, definition)
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) RemoveDefinition(organizationID string, name string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, exists := m.definitions[organizationID][name]; !exists {
+		return derrors.NewNotFoundError("attribute definition").WithParams(organizationID, name)
+	}
+	delete(m.definitions[organizationID], name)
+	return nil
+}
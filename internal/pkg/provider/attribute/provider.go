@@ -0,0 +1,49 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package attribute
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider stores the custom attributes of the devices and the attribute schema of the organizations.
+type Provider interface {
+	// SetAttribute adds or updates an attribute of a device
+	SetAttribute(attribute entities.DeviceAttribute) derrors.Error
+
+	// GetDeviceAttributes returns the attributes of a device
+	GetDeviceAttributes(organizationID string, deviceGroupID string, deviceID string) ([]*entities.DeviceAttribute, derrors.Error)
+
+	// GetGroupAttributes returns the attributes of all the devices of a device group
+	GetGroupAttributes(organizationID string, deviceGroupID string) ([]*entities.DeviceAttribute, derrors.Error)
+
+	// RemoveAttribute removes an attribute of a device
+	RemoveAttribute(organizationID string, deviceGroupID string, deviceID string, name string) derrors.Error
+
+	// RemoveDeviceAttributes removes all the attributes of a device
+	RemoveDeviceAttributes(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+
+	// SetDefinition adds or updates an attribute definition in the schema of an organization
+	SetDefinition(definition entities.AttributeDefinition) derrors.Error
+
+	// ListDefinitions returns the attribute schema of an organization
+	ListDefinitions(organizationID string) ([]*entities.AttributeDefinition, derrors.Error)
+
+	// RemoveDefinition removes an attribute definition from the schema of an organization
+	RemoveDefinition(organizationID string, name string) derrors.Error
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package attribute
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createDeviceAttribute(organizationID string, deviceGroupID string, deviceID string, name string) *entities.DeviceAttribute {
+	return &entities.DeviceAttribute{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Name:           name,
+		Type:           entities.NumberAttribute,
+		Value:          "42",
+		Updated:        time.Now().Unix(),
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.Context("device attributes", func() {
+		ginkgo.It("Should be able to set and retrieve the attributes of a device", func() {
+			attribute := createDeviceAttribute(uuid.New().String(), uuid.New().String(), uuid.New().String(), "battery_level")
+			err := provider.SetAttribute(*attribute)
+			gomega.Expect(err).To(gomega.Succeed())
+			attributes, err := provider.GetDeviceAttributes(attribute.OrganizationId, attribute.DeviceGroupId, attribute.DeviceId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(attributes).Should(gomega.HaveLen(1))
+			gomega.Expect(*attributes[0]).Should(gomega.Equal(*attribute))
+		})
+		ginkgo.It("Should update an existing attribute", func() {
+			attribute := createDeviceAttribute(uuid.New().String(), uuid.New().String(), uuid.New().String(), "battery_level")
+			err := provider.SetAttribute(*attribute)
+			gomega.Expect(err).To(gomega.Succeed())
+			attribute.Value = "10"
+			err = provider.SetAttribute(*attribute)
+			gomega.Expect(err).To(gomega.Succeed())
+			attributes, err := provider.GetDeviceAttributes(attribute.OrganizationId, attribute.DeviceGroupId, attribute.DeviceId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(attributes).Should(gomega.HaveLen(1))
+			gomega.Expect(attributes[0].Value).Should(gomega.Equal("10"))
+		})
+		ginkgo.It("Should return an empty list for a device without attributes", func() {
+			attributes, err := provider.GetDeviceAttributes(uuid.New().String(), uuid.New().String(), uuid.New().String())
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(attributes).Should(gomega.BeEmpty())
+		})
+		ginkgo.It("Should be able to retrieve the attributes of a device group", func() {
+			organizationID := uuid.New().String()
+			deviceGroupID := uuid.New().String()
+			for i := 0; i < 3; i++ {
+				deviceID := uuid.New().String()
+				err := provider.SetAttribute(*createDeviceAttribute(organizationID, deviceGroupID, deviceID, "battery_level"))
+				gomega.Expect(err).To(gomega.Succeed())
+				err = provider.SetAttribute(*createDeviceAttribute(organizationID, deviceGroupID, deviceID, "temperature"))
+				gomega.Expect(err).To(gomega.Succeed())
+			}
+			attributes, err := provider.GetGroupAttributes(organizationID, deviceGroupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(attributes).Should(gomega.HaveLen(6))
+		})
+		ginkgo.It("Should be able to remove an attribute", func() {
+			attribute := createDeviceAttribute(uuid.New().String(), uuid.New().String(), uuid.New().String(), "battery_level")
+			err := provider.SetAttribute(*attribute)
+			gomega.Expect(err).To(gomega.Succeed())
+			err = provider.RemoveAttribute(attribute.OrganizationId, attribute.DeviceGroupId, attribute.DeviceId, attribute.Name)
+			gomega.Expect(err).To(gomega.Succeed())
+			attributes, err := provider.GetDeviceAttributes(attribute.OrganizationId, attribute.DeviceGroupId, attribute.DeviceId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(attributes).Should(gomega.BeEmpty())
+		})
+		ginkgo.It("Should not be able to remove a non existing attribute", func() {
+			err := provider.RemoveAttribute(uuid.New().String(), uuid.New().String(), uuid.New().String(), "battery_level")
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("Should be able to remove all the attributes of a device", func() {
+			organizationID := uuid.New().String()
+			deviceGroupID := uuid.New().String()
+			deviceID := uuid.New().String()
+			err := provider.SetAttribute(*createDeviceAttribute(organizationID, deviceGroupID, deviceID, "battery_level"))
+			gomega.Expect(err).To(gomega.Succeed())
+			err = provider.SetAttribute(*createDeviceAttribute(organizationID, deviceGroupID, deviceID, "temperature"))
+			gomega.Expect(err).To(gomega.Succeed())
+			other := createDeviceAttribute(organizationID, deviceGroupID, uuid.New().String(), "battery_level")
+			err = provider.SetAttribute(*other)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			err = provider.RemoveDeviceAttributes(organizationID, deviceGroupID, deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			attributes, err := provider.GetGroupAttributes(organizationID, deviceGroupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(attributes).Should(gomega.HaveLen(1))
+			gomega.Expect(attributes[0].DeviceId).Should(gomega.Equal(other.DeviceId))
+		})
+	})
+
+	ginkgo.Context("attribute definitions", func() {
+		ginkgo.It("Should be able to set and list the definitions of an organization", func() {
+			organizationID := uuid.New().String()
+			definition := &entities.AttributeDefinition{
+				OrganizationId: organizationID,
+				Name:           "installed",
+				Type:           entities.TimestampAttribute,
+				Description:    "installation date",
+			}
+			err := provider.SetDefinition(*definition)
+			gomega.Expect(err).To(gomega.Succeed())
+			definitions, err := provider.ListDefinitions(organizationID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(definitions).Should(gomega.HaveLen(1))
+			gomega.Expect(*definitions[0]).Should(gomega.Equal(*definition))
+		})
+		ginkgo.It("Should be able to remove a definition", func() {
+			organizationID := uuid.New().String()
+			err := provider.SetDefinition(entities.AttributeDefinition{OrganizationId: organizationID, Name: "owner", Type: entities.StringAttribute})
+			gomega.Expect(err).To(gomega.Succeed())
+			err = provider.RemoveDefinition(organizationID, "owner")
+			gomega.Expect(err).To(gomega.Succeed())
+			definitions, err := provider.ListDefinitions(organizationID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(definitions).Should(gomega.BeEmpty())
+		})
+		ginkgo.It("Should not be able to remove a non existing definition", func() {
+			err := provider.RemoveDefinition(uuid.New().String(), "owner")
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package attribute
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+func (sp *ScyllaProvider) SetAttribute(attribute entities.DeviceAttribute) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("device_attribute").Columns("organization_id", "device_group_id", "device_id",
+		"name", "type", "value", "updated").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(attribute)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot set device attribute")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) GetDeviceAttributes(organizationID string, deviceGroupID string, deviceID string) ([]*entities.DeviceAttribute, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := make([]*entities.DeviceAttribute, 0)
+	stmt, names := qb.Select("device_attribute").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := gocqlx.Select(&attributes, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return attributes, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve device attributes")
+	}
+
+	return attributes, nil
+}
+
+func (sp *ScyllaProvider) GetGroupAttributes(organizationID string, deviceGroupID string) ([]*entities.DeviceAttribute, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := make([]*entities.DeviceAttribute, 0)
+	stmt, names := qb.Select("device_attribute").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+
+	cqlErr := gocqlx.Select(&attributes, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return attributes, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve device group attributes")
+	}
+
+	return attributes, nil
+}
+
+func (sp *ScyllaProvider) unsafeExistsAttribute(organizationID string, deviceGroupID string, deviceID string, name string) (bool, derrors.Error) {
+	var count int
+	stmt, names := qb.Select("device_attribute").CountAll().Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).Where(qb.Eq("name")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+		"name":            name,
+	})
+
+	cqlErr := q.GetRelease(&count)
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot determine if device attribute exists")
+	}
+
+	return count == 1, nil
+}
+
+func (sp *ScyllaProvider) RemoveAttribute(organizationID string, deviceGroupID string, deviceID string, name string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExistsAttribute(organizationID, deviceGroupID, deviceID, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return derrors.NewNotFoundError("device attribute").WithParams(organizationID, deviceGroupID, deviceID, name)
+	}
+
+	stmt, _ := qb.Delete("device_attribute").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).Where(qb.Eq("name")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID, name).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove device attribute")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveDeviceAttributes(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_attribute").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove device attributes")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) SetDefinition(definition entities.AttributeDefinition) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("attribute_definition").Columns("organization_id", "name", "type", "description").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(definition)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot set attribute definition")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) ListDefinitions(organizationID string) ([]*entities.AttributeDefinition, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := make([]*entities.AttributeDefinition, 0)
+	stmt, names := qb.Select("attribute_definition").Where(qb.Eq("organization_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+	})
+
+	cqlErr := gocqlx.Select(&definitions, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return definitions, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list attribute definitions")
+	}
+
+	return definitions, nil
+}
+
+func (sp *ScyllaProvider) unsafeExistsDefinition(organizationID string, name string) (bool, derrors.Error) {
+	var count int
+	stmt, names := qb.Select("attribute_definition").CountAll().Where(qb.Eq("organization_id")).Where(qb.Eq("name")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"name":            name,
+	})
+
+	cqlErr := q.GetRelease(&count)
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot determine if attribute definition exists")
+	}
+
+	return count == 1, nil
+}
+
+func (sp *ScyllaProvider) RemoveDefinition(organizationID string, name string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExistsDefinition(organizationID, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return derrors.NewNotFoundError("attribute definition").WithParams(organizationID, name)
+	}
+
+	stmt, _ := qb.Delete("attribute_definition").Where(qb.Eq("organization_id")).Where(qb.Eq("name")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, name).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove attribute definition")
+	}
+
+	return nil
+}
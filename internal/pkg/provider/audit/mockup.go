@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sort"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// entries indexed by organization_id + target, sorted by timestamp
+	entries map[string][]*entities.AuditEntry
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		entries: make(map[string][]*entities.AuditEntry, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(organizationID string, target string) string {
+	return organizationID + "#" + target
+}
+
+func (m *MockupProvider) AddEntry(entry entities.AuditEntry) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, t := range targets(entry) {
+		key := m.getKey(entry.OrganizationId, t)
+		entries := append(m.entries[key], &entry)
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Timestamp < entries[j].Timestamp
+		})
+		m.entries[key] = entries
+	}
+	return nil
+}
+
+func (m *MockupProvider) ListEntries(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.AuditEntry, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.AuditEntry, 0)
+	entries := m.entries[m.getKey(organizationID, target(deviceGroupID, deviceID))]
+	for i := len(entries) - 1; i >= 0 && len(result) < limit; i-- {
+		if timeRange.Contains(entries[i].Timestamp) {
+			result = append(result, entries[i])
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the audit log. Entries are only appended; they are not updated or removed.
+type Provider interface {
+	// AddEntry appends an entry to the audit log of an organization
+	AddEntry(entry entities.AuditEntry) derrors.Error
+
+	// ListEntries returns up to limit entries of an organization in a time range, the most recent first. If
+	// deviceGroupID is set, only the entries of the device group and its devices are returned, and if deviceID is
+	// also set, only the entries of the device
+	ListEntries(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.AuditEntry, derrors.Error)
+}
+
+// targets returns the targets under which an entry is stored: the organization, the device group and the device.
+func targets(entry entities.AuditEntry) []string {
+	result := []string{target("", "")}
+	if entry.DeviceGroupId != "" {
+		result = append(result, target(entry.DeviceGroupId, ""))
+	}
+	if entry.DeviceId != "" {
+		result = append(result, target(entry.DeviceGroupId, entry.DeviceId))
+	}
+	return result
+}
+
+// target returns the key of the entries of the organization, of a device group or of a device.
+func target(deviceGroupID string, deviceID string) string {
+	if deviceID != "" {
+		return deviceGroupID + "/" + deviceID
+	}
+	return deviceGroupID
+}
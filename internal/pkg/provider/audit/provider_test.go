@@ -0,0 +1,83 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+func createEntry(organizationID string, deviceGroupID string, deviceID string, timestamp int64) *entities.AuditEntry {
+	entry := entities.NewAuditEntry(organizationID, deviceGroupID, deviceID, &entities.Actor{UserId: "user"},
+		"UpdateDevice", timestamp)
+	entry.Complete(map[string]string{"labels.env": "dev"}, map[string]string{"labels.env": "prod"}, nil)
+	return entry
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add an audit entry", func() {
+		entry := createEntry(uuid.New().String(), uuid.New().String(), uuid.New().String(), 1000)
+		err := provider.AddEntry(*entry)
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to list the audit entries of an organization in a time range", func() {
+		organizationID := uuid.New().String()
+		for timestamp := int64(1000); timestamp <= 5000; timestamp += 1000 {
+			err := provider.AddEntry(*createEntry(organizationID, uuid.New().String(), uuid.New().String(), timestamp))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		entries, err := provider.ListEntries(organizationID, "", "", entities.TimeRange{From: 2000, To: 4000}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(entries)).Should(gomega.Equal(3))
+		gomega.Expect(entries[0].Timestamp).Should(gomega.Equal(int64(4000)))
+		gomega.Expect(entries[0].Actor).Should(gomega.Equal("user"))
+		gomega.Expect(entries[0].Outcome).Should(gomega.Equal(entities.AuditSuccess))
+		gomega.Expect(entries[0].Current).Should(gomega.HaveKeyWithValue("labels.env", "prod"))
+
+		entries, err = provider.ListEntries(organizationID, "", "", entities.TimeRange{From: 2000}, 2)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(entries)).Should(gomega.Equal(2))
+		gomega.Expect(entries[0].Timestamp).Should(gomega.Equal(int64(5000)))
+	})
+	ginkgo.It("Should be able to list the audit entries of a target", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		deviceID := uuid.New().String()
+		groupEntry := createEntry(organizationID, deviceGroupID, "", 1000)
+		deviceEntry := createEntry(organizationID, deviceGroupID, deviceID, 2000)
+		otherEntry := createEntry(organizationID, deviceGroupID, uuid.New().String(), 3000)
+		for _, entry := range []*entities.AuditEntry{groupEntry, deviceEntry, otherEntry} {
+			err := provider.AddEntry(*entry)
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+
+		entries, err := provider.ListEntries(organizationID, deviceGroupID, "", entities.TimeRange{}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(entries)).Should(gomega.Equal(3))
+
+		entries, err = provider.ListEntries(organizationID, deviceGroupID, deviceID, entities.TimeRange{}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(entries)).Should(gomega.Equal(1))
+		gomega.Expect(entries[0].EntryId).Should(gomega.Equal(deviceEntry.EntryId))
+
+		entries, err = provider.ListEntries(organizationID, uuid.New().String(), "", entities.TimeRange{}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(entries).To(gomega.BeEmpty())
+	})
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+// AddEntry stores the entry under each of its targets, so the log of an organization, a device group or a device
+// can be read from a single partition.
+func (sp *ScyllaProvider) AddEntry(entry entities.AuditEntry) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("audit_entry").Columns("organization_id", "target", "timestamp", "entry_id", "actor",
+		"operation", "device_group_id", "device_id", "previous", "current", "outcome", "error").ToCql()
+	for _, t := range targets(entry) {
+		q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+			"organization_id": entry.OrganizationId,
+			"target":          t,
+			"timestamp":       entry.Timestamp,
+			"entry_id":        entry.EntryId,
+			"actor":           entry.Actor,
+			"operation":       entry.Operation,
+			"device_group_id": entry.DeviceGroupId,
+			"device_id":       entry.DeviceId,
+			"previous":        entry.Previous,
+			"current":         entry.Current,
+			"outcome":         entry.Outcome,
+			"error":           entry.Error,
+		})
+		cqlErr := q.ExecRelease()
+		if cqlErr != nil {
+			return derrors.AsError(cqlErr, "cannot add audit entry")
+		}
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) ListEntries(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.AuditEntry, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*entities.AuditEntry, 0)
+	stmt, names := qb.Select("audit_entry").Columns("organization_id", "timestamp", "entry_id", "actor", "operation",
+		"device_group_id", "device_id", "previous", "current", "outcome", "error").
+		Where(qb.Eq("organization_id")).Where(qb.Eq("target")).Where(qb.GtOrEqNamed("timestamp", "from")).
+		Where(qb.LtOrEqNamed("timestamp", "to")).Limit(uint(limit)).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"target":          target(deviceGroupID, deviceID),
+		"from":            timeRange.From,
+		"to":              timeRange.Upper(),
+	})
+
+	cqlErr := gocqlx.Select(&entries, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return entries, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list the audit entries")
+	}
+
+	return entries, nil
+}
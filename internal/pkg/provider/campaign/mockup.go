@@ -0,0 +1,164 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package campaign
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// campaigns indexed by organization_id + device_group_id + campaign_id
+	campaigns map[string]entities.Campaign
+	// devices indexed by organization_id + device_group_id + campaign_id, and by device_id
+	devices map[string]map[string]entities.CampaignDevice
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		campaigns: make(map[string]entities.Campaign, 0),
+		devices:   make(map[string]map[string]entities.CampaignDevice, 0),
+	}
+}
+
+func (m *MockupProvider) getGroupKey(organizationID string, deviceGroupID string) string {
+	return organizationID + "/" + deviceGroupID + "/"
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string, campaignID string) string {
+	return m.getGroupKey(organizationID, deviceGroupID) + campaignID
+}
+
+func (m *MockupProvider) AddCampaign(campaign entities.Campaign) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+	if _, exists := m.campaigns[key]; exists {
+		return derrors.NewAlreadyExistsError("campaign").WithParams(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+	}
+	m.campaigns[key] = campaign
+	return nil
+}
+
+func (m *MockupProvider) GetCampaign(organizationID string, deviceGroupID string, campaignID string) (*entities.Campaign, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	campaign, exists := m.campaigns[m.getKey(organizationID, deviceGroupID, campaignID)]
+	if !exists {
+		return nil, derrors.NewNotFoundError("campaign").WithParams(organizationID, deviceGroupID, campaignID)
+	}
+	return &campaign, nil
+}
+
+func (m *MockupProvider) ListCampaigns(organizationID string, deviceGroupID string) ([]*entities.Campaign, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	prefix := m.getGroupKey(organizationID, deviceGroupID)
+	result := make([]*entities.Campaign, 0)
+	for key, campaign := range m.campaigns {
+		if strings.HasPrefix(key, prefix) {
+			retrieved := campaign
+			result = append(result, &retrieved)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created > result[j].Created
+	})
+	return result, nil
+}
+
+func (m *MockupProvider) ListActiveCampaigns() ([]*entities.Campaign, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.Campaign, 0)
+	for _, campaign := range m.campaigns {
+		if !campaign.IsFinal() {
+			retrieved := campaign
+			result = append(result, &retrieved)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) UpdateCampaign(campaign entities.Campaign, previousRevision int64) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+	current, exists := m.campaigns[key]
+	if !exists {
+		return false, derrors.NewNotFoundError("campaign").WithParams(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+	}
+	if current.Revision != previousRevision {
+		return false, nil
+	}
+	m.campaigns[key] = campaign
+	return true, nil
+}
+
+func (m *MockupProvider) SetCampaignDevice(device entities.CampaignDevice) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(device.OrganizationId, device.DeviceGroupId, device.CampaignId)
+	if _, exists := m.devices[key]; !exists {
+		m.devices[key] = make(map[string]entities.CampaignDevice, 0)
+	}
+	m.devices[key][device.DeviceId] = device
+	return nil
+}
+
+func (m *MockupProvider) ListCampaignDevices(organizationID string, deviceGroupID string, campaignID string) ([]*entities.CampaignDevice, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.CampaignDevice, 0)
+	for _, device := range m.devices[m.getKey(organizationID, deviceGroupID, campaignID)] {
+		retrieved := device
+		result = append(result, &retrieved)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DeviceId < result[j].DeviceId
+	})
+	return result, nil
+}
+
+func (m *MockupProvider) RemoveGroupCampaigns(organizationID string, deviceGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	prefix := m.getGroupKey(organizationID, deviceGroupID)
+	for key := range m.campaigns {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.campaigns, key)
+		}
+	}
+	for key := range m.devices {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.devices, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package campaign
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the rollout campaigns and the progress of their devices.
+type Provider interface {
+	// AddCampaign adds a new campaign
+	AddCampaign(campaign entities.Campaign) derrors.Error
+
+	// GetCampaign returns a campaign
+	GetCampaign(organizationID string, deviceGroupID string, campaignID string) (*entities.Campaign, derrors.Error)
+
+	// ListCampaigns returns the campaigns of a device group, the most recent first
+	ListCampaigns(organizationID string, deviceGroupID string) ([]*entities.Campaign, derrors.Error)
+
+	// ListActiveCampaigns returns the campaigns of all the organizations that have not finished
+	ListActiveCampaigns() ([]*entities.Campaign, derrors.Error)
+
+	// UpdateCampaign updates a campaign if its revision has not changed since it was read. It returns false if the
+	// campaign was updated concurrently
+	UpdateCampaign(campaign entities.Campaign, previousRevision int64) (bool, derrors.Error)
+
+	// SetCampaignDevice adds or updates the progress of a device in a campaign
+	SetCampaignDevice(device entities.CampaignDevice) derrors.Error
+
+	// ListCampaignDevices returns the progress of the devices of a campaign
+	ListCampaignDevices(organizationID string, deviceGroupID string, campaignID string) ([]*entities.CampaignDevice, derrors.Error)
+
+	// RemoveGroupCampaigns removes the campaigns of a device group and the progress of their devices
+	RemoveGroupCampaigns(organizationID string, deviceGroupID string) derrors.Error
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package campaign
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createCampaign(organizationID string, deviceGroupID string, created int64) *entities.Campaign {
+	return &entities.Campaign{
+		OrganizationId:       organizationID,
+		DeviceGroupId:        deviceGroupID,
+		CampaignId:           uuid.New().String(),
+		Name:                 "test campaign",
+		Artifact:             "firmware:1.2",
+		BatchPercentages:     []int{10, 50},
+		MaxOfflinePercentage: 10,
+		ObservationPeriod:    600,
+		UpdateTimeout:        3600,
+		Status:               entities.CampaignRunning,
+		Batches:              3,
+		Devices:              20,
+		Created:              created,
+		Updated:              created,
+	}
+}
+
+func createCampaignDevice(campaign *entities.Campaign, deviceID string) *entities.CampaignDevice {
+	return &entities.CampaignDevice{
+		OrganizationId: campaign.OrganizationId,
+		DeviceGroupId:  campaign.DeviceGroupId,
+		CampaignId:     campaign.CampaignId,
+		DeviceId:       deviceID,
+		Status:         entities.CampaignDevicePending,
+		Updated:        campaign.Created,
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add and retrieve a campaign", func() {
+		campaign := createCampaign(uuid.New().String(), uuid.New().String(), 1000)
+		err := provider.AddCampaign(*campaign)
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.AddCampaign(*campaign)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+
+		retrieved, err := provider.GetCampaign(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*retrieved).Should(gomega.Equal(*campaign))
+	})
+
+	ginkgo.It("Should not be able to retrieve a campaign that does not exist", func() {
+		_, err := provider.GetCampaign(uuid.New().String(), uuid.New().String(), uuid.New().String())
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("Should list the campaigns of a group, the most recent first", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		for _, created := range []int64{1000, 3000, 2000} {
+			err := provider.AddCampaign(*createCampaign(organizationID, deviceGroupID, created))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		campaigns, err := provider.ListCampaigns(organizationID, deviceGroupID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(campaigns).To(gomega.HaveLen(3))
+		gomega.Expect(campaigns[0].Created).Should(gomega.Equal(int64(3000)))
+		gomega.Expect(campaigns[2].Created).Should(gomega.Equal(int64(1000)))
+	})
+
+	ginkgo.It("Should update a campaign only if its revision has not changed", func() {
+		campaign := createCampaign(uuid.New().String(), uuid.New().String(), 1000)
+		err := provider.AddCampaign(*campaign)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		campaign.Status = entities.CampaignPaused
+		campaign.Revision = 1
+		applied, err := provider.UpdateCampaign(*campaign, 0)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(applied).To(gomega.BeTrue())
+
+		campaign.Status = entities.CampaignAborted
+		campaign.Revision = 2
+		applied, err = provider.UpdateCampaign(*campaign, 0)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(applied).To(gomega.BeFalse())
+
+		retrieved, err := provider.GetCampaign(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved.Status).Should(gomega.Equal(entities.CampaignPaused))
+		gomega.Expect(retrieved.Revision).Should(gomega.Equal(int64(1)))
+	})
+
+	ginkgo.It("Should list the active campaigns", func() {
+		active := createCampaign(uuid.New().String(), uuid.New().String(), 1000)
+		completed := createCampaign(active.OrganizationId, active.DeviceGroupId, 1000)
+		completed.Status = entities.CampaignCompleted
+		gomega.Expect(provider.AddCampaign(*active)).To(gomega.Succeed())
+		gomega.Expect(provider.AddCampaign(*completed)).To(gomega.Succeed())
+
+		campaigns, err := provider.ListActiveCampaigns()
+		gomega.Expect(err).To(gomega.Succeed())
+		found := make(map[string]bool, 0)
+		for _, c := range campaigns {
+			found[c.CampaignId] = true
+		}
+		gomega.Expect(found).Should(gomega.HaveKey(active.CampaignId))
+		gomega.Expect(found).ShouldNot(gomega.HaveKey(completed.CampaignId))
+	})
+
+	ginkgo.It("Should store the progress of the devices", func() {
+		campaign := createCampaign(uuid.New().String(), uuid.New().String(), 1000)
+		for _, deviceID := range []string{"d1", "d0"} {
+			err := provider.SetCampaignDevice(*createCampaignDevice(campaign, deviceID))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		device := createCampaignDevice(campaign, "d1")
+		device.Start(uuid.New().String(), time.Unix(1001, 0))
+		err := provider.SetCampaignDevice(*device)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		devices, err := provider.ListCampaignDevices(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(devices).To(gomega.HaveLen(2))
+		gomega.Expect(devices[0].DeviceId).Should(gomega.Equal("d0"))
+		gomega.Expect(*devices[1]).Should(gomega.Equal(*device))
+	})
+
+	ginkgo.It("Should remove the campaigns of a group", func() {
+		campaign := createCampaign(uuid.New().String(), uuid.New().String(), 1000)
+		gomega.Expect(provider.AddCampaign(*campaign)).To(gomega.Succeed())
+		gomega.Expect(provider.SetCampaignDevice(*createCampaignDevice(campaign, "d0"))).To(gomega.Succeed())
+
+		err := provider.RemoveGroupCampaigns(campaign.OrganizationId, campaign.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		campaigns, err := provider.ListCampaigns(campaign.OrganizationId, campaign.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(campaigns).To(gomega.BeEmpty())
+		devices, err := provider.ListCampaignDevices(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(devices).To(gomega.BeEmpty())
+	})
+}
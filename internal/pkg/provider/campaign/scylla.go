@@ -0,0 +1,274 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package campaign
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+	"sort"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+var campaignColumns = []string{"organization_id", "device_group_id", "campaign_id", "name", "artifact", "label_selector",
+	"batch_size", "batch_percentages", "max_offline_percentage", "max_latency", "observation_period", "update_timeout",
+	"status", "batches", "current_batch", "batch_started", "devices", "message", "created", "updated", "revision"}
+
+// campaignUpdateColumns contains the columns that change after the creation of a campaign.
+var campaignUpdateColumns = []string{"status", "current_batch", "batch_started", "message", "updated", "revision"}
+
+var campaignDeviceColumns = []string{"organization_id", "device_group_id", "campaign_id", "device_id", "batch", "status",
+	"command_id", "updated", "error"}
+
+func (sp *ScyllaProvider) AddCampaign(campaign entities.Campaign) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("campaign").Columns(campaignColumns...).Unique().ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(campaign)
+	applied, cqlErr := q.MapScanCAS(make(map[string]interface{}))
+	q.Release()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add campaign")
+	}
+	if !applied {
+		return derrors.NewAlreadyExistsError("campaign").WithParams(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) GetCampaign(organizationID string, deviceGroupID string, campaignID string) (*entities.Campaign, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	var campaign entities.Campaign
+	stmt, names := qb.Get("campaign").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("campaign_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"campaign_id":     campaignID,
+	})
+
+	cqlErr := q.GetRelease(&campaign)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return nil, derrors.NewNotFoundError("campaign").WithParams(organizationID, deviceGroupID, campaignID)
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve campaign")
+	}
+
+	return &campaign, nil
+}
+
+func (sp *ScyllaProvider) ListCampaigns(organizationID string, deviceGroupID string) ([]*entities.Campaign, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	campaigns := make([]*entities.Campaign, 0)
+	stmt, names := qb.Select("campaign").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+
+	cqlErr := gocqlx.Select(&campaigns, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return campaigns, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list campaigns")
+	}
+
+	// the campaigns are clustered by identifier
+	sort.Slice(campaigns, func(i, j int) bool {
+		return campaigns[i].Created > campaigns[j].Created
+	})
+	return campaigns, nil
+}
+
+// ListActiveCampaigns reads all the campaigns. Campaigns are created by operators, so the table is expected to be
+// small.
+func (sp *ScyllaProvider) ListActiveCampaigns() ([]*entities.Campaign, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	campaigns := make([]*entities.Campaign, 0)
+	stmt, names := qb.Select("campaign").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names)
+
+	cqlErr := gocqlx.Select(&campaigns, q.Query)
+	if cqlErr != nil && cqlErr.Error() != rowNotFound {
+		return nil, derrors.AsError(cqlErr, "cannot list active campaigns")
+	}
+
+	result := make([]*entities.Campaign, 0)
+	for _, c := range campaigns {
+		if !c.IsFinal() {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+// UpdateCampaign relies on a lightweight transaction so that the instances of the device manager do not start the
+// same batch twice or override the changes of the operators.
+func (sp *ScyllaProvider) UpdateCampaign(campaign entities.Campaign, previousRevision int64) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	stmt, names := qb.Update("campaign").Set(campaignUpdateColumns...).
+		Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("campaign_id")).
+		If(qb.EqNamed("revision", "previous")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": campaign.OrganizationId,
+		"device_group_id": campaign.DeviceGroupId,
+		"campaign_id":     campaign.CampaignId,
+		"status":          campaign.Status,
+		"current_batch":   campaign.CurrentBatch,
+		"batch_started":   campaign.BatchStarted,
+		"message":         campaign.Message,
+		"updated":         campaign.Updated,
+		"revision":        campaign.Revision,
+		"previous":        previousRevision,
+	})
+	applied, cqlErr := q.MapScanCAS(make(map[string]interface{}))
+	q.Release()
+
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot update campaign")
+	}
+
+	return applied, nil
+}
+
+func (sp *ScyllaProvider) SetCampaignDevice(device entities.CampaignDevice) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("campaign_device").Columns(campaignDeviceColumns...).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(device)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot set campaign device")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) ListCampaignDevices(organizationID string, deviceGroupID string, campaignID string) ([]*entities.CampaignDevice, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]*entities.CampaignDevice, 0)
+	stmt, names := qb.Select("campaign_device").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("campaign_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"campaign_id":     campaignID,
+	})
+
+	cqlErr := gocqlx.Select(&devices, q.Query)
+	if cqlErr != nil && cqlErr.Error() != rowNotFound {
+		return nil, derrors.AsError(cqlErr, "cannot list campaign devices")
+	}
+
+	return devices, nil
+}
+
+func (sp *ScyllaProvider) RemoveGroupCampaigns(organizationID string, deviceGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"campaign_device", "campaign"} {
+		stmt, _ := qb.Delete(table).Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+		cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID).Exec()
+		if cqlErr != nil {
+			return derrors.AsError(cqlErr, "cannot remove device group campaigns")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// commands indexed by organization_id + device_group_id + device_id, and by command_id
+	commands map[string]map[string]entities.DeviceCommand
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		commands: make(map[string]map[string]entities.DeviceCommand, 0),
+	}
+}
+
+func (m *MockupProvider) getGroupKey(organizationID string, deviceGroupID string) string {
+	return organizationID + "/" + deviceGroupID + "/"
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string, deviceID string) string {
+	return m.getGroupKey(organizationID, deviceGroupID) + deviceID
+}
+
+func (m *MockupProvider) AddCommand(command entities.DeviceCommand) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(command.OrganizationId, command.DeviceGroupId, command.DeviceId)
+	if _, exists := m.commands[key]; !exists {
+		m.commands[key] = make(map[string]entities.DeviceCommand, 0)
+	}
+	m.commands[key][command.CommandId] = command
+	return nil
+}
+
+func (m *MockupProvider) unsafeGetCommand(organizationID string, deviceGroupID string, deviceID string, commandID string) (*entities.DeviceCommand, derrors.Error) {
+	command, exists := m.commands[m.getKey(organizationID, deviceGroupID, deviceID)][commandID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("command").WithParams(organizationID, deviceGroupID, deviceID, commandID)
+	}
+	return &command, nil
+}
+
+func (m *MockupProvider) GetCommand(organizationID string, deviceGroupID string, deviceID string, commandID string) (*entities.DeviceCommand, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.unsafeGetCommand(organizationID, deviceGroupID, deviceID, commandID)
+}
+
+func (m *MockupProvider) ListCommands(organizationID string, deviceGroupID string, deviceID string) ([]*entities.DeviceCommand, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.DeviceCommand, 0)
+	for _, command := range m.commands[m.getKey(organizationID, deviceGroupID, deviceID)] {
+		retrieved := command
+		result = append(result, &retrieved)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created < result[j].Created
+	})
+	return result, nil
+}
+
+func (m *MockupProvider) UpdateCommand(command entities.DeviceCommand, previous entities.CommandStatus) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	current, err := m.unsafeGetCommand(command.OrganizationId, command.DeviceGroupId, command.DeviceId, command.CommandId)
+	if err != nil {
+		return false, err
+	}
+	if current.Status != previous {
+		return false, nil
+	}
+	current.Status = command.Status
+	current.Delivered = command.Delivered
+	current.Completed = command.Completed
+	current.Result = command.Result
+	current.Error = command.Error
+	m.commands[m.getKey(command.OrganizationId, command.DeviceGroupId, command.DeviceId)][command.CommandId] = *current
+	return true, nil
+}
+
+func (m *MockupProvider) RemoveDeviceCommands(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.commands, m.getKey(organizationID, deviceGroupID, deviceID))
+	return nil
+}
+
+func (m *MockupProvider) RemoveGroupCommands(organizationID string, deviceGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	prefix := m.getGroupKey(organizationID, deviceGroupID)
+	for key := range m.commands {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.commands, key)
+		}
+	}
+	return nil
+}
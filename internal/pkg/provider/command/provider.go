@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the command queues of the devices.
+type Provider interface {
+	// AddCommand adds a command to the queue of a device
+	AddCommand(command entities.DeviceCommand) derrors.Error
+
+	// GetCommand returns a command of a device
+	GetCommand(organizationID string, deviceGroupID string, deviceID string, commandID string) (*entities.DeviceCommand, derrors.Error)
+
+	// ListCommands returns the commands of a device, the oldest first
+	ListCommands(organizationID string, deviceGroupID string, deviceID string) ([]*entities.DeviceCommand, derrors.Error)
+
+	// UpdateCommand sets the status and the result of a command if its status has not changed since it was read. It
+	// returns false if the command was updated concurrently
+	UpdateCommand(command entities.DeviceCommand, previous entities.CommandStatus) (bool, derrors.Error)
+
+	// RemoveDeviceCommands removes the commands of a device
+	RemoveDeviceCommands(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+
+	// RemoveGroupCommands removes the commands of all the devices of a device group
+	RemoveGroupCommands(organizationID string, deviceGroupID string) derrors.Error
+}
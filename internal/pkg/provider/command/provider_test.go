@@ -0,0 +1,95 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createCommand(organizationID string, deviceGroupID string, deviceID string, created time.Time) *entities.DeviceCommand {
+	return entities.NewDeviceCommand(organizationID, deviceGroupID, deviceID, "reboot", `{"delay": 10}`, time.Hour, created)
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add a command", func() {
+		command := createCommand(uuid.New().String(), uuid.New().String(), uuid.New().String(), time.Now())
+		err := provider.AddCommand(*command)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		retrieved, err := provider.GetCommand(command.OrganizationId, command.DeviceGroupId, command.DeviceId, command.CommandId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*retrieved).Should(gomega.Equal(*command))
+	})
+	ginkgo.It("Should not be able to get a command that does not exist", func() {
+		_, err := provider.GetCommand(uuid.New().String(), uuid.New().String(), uuid.New().String(), uuid.New().String())
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to list the commands of a device, the oldest first", func() {
+		command := createCommand(uuid.New().String(), uuid.New().String(), uuid.New().String(), time.Now())
+		for i := 3; i > 0; i-- {
+			err := provider.AddCommand(*createCommand(command.OrganizationId, command.DeviceGroupId, command.DeviceId,
+				time.Unix(int64(1000*i), 0)))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		commands, err := provider.ListCommands(command.OrganizationId, command.DeviceGroupId, command.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(commands)).Should(gomega.Equal(3))
+		gomega.Expect(commands[0].Created).Should(gomega.Equal(int64(1000)))
+	})
+	ginkgo.It("Should be able to update a command if its status has not changed", func() {
+		command := createCommand(uuid.New().String(), uuid.New().String(), uuid.New().String(), time.Now())
+		err := provider.AddCommand(*command)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		gomega.Expect(command.Acknowledge(true, "done", "", time.Now())).To(gomega.Succeed())
+		applied, err := provider.UpdateCommand(*command, entities.CommandPending)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(applied).To(gomega.BeTrue())
+		applied, err = provider.UpdateCommand(*command, entities.CommandPending)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(applied).To(gomega.BeFalse())
+
+		retrieved, err := provider.GetCommand(command.OrganizationId, command.DeviceGroupId, command.DeviceId, command.CommandId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved.Status).Should(gomega.Equal(entities.CommandSucceeded))
+		gomega.Expect(retrieved.Result).Should(gomega.Equal("done"))
+	})
+	ginkgo.It("Should be able to remove the commands of a device and of a device group", func() {
+		command := createCommand(uuid.New().String(), uuid.New().String(), uuid.New().String(), time.Now())
+		other := createCommand(command.OrganizationId, command.DeviceGroupId, uuid.New().String(), time.Now())
+		for _, c := range []*entities.DeviceCommand{command, other} {
+			err := provider.AddCommand(*c)
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+
+		err := provider.RemoveDeviceCommands(command.OrganizationId, command.DeviceGroupId, command.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		commands, err := provider.ListCommands(command.OrganizationId, command.DeviceGroupId, command.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(commands).To(gomega.BeEmpty())
+
+		err = provider.RemoveGroupCommands(command.OrganizationId, command.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		commands, err = provider.ListCommands(other.OrganizationId, other.DeviceGroupId, other.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(commands).To(gomega.BeEmpty())
+	})
+}
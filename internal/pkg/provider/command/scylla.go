@@ -0,0 +1,216 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+	"sort"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+var commandColumns = []string{"organization_id", "device_group_id", "device_id", "command_id", "name", "payload",
+	"status", "created", "expires", "delivered", "completed", "result", "error"}
+
+func (sp *ScyllaProvider) unsafeGetCommand(organizationID string, deviceGroupID string, deviceID string, commandID string) (*entities.DeviceCommand, derrors.Error) {
+	var command entities.DeviceCommand
+	stmt, names := qb.Get("device_command").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).Where(qb.Eq("command_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+		"command_id":      commandID,
+	})
+
+	cqlErr := q.GetRelease(&command)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return nil, derrors.NewNotFoundError("command").WithParams(organizationID, deviceGroupID, deviceID, commandID)
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve command")
+	}
+
+	return &command, nil
+}
+
+func (sp *ScyllaProvider) AddCommand(command entities.DeviceCommand) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("device_command").Columns(commandColumns...).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(command)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add command")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) GetCommand(organizationID string, deviceGroupID string, deviceID string, commandID string) (*entities.DeviceCommand, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	return sp.unsafeGetCommand(organizationID, deviceGroupID, deviceID, commandID)
+}
+
+func (sp *ScyllaProvider) ListCommands(organizationID string, deviceGroupID string, deviceID string) ([]*entities.DeviceCommand, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	commands := make([]*entities.DeviceCommand, 0)
+	stmt, names := qb.Select("device_command").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := gocqlx.Select(&commands, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return commands, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list commands")
+	}
+
+	// the commands are clustered by identifier
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Created < commands[j].Created
+	})
+	return commands, nil
+}
+
+// UpdateCommand relies on a lightweight transaction so that a command cannot be acknowledged and cancelled at the
+// same time by different instances of the device manager.
+func (sp *ScyllaProvider) UpdateCommand(command entities.DeviceCommand, previous entities.CommandStatus) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = sp.unsafeGetCommand(command.OrganizationId, command.DeviceGroupId, command.DeviceId, command.CommandId)
+	if err != nil {
+		return false, err
+	}
+
+	stmt, names := qb.Update("device_command").Set("status", "delivered", "completed", "result", "error").
+		Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).Where(qb.Eq("command_id")).
+		If(qb.EqNamed("status", "previous")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": command.OrganizationId,
+		"device_group_id": command.DeviceGroupId,
+		"device_id":       command.DeviceId,
+		"command_id":      command.CommandId,
+		"status":          command.Status,
+		"delivered":       command.Delivered,
+		"completed":       command.Completed,
+		"result":          command.Result,
+		"error":           command.Error,
+		"previous":        previous,
+	})
+	applied, cqlErr := q.MapScanCAS(make(map[string]interface{}))
+	q.Release()
+
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot update command")
+	}
+
+	return applied, nil
+}
+
+func (sp *ScyllaProvider) RemoveDeviceCommands(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_command").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove device commands")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveGroupCommands(organizationID string, deviceGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_command").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove device group commands")
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configuration
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sort"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// configs indexed by organization_id + device_group_id, and by version
+	configs map[string]map[int64]entities.DeviceConfig
+	// active versions indexed by organization_id + device_group_id
+	active map[string]int64
+	// acknowledgements indexed by organization_id + device_group_id, and by device_id
+	acknowledgements map[string]map[string]entities.ConfigAcknowledgement
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		configs:          make(map[string]map[int64]entities.DeviceConfig, 0),
+		active:           make(map[string]int64, 0),
+		acknowledgements: make(map[string]map[string]entities.ConfigAcknowledgement, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string) string {
+	return organizationID + "/" + deviceGroupID
+}
+
+func (m *MockupProvider) AddConfig(config entities.DeviceConfig) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(config.OrganizationId, config.DeviceGroupId)
+	if _, exists := m.configs[key]; !exists {
+		m.configs[key] = make(map[int64]entities.DeviceConfig, 0)
+	}
+	if _, exists := m.configs[key][config.Version]; exists {
+		return false, nil
+	}
+	m.configs[key][config.Version] = config
+	return true, nil
+}
+
+func (m *MockupProvider) GetConfig(organizationID string, deviceGroupID string, version int64) (*entities.DeviceConfig, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	config, exists := m.configs[m.getKey(organizationID, deviceGroupID)][version]
+	if !exists {
+		return nil, derrors.NewNotFoundError("configuration version").WithParams(organizationID, deviceGroupID, version)
+	}
+	return &config, nil
+}
+
+func (m *MockupProvider) ListConfigs(organizationID string, deviceGroupID string) ([]*entities.DeviceConfig, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.DeviceConfig, 0)
+	for _, config := range m.configs[m.getKey(organizationID, deviceGroupID)] {
+		retrieved := config
+		result = append(result, &retrieved)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version > result[j].Version
+	})
+	return result, nil
+}
+
+func (m *MockupProvider) SetActiveVersion(organizationID string, deviceGroupID string, version int64) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.active[m.getKey(organizationID, deviceGroupID)] = version
+	return nil
+}
+
+func (m *MockupProvider) GetActiveVersion(organizationID string, deviceGroupID string) (int64, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.active[m.getKey(organizationID, deviceGroupID)], nil
+}
+
+func (m *MockupProvider) SetAcknowledgement(acknowledgement entities.ConfigAcknowledgement) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(acknowledgement.OrganizationId, acknowledgement.DeviceGroupId)
+	if _, exists := m.acknowledgements[key]; !exists {
+		m.acknowledgements[key] = make(map[string]entities.ConfigAcknowledgement, 0)
+	}
+	m.acknowledgements[key][acknowledgement.DeviceId] = acknowledgement
+	return nil
+}
+
+func (m *MockupProvider) ListAcknowledgements(organizationID string, deviceGroupID string) ([]*entities.ConfigAcknowledgement, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.ConfigAcknowledgement, 0)
+	for _, acknowledgement := range m.acknowledgements[m.getKey(organizationID, deviceGroupID)] {
+		retrieved := acknowledgement
+		result = append(result, &retrieved)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DeviceId < result[j].DeviceId
+	})
+	return result, nil
+}
+
+func (m *MockupProvider) RemoveDeviceAcknowledgement(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.acknowledgements[m.getKey(organizationID, deviceGroupID)], deviceID)
+	return nil
+}
+
+func (m *MockupProvider) RemoveGroupConfigs(organizationID string, deviceGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(organizationID, deviceGroupID)
+	delete(m.configs, key)
+	delete(m.active, key)
+	delete(m.acknowledgements, key)
+	return nil
+}
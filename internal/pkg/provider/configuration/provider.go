@@ -0,0 +1,53 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configuration
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the configuration versions of the device groups and of the configurations acknowledged by the devices.
+type Provider interface {
+	// AddConfig adds a configuration version. It returns false if the version already exists
+	AddConfig(config entities.DeviceConfig) (bool, derrors.Error)
+
+	// GetConfig returns a configuration version
+	GetConfig(organizationID string, deviceGroupID string, version int64) (*entities.DeviceConfig, derrors.Error)
+
+	// ListConfigs returns the configuration versions of a device group, the most recent first
+	ListConfigs(organizationID string, deviceGroupID string) ([]*entities.DeviceConfig, derrors.Error)
+
+	// SetActiveVersion sets the configuration version delivered to the devices of a group
+	SetActiveVersion(organizationID string, deviceGroupID string, version int64) derrors.Error
+
+	// GetActiveVersion returns the configuration version delivered to the devices of a group, or zero if no
+	// configuration has been published
+	GetActiveVersion(organizationID string, deviceGroupID string) (int64, derrors.Error)
+
+	// SetAcknowledgement records the last configuration applied by a device
+	SetAcknowledgement(acknowledgement entities.ConfigAcknowledgement) derrors.Error
+
+	// ListAcknowledgements returns the last configuration applied by each device of a group
+	ListAcknowledgements(organizationID string, deviceGroupID string) ([]*entities.ConfigAcknowledgement, derrors.Error)
+
+	// RemoveDeviceAcknowledgement removes the acknowledgement of a device
+	RemoveDeviceAcknowledgement(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+
+	// RemoveGroupConfigs removes the configuration versions of a device group and the acknowledgements of its devices
+	RemoveGroupConfigs(organizationID string, deviceGroupID string) derrors.Error
+}
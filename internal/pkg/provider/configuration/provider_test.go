@@ -0,0 +1,132 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configuration
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+func createConfig(organizationID string, deviceGroupID string, version int64) *entities.DeviceConfig {
+	return &entities.DeviceConfig{
+		OrganizationId:   organizationID,
+		DeviceGroupId:    deviceGroupID,
+		Version:          version,
+		Content:          `{"interval": 60}`,
+		OverlaySelectors: []string{"env=dev"},
+		OverlayContents:  []string{`{"interval": 10}`},
+		Description:      "test configuration",
+		Created:          1000,
+	}
+}
+
+func createAcknowledgement(organizationID string, deviceGroupID string, deviceID string) *entities.ConfigAcknowledgement {
+	return &entities.ConfigAcknowledgement{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Version:        1,
+		Etag:           "1-0123456789abcdef",
+		Acknowledged:   1000,
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add a configuration version only once", func() {
+		config := createConfig(uuid.New().String(), uuid.New().String(), 1)
+		added, err := provider.AddConfig(*config)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(added).To(gomega.BeTrue())
+		added, err = provider.AddConfig(*config)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(added).To(gomega.BeFalse())
+
+		retrieved, err := provider.GetConfig(config.OrganizationId, config.DeviceGroupId, config.Version)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*retrieved).Should(gomega.Equal(*config))
+	})
+	ginkgo.It("Should not be able to get a configuration version that does not exist", func() {
+		_, err := provider.GetConfig(uuid.New().String(), uuid.New().String(), 1)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to list the configuration versions, the most recent first", func() {
+		config := createConfig(uuid.New().String(), uuid.New().String(), 1)
+		for version := int64(1); version <= 3; version++ {
+			_, err := provider.AddConfig(*createConfig(config.OrganizationId, config.DeviceGroupId, version))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		configs, err := provider.ListConfigs(config.OrganizationId, config.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(configs)).Should(gomega.Equal(3))
+		gomega.Expect(configs[0].Version).Should(gomega.Equal(int64(3)))
+	})
+	ginkgo.It("Should be able to set the active version", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		version, err := provider.GetActiveVersion(organizationID, deviceGroupID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(version).Should(gomega.Equal(int64(0)))
+
+		err = provider.SetActiveVersion(organizationID, deviceGroupID, 2)
+		gomega.Expect(err).To(gomega.Succeed())
+		version, err = provider.GetActiveVersion(organizationID, deviceGroupID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(version).Should(gomega.Equal(int64(2)))
+	})
+	ginkgo.It("Should be able to record the acknowledgements of the devices", func() {
+		acknowledgement := createAcknowledgement(uuid.New().String(), uuid.New().String(), uuid.New().String())
+		err := provider.SetAcknowledgement(*acknowledgement)
+		gomega.Expect(err).To(gomega.Succeed())
+		acknowledgement.Version = 2
+		err = provider.SetAcknowledgement(*acknowledgement)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		acknowledgements, err := provider.ListAcknowledgements(acknowledgement.OrganizationId, acknowledgement.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(acknowledgements)).Should(gomega.Equal(1))
+		gomega.Expect(*acknowledgements[0]).Should(gomega.Equal(*acknowledgement))
+
+		err = provider.RemoveDeviceAcknowledgement(acknowledgement.OrganizationId, acknowledgement.DeviceGroupId, acknowledgement.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		acknowledgements, err = provider.ListAcknowledgements(acknowledgement.OrganizationId, acknowledgement.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(acknowledgements).To(gomega.BeEmpty())
+	})
+	ginkgo.It("Should be able to remove the configurations of a device group", func() {
+		config := createConfig(uuid.New().String(), uuid.New().String(), 1)
+		_, err := provider.AddConfig(*config)
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.SetActiveVersion(config.OrganizationId, config.DeviceGroupId, config.Version)
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.SetAcknowledgement(*createAcknowledgement(config.OrganizationId, config.DeviceGroupId, uuid.New().String()))
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveGroupConfigs(config.OrganizationId, config.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		configs, err := provider.ListConfigs(config.OrganizationId, config.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(configs).To(gomega.BeEmpty())
+		version, err := provider.GetActiveVersion(config.OrganizationId, config.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(version).Should(gomega.Equal(int64(0)))
+		acknowledgements, err := provider.ListAcknowledgements(config.OrganizationId, config.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(acknowledgements).To(gomega.BeEmpty())
+	})
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configuration
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+var configColumns = []string{"organization_id", "device_group_id", "version", "content", "overlay_selectors",
+	"overlay_contents", "description", "created"}
+
+// AddConfig relies on a lightweight transaction so that two instances of the device manager cannot publish the
+// same version.
+func (sp *ScyllaProvider) AddConfig(config entities.DeviceConfig) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	stmt, names := qb.Insert("device_config").Columns(configColumns...).Unique().ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(config)
+	applied, cqlErr := q.MapScanCAS(make(map[string]interface{}))
+	q.Release()
+
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot add configuration version")
+	}
+
+	return applied, nil
+}
+
+func (sp *ScyllaProvider) GetConfig(organizationID string, deviceGroupID string, version int64) (*entities.DeviceConfig, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	var config entities.DeviceConfig
+	stmt, names := qb.Get("device_config").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("version")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"version":         version,
+	})
+
+	cqlErr := q.GetRelease(&config)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return nil, derrors.NewNotFoundError("configuration version").WithParams(organizationID, deviceGroupID, version)
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve configuration version")
+	}
+
+	return &config, nil
+}
+
+func (sp *ScyllaProvider) ListConfigs(organizationID string, deviceGroupID string) ([]*entities.DeviceConfig, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]*entities.DeviceConfig, 0)
+	stmt, names := qb.Select("device_config").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+
+	cqlErr := gocqlx.Select(&configs, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return configs, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list configuration versions")
+	}
+
+	return configs, nil
+}
+
+func (sp *ScyllaProvider) SetActiveVersion(organizationID string, deviceGroupID string, version int64) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("device_config_active").Columns("organization_id", "device_group_id", "version").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"version":         version,
+	})
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot set active configuration version")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) GetActiveVersion(organizationID string, deviceGroupID string) (int64, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+	stmt, names := qb.Select("device_config_active").Columns("version").
+		Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+
+	cqlErr := q.GetRelease(&version)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return 0, nil
+		}
+		return 0, derrors.AsError(cqlErr, "cannot retrieve active configuration version")
+	}
+
+	return version, nil
+}
+
+func (sp *ScyllaProvider) SetAcknowledgement(acknowledgement entities.ConfigAcknowledgement) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("device_config_ack").Columns("organization_id", "device_group_id", "device_id",
+		"version", "etag", "acknowledged").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(acknowledgement)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot set configuration acknowledgement")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) ListAcknowledgements(organizationID string, deviceGroupID string) ([]*entities.ConfigAcknowledgement, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	acknowledgements := make([]*entities.ConfigAcknowledgement, 0)
+	stmt, names := qb.Select("device_config_ack").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+
+	cqlErr := gocqlx.Select(&acknowledgements, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return acknowledgements, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list configuration acknowledgements")
+	}
+
+	return acknowledgements, nil
+}
+
+func (sp *ScyllaProvider) RemoveDeviceAcknowledgement(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_config_ack").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove configuration acknowledgement")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveGroupConfigs(organizationID string, deviceGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"device_config", "device_config_active", "device_config_ack"} {
+		stmt, _ := qb.Delete(table).Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+		cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID).Exec()
+		if cqlErr != nil {
+			return derrors.AsError(cqlErr, "cannot remove device group configurations")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deletion
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// deleted devices indexed by organization_id + device_group_id, device_id
+	deleted map[string]map[string]*entities.DeletedDevice
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		deleted: make(map[string]map[string]*entities.DeletedDevice, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string) string {
+	return organizationID + "/" + deviceGroupID
+}
+
+func (m *MockupProvider) AddDeletedDevice(deleted entities.DeletedDevice) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(deleted.OrganizationId, deleted.DeviceGroupId)
+	group, exists := m.deleted[key]
+	if !exists {
+		group = make(map[string]*entities.DeletedDevice, 0)
+		m.deleted[key] = group
+	}
+	group[deleted.DeviceId] = &deleted
+	return nil
+}
+
+func (m *MockupProvider) GetDeletedDevice(organizationID string, deviceGroupID string, deviceID string) (*entities.DeletedDevice, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	deleted, exists := m.deleted[m.getKey(organizationID, deviceGroupID)][deviceID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("deleted device").WithParams(organizationID, deviceGroupID, deviceID)
+	}
+	return deleted, nil
+}
+
+func (m *MockupProvider) ExistsDeletedDevice(organizationID string, deviceGroupID string, deviceID string) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	_, exists := m.deleted[m.getKey(organizationID, deviceGroupID)][deviceID]
+	return exists, nil
+}
+
+func (m *MockupProvider) ListDeletedDevices(organizationID string, deviceGroupID string) ([]*entities.DeletedDevice, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.DeletedDevice, 0)
+	for _, deleted := range m.deleted[m.getKey(organizationID, deviceGroupID)] {
+		result = append(result, deleted)
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) ListExpiredDeletedDevices(timestamp int64) ([]*entities.DeletedDevice, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.DeletedDevice, 0)
+	for _, group := range m.deleted {
+		for _, deleted := range group {
+			if deleted.PurgeAfter <= timestamp {
+				result = append(result, deleted)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) RemoveDeletedDevice(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(organizationID, deviceGroupID)
+	if _, exists := m.deleted[key][deviceID]; !exists {
+		return derrors.NewNotFoundError("deleted device").WithParams(organizationID, deviceGroupID, deviceID)
+	}
+	delete(m.deleted[key], deviceID)
+	return nil
+}
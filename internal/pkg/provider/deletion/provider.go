@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deletion
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider stores the devices that have been removed and can still be restored.
+type Provider interface {
+	// AddDeletedDevice adds the removal record of a device
+	AddDeletedDevice(deleted entities.DeletedDevice) derrors.Error
+
+	// GetDeletedDevice returns the removal record of a device
+	GetDeletedDevice(organizationID string, deviceGroupID string, deviceID string) (*entities.DeletedDevice, derrors.Error)
+
+	// ExistsDeletedDevice checks if a device has been removed
+	ExistsDeletedDevice(organizationID string, deviceGroupID string, deviceID string) (bool, derrors.Error)
+
+	// ListDeletedDevices returns the removed devices of a device group
+	ListDeletedDevices(organizationID string, deviceGroupID string) ([]*entities.DeletedDevice, derrors.Error)
+
+	// ListExpiredDeletedDevices returns the removed devices of all the groups that must be purged before a given
+	// timestamp
+	ListExpiredDeletedDevices(timestamp int64) ([]*entities.DeletedDevice, derrors.Error)
+
+	// RemoveDeletedDevice removes the removal record of a device
+	RemoveDeletedDevice(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+}
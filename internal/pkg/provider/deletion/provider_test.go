@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deletion
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createDeletedDevice(organizationID string, deviceGroupID string, purgeAfter int64) *entities.DeletedDevice {
+	return &entities.DeletedDevice{
+		OrganizationId:     organizationID,
+		DeviceGroupId:      deviceGroupID,
+		DeviceId:           uuid.New().String(),
+		Deleted:            time.Now().Unix(),
+		PurgeAfter:         purgeAfter,
+		CredentialsEnabled: true,
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add and retrieve a deleted device", func() {
+		deleted := createDeletedDevice(uuid.New().String(), uuid.New().String(), time.Now().Add(time.Hour).Unix())
+		err := provider.AddDeletedDevice(*deleted)
+		gomega.Expect(err).To(gomega.Succeed())
+		retrieved, err := provider.GetDeletedDevice(deleted.OrganizationId, deleted.DeviceGroupId, deleted.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*retrieved).Should(gomega.Equal(*deleted))
+		exists, err := provider.ExistsDeletedDevice(deleted.OrganizationId, deleted.DeviceGroupId, deleted.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(exists).To(gomega.BeTrue())
+	})
+	ginkgo.It("Should not be able to retrieve a non existing deleted device", func() {
+		_, err := provider.GetDeletedDevice(uuid.New().String(), uuid.New().String(), uuid.New().String())
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to list the deleted devices of a group", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		for i := 0; i < 3; i++ {
+			err := provider.AddDeletedDevice(*createDeletedDevice(organizationID, deviceGroupID, time.Now().Add(time.Hour).Unix()))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		list, err := provider.ListDeletedDevices(organizationID, deviceGroupID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(list)).Should(gomega.Equal(3))
+	})
+	ginkgo.It("Should be able to list the expired deleted devices", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		expired := createDeletedDevice(organizationID, deviceGroupID, time.Now().Add(-time.Minute).Unix())
+		err := provider.AddDeletedDevice(*expired)
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.AddDeletedDevice(*createDeletedDevice(organizationID, deviceGroupID, time.Now().Add(time.Hour).Unix()))
+		gomega.Expect(err).To(gomega.Succeed())
+
+		list, err := provider.ListExpiredDeletedDevices(time.Now().Unix())
+		gomega.Expect(err).To(gomega.Succeed())
+		found := 0
+		for _, d := range list {
+			if d.OrganizationId == organizationID {
+				gomega.Expect(d.DeviceId).Should(gomega.Equal(expired.DeviceId))
+				found++
+			}
+		}
+		gomega.Expect(found).Should(gomega.Equal(1))
+	})
+	ginkgo.It("Should be able to remove a deleted device", func() {
+		deleted := createDeletedDevice(uuid.New().String(), uuid.New().String(), time.Now().Add(time.Hour).Unix())
+		err := provider.AddDeletedDevice(*deleted)
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.RemoveDeletedDevice(deleted.OrganizationId, deleted.DeviceGroupId, deleted.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		exists, err := provider.ExistsDeletedDevice(deleted.OrganizationId, deleted.DeviceGroupId, deleted.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(exists).To(gomega.BeFalse())
+	})
+	ginkgo.It("Should not be able to remove a non existing deleted device", func() {
+		err := provider.RemoveDeletedDevice(uuid.New().String(), uuid.New().String(), uuid.New().String())
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deletion
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+func (sp *ScyllaProvider) AddDeletedDevice(deleted entities.DeletedDevice) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("deleted_device").Columns("organization_id", "device_group_id", "device_id",
+		"deleted", "purge_after", "credentials_enabled").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(deleted)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add deleted device")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) GetDeletedDevice(organizationID string, deviceGroupID string, deviceID string) (*entities.DeletedDevice, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted entities.DeletedDevice
+	stmt, names := qb.Get("deleted_device").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := q.GetRelease(&deleted)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return nil, derrors.NewNotFoundError("deleted device").WithParams(organizationID, deviceGroupID, deviceID)
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve deleted device")
+	}
+
+	return &deleted, nil
+}
+
+func (sp *ScyllaProvider) unsafeExistsDeletedDevice(organizationID string, deviceGroupID string, deviceID string) (bool, derrors.Error) {
+	var count int
+	stmt, names := qb.Select("deleted_device").CountAll().Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := q.GetRelease(&count)
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot determine if the device has been deleted")
+	}
+
+	return count == 1, nil
+}
+
+func (sp *ScyllaProvider) ExistsDeletedDevice(organizationID string, deviceGroupID string, deviceID string) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	return sp.unsafeExistsDeletedDevice(organizationID, deviceGroupID, deviceID)
+}
+
+func (sp *ScyllaProvider) ListDeletedDevices(organizationID string, deviceGroupID string) ([]*entities.DeletedDevice, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make([]*entities.DeletedDevice, 0)
+	stmt, names := qb.Select("deleted_device").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+
+	cqlErr := gocqlx.Select(&deleted, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return deleted, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list deleted devices")
+	}
+
+	return deleted, nil
+}
+
+// ListExpiredDeletedDevices reads all the deleted devices. The table only contains the devices that can still be
+// restored, so it is expected to be small.
+func (sp *ScyllaProvider) ListExpiredDeletedDevices(timestamp int64) ([]*entities.DeletedDevice, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make([]*entities.DeletedDevice, 0)
+	stmt, names := qb.Select("deleted_device").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names)
+
+	cqlErr := gocqlx.Select(&deleted, q.Query)
+	if cqlErr != nil && cqlErr.Error() != rowNotFound {
+		return nil, derrors.AsError(cqlErr, "cannot list expired deleted devices")
+	}
+
+	result := make([]*entities.DeletedDevice, 0)
+	for _, d := range deleted {
+		if d.PurgeAfter <= timestamp {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+func (sp *ScyllaProvider) RemoveDeletedDevice(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExistsDeletedDevice(organizationID, deviceGroupID, deviceID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return derrors.NewNotFoundError("deleted device").WithParams(organizationID, deviceGroupID, deviceID)
+	}
+
+	stmt, _ := qb.Delete("deleted_device").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove deleted device")
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dynamicgroup
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// groups indexed by organization_id, dynamic_group_id
+	groups map[string]map[string]*entities.DynamicGroup
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		groups: make(map[string]map[string]*entities.DynamicGroup, 0),
+	}
+}
+
+func (m *MockupProvider) AddDynamicGroup(group entities.DynamicGroup) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	organization, exists := m.groups[group.OrganizationId]
+	if !exists {
+		organization = make(map[string]*entities.DynamicGroup, 0)
+		m.groups[group.OrganizationId] = organization
+	}
+	if _, exists := organization[group.DynamicGroupId]; exists {
+		return derrors.NewAlreadyExistsError("dynamic group").WithParams(group.OrganizationId, group.DynamicGroupId)
+	}
+	organization[group.DynamicGroupId] = &group
+	return nil
+}
+
+func (m *MockupProvider) GetDynamicGroup(organizationID string, dynamicGroupID string) (*entities.DynamicGroup, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	group, exists := m.groups[organizationID][dynamicGroupID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("dynamic group").WithParams(organizationID, dynamicGroupID)
+	}
+	result := *group
+	return &result, nil
+}
+
+func (m *MockupProvider) ListDynamicGroups(organizationID string) ([]*entities.DynamicGroup, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.DynamicGroup, 0)
+	for _, group := range m.groups[organizationID] {
+		copied := *group
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) UpdateDynamicGroup(group entities.DynamicGroup) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	organization := m.groups[group.OrganizationId]
+	if _, exists := organization[group.DynamicGroupId]; !exists {
+		return derrors.NewNotFoundError("dynamic group").WithParams(group.OrganizationId, group.DynamicGroupId)
+	}
+	organization[group.DynamicGroupId] = &group
+	return nil
+}
+
+func (m *MockupProvider) RemoveDynamicGroup(organizationID string, dynamicGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	organization := m.groups[organizationID]
+	if _, exists := organization[dynamicGroupID]; !exists {
+		return derrors.NewNotFoundError("dynamic group").WithParams(organizationID, dynamicGroupID)
+	}
+	delete(organization, dynamicGroupID)
+	return nil
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dynamicgroup
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the dynamic groups of the organizations.
+type Provider interface {
+	// AddDynamicGroup adds a new dynamic group
+	AddDynamicGroup(group entities.DynamicGroup) derrors.Error
+
+	// GetDynamicGroup returns a dynamic group
+	GetDynamicGroup(organizationID string, dynamicGroupID string) (*entities.DynamicGroup, derrors.Error)
+
+	// ListDynamicGroups returns the dynamic groups of an organization
+	ListDynamicGroups(organizationID string) ([]*entities.DynamicGroup, derrors.Error)
+
+	// UpdateDynamicGroup replaces an existing dynamic group
+	UpdateDynamicGroup(group entities.DynamicGroup) derrors.Error
+
+	// RemoveDynamicGroup removes a dynamic group
+	RemoveDynamicGroup(organizationID string, dynamicGroupID string) derrors.Error
+}
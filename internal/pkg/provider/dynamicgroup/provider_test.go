@@ -0,0 +1,103 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dynamicgroup
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createDynamicGroup(organizationID string) *entities.DynamicGroup {
+	return &entities.DynamicGroup{
+		OrganizationId:  organizationID,
+		DynamicGroupId:  uuid.New().String(),
+		Name:            "cameras",
+		LabelSelector:   "type=camera",
+		AttributeFilter: "os.name=linux",
+		DeviceStatus:    "ONLINE",
+		Created:         time.Now().Unix(),
+		Updated:         time.Now().Unix(),
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add a dynamic group", func() {
+		group := createDynamicGroup(uuid.New().String())
+		err := provider.AddDynamicGroup(*group)
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.AddDynamicGroup(*group)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to get a dynamic group", func() {
+		group := createDynamicGroup(uuid.New().String())
+		err := provider.AddDynamicGroup(*group)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		retrieved, err := provider.GetDynamicGroup(group.OrganizationId, group.DynamicGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*retrieved).Should(gomega.Equal(*group))
+
+		_, err = provider.GetDynamicGroup(group.OrganizationId, uuid.New().String())
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to list the dynamic groups of an organization", func() {
+		organizationID := uuid.New().String()
+		for i := 0; i < 3; i++ {
+			err := provider.AddDynamicGroup(*createDynamicGroup(organizationID))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		groups, err := provider.ListDynamicGroups(organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(groups)).Should(gomega.Equal(3))
+
+		groups, err = provider.ListDynamicGroups(uuid.New().String())
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(groups).To(gomega.BeEmpty())
+	})
+	ginkgo.It("Should be able to update a dynamic group", func() {
+		group := createDynamicGroup(uuid.New().String())
+		err := provider.UpdateDynamicGroup(*group)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		err = provider.AddDynamicGroup(*group)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		group.LabelSelector = "type=sensor"
+		group.DeviceStatus = ""
+		err = provider.UpdateDynamicGroup(*group)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		retrieved, err := provider.GetDynamicGroup(group.OrganizationId, group.DynamicGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved.LabelSelector).Should(gomega.Equal("type=sensor"))
+		gomega.Expect(retrieved.DeviceStatus).Should(gomega.BeEmpty())
+	})
+	ginkgo.It("Should be able to remove a dynamic group", func() {
+		group := createDynamicGroup(uuid.New().String())
+		err := provider.AddDynamicGroup(*group)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveDynamicGroup(group.OrganizationId, group.DynamicGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.RemoveDynamicGroup(group.OrganizationId, group.DynamicGroupId)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = provider.GetDynamicGroup(group.OrganizationId, group.DynamicGroupId)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dynamicgroup
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+var dynamicGroupColumns = []string{"organization_id", "dynamic_group_id", "name", "label_selector", "attribute_filter",
+	"device_status", "created", "updated"}
+
+func (sp *ScyllaProvider) unsafeExists(organizationID string, dynamicGroupID string) (bool, derrors.Error) {
+	var count int
+	stmt, names := qb.Select("dynamic_group").CountAll().Where(qb.Eq("organization_id")).
+		Where(qb.Eq("dynamic_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id":  organizationID,
+		"dynamic_group_id": dynamicGroupID,
+	})
+
+	cqlErr := q.GetRelease(&count)
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot determine if dynamic group exists")
+	}
+
+	return count == 1, nil
+}
+
+func (sp *ScyllaProvider) AddDynamicGroup(group entities.DynamicGroup) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("dynamic_group").Columns(dynamicGroupColumns...).Unique().ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(group)
+	applied, cqlErr := q.MapScanCAS(make(map[string]interface{}))
+	q.Release()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add dynamic group")
+	}
+	if !applied {
+		return derrors.NewAlreadyExistsError("dynamic group").WithParams(group.OrganizationId, group.DynamicGroupId)
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) GetDynamicGroup(organizationID string, dynamicGroupID string) (*entities.DynamicGroup, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	var group entities.DynamicGroup
+	stmt, names := qb.Get("dynamic_group").Where(qb.Eq("organization_id")).Where(qb.Eq("dynamic_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id":  organizationID,
+		"dynamic_group_id": dynamicGroupID,
+	})
+
+	cqlErr := q.GetRelease(&group)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return nil, derrors.NewNotFoundError("dynamic group").WithParams(organizationID, dynamicGroupID)
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve dynamic group")
+	}
+
+	return &group, nil
+}
+
+func (sp *ScyllaProvider) ListDynamicGroups(organizationID string) ([]*entities.DynamicGroup, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*entities.DynamicGroup, 0)
+	stmt, names := qb.Select("dynamic_group").Where(qb.Eq("organization_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+	})
+
+	cqlErr := gocqlx.Select(&groups, q.Query)
+	if cqlErr != nil && cqlErr.Error() != rowNotFound {
+		return nil, derrors.AsError(cqlErr, "cannot list dynamic groups")
+	}
+
+	return groups, nil
+}
+
+func (sp *ScyllaProvider) UpdateDynamicGroup(group entities.DynamicGroup) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExists(group.OrganizationId, group.DynamicGroupId)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return derrors.NewNotFoundError("dynamic group").WithParams(group.OrganizationId, group.DynamicGroupId)
+	}
+
+	stmt, names := qb.Insert("dynamic_group").Columns(dynamicGroupColumns...).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(group)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot update dynamic group")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveDynamicGroup(organizationID string, dynamicGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExists(organizationID, dynamicGroupID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return derrors.NewNotFoundError("dynamic group").WithParams(organizationID, dynamicGroupID)
+	}
+
+	stmt, _ := qb.Delete("dynamic_group").Where(qb.Eq("organization_id")).Where(qb.Eq("dynamic_group_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, dynamicGroupID).Exec()
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove dynamic group")
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"strings"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// locations indexed by organization_id, device_group_id + device_id
+	locations map[string]map[string]*entities.DeviceLocation
+	// indexed organizations
+	indexed map[string]bool
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		locations: make(map[string]map[string]*entities.DeviceLocation, 0),
+		indexed:   make(map[string]bool, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(deviceGroupID string, deviceID string) string {
+	return deviceGroupID + "/" + deviceID
+}
+
+func (m *MockupProvider) SetDeviceLocation(location entities.DeviceLocation) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	organization, exists := m.locations[location.OrganizationId]
+	if !exists {
+		organization = make(map[string]*entities.DeviceLocation, 0)
+		m.locations[location.OrganizationId] = organization
+	}
+	organization[m.getKey(location.DeviceGroupId, location.DeviceId)] = &location
+	return nil
+}
+
+func (m *MockupProvider) RemoveDeviceLocation(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	organization, exists := m.locations[organizationID]
+	if exists {
+		delete(organization, m.getKey(deviceGroupID, deviceID))
+	}
+	return nil
+}
+
+func (m *MockupProvider) RemoveDeviceGroup(organizationID string, deviceGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	organization, exists := m.locations[organizationID]
+	if exists {
+		for key, location := range organization {
+			if location.DeviceGroupId == deviceGroupID {
+				delete(organization, key)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MockupProvider) SearchLocations(organizationID string, prefixes []string) ([]*entities.DeviceLocation, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.DeviceLocation, 0)
+	for _, location := range m.locations[organizationID] {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(location.Geohash, prefix) {
+				result = append(result, location)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) IsOrganizationIndexed(organizationID string) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.indexed[organizationID], nil
+}
+
+func (m *MockupProvider) SetOrganizationIndexed(organizationID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.indexed[organizationID] = true
+	return nil
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the spatial index with the last known location of the devices of an organization.
+type Provider interface {
+	// SetDeviceLocation adds or replaces the location of a device
+	SetDeviceLocation(location entities.DeviceLocation) derrors.Error
+
+	// RemoveDeviceLocation removes the location of a device
+	RemoveDeviceLocation(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+
+	// RemoveDeviceGroup removes the locations of all the devices of a group
+	RemoveDeviceGroup(organizationID string, deviceGroupID string) derrors.Error
+
+	// SearchLocations returns the locations of an organization whose geohash starts with any of the prefixes
+	SearchLocations(organizationID string, prefixes []string) ([]*entities.DeviceLocation, derrors.Error)
+
+	// IsOrganizationIndexed checks if the index contains the locations of all the devices of an organization
+	IsOrganizationIndexed(organizationID string) (bool, derrors.Error)
+
+	// SetOrganizationIndexed marks an organization as completely indexed
+	SetOrganizationIndexed(organizationID string) derrors.Error
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createLocation(organizationID string, deviceGroupID string, latitude float64, longitude float64) *entities.DeviceLocation {
+	return entities.NewDeviceLocation(organizationID, deviceGroupID, uuid.New().String(),
+		entities.GeoPoint{Latitude: latitude, Longitude: longitude}, time.Now().Unix())
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add the location of a device", func() {
+		location := createLocation(uuid.New().String(), uuid.New().String(), 40.4168, -3.7038)
+		err := provider.SetDeviceLocation(*location)
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to search locations by geohash prefix", func() {
+		organizationID := uuid.New().String()
+		madrid := createLocation(organizationID, uuid.New().String(), 40.4168, -3.7038)
+		err := provider.SetDeviceLocation(*madrid)
+		gomega.Expect(err).To(gomega.Succeed())
+		paris := createLocation(organizationID, uuid.New().String(), 48.8566, 2.3522)
+		err = provider.SetDeviceLocation(*paris)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		result, err := provider.SearchLocations(organizationID, []string{madrid.Geohash[:4], "zzzz"})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(result)).Should(gomega.Equal(1))
+		gomega.Expect(result[0].DeviceId).Should(gomega.Equal(madrid.DeviceId))
+		gomega.Expect(result[0].Latitude).Should(gomega.Equal(madrid.Latitude))
+	})
+	ginkgo.It("Should be able to move a device", func() {
+		location := createLocation(uuid.New().String(), uuid.New().String(), 40.4168, -3.7038)
+		err := provider.SetDeviceLocation(*location)
+		gomega.Expect(err).To(gomega.Succeed())
+		moved := entities.NewDeviceLocation(location.OrganizationId, location.DeviceGroupId, location.DeviceId,
+			entities.GeoPoint{Latitude: 48.8566, Longitude: 2.3522}, time.Now().Unix())
+		err = provider.SetDeviceLocation(*moved)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		result, err := provider.SearchLocations(location.OrganizationId, []string{location.Geohash[:4]})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result).To(gomega.BeEmpty())
+		result, err = provider.SearchLocations(location.OrganizationId, []string{moved.Geohash[:4]})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(result)).Should(gomega.Equal(1))
+	})
+	ginkgo.It("Should be able to remove the location of a device", func() {
+		location := createLocation(uuid.New().String(), uuid.New().String(), 40.4168, -3.7038)
+		err := provider.SetDeviceLocation(*location)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveDeviceLocation(location.OrganizationId, location.DeviceGroupId, location.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		result, err := provider.SearchLocations(location.OrganizationId, []string{location.Geohash[:1]})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result).To(gomega.BeEmpty())
+	})
+	ginkgo.It("Should be able to remove the locations of a group", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		for i := 0; i < 3; i++ {
+			err := provider.SetDeviceLocation(*createLocation(organizationID, deviceGroupID, 40.4168, -3.7038))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		other := createLocation(organizationID, uuid.New().String(), 40.4168, -3.7038)
+		err := provider.SetDeviceLocation(*other)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveDeviceGroup(organizationID, deviceGroupID)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		result, err := provider.SearchLocations(organizationID, []string{other.Geohash[:1]})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(result)).Should(gomega.Equal(1))
+	})
+	ginkgo.It("Should be able to mark an organization as indexed", func() {
+		organizationID := uuid.New().String()
+		indexed, err := provider.IsOrganizationIndexed(organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(indexed).Should(gomega.BeFalse())
+
+		err = provider.SetOrganizationIndexed(organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		indexed, err = provider.IsOrganizationIndexed(organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(indexed).Should(gomega.BeTrue())
+	})
+}
@@ -0,0 +1,259 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+	"time"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+// unsafeGetGeohash returns the geohash under which the location of a device is stored, if any.
+func (sp *ScyllaProvider) unsafeGetGeohash(organizationID string, deviceGroupID string, deviceID string) (string, bool, derrors.Error) {
+	var geohash string
+	stmt, names := qb.Get("device_location_key").Columns("geohash").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := q.GetRelease(&geohash)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return "", false, nil
+		}
+		return "", false, derrors.AsError(cqlErr, "cannot get the location of the device")
+	}
+	return geohash, true, nil
+}
+
+// unsafeRemoveLocation removes the location of a device stored under a geohash.
+func (sp *ScyllaProvider) unsafeRemoveLocation(organizationID string, geohash string, deviceGroupID string, deviceID string) derrors.Error {
+	stmt, _ := qb.Delete("device_location").Where(qb.Eq("organization_id")).Where(qb.Eq("geohash")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, geohash, deviceGroupID, deviceID).Exec()
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove the location of the device")
+	}
+	return nil
+}
+
+// SetDeviceLocation stores the location in the device_location table, clustered by geohash, and the geohash in the
+// device_location_key table so the previous location can be removed when the device moves.
+func (sp *ScyllaProvider) SetDeviceLocation(location entities.DeviceLocation) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	previous, exists, err := sp.unsafeGetGeohash(location.OrganizationId, location.DeviceGroupId, location.DeviceId)
+	if err != nil {
+		return err
+	}
+	if exists && previous != location.Geohash {
+		err = sp.unsafeRemoveLocation(location.OrganizationId, previous, location.DeviceGroupId, location.DeviceId)
+		if err != nil {
+			return err
+		}
+	}
+
+	stmt, names := qb.Insert("device_location").Columns("organization_id", "geohash", "device_group_id", "device_id",
+		"latitude", "longitude", "updated").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(location)
+	cqlErr := q.ExecRelease()
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add the location of the device")
+	}
+
+	stmt, names = qb.Insert("device_location_key").Columns("organization_id", "device_group_id", "device_id", "geohash").ToCql()
+	q = gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(location)
+	cqlErr = q.ExecRelease()
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add the location of the device")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveDeviceLocation(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	geohash, exists, err := sp.unsafeGetGeohash(organizationID, deviceGroupID, deviceID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	err = sp.unsafeRemoveLocation(organizationID, geohash, deviceGroupID, deviceID)
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_location_key").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove the location of the device")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveDeviceGroup(organizationID string, deviceGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*entities.DeviceLocation, 0)
+	stmt, names := qb.Select("device_location_key").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+	cqlErr := gocqlx.Select(&keys, q.Query)
+	if cqlErr != nil && cqlErr.Error() != rowNotFound {
+		return derrors.AsError(cqlErr, "cannot list the locations of the device group")
+	}
+
+	for _, key := range keys {
+		err = sp.unsafeRemoveLocation(organizationID, key.Geohash, deviceGroupID, key.DeviceId)
+		if err != nil {
+			return err
+		}
+	}
+
+	stmt, _ = qb.Delete("device_location_key").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	cqlErr = sp.Session.Query(stmt, organizationID, deviceGroupID).Exec()
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove the locations of the device group")
+	}
+
+	return nil
+}
+
+// SearchLocations runs a range query on the geohash clustering column for each prefix.
+func (sp *ScyllaProvider) SearchLocations(organizationID string, prefixes []string) ([]*entities.DeviceLocation, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*entities.DeviceLocation, 0)
+	stmt, names := qb.Select("device_location").Where(qb.Eq("organization_id"),
+		qb.GtOrEqNamed("geohash", "geohash_from"), qb.LtNamed("geohash", "geohash_to")).ToCql()
+	for _, prefix := range prefixes {
+		locations := make([]*entities.DeviceLocation, 0)
+		q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+			"organization_id": organizationID,
+			"geohash_from":    prefix,
+			// ~ sorts after all the characters of the geohash alphabet
+			"geohash_to": prefix + "~",
+		})
+		cqlErr := gocqlx.Select(&locations, q.Query)
+		if cqlErr != nil && cqlErr.Error() != rowNotFound {
+			return nil, derrors.AsError(cqlErr, "cannot search device locations")
+		}
+		result = append(result, locations...)
+	}
+	return result, nil
+}
+
+func (sp *ScyllaProvider) IsOrganizationIndexed(organizationID string) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	var count int
+	stmt, names := qb.Select("location_indexed_organization").CountAll().Where(qb.Eq("organization_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+	})
+
+	cqlErr := q.GetRelease(&count)
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot determine if the organization locations are indexed")
+	}
+
+	return count == 1, nil
+}
+
+func (sp *ScyllaProvider) SetOrganizationIndexed(organizationID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("location_indexed_organization").Columns("organization_id", "indexed").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"indexed":         time.Now().Unix(),
+	})
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot mark the organization locations as indexed")
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geofence
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sort"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// geofences indexed by organization_id + device_group_id, geofence_id
+	geofences map[string]map[string]*entities.Geofence
+	// events indexed by organization_id + device_group_id, sorted by timestamp
+	events map[string][]*entities.GeofenceEvent
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		geofences: make(map[string]map[string]*entities.Geofence, 0),
+		events:    make(map[string][]*entities.GeofenceEvent, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string) string {
+	return organizationID + "/" + deviceGroupID
+}
+
+func (m *MockupProvider) AddGeofence(fence entities.Geofence) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(fence.OrganizationId, fence.DeviceGroupId)
+	group, exists := m.geofences[key]
+	if !exists {
+		group = make(map[string]*entities.Geofence, 0)
+		m.geofences[key] = group
+	}
+	if _, exists := group[fence.GeofenceId]; exists {
+		return derrors.NewAlreadyExistsError("geofence").WithParams(fence.OrganizationId, fence.DeviceGroupId, fence.GeofenceId)
+	}
+	group[fence.GeofenceId] = &fence
+	return nil
+}
+
+func (m *MockupProvider) ListGeofences(organizationID string, deviceGroupID string) ([]*entities.Geofence, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.Geofence, 0)
+	for _, fence := range m.geofences[m.getKey(organizationID, deviceGroupID)] {
+		result = append(result, fence)
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) RemoveGeofence(organizationID string, deviceGroupID string, geofenceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	group := m.geofences[m.getKey(organizationID, deviceGroupID)]
+	if _, exists := group[geofenceID]; !exists {
+		return derrors.NewNotFoundError("geofence").WithParams(organizationID, deviceGroupID, geofenceID)
+	}
+	delete(group, geofenceID)
+	return nil
+}
+
+func (m *MockupProvider) AddEvent(event entities.GeofenceEvent) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(event.OrganizationId, event.DeviceGroupId)
+	events := append(m.events[key], &event)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp < events[j].Timestamp
+	})
+	m.events[key] = events
+	return nil
+}
+
+func (m *MockupProvider) ListEvents(organizationID string, deviceGroupID string, timeRange entities.TimeRange, limit int) ([]*entities.GeofenceEvent, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.GeofenceEvent, 0)
+	events := m.events[m.getKey(organizationID, deviceGroupID)]
+	for i := len(events) - 1; i >= 0 && len(result) < limit; i-- {
+		if timeRange.Contains(events[i].Timestamp) {
+			result = append(result, events[i])
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) RemoveGroupGeofences(organizationID string, deviceGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(organizationID, deviceGroupID)
+	delete(m.geofences, key)
+	delete(m.events, key)
+	return nil
+}
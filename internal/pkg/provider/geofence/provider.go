@@ -0,0 +1,43 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geofence
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the geofences of the device groups and the events produced by the devices that enter or leave them.
+type Provider interface {
+	// AddGeofence adds a new geofence
+	AddGeofence(fence entities.Geofence) derrors.Error
+
+	// ListGeofences returns the geofences of a device group
+	ListGeofences(organizationID string, deviceGroupID string) ([]*entities.Geofence, derrors.Error)
+
+	// RemoveGeofence removes a geofence
+	RemoveGeofence(organizationID string, deviceGroupID string, geofenceID string) derrors.Error
+
+	// AddEvent adds a geofence event
+	AddEvent(event entities.GeofenceEvent) derrors.Error
+
+	// ListEvents returns up to limit events of a device group in a time range, the most recent first
+	ListEvents(organizationID string, deviceGroupID string, timeRange entities.TimeRange, limit int) ([]*entities.GeofenceEvent, derrors.Error)
+
+	// RemoveGroupGeofences removes the geofences and the events of a device group
+	RemoveGroupGeofences(organizationID string, deviceGroupID string) derrors.Error
+}
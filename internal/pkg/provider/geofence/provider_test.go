@@ -0,0 +1,121 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geofence
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createGeofence(organizationID string, deviceGroupID string) *entities.Geofence {
+	return &entities.Geofence{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		GeofenceId:     uuid.New().String(),
+		Name:           "warehouse",
+		Shape:          entities.CircleGeofence,
+		Latitudes:      []float64{40.4168},
+		Longitudes:     []float64{-3.7038},
+		Radius:         500,
+		Created:        time.Now().Unix(),
+	}
+}
+
+func createEvent(organizationID string, deviceGroupID string, timestamp int64) *entities.GeofenceEvent {
+	return &entities.GeofenceEvent{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		Timestamp:      timestamp,
+		DeviceId:       uuid.New().String(),
+		GeofenceId:     uuid.New().String(),
+		EventType:      entities.GeofenceEnter,
+		Latitude:       40.4168,
+		Longitude:      -3.7038,
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add a geofence", func() {
+		fence := createGeofence(uuid.New().String(), uuid.New().String())
+		err := provider.AddGeofence(*fence)
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.AddGeofence(*fence)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to list the geofences of a group", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		fence := createGeofence(organizationID, deviceGroupID)
+		err := provider.AddGeofence(*fence)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		fences, err := provider.ListGeofences(organizationID, deviceGroupID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(fences)).Should(gomega.Equal(1))
+		gomega.Expect(fences[0].Shape).Should(gomega.Equal(entities.CircleGeofence))
+		gomega.Expect(fences[0].Latitudes).Should(gomega.Equal(fence.Latitudes))
+		gomega.Expect(fences[0].Radius).Should(gomega.Equal(fence.Radius))
+	})
+	ginkgo.It("Should be able to remove a geofence", func() {
+		fence := createGeofence(uuid.New().String(), uuid.New().String())
+		err := provider.AddGeofence(*fence)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveGeofence(fence.OrganizationId, fence.DeviceGroupId, fence.GeofenceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.RemoveGeofence(fence.OrganizationId, fence.DeviceGroupId, fence.GeofenceId)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to list the events of a group in a time range", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		for timestamp := int64(1000); timestamp <= 5000; timestamp += 1000 {
+			err := provider.AddEvent(*createEvent(organizationID, deviceGroupID, timestamp))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		events, err := provider.ListEvents(organizationID, deviceGroupID, entities.TimeRange{From: 2000, To: 4000}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(events)).Should(gomega.Equal(3))
+		gomega.Expect(events[0].Timestamp).Should(gomega.Equal(int64(4000)))
+		gomega.Expect(events[0].EventType).Should(gomega.Equal(entities.GeofenceEnter))
+
+		events, err = provider.ListEvents(organizationID, deviceGroupID, entities.TimeRange{}, 2)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(events)).Should(gomega.Equal(2))
+	})
+	ginkgo.It("Should be able to remove the geofences of a group", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		err := provider.AddGeofence(*createGeofence(organizationID, deviceGroupID))
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.AddEvent(*createEvent(organizationID, deviceGroupID, 1000))
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveGroupGeofences(organizationID, deviceGroupID)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		fences, err := provider.ListGeofences(organizationID, deviceGroupID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(fences).To(gomega.BeEmpty())
+		events, err := provider.ListEvents(organizationID, deviceGroupID, entities.TimeRange{}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(events).To(gomega.BeEmpty())
+	})
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geofence
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+var geofenceColumns = []string{"organization_id", "device_group_id", "geofence_id", "name", "shape", "latitudes",
+	"longitudes", "radius", "created"}
+
+var eventColumns = []string{"organization_id", "device_group_id", "timestamp", "device_id", "geofence_id", "event_type",
+	"latitude", "longitude"}
+
+func (sp *ScyllaProvider) unsafeExists(organizationID string, deviceGroupID string, geofenceID string) (bool, derrors.Error) {
+	var count int
+	stmt, names := qb.Select("geofence").CountAll().Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("geofence_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"geofence_id":     geofenceID,
+	})
+
+	cqlErr := q.GetRelease(&count)
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot determine if geofence exists")
+	}
+
+	return count == 1, nil
+}
+
+func (sp *ScyllaProvider) AddGeofence(fence entities.Geofence) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExists(fence.OrganizationId, fence.DeviceGroupId, fence.GeofenceId)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return derrors.NewAlreadyExistsError("geofence").WithParams(fence.OrganizationId, fence.DeviceGroupId, fence.GeofenceId)
+	}
+
+	stmt, names := qb.Insert("geofence").Columns(geofenceColumns...).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(fence)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add geofence")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) ListGeofences(organizationID string, deviceGroupID string) ([]*entities.Geofence, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	fences := make([]*entities.Geofence, 0)
+	stmt, names := qb.Select("geofence").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+
+	cqlErr := gocqlx.Select(&fences, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return fences, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list geofences")
+	}
+
+	return fences, nil
+}
+
+func (sp *ScyllaProvider) RemoveGeofence(organizationID string, deviceGroupID string, geofenceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExists(organizationID, deviceGroupID, geofenceID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return derrors.NewNotFoundError("geofence").WithParams(organizationID, deviceGroupID, geofenceID)
+	}
+
+	stmt, _ := qb.Delete("geofence").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("geofence_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, geofenceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove geofence")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) AddEvent(event entities.GeofenceEvent) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("geofence_event").Columns(eventColumns...).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(event)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add geofence event")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) ListEvents(organizationID string, deviceGroupID string, timeRange entities.TimeRange, limit int) ([]*entities.GeofenceEvent, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*entities.GeofenceEvent, 0)
+	stmt, names := qb.Select("geofence_event").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.GtOrEqNamed("timestamp", "from")).Where(qb.LtOrEqNamed("timestamp", "to")).Limit(uint(limit)).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"from":            timeRange.From,
+		"to":              timeRange.Upper(),
+	})
+
+	cqlErr := gocqlx.Select(&events, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return events, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list geofence events")
+	}
+
+	return events, nil
+}
+
+func (sp *ScyllaProvider) RemoveGroupGeofences(organizationID string, deviceGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"geofence", "geofence_event"} {
+		stmt, _ := qb.Delete(table).Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+		cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID).Exec()
+		if cqlErr != nil {
+			return derrors.AsError(cqlErr, "cannot remove the geofences of the device group")
+		}
+	}
+
+	return nil
+}
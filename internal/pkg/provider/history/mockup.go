@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package history
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sort"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// records indexed by organization_id + device_group_id + device_id, sorted by timestamp
+	records map[string][]*entities.LocationRecord
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		records: make(map[string][]*entities.LocationRecord, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string, deviceID string) string {
+	return organizationID + "/" + deviceGroupID + "/" + deviceID
+}
+
+func (m *MockupProvider) AddLocation(record entities.LocationRecord) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(record.OrganizationId, record.DeviceGroupId, record.DeviceId)
+	records := m.records[key]
+	// entries with the same timestamp are replaced as in the database
+	for i, r := range records {
+		if r.Timestamp == record.Timestamp {
+			records[i] = &record
+			return nil
+		}
+	}
+	records = append(records, &record)
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Timestamp < records[j].Timestamp
+	})
+	m.records[key] = records
+	return nil
+}
+
+func (m *MockupProvider) GetLastLocation(organizationID string, deviceGroupID string, deviceID string) (*entities.LocationRecord, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	records := m.records[m.getKey(organizationID, deviceGroupID, deviceID)]
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[len(records)-1], nil
+}
+
+func (m *MockupProvider) ListLocations(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.LocationRecord, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.LocationRecord, 0)
+	records := m.records[m.getKey(organizationID, deviceGroupID, deviceID)]
+	for i := len(records) - 1; i >= 0 && len(result) < limit; i-- {
+		if timeRange.Contains(records[i].Timestamp) {
+			result = append(result, records[i])
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) RemoveDeviceLocations(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.records, m.getKey(organizationID, deviceGroupID, deviceID))
+	return nil
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package history
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the location history of the devices.
+type Provider interface {
+	// AddLocation adds an entry to the location history of a device
+	AddLocation(record entities.LocationRecord) derrors.Error
+
+	// GetLastLocation returns the most recent entry of the location history of a device, or nil if the device has
+	// no history
+	GetLastLocation(organizationID string, deviceGroupID string, deviceID string) (*entities.LocationRecord, derrors.Error)
+
+	// ListLocations returns up to limit entries of the location history of a device in a time range, the most
+	// recent first
+	ListLocations(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.LocationRecord, derrors.Error)
+
+	// RemoveDeviceLocations removes the location history of a device
+	RemoveDeviceLocations(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package history
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+func createRecord(organizationID string, deviceGroupID string, deviceID string, timestamp int64) *entities.LocationRecord {
+	return entities.NewLocationRecord(organizationID, deviceGroupID, deviceID,
+		entities.GeoPoint{Latitude: 40.4168, Longitude: -3.7038}, timestamp)
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add a location to the history", func() {
+		record := createRecord(uuid.New().String(), uuid.New().String(), uuid.New().String(), 1000)
+		err := provider.AddLocation(*record)
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to get the last location of a device", func() {
+		record := createRecord(uuid.New().String(), uuid.New().String(), uuid.New().String(), 1000)
+		last, err := provider.GetLastLocation(record.OrganizationId, record.DeviceGroupId, record.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(last).To(gomega.BeNil())
+
+		for _, timestamp := range []int64{1000, 3000, 2000} {
+			err = provider.AddLocation(*createRecord(record.OrganizationId, record.DeviceGroupId, record.DeviceId, timestamp))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		last, err = provider.GetLastLocation(record.OrganizationId, record.DeviceGroupId, record.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(last.Timestamp).Should(gomega.Equal(int64(3000)))
+	})
+	ginkgo.It("Should be able to list the locations of a device in a time range", func() {
+		record := createRecord(uuid.New().String(), uuid.New().String(), uuid.New().String(), 1000)
+		for timestamp := int64(1000); timestamp <= 5000; timestamp += 1000 {
+			err := provider.AddLocation(*createRecord(record.OrganizationId, record.DeviceGroupId, record.DeviceId, timestamp))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		records, err := provider.ListLocations(record.OrganizationId, record.DeviceGroupId, record.DeviceId,
+			entities.TimeRange{From: 2000, To: 4000}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(records)).Should(gomega.Equal(3))
+		gomega.Expect(records[0].Timestamp).Should(gomega.Equal(int64(4000)))
+
+		records, err = provider.ListLocations(record.OrganizationId, record.DeviceGroupId, record.DeviceId,
+			entities.TimeRange{From: 2000}, 2)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(records)).Should(gomega.Equal(2))
+		gomega.Expect(records[0].Timestamp).Should(gomega.Equal(int64(5000)))
+	})
+	ginkgo.It("Should be able to remove the location history of a device", func() {
+		record := createRecord(uuid.New().String(), uuid.New().String(), uuid.New().String(), 1000)
+		err := provider.AddLocation(*record)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveDeviceLocations(record.OrganizationId, record.DeviceGroupId, record.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		records, err := provider.ListLocations(record.OrganizationId, record.DeviceGroupId, record.DeviceId, entities.TimeRange{}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(records).To(gomega.BeEmpty())
+	})
+}
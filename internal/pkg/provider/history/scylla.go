@@ -0,0 +1,146 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package history
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+func (sp *ScyllaProvider) AddLocation(record entities.LocationRecord) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("device_location_history").Columns("organization_id", "device_group_id", "device_id",
+		"timestamp", "latitude", "longitude").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(record)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add device location to the history")
+	}
+
+	return nil
+}
+
+// GetLastLocation reads the first row of the partition of the device, as the table is sorted by descending timestamp.
+func (sp *ScyllaProvider) GetLastLocation(organizationID string, deviceGroupID string, deviceID string) (*entities.LocationRecord, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	var record entities.LocationRecord
+	stmt, names := qb.Select("device_location_history").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).Limit(1).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := q.GetRelease(&record)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return nil, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot get the last location of the device")
+	}
+
+	return &record, nil
+}
+
+func (sp *ScyllaProvider) ListLocations(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.LocationRecord, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*entities.LocationRecord, 0)
+	stmt, names := qb.Select("device_location_history").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).Where(qb.GtOrEqNamed("timestamp", "from")).Where(qb.LtOrEqNamed("timestamp", "to")).
+		Limit(uint(limit)).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+		"from":            timeRange.From,
+		"to":              timeRange.Upper(),
+	})
+
+	cqlErr := gocqlx.Select(&records, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return records, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list the location history of the device")
+	}
+
+	return records, nil
+}
+
+func (sp *ScyllaProvider) RemoveDeviceLocations(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_location_history").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove the location history of the device")
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// entries indexed by organization_id, device_group_id + device_id
+	entries map[string]map[string]*entities.DeviceIndexEntry
+	// indexed organizations
+	indexed map[string]bool
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		entries: make(map[string]map[string]*entities.DeviceIndexEntry, 0),
+		indexed: make(map[string]bool, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(deviceGroupID string, deviceID string) string {
+	return deviceGroupID + "/" + deviceID
+}
+
+func (m *MockupProvider) AddDevice(entry entities.DeviceIndexEntry) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	organization, exists := m.entries[entry.OrganizationId]
+	if !exists {
+		organization = make(map[string]*entities.DeviceIndexEntry, 0)
+		m.entries[entry.OrganizationId] = organization
+	}
+	organization[m.getKey(entry.DeviceGroupId, entry.DeviceId)] = &entry
+	return nil
+}
+
+func (m *MockupProvider) RemoveDevice(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	organization, exists := m.entries[organizationID]
+	if exists {
+		delete(organization, m.getKey(deviceGroupID, deviceID))
+	}
+	return nil
+}
+
+func (m *MockupProvider) RemoveDeviceGroup(organizationID string, deviceGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	organization, exists := m.entries[organizationID]
+	if exists {
+		for key, entry := range organization {
+			if entry.DeviceGroupId == deviceGroupID {
+				delete(organization, key)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MockupProvider) SearchDevices(query entities.DeviceSearchQuery) ([]*entities.DeviceIndexEntry, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.DeviceIndexEntry, 0)
+	for _, entry := range m.entries[query.OrganizationId] {
+		if query.Matches(entry) {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) IsOrganizationIndexed(organizationID string) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.indexed[organizationID], nil
+}
+
+func (m *MockupProvider) SetOrganizationIndexed(organizationID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.indexed[organizationID] = true
+	return nil
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the device index used to search devices across the groups of an organization.
+type Provider interface {
+	// AddDevice adds or replaces the entry of a device
+	AddDevice(entry entities.DeviceIndexEntry) derrors.Error
+
+	// RemoveDevice removes the entry of a device
+	RemoveDevice(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+
+	// RemoveDeviceGroup removes the entries of all the devices of a group
+	RemoveDeviceGroup(organizationID string, deviceGroupID string) derrors.Error
+
+	// SearchDevices returns the entries that match the query
+	SearchDevices(query entities.DeviceSearchQuery) ([]*entities.DeviceIndexEntry, derrors.Error)
+
+	// IsOrganizationIndexed checks if the index contains all the devices of an organization
+	IsOrganizationIndexed(organizationID string) (bool, derrors.Error)
+
+	// SetOrganizationIndexed marks an organization as completely indexed
+	SetOrganizationIndexed(organizationID string) derrors.Error
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createEntry(organizationID string, deviceGroupID string, labels map[string]string) *entities.DeviceIndexEntry {
+	return &entities.DeviceIndexEntry{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       uuid.New().String(),
+		RegisterSince:  time.Now().Unix(),
+		Labels:         labels,
+		AssetInfo:      map[string]string{"os.name": "linux", "os.version": "4.19"},
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add a device to the index", func() {
+		entry := createEntry(uuid.New().String(), uuid.New().String(), nil)
+		err := provider.AddDevice(*entry)
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to search devices", func() {
+		organizationID := uuid.New().String()
+		entry := createEntry(organizationID, uuid.New().String(), map[string]string{"env": "prod"})
+		err := provider.AddDevice(*entry)
+		gomega.Expect(err).To(gomega.Succeed())
+		other := createEntry(organizationID, uuid.New().String(), map[string]string{"env": "dev"})
+		err = provider.AddDevice(*other)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		selector, err := entities.ParseLabelSelector("env=prod")
+		gomega.Expect(err).To(gomega.Succeed())
+		result, err := provider.SearchDevices(entities.DeviceSearchQuery{
+			OrganizationId: organizationID,
+			LabelSelector:  selector,
+			AssetInfo:      "LINUX",
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(result)).Should(gomega.Equal(1))
+		gomega.Expect(result[0].DeviceId).Should(gomega.Equal(entry.DeviceId))
+
+		result, err = provider.SearchDevices(entities.DeviceSearchQuery{
+			OrganizationId: organizationID,
+			DeviceIdPrefix: other.DeviceId[:8],
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(result)).Should(gomega.Equal(1))
+		gomega.Expect(result[0].DeviceGroupId).Should(gomega.Equal(other.DeviceGroupId))
+	})
+	ginkgo.It("Should be able to remove a device from the index", func() {
+		entry := createEntry(uuid.New().String(), uuid.New().String(), nil)
+		err := provider.AddDevice(*entry)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveDevice(entry.OrganizationId, entry.DeviceGroupId, entry.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		result, err := provider.SearchDevices(entities.DeviceSearchQuery{OrganizationId: entry.OrganizationId})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result).To(gomega.BeEmpty())
+	})
+	ginkgo.It("Should be able to remove the devices of a group from the index", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		for i := 0; i < 3; i++ {
+			err := provider.AddDevice(*createEntry(organizationID, deviceGroupID, nil))
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		err := provider.AddDevice(*createEntry(organizationID, uuid.New().String(), nil))
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveDeviceGroup(organizationID, deviceGroupID)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		result, err := provider.SearchDevices(entities.DeviceSearchQuery{OrganizationId: organizationID})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(result)).Should(gomega.Equal(1))
+	})
+	ginkgo.It("Should be able to mark an organization as indexed", func() {
+		organizationID := uuid.New().String()
+		indexed, err := provider.IsOrganizationIndexed(organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(indexed).Should(gomega.BeFalse())
+
+		err = provider.SetOrganizationIndexed(organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		indexed, err = provider.IsOrganizationIndexed(organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(indexed).Should(gomega.BeTrue())
+	})
+}
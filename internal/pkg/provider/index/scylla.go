@@ -0,0 +1,185 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+	"time"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+func (sp *ScyllaProvider) AddDevice(entry entities.DeviceIndexEntry) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("device_index").Columns("organization_id", "device_group_id", "device_id",
+		"register_since", "labels", "asset_info").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(entry)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add device to the index")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveDevice(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_index").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove device from the index")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveDeviceGroup(organizationID string, deviceGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_index").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove device group from the index")
+	}
+
+	return nil
+}
+
+// SearchDevices reads the partition of the organization and filters the entries that match the query.
+func (sp *ScyllaProvider) SearchDevices(query entities.DeviceSearchQuery) ([]*entities.DeviceIndexEntry, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*entities.DeviceIndexEntry, 0)
+	stmt, names := qb.Select("device_index").Where(qb.Eq("organization_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": query.OrganizationId,
+	})
+
+	cqlErr := gocqlx.Select(&entries, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return entries, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot search devices")
+	}
+
+	result := make([]*entities.DeviceIndexEntry, 0)
+	for _, entry := range entries {
+		if query.Matches(entry) {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+func (sp *ScyllaProvider) IsOrganizationIndexed(organizationID string) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	var count int
+	stmt, names := qb.Select("indexed_organization").CountAll().Where(qb.Eq("organization_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+	})
+
+	cqlErr := q.GetRelease(&count)
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot determine if the organization is indexed")
+	}
+
+	return count == 1, nil
+}
+
+func (sp *ScyllaProvider) SetOrganizationIndexed(organizationID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("indexed_organization").Columns("organization_id", "indexed").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"indexed":         time.Now().Unix(),
+	})
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot mark the organization as indexed")
+	}
+
+	return nil
+}
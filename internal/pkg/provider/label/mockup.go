@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package label
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// policies indexed by organization_id
+	policies map[string]*entities.LabelPolicy
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		policies: make(map[string]*entities.LabelPolicy, 0),
+	}
+}
+
+func (m *MockupProvider) SetLabelPolicy(policy entities.LabelPolicy) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.policies[policy.OrganizationId] = &policy
+	return nil
+}
+
+func (m *MockupProvider) GetLabelPolicy(organizationID string) (*entities.LabelPolicy, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	policy, exists := m.policies[organizationID]
+	if !exists {
+		return &entities.LabelPolicy{OrganizationId: organizationID}, nil
+	}
+	return policy, nil
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package label
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider stores the label policies of the organizations.
+type Provider interface {
+	// SetLabelPolicy adds or replaces the label policy of an organization
+	SetLabelPolicy(policy entities.LabelPolicy) derrors.Error
+
+	// GetLabelPolicy returns the label policy of an organization. Organizations without a policy allow any key
+	GetLabelPolicy(organizationID string) (*entities.LabelPolicy, derrors.Error)
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package label
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to set and retrieve a label policy", func() {
+		policy := &entities.LabelPolicy{
+			OrganizationId: uuid.New().String(),
+			AllowedKeys:    []string{"env", "tier"},
+		}
+		err := provider.SetLabelPolicy(*policy)
+		gomega.Expect(err).To(gomega.Succeed())
+		retrieved, err := provider.GetLabelPolicy(policy.OrganizationId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*retrieved).Should(gomega.Equal(*policy))
+	})
+	ginkgo.It("Should be able to replace a label policy", func() {
+		policy := &entities.LabelPolicy{
+			OrganizationId: uuid.New().String(),
+			AllowedKeys:    []string{"env", "tier"},
+		}
+		err := provider.SetLabelPolicy(*policy)
+		gomega.Expect(err).To(gomega.Succeed())
+		policy.AllowedKeys = []string{"owner"}
+		err = provider.SetLabelPolicy(*policy)
+		gomega.Expect(err).To(gomega.Succeed())
+		retrieved, err := provider.GetLabelPolicy(policy.OrganizationId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved.AllowedKeys).Should(gomega.Equal([]string{"owner"}))
+	})
+	ginkgo.It("Should return an empty policy for organizations without policy", func() {
+		organizationID := uuid.New().String()
+		retrieved, err := provider.GetLabelPolicy(organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved.OrganizationId).Should(gomega.Equal(organizationID))
+		gomega.Expect(retrieved.AllowedKeys).Should(gomega.BeEmpty())
+	})
+}
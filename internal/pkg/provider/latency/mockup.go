@@ -78,6 +78,20 @@ func (m *MockupProvider) GetLatency(organizationID string, deviceGroupID string,
 	return list, nil
 }
 
+func (m *MockupProvider) ListLatencies(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.Latency, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.Latency, 0)
+	list := m.latency[m.getKey(organizationID, deviceGroupID, deviceID)]
+	for i := len(list) - 1; i >= 0 && len(result) < limit; i-- {
+		if timeRange.Contains(list[i].Inserted) {
+			result = append(result, list[i])
+		}
+	}
+	return result, nil
+}
+
 func (m *MockupProvider) RemoveLatency(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
 	m.Lock()
 	defer m.Unlock()
@@ -140,3 +154,31 @@ func (m *MockupProvider) GetGroupLastLatencies(organizationID string, deviceGrou
 
 	return latencies, nil
 }
+
+func (m *MockupProvider) GetOrganizationLastLatencies(organizationID string) ([]*entities.Latency, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	latencies := make([]*entities.Latency, 0)
+	for _, list := range m.lastLatency {
+		for _, latency := range list {
+			if latency.OrganizationId == organizationID {
+				latencies = append(latencies, latency)
+			}
+		}
+	}
+
+	return latencies, nil
+}
+
+func (m *MockupProvider) RemoveLastLatency(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	latencies, exists := m.lastLatency[m.getShortKey(organizationID, deviceGroupID)]
+	if exists {
+		delete(latencies, deviceID)
+	}
+
+	return nil
+}
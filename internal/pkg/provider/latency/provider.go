@@ -31,6 +31,9 @@ type Provider interface {
 
 	GetLatency(organizationID string, deviceGroupID string, deviceID string) ([]*entities.Latency, derrors.Error)
 
+	// ListLatencies returns the latencies of a device, with their health metrics, in a time range, the most recent first
+	ListLatencies(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.Latency, derrors.Error)
+
 	// RemoveLatency removes the entries associated with a given device.
 	RemoveLatency(organizationID string, deviceGroupID string, deviceID string) derrors.Error
 
@@ -45,4 +48,10 @@ type Provider interface {
 
 	// GetGroupLastLatencies get all the last latencies of the devices in the group
 	GetGroupLastLatencies(organizationID string, deviceGroupID string) ([]*entities.Latency, derrors.Error)
+
+	// GetOrganizationLastLatencies get all the last latencies of the devices of an organization
+	GetOrganizationLastLatencies(organizationID string) ([]*entities.Latency, derrors.Error)
+
+	// RemoveLastLatency removes the last latency of a device
+	RemoveLastLatency(organizationID string, deviceGroupID string, deviceID string) derrors.Error
 }
@@ -70,6 +70,33 @@ func RunTest(provider Provider) {
 		gomega.Expect(len(retrieved)).Should(gomega.Equal(2))
 
 	})
+	ginkgo.It("Should be able to list the latencies of a device in a time range", func() {
+		organizationID := uuid.New().String()
+		deviceGroupID := uuid.New().String()
+		deviceID := uuid.New().String()
+		for _, inserted := range []int64{1000, 2000, 3000, 4000} {
+			err := provider.AddPingLatency(entities.Latency{
+				OrganizationId: organizationID,
+				DeviceGroupId:  deviceGroupID,
+				DeviceId:       deviceID,
+				Latency:        300,
+				Inserted:       inserted,
+				Metrics:        map[string]float64{string(entities.BatteryLevel): 80},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+
+		retrieved, err := provider.ListLatencies(organizationID, deviceGroupID, deviceID, entities.TimeRange{From: 2000, To: 4000}, 2)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved).To(gomega.HaveLen(2))
+		gomega.Expect(retrieved[0].Inserted).Should(gomega.Equal(int64(4000)))
+		gomega.Expect(retrieved[1].Inserted).Should(gomega.Equal(int64(3000)))
+		gomega.Expect(retrieved[0].Metrics).Should(gomega.HaveKeyWithValue(string(entities.BatteryLevel), 80.0))
+
+		retrieved, err = provider.ListLatencies(organizationID, deviceGroupID, deviceID, entities.TimeRange{From: 1500}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved).To(gomega.HaveLen(3))
+	})
 	ginkgo.It("Should be able to remove a latency", func() {
 		latency := &entities.Latency{
 			OrganizationId: uuid.New().String(),
@@ -167,4 +194,48 @@ func RunTest(provider Provider) {
 
 	})
 
+	ginkgo.It("Should be able to get the latency list of an organization", func() {
+
+		organizationID := uuid.New().String()
+		numGroups := 3
+		for i := 0; i < numGroups; i++ {
+			latency := &entities.Latency{
+				OrganizationId: organizationID,
+				DeviceGroupId:  uuid.New().String(),
+				DeviceId:       uuid.New().String(),
+				Latency:        rand.Intn(500) + 1,
+				Inserted:       time.Now().Unix(),
+			}
+
+			err := provider.AddLastLatency(*latency)
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+
+		list, err := provider.GetOrganizationLastLatencies(organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(list)).Should(gomega.Equal(numGroups))
+
+	})
+	ginkgo.It("Should be able to remove a last latency", func() {
+
+		latency := &entities.Latency{
+			OrganizationId: uuid.New().String(),
+			DeviceGroupId:  uuid.New().String(),
+			DeviceId:       uuid.New().String(),
+			Latency:        300,
+			Inserted:       time.Now().Unix(),
+		}
+
+		err := provider.AddLastLatency(*latency)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveLastLatency(latency.OrganizationId, latency.DeviceGroupId, latency.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		list, err := provider.GetGroupLastLatencies(latency.OrganizationId, latency.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(list).To(gomega.BeEmpty())
+
+	})
+
 }
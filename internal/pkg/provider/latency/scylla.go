@@ -20,11 +20,9 @@ import (
 	"github.com/gocql/gocql"
 	"github.com/nalej/derrors"
 	"github.com/nalej/device-manager/internal/pkg/entities"
-	"github.com/nalej/grpc-utils/pkg/conversions"
-	"github.com/rs/zerolog/log"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
 	"github.com/scylladb/gocqlx"
 	"github.com/scylladb/gocqlx/qb"
-	"sync"
 	"time"
 )
 
@@ -35,58 +33,15 @@ const rowNotFound = "not found"
 const limitTime = time.Duration(5) * time.Minute
 
 type ScyllaProvider struct {
-	Address  string
-	Port     int
-	Keyspace string
-	Session  *gocql.Session
-	sync.Mutex
+	*scylladb.Connection
 }
 
 func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
-	provider := ScyllaProvider{Address: address, Port: port, Keyspace: keyspace, Session: nil}
-	provider.connect()
-	return &provider
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
 }
 
-func (sp *ScyllaProvider) connect() derrors.Error {
-	// connect to the cluster
-	conf := gocql.NewCluster(sp.Address)
-	conf.Keyspace = sp.Keyspace
-	conf.Port = sp.Port
-
-	session, err := conf.CreateSession()
-	if err != nil {
-		log.Error().Str("provider", "ScyllaProvider").Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to connect")
-		return derrors.AsError(err, "cannot connect")
-	}
-
-	sp.Session = session
-
-	return nil
-}
-
-func (sp *ScyllaProvider) checkAndConnect() derrors.Error {
-
-	if sp.Session == nil {
-		log.Info().Msg("session no created, trying to reconnect...")
-		// try to reconnect
-		err := sp.connect()
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (sp *ScyllaProvider) Disconnect() {
-
-	sp.Lock()
-	defer sp.Unlock()
-
-	if sp.Session != nil {
-		sp.Session.Close()
-		sp.Session = nil
-	}
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
 }
 
 // -- Latency
@@ -96,14 +51,14 @@ func (sp *ScyllaProvider) AddPingLatency(latency entities.Latency) derrors.Error
 	defer sp.Unlock()
 
 	// check connection
-	err := sp.checkAndConnect()
+	err := sp.CheckAndConnect()
 	if err != nil {
 		return err
 	}
 
 	// insert the application instance
 	stmt, names := qb.Insert("latency").Columns("organization_id", "device_group_id", "device_id",
-		"inserted", "latency").TTL(ttlExpired).ToCql()
+		"inserted", "latency", "metrics").TTL(ttlExpired).ToCql()
 	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(latency)
 	cqlErr := q.ExecRelease()
 
@@ -119,7 +74,7 @@ func (sp *ScyllaProvider) GetLatency(organizationID string, deviceGroupID string
 	defer sp.Unlock()
 
 	// check connection
-	err := sp.checkAndConnect()
+	err := sp.CheckAndConnect()
 	if err != nil {
 		return nil, err
 	}
@@ -148,13 +103,47 @@ func (sp *ScyllaProvider) GetLatency(organizationID string, deviceGroupID string
 	return latencyList, nil
 }
 
+func (sp *ScyllaProvider) ListLatencies(organizationID string, deviceGroupID string, deviceID string, timeRange entities.TimeRange, limit int) ([]*entities.Latency, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	latencyList := make([]*entities.Latency, 0)
+	stmt, names := qb.Select("latency").Where(qb.Eq("organization_id")).
+		Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).
+		Where(qb.GtOrEqNamed("inserted", "from")).Where(qb.LtOrEqNamed("inserted", "to")).
+		OrderBy("device_id", qb.DESC).OrderBy("inserted", qb.DESC).Limit(uint(limit)).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+		"from":            timeRange.From,
+		"to":              timeRange.Upper(),
+	})
+
+	cqlErr := gocqlx.Select(&latencyList, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return latencyList, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list device latencies")
+	}
+
+	return latencyList, nil
+}
+
 func (sp *ScyllaProvider) RemoveLatency(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
 
 	sp.Lock()
 	defer sp.Unlock()
 
 	// check connection
-	err := sp.checkAndConnect()
+	err := sp.CheckAndConnect()
 	if err != nil {
 		return err
 	}
@@ -178,7 +167,7 @@ func (sp *ScyllaProvider) GetLastLatency(organizationID string, deviceGroupID st
 	defer sp.Unlock()
 
 	// check connection
-	err := sp.checkAndConnect()
+	err := sp.CheckAndConnect()
 	if err != nil {
 		return nil, err
 	}
@@ -213,14 +202,14 @@ func (sp *ScyllaProvider) AddLastLatency(latency entities.Latency) derrors.Error
 	defer sp.Unlock()
 
 	// check connection
-	err := sp.checkAndConnect()
+	err := sp.CheckAndConnect()
 	if err != nil {
 		return err
 	}
 
 	// insert the application instance
 	stmt, names := qb.Insert("lastlatency").Columns("organization_id", "device_group_id", "device_id",
-		"inserted", "latency").TTL(ttlExpired).ToCql()
+		"inserted", "latency", "metrics").TTL(ttlExpired).ToCql()
 	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(latency)
 	cqlErr := q.ExecRelease()
 
@@ -236,7 +225,7 @@ func (sp *ScyllaProvider) GetGroupLastLatencies(organizationID string, deviceGro
 	defer sp.Unlock()
 
 	// check connection
-	err := sp.checkAndConnect()
+	err := sp.CheckAndConnect()
 	if err != nil {
 		return nil, err
 	}
@@ -261,3 +250,55 @@ func (sp *ScyllaProvider) GetGroupLastLatencies(organizationID string, deviceGro
 
 	return latencyList, nil
 }
+
+// GetOrganizationLastLatencies get all the last latencies of the devices of an organization. The table is
+// partitioned by device group, so the query requires filtering and is only intended for maintenance tasks.
+func (sp *ScyllaProvider) GetOrganizationLastLatencies(organizationID string) ([]*entities.Latency, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	latencyList := make([]*entities.Latency, 0)
+	stmt, names := qb.Select("lastlatency").Where(qb.Eq("organization_id")).AllowFiltering().ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+	})
+
+	cqlErr := gocqlx.Select(&latencyList, q.Query)
+
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return latencyList, nil
+		} else {
+			return nil, derrors.AsError(cqlErr, "cannot list organization latencies")
+		}
+	}
+
+	return latencyList, nil
+}
+
+func (sp *ScyllaProvider) RemoveLastLatency(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("lastlatency").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot delete last latency")
+	}
+
+	return nil
+}
@@ -24,7 +24,8 @@
  docker exec -it scylla cqlsh
 
  create KEYSPACE IF NOT EXISTS measure WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1};
- create table IF NOT EXISTS measure.latency (organization_id text, device_group_id text, device_id text, inserted bigint, latency int, PRIMARY KEY ((organization_id, device_group_id, device_id), inserted) );
+ create table IF NOT EXISTS measure.latency (organization_id text, device_group_id text, device_id text, inserted bigint, latency int, metrics map<text, double>, PRIMARY KEY ((organization_id, device_group_id), device_id, inserted) );
+ create table IF NOT EXISTS measure.lastlatency (organization_id text, device_group_id text, device_id text, inserted bigint, latency int, metrics map<text, double>, PRIMARY KEY ((organization_id, device_group_id), device_id ));
 
  3)environment variables:
  RUN_INTEGRATION_TEST=true
@@ -39,9 +40,6 @@ import (
 	"github.com/nalej/device-manager/internal/pkg/utils"
 	"github.com/onsi/ginkgo"
 	"github.com/rs/zerolog/log"
-
-	"os"
-	"strconv"
 )
 
 var _ = ginkgo.Describe("Scylla latency provider", func() {
@@ -51,24 +49,13 @@ var _ = ginkgo.Describe("Scylla latency provider", func() {
 		return
 	}
 
-	var scyllaHost = os.Getenv("IT_SCYLLA_HOST")
-	if scyllaHost == "" {
-		ginkgo.Fail("missing environment variables")
-	}
-
-	var nalejKeySpace = os.Getenv("IT_NALEJ_KEYSPACE")
-	if nalejKeySpace == "" {
-		ginkgo.Fail("missing environment variables")
-
-	}
-	scyllaPort, _ := strconv.Atoi(os.Getenv("IT_SCYLLA_PORT"))
-	if scyllaPort <= 0 {
-		ginkgo.Fail("missing environment variables")
-
+	settings, err := utils.GetScyllaTestSettings()
+	if err != nil {
+		ginkgo.Fail(err.Error())
 	}
 
 	// create a provider and connect it
-	sp := NewScyllaProvider(scyllaHost, scyllaPort, nalejKeySpace)
+	sp := NewScyllaProvider(settings.Address, settings.Port, settings.Keyspace)
 
 	// disconnect
 	ginkgo.AfterSuite(func() {
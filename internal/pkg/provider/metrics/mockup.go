@@ -0,0 +1,150 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sort"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// samples indexed by organization_id + device_group_id + device_id + name, sorted by timestamp
+	samples map[string][]*entities.MetricSample
+	// last values indexed by organization_id + device_group_id + device_id and name
+	last map[string]map[string]*entities.MetricSample
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		samples: make(map[string][]*entities.MetricSample, 0),
+		last:    make(map[string]map[string]*entities.MetricSample, 0),
+	}
+}
+
+func (m *MockupProvider) getDeviceKey(organizationID string, deviceGroupID string, deviceID string) string {
+	return organizationID + "/" + deviceGroupID + "/" + deviceID
+}
+
+func (m *MockupProvider) getSeriesKey(organizationID string, deviceGroupID string, deviceID string, name string) string {
+	return m.getDeviceKey(organizationID, deviceGroupID, deviceID) + "/" + name
+}
+
+func (m *MockupProvider) AddSamples(samples []*entities.MetricSample) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, sample := range samples {
+		toAdd := *sample
+		m.addSample(&toAdd)
+
+		deviceKey := m.getDeviceKey(toAdd.OrganizationId, toAdd.DeviceGroupId, toAdd.DeviceId)
+		last, exists := m.last[deviceKey]
+		if !exists {
+			last = make(map[string]*entities.MetricSample, 0)
+			m.last[deviceKey] = last
+		}
+		if toAdd.IsNewer(last[toAdd.Name]) {
+			last[toAdd.Name] = &toAdd
+		}
+	}
+	return nil
+}
+
+func (m *MockupProvider) addSample(sample *entities.MetricSample) {
+	key := m.getSeriesKey(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, sample.Name)
+	samples := m.samples[key]
+	// samples with the same timestamp are replaced as in the database
+	for i, s := range samples {
+		if s.Timestamp == sample.Timestamp {
+			samples[i] = sample
+			return
+		}
+	}
+	samples = append(samples, sample)
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Timestamp < samples[j].Timestamp
+	})
+	m.samples[key] = samples
+}
+
+func (m *MockupProvider) ListSamples(organizationID string, deviceGroupID string, deviceID string, name string, timeRange entities.TimeRange, limit int) ([]*entities.MetricSample, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.MetricSample, 0)
+	samples := m.samples[m.getSeriesKey(organizationID, deviceGroupID, deviceID, name)]
+	for i := len(samples) - 1; i >= 0 && len(result) < limit; i-- {
+		if timeRange.Contains(samples[i].Timestamp) {
+			result = append(result, samples[i])
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) GetLastValues(organizationID string, deviceGroupID string, deviceID string, names []string) ([]*entities.MetricSample, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.MetricSample, 0)
+	last := m.last[m.getDeviceKey(organizationID, deviceGroupID, deviceID)]
+	if len(names) == 0 {
+		for _, sample := range last {
+			result = append(result, sample)
+		}
+	} else {
+		for _, name := range names {
+			sample, exists := last[name]
+			if exists {
+				result = append(result, sample)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (m *MockupProvider) RemoveDeviceMetrics(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	deviceKey := m.getDeviceKey(organizationID, deviceGroupID, deviceID)
+	for name := range m.last[deviceKey] {
+		delete(m.samples, m.getSeriesKey(organizationID, deviceGroupID, deviceID, name))
+	}
+	delete(m.last, deviceKey)
+	return nil
+}
+
+func (m *MockupProvider) RemoveGroupMetrics(organizationID string, deviceGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	for deviceKey, last := range m.last {
+		for _, sample := range last {
+			if sample.OrganizationId == organizationID && sample.DeviceGroupId == deviceGroupID {
+				delete(m.samples, m.getSeriesKey(organizationID, deviceGroupID, sample.DeviceId, sample.Name))
+				delete(m.last, deviceKey)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the custom metrics of the devices. Each metric of a device is a time series identified by its name.
+type Provider interface {
+	// AddSamples adds samples to the time series of their metrics, and updates the last value of the metrics if the
+	// samples are newer
+	AddSamples(samples []*entities.MetricSample) derrors.Error
+
+	// ListSamples returns up to limit samples of a metric of a device in a time range, the most recent first
+	ListSamples(organizationID string, deviceGroupID string, deviceID string, name string, timeRange entities.TimeRange, limit int) ([]*entities.MetricSample, derrors.Error)
+
+	// GetLastValues returns the last sample of the given metrics of a device, or of all its metrics if no names are
+	// given, sorted by name
+	GetLastValues(organizationID string, deviceGroupID string, deviceID string, names []string) ([]*entities.MetricSample, derrors.Error)
+
+	// RemoveDeviceMetrics removes the metrics of a device
+	RemoveDeviceMetrics(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+
+	// RemoveGroupMetrics removes the metrics of the devices of a device group
+	RemoveGroupMetrics(organizationID string, deviceGroupID string) derrors.Error
+}
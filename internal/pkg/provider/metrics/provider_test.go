@@ -0,0 +1,134 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+func createSample(organizationID string, deviceGroupID string, deviceID string, name string, timestamp int64, value float64) *entities.MetricSample {
+	return &entities.MetricSample{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Name:           name,
+		Timestamp:      timestamp,
+		Value:          value,
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add metric samples", func() {
+		sample := createSample(uuid.New().String(), uuid.New().String(), uuid.New().String(), "temperature", 1000, 21.5)
+		err := provider.AddSamples([]*entities.MetricSample{sample})
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to list the samples of a metric in a time range", func() {
+		sample := createSample(uuid.New().String(), uuid.New().String(), uuid.New().String(), "temperature", 1000, 21.5)
+		samples := make([]*entities.MetricSample, 0)
+		for timestamp := int64(1000); timestamp <= 5000; timestamp += 1000 {
+			samples = append(samples, createSample(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, "temperature", timestamp, float64(timestamp)))
+			samples = append(samples, createSample(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, "humidity", timestamp, 40))
+		}
+		err := provider.AddSamples(samples)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		retrieved, err := provider.ListSamples(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, "temperature",
+			entities.TimeRange{From: 2000, To: 4000}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(retrieved)).Should(gomega.Equal(3))
+		gomega.Expect(retrieved[0].Timestamp).Should(gomega.Equal(int64(4000)))
+		gomega.Expect(retrieved[0].Value).Should(gomega.Equal(float64(4000)))
+
+		retrieved, err = provider.ListSamples(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, "temperature",
+			entities.TimeRange{From: 2000}, 2)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(retrieved)).Should(gomega.Equal(2))
+		gomega.Expect(retrieved[0].Timestamp).Should(gomega.Equal(int64(5000)))
+	})
+	ginkgo.It("Should keep the newest sample as the last value of a metric", func() {
+		sample := createSample(uuid.New().String(), uuid.New().String(), uuid.New().String(), "temperature", 1000, 21.5)
+		last, err := provider.GetLastValues(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, nil)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(last).To(gomega.BeEmpty())
+
+		err = provider.AddSamples([]*entities.MetricSample{
+			createSample(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, "temperature", 3000, 23),
+			createSample(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, "humidity", 1000, 40),
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		err = provider.AddSamples([]*entities.MetricSample{
+			createSample(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, "temperature", 2000, 22),
+			createSample(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, "humidity", 2000, 45),
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+
+		last, err = provider.GetLastValues(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, nil)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(last)).Should(gomega.Equal(2))
+		gomega.Expect(last[0].Name).Should(gomega.Equal("humidity"))
+		gomega.Expect(last[0].Value).Should(gomega.Equal(float64(45)))
+		gomega.Expect(last[1].Name).Should(gomega.Equal("temperature"))
+		gomega.Expect(last[1].Value).Should(gomega.Equal(float64(23)))
+
+		last, err = provider.GetLastValues(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, []string{"temperature", "pressure"})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(last)).Should(gomega.Equal(1))
+		gomega.Expect(last[0].Timestamp).Should(gomega.Equal(int64(3000)))
+	})
+	ginkgo.It("Should be able to remove the metrics of a device", func() {
+		sample := createSample(uuid.New().String(), uuid.New().String(), uuid.New().String(), "temperature", 1000, 21.5)
+		other := createSample(sample.OrganizationId, sample.DeviceGroupId, uuid.New().String(), "temperature", 1000, 21.5)
+		err := provider.AddSamples([]*entities.MetricSample{sample, other})
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveDeviceMetrics(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		samples, err := provider.ListSamples(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, "temperature", entities.TimeRange{}, 10)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(samples).To(gomega.BeEmpty())
+		last, err := provider.GetLastValues(sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, nil)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(last).To(gomega.BeEmpty())
+
+		last, err = provider.GetLastValues(other.OrganizationId, other.DeviceGroupId, other.DeviceId, nil)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(last)).Should(gomega.Equal(1))
+	})
+	ginkgo.It("Should be able to remove the metrics of a device group", func() {
+		sample := createSample(uuid.New().String(), uuid.New().String(), uuid.New().String(), "temperature", 1000, 21.5)
+		other := createSample(sample.OrganizationId, sample.DeviceGroupId, uuid.New().String(), "humidity", 1000, 40)
+		err := provider.AddSamples([]*entities.MetricSample{sample, other})
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveGroupMetrics(sample.OrganizationId, sample.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		for _, removed := range []*entities.MetricSample{sample, other} {
+			samples, err := provider.ListSamples(removed.OrganizationId, removed.DeviceGroupId, removed.DeviceId, removed.Name, entities.TimeRange{}, 10)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(samples).To(gomega.BeEmpty())
+			last, err := provider.GetLastValues(removed.OrganizationId, removed.DeviceGroupId, removed.DeviceId, nil)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(last).To(gomega.BeEmpty())
+		}
+	})
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+	"sort"
+	"time"
+)
+
+const rowNotFound = "not found"
+
+// ttlExpired is the retention of the samples. The last values of the metrics are kept until they are removed.
+const ttlExpired = time.Duration(30*24) * time.Hour
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+// AddSamples writes the last values with the timestamp of the samples, so older samples do not replace newer ones
+// regardless of the order in which they arrive.
+func (sp *ScyllaProvider) AddSamples(samples []*entities.MetricSample) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	for _, sample := range samples {
+		stmt, names := qb.Insert("device_metric").Columns("organization_id", "device_group_id", "device_id", "name",
+			"timestamp", "value").TTL(ttlExpired).ToCql()
+		q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(sample)
+		cqlErr := q.ExecRelease()
+		if cqlErr != nil {
+			return derrors.AsError(cqlErr, "cannot add metric sample")
+		}
+
+		stmt, names = qb.Insert("device_metric_last").Columns("organization_id", "device_group_id", "device_id", "name",
+			"timestamp", "value").Timestamp(time.Unix(sample.Timestamp, 0)).ToCql()
+		q = gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(sample)
+		cqlErr = q.ExecRelease()
+		if cqlErr != nil {
+			return derrors.AsError(cqlErr, "cannot update the last value of the metric")
+		}
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) ListSamples(organizationID string, deviceGroupID string, deviceID string, name string, timeRange entities.TimeRange, limit int) ([]*entities.MetricSample, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]*entities.MetricSample, 0)
+	stmt, names := qb.Select("device_metric").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).Where(qb.Eq("name")).Where(qb.GtOrEqNamed("timestamp", "from")).
+		Where(qb.LtOrEqNamed("timestamp", "to")).Limit(uint(limit)).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+		"name":            name,
+		"from":            timeRange.From,
+		"to":              timeRange.Upper(),
+	})
+
+	cqlErr := gocqlx.Select(&samples, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return samples, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list the samples of the metric")
+	}
+
+	return samples, nil
+}
+
+func (sp *ScyllaProvider) GetLastValues(organizationID string, deviceGroupID string, deviceID string, names []string) ([]*entities.MetricSample, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := sp.listDeviceLastValues(organizationID, deviceGroupID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return last, nil
+	}
+
+	requested := make(map[string]bool, len(names))
+	for _, name := range names {
+		requested[name] = true
+	}
+	result := make([]*entities.MetricSample, 0, len(names))
+	for _, sample := range last {
+		if requested[sample.Name] {
+			result = append(result, sample)
+		}
+	}
+	return result, nil
+}
+
+// listDeviceLastValues returns the last values of the metrics of a device, sorted by name.
+func (sp *ScyllaProvider) listDeviceLastValues(organizationID string, deviceGroupID string, deviceID string) ([]*entities.MetricSample, derrors.Error) {
+	samples := make([]*entities.MetricSample, 0)
+	stmt, names := qb.Select("device_metric_last").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := gocqlx.Select(&samples, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return samples, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot get the last values of the metrics")
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Name < samples[j].Name
+	})
+
+	return samples, nil
+}
+
+// removeSeries removes the samples of the metrics whose last values are given.
+func (sp *ScyllaProvider) removeSeries(last []*entities.MetricSample) derrors.Error {
+	stmt, _ := qb.Delete("device_metric").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).Where(qb.Eq("name")).ToCql()
+	for _, sample := range last {
+		cqlErr := sp.Session.Query(stmt, sample.OrganizationId, sample.DeviceGroupId, sample.DeviceId, sample.Name).Exec()
+		if cqlErr != nil {
+			return derrors.AsError(cqlErr, "cannot remove the samples of the metric")
+		}
+	}
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveDeviceMetrics(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	// the last values are the index of the time series of the device, so they are removed at the end
+	last, err := sp.listDeviceLastValues(organizationID, deviceGroupID, deviceID)
+	if err != nil {
+		return err
+	}
+	err = sp.removeSeries(last)
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_metric_last").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).
+		Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove the metrics of the device")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveGroupMetrics(organizationID string, deviceGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	last := make([]*entities.MetricSample, 0)
+	stmt, names := qb.Select("device_metric_last").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+	cqlErr := gocqlx.Select(&last, q.Query)
+	if cqlErr != nil && cqlErr.Error() != rowNotFound {
+		return derrors.AsError(cqlErr, "cannot list the metrics of the device group")
+	}
+	err = sp.removeSeries(last)
+	if err != nil {
+		return err
+	}
+
+	stmt, _ = qb.Delete("device_metric_last").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	cqlErr = sp.Session.Query(stmt, organizationID, deviceGroupID).Exec()
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove the metrics of the device group")
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package repair
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// tasks indexed by task_id
+	tasks map[string]*entities.RepairTask
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		tasks: make(map[string]*entities.RepairTask, 0),
+	}
+}
+
+func (m *MockupProvider) AddTask(task entities.RepairTask) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, exists := m.tasks[task.TaskId]; exists {
+		return derrors.NewAlreadyExistsError("repair task").WithParams(task.TaskId)
+	}
+	m.tasks[task.TaskId] = &task
+	return nil
+}
+
+func (m *MockupProvider) GetTask(taskID string) (*entities.RepairTask, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	task, exists := m.tasks[taskID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("repair task").WithParams(taskID)
+	}
+	retrieved := *task
+	return &retrieved, nil
+}
+
+func (m *MockupProvider) ListTasks() ([]*entities.RepairTask, derrors.Error) {
+	return m.ListDueTasks(-1)
+}
+
+// ListDueTasks returns all the tasks if the timestamp is negative.
+func (m *MockupProvider) ListDueTasks(timestamp int64) ([]*entities.RepairTask, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.RepairTask, 0)
+	for _, task := range m.tasks {
+		if timestamp < 0 || task.NextAttempt <= timestamp {
+			retrieved := *task
+			result = append(result, &retrieved)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) UpdateTask(task entities.RepairTask) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, exists := m.tasks[task.TaskId]; !exists {
+		return derrors.NewNotFoundError("repair task").WithParams(task.TaskId)
+	}
+	m.tasks[task.TaskId] = &task
+	return nil
+}
+
+func (m *MockupProvider) RemoveTask(taskID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, exists := m.tasks[taskID]; !exists {
+		return derrors.NewNotFoundError("repair task").WithParams(taskID)
+	}
+	delete(m.tasks, taskID)
+	return nil
+}
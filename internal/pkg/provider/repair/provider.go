@@ -0,0 +1,43 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package repair
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the durable queue of repair tasks.
+type Provider interface {
+	// AddTask adds a task to the queue
+	AddTask(task entities.RepairTask) derrors.Error
+
+	// GetTask returns a task of the queue
+	GetTask(taskID string) (*entities.RepairTask, derrors.Error)
+
+	// ListTasks returns all the tasks of the queue
+	ListTasks() ([]*entities.RepairTask, derrors.Error)
+
+	// ListDueTasks returns the tasks whose next attempt is before a given timestamp
+	ListDueTasks(timestamp int64) ([]*entities.RepairTask, derrors.Error)
+
+	// UpdateTask updates the execution information of a task
+	UpdateTask(task entities.RepairTask) derrors.Error
+
+	// RemoveTask removes a task from the queue
+	RemoveTask(taskID string) derrors.Error
+}
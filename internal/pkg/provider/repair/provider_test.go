@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package repair
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createTask(now time.Time) *entities.RepairTask {
+	task := entities.NewDeviceRepairTask(entities.RemoveDeviceOperation, uuid.New().String(), uuid.New().String(), uuid.New().String())
+	task.Queued(fmt.Errorf("unavailable"), now)
+	return task
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add and retrieve a task", func() {
+		task := createTask(time.Now())
+		err := provider.AddTask(*task)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		retrieved, err := provider.GetTask(task.TaskId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*retrieved).To(gomega.Equal(*task))
+	})
+	ginkgo.It("Should not be able to retrieve a non existing task", func() {
+		_, err := provider.GetTask(uuid.New().String())
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("Should only list the tasks that are due", func() {
+		now := time.Now()
+		due := createTask(now)
+		err := provider.AddTask(*due)
+		gomega.Expect(err).To(gomega.Succeed())
+		later := createTask(now)
+		later.Failed(fmt.Errorf("unavailable"), now)
+		err = provider.AddTask(*later)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		list, err := provider.ListDueTasks(now.Unix())
+		gomega.Expect(err).To(gomega.Succeed())
+		ids := make([]string, 0)
+		for _, task := range list {
+			ids = append(ids, task.TaskId)
+		}
+		gomega.Expect(ids).To(gomega.ContainElement(due.TaskId))
+		gomega.Expect(ids).NotTo(gomega.ContainElement(later.TaskId))
+
+		all, err := provider.ListTasks()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(len(all)).To(gomega.BeNumerically(">=", 2))
+	})
+	ginkgo.It("Should be able to update a task", func() {
+		now := time.Now()
+		task := createTask(now)
+		err := provider.AddTask(*task)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		task.Failed(fmt.Errorf("still unavailable"), now)
+		err = provider.UpdateTask(*task)
+		gomega.Expect(err).To(gomega.Succeed())
+		retrieved, err := provider.GetTask(task.TaskId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved.Attempts).To(gomega.Equal(int32(1)))
+		gomega.Expect(retrieved.LastError).To(gomega.Equal("still unavailable"))
+	})
+	ginkgo.It("Should be able to remove a task", func() {
+		task := createTask(time.Now())
+		err := provider.AddTask(*task)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		err = provider.RemoveTask(task.TaskId)
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = provider.GetTask(task.TaskId)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("Should not be able to remove a non existing task", func() {
+		err := provider.RemoveTask(uuid.New().String())
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+}
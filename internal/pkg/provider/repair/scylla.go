@@ -0,0 +1,205 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package repair
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+var taskColumns = []string{"task_id", "organization_id", "device_group_id", "device_id", "operation", "created",
+	"attempts", "last_error", "next_attempt"}
+
+func (sp *ScyllaProvider) unsafeExists(taskID string) (bool, derrors.Error) {
+	var count int
+	stmt, names := qb.Select("repair_task").CountAll().Where(qb.Eq("task_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"task_id": taskID,
+	})
+
+	cqlErr := q.GetRelease(&count)
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot determine if the repair task exists")
+	}
+
+	return count == 1, nil
+}
+
+func (sp *ScyllaProvider) AddTask(task entities.RepairTask) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExists(task.TaskId)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return derrors.NewAlreadyExistsError("repair task").WithParams(task.TaskId)
+	}
+
+	stmt, names := qb.Insert("repair_task").Columns(taskColumns...).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(task)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add repair task")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) GetTask(taskID string) (*entities.RepairTask, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	var task entities.RepairTask
+	stmt, names := qb.Get("repair_task").Where(qb.Eq("task_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"task_id": taskID,
+	})
+
+	cqlErr := q.GetRelease(&task)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return nil, derrors.NewNotFoundError("repair task").WithParams(taskID)
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve repair task")
+	}
+
+	return &task, nil
+}
+
+func (sp *ScyllaProvider) ListTasks() ([]*entities.RepairTask, derrors.Error) {
+	return sp.ListDueTasks(-1)
+}
+
+// ListDueTasks reads the whole queue, which is only expected to contain the operations that failed. All the tasks
+// are returned if the timestamp is negative.
+func (sp *ScyllaProvider) ListDueTasks(timestamp int64) ([]*entities.RepairTask, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*entities.RepairTask, 0)
+	stmt, names := qb.Select("repair_task").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names)
+
+	cqlErr := gocqlx.Select(&tasks, q.Query)
+	if cqlErr != nil && cqlErr.Error() != rowNotFound {
+		return nil, derrors.AsError(cqlErr, "cannot list repair tasks")
+	}
+
+	result := make([]*entities.RepairTask, 0)
+	for _, task := range tasks {
+		if timestamp < 0 || task.NextAttempt <= timestamp {
+			result = append(result, task)
+		}
+	}
+	return result, nil
+}
+
+func (sp *ScyllaProvider) UpdateTask(task entities.RepairTask) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExists(task.TaskId)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return derrors.NewNotFoundError("repair task").WithParams(task.TaskId)
+	}
+
+	stmt, names := qb.Update("repair_task").Set("attempts", "last_error", "next_attempt").Where(qb.Eq("task_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(task)
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot update repair task")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveTask(taskID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	exists, err := sp.unsafeExists(taskID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return derrors.NewNotFoundError("repair task").WithParams(taskID)
+	}
+
+	stmt, _ := qb.Delete("repair_task").Where(qb.Eq("task_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, taskID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove repair task")
+	}
+
+	return nil
+}
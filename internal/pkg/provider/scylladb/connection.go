@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scylladb
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"sync"
+)
+
+// Connection is the connection of a provider to a ScyllaDB keyspace. Providers embed it and lock it while they use the
+// session.
+type Connection struct {
+	Address  string
+	Port     int
+	Keyspace string
+	Session  *gocql.Session
+	sync.Mutex
+}
+
+// NewConnection creates a connection with its own session. If the session cannot be created, it is created again
+// when the connection is used.
+func NewConnection(address string, port int, keyspace string) *Connection {
+	connection := &Connection{Address: address, Port: port, Keyspace: keyspace, Session: nil}
+	connection.connect()
+	return connection
+}
+
+// NewSharedConnection creates a connection that uses a session shared with other providers. Closing the session
+// affects all of them.
+func NewSharedConnection(address string, port int, keyspace string, session *gocql.Session) *Connection {
+	return &Connection{Address: address, Port: port, Keyspace: keyspace, Session: session}
+}
+
+func (c *Connection) connect() derrors.Error {
+	// connect to the cluster
+	conf := gocql.NewCluster(c.Address)
+	conf.Keyspace = c.Keyspace
+	conf.Port = c.Port
+
+	session, err := conf.CreateSession()
+	if err != nil {
+		log.Error().Str("provider", "ScyllaProvider").Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to connect")
+		return derrors.AsError(err, "cannot connect")
+	}
+
+	c.Session = session
+
+	return nil
+}
+
+// CheckAndConnect creates the session if the connection does not have one. The connection must be locked.
+func (c *Connection) CheckAndConnect() derrors.Error {
+
+	if c.Session == nil {
+		log.Info().Msg("session no created, trying to reconnect...")
+		// try to reconnect
+		err := c.connect()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Disconnect closes the session of the connection.
+func (c *Connection) Disconnect() {
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.Session != nil {
+		c.Session.Close()
+		c.Session = nil
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package token
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// tokens indexed by organization_id + device_group_id, token_id
+	tokens map[string]map[string]*entities.RegistrationToken
+	// token identifiers indexed by organization_id + device_group_id, device_id
+	devices map[string]map[string]string
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		tokens:  make(map[string]map[string]*entities.RegistrationToken, 0),
+		devices: make(map[string]map[string]string, 0),
+	}
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string) string {
+	return organizationID + "/" + deviceGroupID
+}
+
+func (m *MockupProvider) unsafeGetToken(organizationID string, deviceGroupID string, tokenID string) (*entities.RegistrationToken, derrors.Error) {
+	token, exists := m.tokens[m.getKey(organizationID, deviceGroupID)][tokenID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("registration token").WithParams(organizationID, deviceGroupID, tokenID)
+	}
+	return token, nil
+}
+
+func (m *MockupProvider) AddToken(token entities.RegistrationToken) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(token.OrganizationId, token.DeviceGroupId)
+	group, exists := m.tokens[key]
+	if !exists {
+		group = make(map[string]*entities.RegistrationToken, 0)
+		m.tokens[key] = group
+	}
+	if _, exists := group[token.TokenId]; exists {
+		return derrors.NewAlreadyExistsError("registration token").WithParams(token.OrganizationId, token.DeviceGroupId, token.TokenId)
+	}
+	group[token.TokenId] = &token
+	return nil
+}
+
+func (m *MockupProvider) GetToken(organizationID string, deviceGroupID string, tokenID string) (*entities.RegistrationToken, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	token, err := m.unsafeGetToken(organizationID, deviceGroupID, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	// return a copy so that the caller cannot modify the stored token
+	retrieved := *token
+	return &retrieved, nil
+}
+
+func (m *MockupProvider) ListTokens(organizationID string, deviceGroupID string) ([]*entities.RegistrationToken, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]*entities.RegistrationToken, 0)
+	for _, token := range m.tokens[m.getKey(organizationID, deviceGroupID)] {
+		retrieved := *token
+		result = append(result, &retrieved)
+	}
+	return result, nil
+}
+
+func (m *MockupProvider) UpdateTokenUses(organizationID string, deviceGroupID string, tokenID string, previous int32, uses int32) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	token, err := m.unsafeGetToken(organizationID, deviceGroupID, tokenID)
+	if err != nil {
+		return false, err
+	}
+	if token.Uses != previous {
+		return false, nil
+	}
+	token.Uses = uses
+	return true, nil
+}
+
+func (m *MockupProvider) RevokeToken(organizationID string, deviceGroupID string, tokenID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	token, err := m.unsafeGetToken(organizationID, deviceGroupID, tokenID)
+	if err != nil {
+		return err
+	}
+	token.Revoked = true
+	return nil
+}
+
+func (m *MockupProvider) RemoveGroupTokens(organizationID string, deviceGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(organizationID, deviceGroupID)
+	delete(m.tokens, key)
+	delete(m.devices, key)
+	return nil
+}
+
+func (m *MockupProvider) SetDeviceToken(organizationID string, deviceGroupID string, deviceID string, tokenID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(organizationID, deviceGroupID)
+	group, exists := m.devices[key]
+	if !exists {
+		group = make(map[string]string, 0)
+		m.devices[key] = group
+	}
+	group[deviceID] = tokenID
+	return nil
+}
+
+func (m *MockupProvider) GetDeviceToken(organizationID string, deviceGroupID string, deviceID string) (string, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.devices[m.getKey(organizationID, deviceGroupID)][deviceID], nil
+}
+
+func (m *MockupProvider) RemoveDeviceToken(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.devices[m.getKey(organizationID, deviceGroupID)], deviceID)
+	return nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package token
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the registration tokens of the device groups.
+type Provider interface {
+	// AddToken adds a new registration token
+	AddToken(token entities.RegistrationToken) derrors.Error
+
+	// GetToken returns a registration token
+	GetToken(organizationID string, deviceGroupID string, tokenID string) (*entities.RegistrationToken, derrors.Error)
+
+	// ListTokens returns the registration tokens of a device group
+	ListTokens(organizationID string, deviceGroupID string) ([]*entities.RegistrationToken, derrors.Error)
+
+	// UpdateTokenUses sets the number of uses of a token if it has not changed since it was read. It returns
+	// false if the token was updated concurrently
+	UpdateTokenUses(organizationID string, deviceGroupID string, tokenID string, previous int32, uses int32) (bool, derrors.Error)
+
+	// RevokeToken marks a token as revoked
+	RevokeToken(organizationID string, deviceGroupID string, tokenID string) derrors.Error
+
+	// RemoveGroupTokens removes all the tokens of a device group and the devices registered with them
+	RemoveGroupTokens(organizationID string, deviceGroupID string) derrors.Error
+
+	// SetDeviceToken records the token used to register a device
+	SetDeviceToken(organizationID string, deviceGroupID string, deviceID string, tokenID string) derrors.Error
+
+	// GetDeviceToken returns the token used to register a device, or an empty string if the device was registered
+	// with the device group API key
+	GetDeviceToken(organizationID string, deviceGroupID string, deviceID string) (string, derrors.Error)
+
+	// RemoveDeviceToken removes the token record of a device
+	RemoveDeviceToken(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package token
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+func createToken(organizationID string, deviceGroupID string) *entities.RegistrationToken {
+	return &entities.RegistrationToken{
+		OrganizationId:  organizationID,
+		DeviceGroupId:   deviceGroupID,
+		TokenId:         uuid.New().String(),
+		SecretHash:      uuid.New().String(),
+		Created:         time.Now().Unix(),
+		Expires:         time.Now().Add(time.Hour).Unix(),
+		MaxUses:         10,
+		DeviceIdPattern: "sensor-.*",
+	}
+}
+
+func RunTest(provider Provider) {
+	ginkgo.Context("registration tokens", func() {
+		ginkgo.It("Should be able to add and retrieve a token", func() {
+			token := createToken(uuid.New().String(), uuid.New().String())
+			err := provider.AddToken(*token)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			retrieved, err := provider.GetToken(token.OrganizationId, token.DeviceGroupId, token.TokenId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(*retrieved).To(gomega.Equal(*token))
+		})
+		ginkgo.It("Should not be able to add the same token twice", func() {
+			token := createToken(uuid.New().String(), uuid.New().String())
+			err := provider.AddToken(*token)
+			gomega.Expect(err).To(gomega.Succeed())
+			err = provider.AddToken(*token)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("Should not be able to retrieve a non existing token", func() {
+			_, err := provider.GetToken(uuid.New().String(), uuid.New().String(), uuid.New().String())
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("Should be able to list the tokens of a group", func() {
+			organizationID := uuid.New().String()
+			deviceGroupID := uuid.New().String()
+			for i := 0; i < 2; i++ {
+				err := provider.AddToken(*createToken(organizationID, deviceGroupID))
+				gomega.Expect(err).To(gomega.Succeed())
+			}
+			list, err := provider.ListTokens(organizationID, deviceGroupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(list)).To(gomega.Equal(2))
+		})
+		ginkgo.It("Should only update the uses if they have not changed", func() {
+			token := createToken(uuid.New().String(), uuid.New().String())
+			err := provider.AddToken(*token)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			applied, err := provider.UpdateTokenUses(token.OrganizationId, token.DeviceGroupId, token.TokenId, 0, 1)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(applied).To(gomega.BeTrue())
+			applied, err = provider.UpdateTokenUses(token.OrganizationId, token.DeviceGroupId, token.TokenId, 0, 1)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(applied).To(gomega.BeFalse())
+
+			retrieved, err := provider.GetToken(token.OrganizationId, token.DeviceGroupId, token.TokenId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.Uses).To(gomega.Equal(int32(1)))
+		})
+		ginkgo.It("Should be able to revoke a token", func() {
+			token := createToken(uuid.New().String(), uuid.New().String())
+			err := provider.AddToken(*token)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			err = provider.RevokeToken(token.OrganizationId, token.DeviceGroupId, token.TokenId)
+			gomega.Expect(err).To(gomega.Succeed())
+			retrieved, err := provider.GetToken(token.OrganizationId, token.DeviceGroupId, token.TokenId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.Revoked).To(gomega.BeTrue())
+		})
+		ginkgo.It("Should not be able to revoke a non existing token", func() {
+			err := provider.RevokeToken(uuid.New().String(), uuid.New().String(), uuid.New().String())
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("device tokens", func() {
+		ginkgo.It("Should record the token used to register a device", func() {
+			organizationID := uuid.New().String()
+			deviceGroupID := uuid.New().String()
+			deviceID := uuid.New().String()
+			tokenID := uuid.New().String()
+
+			err := provider.SetDeviceToken(organizationID, deviceGroupID, deviceID, tokenID)
+			gomega.Expect(err).To(gomega.Succeed())
+			retrieved, err := provider.GetDeviceToken(organizationID, deviceGroupID, deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved).To(gomega.Equal(tokenID))
+
+			err = provider.RemoveDeviceToken(organizationID, deviceGroupID, deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			retrieved, err = provider.GetDeviceToken(organizationID, deviceGroupID, deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved).To(gomega.BeEmpty())
+		})
+		ginkgo.It("Should remove the tokens of a device group", func() {
+			token := createToken(uuid.New().String(), uuid.New().String())
+			err := provider.AddToken(*token)
+			gomega.Expect(err).To(gomega.Succeed())
+			deviceID := uuid.New().String()
+			err = provider.SetDeviceToken(token.OrganizationId, token.DeviceGroupId, deviceID, token.TokenId)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			err = provider.RemoveGroupTokens(token.OrganizationId, token.DeviceGroupId)
+			gomega.Expect(err).To(gomega.Succeed())
+			list, err := provider.ListTokens(token.OrganizationId, token.DeviceGroupId)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(list).To(gomega.BeEmpty())
+			retrieved, err := provider.GetDeviceToken(token.OrganizationId, token.DeviceGroupId, deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved).To(gomega.BeEmpty())
+		})
+	})
+}
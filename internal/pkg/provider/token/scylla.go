@@ -0,0 +1,295 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package token
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+var tokenColumns = []string{"organization_id", "device_group_id", "token_id", "secret_hash", "created", "expires",
+	"max_uses", "uses", "device_id_pattern", "revoked"}
+
+func (sp *ScyllaProvider) unsafeGetToken(organizationID string, deviceGroupID string, tokenID string) (*entities.RegistrationToken, derrors.Error) {
+	var token entities.RegistrationToken
+	stmt, names := qb.Get("registration_token").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("token_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"token_id":        tokenID,
+	})
+
+	cqlErr := q.GetRelease(&token)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return nil, derrors.NewNotFoundError("registration token").WithParams(organizationID, deviceGroupID, tokenID)
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve registration token")
+	}
+
+	return &token, nil
+}
+
+func (sp *ScyllaProvider) AddToken(token entities.RegistrationToken) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("registration_token").Columns(tokenColumns...).Unique().ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(token)
+	applied, cqlErr := q.MapScanCAS(make(map[string]interface{}))
+	q.Release()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot add registration token")
+	}
+	if !applied {
+		return derrors.NewAlreadyExistsError("registration token").WithParams(token.OrganizationId, token.DeviceGroupId, token.TokenId)
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) GetToken(organizationID string, deviceGroupID string, tokenID string) (*entities.RegistrationToken, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	return sp.unsafeGetToken(organizationID, deviceGroupID, tokenID)
+}
+
+func (sp *ScyllaProvider) ListTokens(organizationID string, deviceGroupID string) ([]*entities.RegistrationToken, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]*entities.RegistrationToken, 0)
+	stmt, names := qb.Select("registration_token").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+	})
+
+	cqlErr := gocqlx.Select(&tokens, q.Query)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return tokens, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot list registration tokens")
+	}
+
+	return tokens, nil
+}
+
+// UpdateTokenUses relies on a lightweight transaction so that the maximum number of uses is respected by all the
+// instances of the device manager.
+func (sp *ScyllaProvider) UpdateTokenUses(organizationID string, deviceGroupID string, tokenID string, previous int32, uses int32) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = sp.unsafeGetToken(organizationID, deviceGroupID, tokenID)
+	if err != nil {
+		return false, err
+	}
+
+	stmt, names := qb.Update("registration_token").Set("uses").
+		Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("token_id")).
+		If(qb.EqNamed("uses", "previous")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"token_id":        tokenID,
+		"uses":            uses,
+		"previous":        previous,
+	})
+	applied, cqlErr := q.MapScanCAS(make(map[string]interface{}))
+	q.Release()
+
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot update registration token uses")
+	}
+
+	return applied, nil
+}
+
+func (sp *ScyllaProvider) RevokeToken(organizationID string, deviceGroupID string, tokenID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	_, err = sp.unsafeGetToken(organizationID, deviceGroupID, tokenID)
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Update("registration_token").Set("revoked").
+		Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("token_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"token_id":        tokenID,
+		"revoked":         true,
+	})
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot revoke registration token")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveGroupTokens(organizationID string, deviceGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"registration_token", "device_registration_token"} {
+		stmt, _ := qb.Delete(table).Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+		cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID).Exec()
+		if cqlErr != nil {
+			return derrors.AsError(cqlErr, "cannot remove registration tokens")
+		}
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) SetDeviceToken(organizationID string, deviceGroupID string, deviceID string, tokenID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, names := qb.Insert("device_registration_token").Columns("organization_id", "device_group_id", "device_id", "token_id").ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+		"token_id":        tokenID,
+	})
+	cqlErr := q.ExecRelease()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot record device registration token")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) GetDeviceToken(organizationID string, deviceGroupID string, deviceID string) (string, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return "", err
+	}
+
+	var tokenID string
+	stmt, names := qb.Select("device_registration_token").Columns("token_id").
+		Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := q.GetRelease(&tokenID)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return "", nil
+		}
+		return "", derrors.AsError(cqlErr, "cannot retrieve device registration token")
+	}
+
+	return tokenID, nil
+}
+
+func (sp *ScyllaProvider) RemoveDeviceToken(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_registration_token").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove device registration token")
+	}
+
+	return nil
+}
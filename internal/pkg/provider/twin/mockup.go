@@ -0,0 +1,126 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package twin
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"strings"
+	"sync"
+)
+
+type MockupProvider struct {
+	sync.Mutex
+	// twins indexed by organization_id + device_group_id + device_id
+	twins map[string]entities.DeviceTwin
+}
+
+func NewMockupProvider() *MockupProvider {
+	return &MockupProvider{
+		twins: make(map[string]entities.DeviceTwin, 0),
+	}
+}
+
+func (m *MockupProvider) getGroupKey(organizationID string, deviceGroupID string) string {
+	return organizationID + "/" + deviceGroupID + "/"
+}
+
+func (m *MockupProvider) getKey(organizationID string, deviceGroupID string, deviceID string) string {
+	return m.getGroupKey(organizationID, deviceGroupID) + deviceID
+}
+
+func (m *MockupProvider) AddTwin(twin entities.DeviceTwin) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+	if _, exists := m.twins[key]; exists {
+		return false, nil
+	}
+	m.twins[key] = twin
+	return true, nil
+}
+
+func (m *MockupProvider) GetTwin(organizationID string, deviceGroupID string, deviceID string) (*entities.DeviceTwin, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	twin, exists := m.twins[m.getKey(organizationID, deviceGroupID, deviceID)]
+	if !exists {
+		return nil, nil
+	}
+	return &twin, nil
+}
+
+func (m *MockupProvider) UpdateDesired(twin entities.DeviceTwin, previousVersion int64) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+	current, exists := m.twins[key]
+	if !exists {
+		return false, derrors.NewNotFoundError("device twin").WithParams(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+	}
+	if current.DesiredVersion != previousVersion {
+		return false, nil
+	}
+	current.Desired = twin.Desired
+	current.DesiredVersion = twin.DesiredVersion
+	current.DesiredUpdated = twin.DesiredUpdated
+	m.twins[key] = current
+	return true, nil
+}
+
+func (m *MockupProvider) UpdateReported(twin entities.DeviceTwin, previousVersion int64) (bool, derrors.Error) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := m.getKey(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+	current, exists := m.twins[key]
+	if !exists {
+		return false, derrors.NewNotFoundError("device twin").WithParams(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+	}
+	if current.ReportedVersion != previousVersion {
+		return false, nil
+	}
+	current.Reported = twin.Reported
+	current.ReportedVersion = twin.ReportedVersion
+	current.ReportedUpdated = twin.ReportedUpdated
+	m.twins[key] = current
+	return true, nil
+}
+
+func (m *MockupProvider) RemoveTwin(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.twins, m.getKey(organizationID, deviceGroupID, deviceID))
+	return nil
+}
+
+func (m *MockupProvider) RemoveGroupTwins(organizationID string, deviceGroupID string) derrors.Error {
+	m.Lock()
+	defer m.Unlock()
+
+	prefix := m.getGroupKey(organizationID, deviceGroupID)
+	for key := range m.twins {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.twins, key)
+		}
+	}
+	return nil
+}
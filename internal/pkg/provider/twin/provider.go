@@ -0,0 +1,45 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package twin
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+)
+
+// Provider of the twins of the devices.
+type Provider interface {
+	// AddTwin adds the twin of a device if it does not exist. It returns false if the twin already exists
+	AddTwin(twin entities.DeviceTwin) (bool, derrors.Error)
+
+	// GetTwin returns the twin of a device, or nil if the twin has not been created
+	GetTwin(organizationID string, deviceGroupID string, deviceID string) (*entities.DeviceTwin, derrors.Error)
+
+	// UpdateDesired sets the desired document of a twin if its version has not changed since it was read. It
+	// returns false if the twin was updated concurrently
+	UpdateDesired(twin entities.DeviceTwin, previousVersion int64) (bool, derrors.Error)
+
+	// UpdateReported sets the reported document of a twin if its version has not changed since it was read. It
+	// returns false if the twin was updated concurrently
+	UpdateReported(twin entities.DeviceTwin, previousVersion int64) (bool, derrors.Error)
+
+	// RemoveTwin removes the twin of a device
+	RemoveTwin(organizationID string, deviceGroupID string, deviceID string) derrors.Error
+
+	// RemoveGroupTwins removes the twins of all the devices of a device group
+	RemoveGroupTwins(organizationID string, deviceGroupID string) derrors.Error
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package twin
+
+import (
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+func createTwin() *entities.DeviceTwin {
+	return entities.NewDeviceTwin(uuid.New().String(), uuid.New().String(), uuid.New().String())
+}
+
+func RunTest(provider Provider) {
+	ginkgo.It("Should be able to add a twin only once", func() {
+		twin := createTwin()
+		added, err := provider.AddTwin(*twin)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(added).To(gomega.BeTrue())
+
+		added, err = provider.AddTwin(*twin)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(added).To(gomega.BeFalse())
+	})
+	ginkgo.It("Should be able to get a twin", func() {
+		twin := createTwin()
+		retrieved, err := provider.GetTwin(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved).To(gomega.BeNil())
+
+		_, err = provider.AddTwin(*twin)
+		gomega.Expect(err).To(gomega.Succeed())
+		retrieved, err = provider.GetTwin(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*retrieved).Should(gomega.Equal(*twin))
+	})
+	ginkgo.It("Should be able to update the documents of a twin if the version has not changed", func() {
+		twin := createTwin()
+		_, err := provider.AddTwin(*twin)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		_, derr := twin.PatchDesired(`{"led": true}`, 10)
+		gomega.Expect(derr).To(gomega.Succeed())
+		applied, err := provider.UpdateDesired(*twin, 0)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(applied).To(gomega.BeTrue())
+		applied, err = provider.UpdateDesired(*twin, 0)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(applied).To(gomega.BeFalse())
+
+		_, derr = twin.PatchReported(`{"led": false}`, 20)
+		gomega.Expect(derr).To(gomega.Succeed())
+		applied, err = provider.UpdateReported(*twin, 0)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(applied).To(gomega.BeTrue())
+
+		retrieved, err := provider.GetTwin(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*retrieved).Should(gomega.Equal(*twin))
+	})
+	ginkgo.It("Should not be able to update a twin that does not exist", func() {
+		twin := createTwin()
+		_, err := provider.UpdateDesired(*twin, 0)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("Should be able to remove the twins of a device and of a device group", func() {
+		twin := createTwin()
+		other := entities.NewDeviceTwin(twin.OrganizationId, twin.DeviceGroupId, uuid.New().String())
+		for _, t := range []*entities.DeviceTwin{twin, other} {
+			_, err := provider.AddTwin(*t)
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+
+		err := provider.RemoveTwin(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		retrieved, err := provider.GetTwin(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved).To(gomega.BeNil())
+
+		err = provider.RemoveGroupTwins(twin.OrganizationId, twin.DeviceGroupId)
+		gomega.Expect(err).To(gomega.Succeed())
+		retrieved, err = provider.GetTwin(other.OrganizationId, other.DeviceGroupId, other.DeviceId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved).To(gomega.BeNil())
+	})
+}
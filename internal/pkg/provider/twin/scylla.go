@@ -0,0 +1,199 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package twin
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/scylladb"
+	"github.com/scylladb/gocqlx"
+	"github.com/scylladb/gocqlx/qb"
+)
+
+const rowNotFound = "not found"
+
+type ScyllaProvider struct {
+	*scylladb.Connection
+}
+
+func NewScyllaProvider(address string, port int, keyspace string) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewConnection(address, port, keyspace)}
+}
+
+func NewScyllaProviderWithSession(address string, port int, keyspace string, session *gocql.Session) *ScyllaProvider {
+	return &ScyllaProvider{scylladb.NewSharedConnection(address, port, keyspace, session)}
+}
+
+var twinColumns = []string{"organization_id", "device_group_id", "device_id", "desired", "desired_version",
+	"desired_updated", "reported", "reported_version", "reported_updated"}
+
+func (sp *ScyllaProvider) unsafeGetTwin(organizationID string, deviceGroupID string, deviceID string) (*entities.DeviceTwin, derrors.Error) {
+	var twin entities.DeviceTwin
+	stmt, names := qb.Get("device_twin").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id": organizationID,
+		"device_group_id": deviceGroupID,
+		"device_id":       deviceID,
+	})
+
+	cqlErr := q.GetRelease(&twin)
+	if cqlErr != nil {
+		if cqlErr.Error() == rowNotFound {
+			return nil, nil
+		}
+		return nil, derrors.AsError(cqlErr, "cannot retrieve device twin")
+	}
+
+	return &twin, nil
+}
+
+// AddTwin relies on a lightweight transaction so that the twin is only created once when several instances of the
+// device manager receive the first update of a device at the same time.
+func (sp *ScyllaProvider) AddTwin(twin entities.DeviceTwin) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	stmt, names := qb.Insert("device_twin").Columns(twinColumns...).Unique().ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindStruct(twin)
+	applied, cqlErr := q.MapScanCAS(make(map[string]interface{}))
+	q.Release()
+
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot add device twin")
+	}
+
+	return applied, nil
+}
+
+func (sp *ScyllaProvider) GetTwin(organizationID string, deviceGroupID string, deviceID string) (*entities.DeviceTwin, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return nil, err
+	}
+
+	return sp.unsafeGetTwin(organizationID, deviceGroupID, deviceID)
+}
+
+// unsafeUpdateDocument sets one of the documents of a twin with a lightweight transaction on its version.
+func (sp *ScyllaProvider) unsafeUpdateDocument(twin entities.DeviceTwin, document string, value string, version int64,
+	updated int64, previousVersion int64) (bool, derrors.Error) {
+	current, err := sp.unsafeGetTwin(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+	if err != nil {
+		return false, err
+	}
+	if current == nil {
+		return false, derrors.NewNotFoundError("device twin").WithParams(twin.OrganizationId, twin.DeviceGroupId, twin.DeviceId)
+	}
+
+	stmt, names := qb.Update("device_twin").Set(document, document+"_version", document+"_updated").
+		Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).
+		If(qb.EqNamed(document+"_version", "previous")).ToCql()
+	q := gocqlx.Query(sp.Session.Query(stmt), names).BindMap(qb.M{
+		"organization_id":     twin.OrganizationId,
+		"device_group_id":     twin.DeviceGroupId,
+		"device_id":           twin.DeviceId,
+		document:              value,
+		document + "_version": version,
+		document + "_updated": updated,
+		"previous":            previousVersion,
+	})
+	applied, cqlErr := q.MapScanCAS(make(map[string]interface{}))
+	q.Release()
+
+	if cqlErr != nil {
+		return false, derrors.AsError(cqlErr, "cannot update device twin")
+	}
+
+	return applied, nil
+}
+
+func (sp *ScyllaProvider) UpdateDesired(twin entities.DeviceTwin, previousVersion int64) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	return sp.unsafeUpdateDocument(twin, "desired", twin.Desired, twin.DesiredVersion, twin.DesiredUpdated, previousVersion)
+}
+
+func (sp *ScyllaProvider) UpdateReported(twin entities.DeviceTwin, previousVersion int64) (bool, derrors.Error) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return false, err
+	}
+
+	return sp.unsafeUpdateDocument(twin, "reported", twin.Reported, twin.ReportedVersion, twin.ReportedUpdated, previousVersion)
+}
+
+func (sp *ScyllaProvider) RemoveTwin(organizationID string, deviceGroupID string, deviceID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_twin").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).Where(qb.Eq("device_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID, deviceID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove device twin")
+	}
+
+	return nil
+}
+
+func (sp *ScyllaProvider) RemoveGroupTwins(organizationID string, deviceGroupID string) derrors.Error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	// check connection
+	err := sp.CheckAndConnect()
+	if err != nil {
+		return err
+	}
+
+	stmt, _ := qb.Delete("device_twin").Where(qb.Eq("organization_id")).Where(qb.Eq("device_group_id")).ToCql()
+	cqlErr := sp.Session.Query(stmt, organizationID, deviceGroupID).Exec()
+
+	if cqlErr != nil {
+		return derrors.AsError(cqlErr, "cannot remove device group twins")
+	}
+
+	return nil
+}
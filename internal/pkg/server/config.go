@@ -42,6 +42,25 @@ type Config struct {
 	SystemModelAddress string
 	// Threshold maximum time (seconds) between ping to decide if a device is offline or online
 	Threshold time.Duration
+	// DefaultPageSize number of elements returned by the listings when the request does not set a page size
+	DefaultPageSize int
+	// MaxPageSize maximum number of elements returned by the listings in a single page
+	MaxPageSize int
+	// BulkConcurrency maximum number of devices processed concurrently by a bulk operation
+	BulkConcurrency int
+	// PendingDeviceExpiration time a registration can wait for approval before it is removed
+	PendingDeviceExpiration time.Duration
+	// DeletedDeviceRetention time a deleted device can be restored before it is purged
+	DeletedDeviceRetention time.Duration
+	// ReconcilePeriod time between two reconciliations of all the organizations, zero to disable them
+	ReconcilePeriod time.Duration
+	// ReconcileApply fixes the inconsistencies found by the periodic reconciliation instead of only logging them
+	ReconcileApply bool
+	// ReservedLabelPrefixes contains the prefixes of the label keys that only administrators can set
+	ReservedLabelPrefixes []string
+	// ActorSecret shared with the components that authenticate the users to sign their identity. If empty, the
+	// identity of the requests is ignored and the administrator operations are not available
+	ActorSecret string
 }
 
 func (conf *Config) Validate() derrors.Error {
@@ -58,6 +77,32 @@ func (conf *Config) Validate() derrors.Error {
 		return derrors.NewInvalidArgumentError("systemModelAddress must be set")
 	}
 
+	if conf.DefaultPageSize <= 0 || conf.MaxPageSize < conf.DefaultPageSize {
+		return derrors.NewInvalidArgumentError("defaultPageSize must be positive and not greater than maxPageSize")
+	}
+
+	if conf.BulkConcurrency <= 0 {
+		return derrors.NewInvalidArgumentError("bulkConcurrency must be positive")
+	}
+
+	if conf.PendingDeviceExpiration <= 0 {
+		return derrors.NewInvalidArgumentError("pendingDeviceExpiration must be positive")
+	}
+
+	if conf.DeletedDeviceRetention <= 0 {
+		return derrors.NewInvalidArgumentError("deletedDeviceRetention must be positive")
+	}
+
+	if conf.ReconcilePeriod < 0 {
+		return derrors.NewInvalidArgumentError("reconcilePeriod cannot be negative")
+	}
+
+	for _, prefix := range conf.ReservedLabelPrefixes {
+		if prefix == "" {
+			return derrors.NewInvalidArgumentError("reservedLabelPrefixes cannot contain empty prefixes")
+		}
+	}
+
 	return nil
 }
 
@@ -76,5 +121,14 @@ func (conf *Config) Print() {
 		log.Info().Str("URL", conf.ScyllaDBAddress).Str("KeySpace", conf.KeySpace).Int("Port", conf.ScyllaDBPort).Msg("ScyllaDB")
 	}
 	log.Info().Str("Threshold", conf.Threshold.String()).Msg("Online/Offline Threshold")
+	log.Info().Int("default", conf.DefaultPageSize).Int("max", conf.MaxPageSize).Msg("Page size")
+	log.Info().Int("BulkConcurrency", conf.BulkConcurrency).Msg("Bulk operations")
+	log.Info().Str("PendingDeviceExpiration", conf.PendingDeviceExpiration.String()).Msg("Registration approval")
+	log.Info().Str("DeletedDeviceRetention", conf.DeletedDeviceRetention.String()).Msg("Device deletion")
+	log.Info().Str("ReconcilePeriod", conf.ReconcilePeriod.String()).Bool("ReconcileApply", conf.ReconcileApply).Msg("Reconciliation")
+	log.Info().Strs("ReservedLabelPrefixes", conf.ReservedLabelPrefixes).Msg("Labels")
+	if conf.ActorSecret == "" {
+		log.Warn().Msg("actorSecret is not set, the identity of the requests is ignored and administrator operations are disabled")
+	}
 
 }
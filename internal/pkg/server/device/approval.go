@@ -0,0 +1,216 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// PendingDevicesCleanupPeriod is the time between two executions of the cleanup of expired registrations.
+const PendingDevicesCleanupPeriod = time.Minute * 5
+
+// isApprovalRequired checks if the devices registered in a group must be approved by an operator.
+func (m *Manager) isApprovalRequired(organizationID string, deviceGroupID string) (bool, error) {
+	policy, err := m.approvalProvider.GetApprovalPolicy(organizationID, deviceGroupID)
+	if err != nil {
+		return false, conversions.ToGRPCError(err)
+	}
+	return policy.ApprovalRequired, nil
+}
+
+// setApprovalRequired updates the approval policy of a device group.
+func (m *Manager) setApprovalRequired(organizationID string, deviceGroupID string, required bool) error {
+	err := m.approvalProvider.SetApprovalPolicy(entities.ApprovalPolicy{
+		OrganizationId:   organizationID,
+		DeviceGroupId:    deviceGroupID,
+		ApprovalRequired: required,
+	})
+	if err != nil {
+		return conversions.ToGRPCError(err)
+	}
+	return nil
+}
+
+// registerPendingDevice creates a device with its credentials disabled until an operator approves it. If any
+// step fails, the device is removed so that the registration can be retried.
+func (m *Manager) registerPendingDevice(request *grpc_device_manager_go.RegisterDeviceRequest) (*grpc_device_manager_go.RegisterResponse, error) {
+	response, err := m.addDeviceEntity(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.AlreadyRegistered {
+		// a previous registration was completed, keep its approval state
+		pending, derr := m.approvalProvider.ExistsPendingDevice(request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		response.ApprovalPending = pending
+		return response, nil
+	}
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+	}
+	err = m.updateDeviceCredentials(request.OrganizationId, request.DeviceGroupId, request.DeviceId, false)
+	if err == nil {
+		derr := m.approvalProvider.AddPendingDevice(*entities.NewPendingDevice(request, m.pendingExpiration))
+		if derr != nil {
+			err = conversions.ToGRPCError(derr)
+		}
+	}
+	if err != nil {
+		rErr := m.removeDevice(deviceID)
+		if rErr != nil {
+			log.Warn().Interface("deviceID", deviceID).Msg("Device may be partially registered. Cannot remove it after a failed registration")
+		}
+		return nil, err
+	}
+	log.Debug().Interface("deviceID", deviceID).Msg("device is waiting for approval")
+	response.ApprovalPending = true
+	return response, nil
+}
+
+// checkNotPending returns an error if the device is waiting for approval, as its credentials can only be
+// enabled by approving it.
+func (m *Manager) checkNotPending(organizationID string, deviceGroupID string, deviceID string) error {
+	pending, err := m.approvalProvider.ExistsPendingDevice(organizationID, deviceGroupID, deviceID)
+	if err != nil {
+		return conversions.ToGRPCError(err)
+	}
+	if pending {
+		return conversions.ToGRPCError(
+			derrors.NewFailedPreconditionError("device is waiting for approval").WithParams(organizationID, deviceGroupID, deviceID))
+	}
+	return nil
+}
+
+// ListPendingDevices retrieves the registrations of a device group waiting for approval.
+func (m *Manager) ListPendingDevices(deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.PendingDeviceList, error) {
+	pending, err := m.approvalProvider.ListPendingDevices(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	result := make([]*grpc_device_manager_go.PendingDevice, 0, len(pending))
+	for _, p := range pending {
+		result = append(result, p.ToGRPC())
+	}
+	return &grpc_device_manager_go.PendingDeviceList{
+		Devices: result,
+	}, nil
+}
+
+// ApproveDevice enables the credentials of a device waiting for approval.
+func (m *Manager) ApproveDevice(deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.Device, error) {
+	dErr := m.checkNotDeleted(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if dErr != nil {
+		return nil, dErr
+	}
+	pending, err := m.approvalProvider.GetPendingDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	if pending.IsExpired(time.Now()) {
+		return nil, conversions.ToGRPCError(
+			derrors.NewFailedPreconditionError("registration request has expired").WithParams(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+	}
+	uErr := m.updateDeviceCredentials(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId, true)
+	if uErr != nil {
+		return nil, uErr
+	}
+	err = m.approvalProvider.RemovePendingDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	log.Debug().Interface("deviceID", deviceID).Msg("device has been approved")
+	return m.GetDevice(deviceID)
+}
+
+// RejectDevice removes a device waiting for approval.
+func (m *Manager) RejectDevice(deviceID *grpc_device_go.DeviceId) (*grpc_common_go.Success, error) {
+	exists, err := m.approvalProvider.ExistsPendingDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	if !exists {
+		return nil, conversions.ToGRPCError(
+			derrors.NewNotFoundError("pending device").WithParams(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+	}
+	rErr := m.removeDevice(deviceID)
+	if rErr != nil {
+		return nil, rErr
+	}
+	log.Debug().Interface("deviceID", deviceID).Msg("device has been rejected")
+	return &grpc_common_go.Success{}, nil
+}
+
+// removePendingDevice removes the pending registration of a device if it exists.
+func (m *Manager) removePendingDevice(deviceID *grpc_device_go.DeviceId) {
+	exists, err := m.approvalProvider.ExistsPendingDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err == nil && exists {
+		err = m.approvalProvider.RemovePendingDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	}
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove pending registration")
+	}
+}
+
+// RemoveExpiredPendingDevices removes the devices whose registration has not been approved in time.
+func (m *Manager) RemoveExpiredPendingDevices() (int, error) {
+	expired, err := m.approvalProvider.ListExpiredPendingDevices(time.Now().Unix())
+	if err != nil {
+		return 0, conversions.ToGRPCError(err)
+	}
+	removed := 0
+	for _, p := range expired {
+		deviceID := &grpc_device_go.DeviceId{
+			OrganizationId: p.OrganizationId,
+			DeviceGroupId:  p.DeviceGroupId,
+			DeviceId:       p.DeviceId,
+		}
+		rErr := m.removeDevice(deviceID)
+		if rErr != nil {
+			log.Warn().Err(rErr).Interface("deviceID", deviceID).Msg("cannot remove expired pending device")
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunPendingDevicesCleanup periodically removes the expired registrations.
+func (m *Manager) RunPendingDevicesCleanup(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for range ticker.C {
+		removed, err := m.RemoveExpiredPendingDevices()
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot remove expired pending devices")
+			continue
+		}
+		if removed > 0 {
+			log.Info().Int("removed", removed).Msg("expired pending devices have been removed")
+		}
+	}
+}
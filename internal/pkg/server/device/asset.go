@@ -0,0 +1,105 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// UpdateDeviceAssetInfo replaces the sections of the asset information of a device marked in the request, keeping
+// the rest, and records the fields that changed in the asset history of the device and in the audit record.
+func (m *Manager) UpdateDeviceAssetInfo(request *grpc_device_manager_go.UpdateDeviceAssetInfoRequest, audit *auditRecord) (*grpc_device_manager_go.Device, error) {
+	err := m.checkNotDeleted(request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	current, err := m.devicesClient.GetDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	merged := entities.MergeAssetInfo(current.AssetInfo, request)
+	change := entities.NewAssetInfoChange(request.OrganizationId, request.DeviceGroupId, request.DeviceId,
+		current.AssetInfo, merged, time.Now().Unix())
+	if change == nil {
+		log.Debug().Interface("deviceID", deviceID).Msg("asset info has not changed")
+		return m.addAuthLatencyInfoToDevice(current)
+	}
+
+	uCtx, uCancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer uCancel()
+	updated, err := m.devicesClient.UpdateDevice(uCtx, &grpc_device_go.UpdateDeviceRequest{
+		OrganizationId:  request.OrganizationId,
+		DeviceGroupId:   request.DeviceGroupId,
+		DeviceId:        request.DeviceId,
+		UpdateAssetInfo: true,
+		AssetInfo:       merged,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.indexDevice(updated)
+	audit.setPrevious(assetInfoFields(current.AssetInfo))
+	audit.setCurrent(assetInfoFields(merged))
+	derr := m.assetProvider.AddChange(*change)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceID", deviceID).Msg("cannot record asset info change")
+	}
+	log.Debug().Interface("deviceID", deviceID).Int("fields", len(change.Previous)+len(change.Current)).Msg("asset info has been updated")
+	return m.addAuthLatencyInfoToDevice(updated)
+}
+
+// ListAssetInfoHistory retrieves the changes of the asset information of a device in a time range, the most
+// recent first.
+func (m *Manager) ListAssetInfoHistory(request *grpc_device_manager_go.AssetInfoHistoryRequest) (*grpc_device_manager_go.AssetInfoHistory, error) {
+	timeRange, derr := entities.NewTimeRange(request.From, request.To)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	changes, derr := m.assetProvider.ListChanges(request.OrganizationId, request.DeviceGroupId, request.DeviceId,
+		*timeRange, m.pagination.PageSize(int(request.Limit)))
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	result := make([]*grpc_device_manager_go.AssetInfoChange, 0, len(changes))
+	for _, c := range changes {
+		result = append(result, c.ToGRPC())
+	}
+	return &grpc_device_manager_go.AssetInfoHistory{
+		Changes: result,
+	}, nil
+}
+
+// removeAssetInfoHistory removes the asset history of a device.
+func (m *Manager) removeAssetInfoHistory(deviceID *grpc_device_go.DeviceId) {
+	err := m.assetProvider.RemoveDeviceChanges(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove device asset info history")
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"fmt"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+)
+
+// SetDeviceAttributes adds or updates a set of attributes of a device. All the attributes are checked against the
+// schema of the organization before storing any of them.
+func (m *Manager) SetDeviceAttributes(request *grpc_device_manager_go.SetDeviceAttributesRequest) (*grpc_device_manager_go.DeviceAttributeList, error) {
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+	}
+	err := m.checkDeviceExists(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	definitions, derr := m.attributeProvider.ListDefinitions(request.OrganizationId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	schema := entities.NewAttributeSchema(definitions)
+	attributes := make([]*entities.DeviceAttribute, 0, len(request.Attributes))
+	for _, a := range request.Attributes {
+		attribute, derr := entities.NewDeviceAttribute(request.OrganizationId, request.DeviceGroupId, request.DeviceId, a)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		derr = schema.Check(attribute)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		attributes = append(attributes, attribute)
+	}
+	for _, attribute := range attributes {
+		derr = m.attributeProvider.SetAttribute(*attribute)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+	}
+	return m.getDeviceAttributeList(deviceID)
+}
+
+// GetDeviceAttributes retrieves the attributes of a device.
+func (m *Manager) GetDeviceAttributes(deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.DeviceAttributeList, error) {
+	err := m.checkNotDeleted(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+	return m.getDeviceAttributeList(deviceID)
+}
+
+// RemoveDeviceAttributes removes a set of attributes of a device.
+func (m *Manager) RemoveDeviceAttributes(request *grpc_device_manager_go.RemoveDeviceAttributesRequest) (*grpc_common_go.Success, error) {
+	err := m.checkNotDeleted(request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range request.Names {
+		derr := m.attributeProvider.RemoveAttribute(request.OrganizationId, request.DeviceGroupId, request.DeviceId, name)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+	}
+	return &grpc_common_go.Success{}, nil
+}
+
+// SetAttributeDefinition adds or updates an attribute in the schema of an organization. Changing the type of an
+// attribute does not modify the values already stored, which are compared using their own type.
+func (m *Manager) SetAttributeDefinition(request *grpc_device_manager_go.AttributeDefinition) (*grpc_device_manager_go.AttributeDefinition, error) {
+	definition, derr := entities.NewAttributeDefinition(request)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	derr = m.attributeProvider.SetDefinition(*definition)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return definition.ToGRPC(), nil
+}
+
+// ListAttributeDefinitions retrieves the attribute schema of an organization.
+func (m *Manager) ListAttributeDefinitions(organizationID *grpc_organization_go.OrganizationId) (*grpc_device_manager_go.AttributeDefinitionList, error) {
+	definitions, derr := m.attributeProvider.ListDefinitions(organizationID.OrganizationId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	result := make([]*grpc_device_manager_go.AttributeDefinition, 0, len(definitions))
+	for _, d := range definitions {
+		result = append(result, d.ToGRPC())
+	}
+	return &grpc_device_manager_go.AttributeDefinitionList{Definitions: result}, nil
+}
+
+// RemoveAttributeDefinition removes an attribute from the schema of an organization. Once the last definition is
+// removed, the devices of the organization accept any attribute.
+func (m *Manager) RemoveAttributeDefinition(definitionID *grpc_device_manager_go.AttributeDefinitionId) (*grpc_common_go.Success, error) {
+	derr := m.attributeProvider.RemoveDefinition(definitionID.OrganizationId, definitionID.Name)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return &grpc_common_go.Success{}, nil
+}
+
+// checkDeviceExists checks that a device exists in system model and has not been deleted.
+func (m *Manager) checkDeviceExists(deviceID *grpc_device_go.DeviceId) error {
+	err := m.checkNotDeleted(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	_, err = m.devicesClient.GetDevice(ctx, deviceID)
+	return err
+}
+
+func (m *Manager) getDeviceAttributes(deviceID *grpc_device_go.DeviceId) ([]*grpc_device_manager_go.DeviceAttribute, error) {
+	attributes, derr := m.attributeProvider.GetDeviceAttributes(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	result := make([]*grpc_device_manager_go.DeviceAttribute, 0, len(attributes))
+	for _, a := range attributes {
+		result = append(result, a.ToGRPC())
+	}
+	return result, nil
+}
+
+func (m *Manager) getDeviceAttributeList(deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.DeviceAttributeList, error) {
+	attributes, err := m.getDeviceAttributes(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return &grpc_device_manager_go.DeviceAttributeList{
+		OrganizationId: deviceID.OrganizationId,
+		DeviceGroupId:  deviceID.DeviceGroupId,
+		DeviceId:       deviceID.DeviceId,
+		Attributes:     attributes,
+	}, nil
+}
+
+// filterDeviceAttributes returns the devices whose attributes match the filter. The attributes are retrieved with
+// one request per device group.
+func (m *Manager) filterDeviceAttributes(devices []*grpc_device_go.Device, filter *entities.AttributeFilter) ([]*grpc_device_go.Device, error) {
+	if filter.Empty() {
+		return devices, nil
+	}
+	// attributes indexed by organization_id/device_group_id, device_id, name
+	groups := make(map[string]map[string]map[string]*entities.DeviceAttribute, 0)
+	result := make([]*grpc_device_go.Device, 0)
+	for _, d := range devices {
+		groupKey := fmt.Sprintf("%s/%s", d.OrganizationId, d.DeviceGroupId)
+		attributes, retrieved := groups[groupKey]
+		if !retrieved {
+			list, derr := m.attributeProvider.GetGroupAttributes(d.OrganizationId, d.DeviceGroupId)
+			if derr != nil {
+				return nil, conversions.ToGRPCError(derr)
+			}
+			attributes = make(map[string]map[string]*entities.DeviceAttribute, 0)
+			for _, a := range list {
+				if _, exists := attributes[a.DeviceId]; !exists {
+					attributes[a.DeviceId] = make(map[string]*entities.DeviceAttribute, 0)
+				}
+				attributes[a.DeviceId][a.Name] = a
+			}
+			groups[groupKey] = attributes
+		}
+		if filter.Matches(attributes[d.DeviceId]) {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+// removeAllDeviceAttributes removes the attributes of a device that has been removed.
+func (m *Manager) removeAllDeviceAttributes(deviceID *grpc_device_go.DeviceId) {
+	err := m.attributeProvider.RemoveDeviceAttributes(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove device attributes")
+	}
+}
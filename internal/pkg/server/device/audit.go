@@ -0,0 +1,180 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-inventory-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"strconv"
+	"time"
+)
+
+// auditRecord contains the audit entry of an operation in progress and the fields of its target before and after the
+// operation. The fields are taken from the request and from the data that the operation reads or returns, so the target
+// is never read only to audit it and fields that the operation does not know about are not recorded.
+type auditRecord struct {
+	entry    *entities.AuditEntry
+	previous map[string]string
+	current  map[string]string
+}
+
+// ListAuditEntries retrieves the audit entries of an organization, a device group or a device in a time range, the
+// most recent first.
+func (m *Manager) ListAuditEntries(request *grpc_device_manager_go.AuditEntriesRequest) (*grpc_device_manager_go.AuditEntryList, error) {
+	timeRange, derr := entities.NewTimeRange(request.From, request.To)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	entries, derr := m.auditProvider.ListEntries(request.OrganizationId, request.DeviceGroupId, request.DeviceId,
+		*timeRange, m.pagination.PageSize(int(request.Limit)))
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	result := make([]*grpc_device_manager_go.AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e.ToGRPC())
+	}
+	return &grpc_device_manager_go.AuditEntryList{
+		Entries: result,
+	}, nil
+}
+
+// startAudit creates the audit entry of an operation on a device group, or on a device if deviceID is set.
+func (m *Manager) startAudit(actor *entities.Actor, operation string, organizationID string, deviceGroupID string, deviceID string) *auditRecord {
+	return &auditRecord{
+		entry: entities.NewAuditEntry(organizationID, deviceGroupID, deviceID, actor,
+			operation, time.Now().Unix()),
+		previous: make(map[string]string, 0),
+		current:  make(map[string]string, 0),
+	}
+}
+
+// setPrevious adds fields of the target before the operation.
+func (r *auditRecord) setPrevious(fields map[string]string) {
+	for path, value := range fields {
+		r.previous[path] = value
+	}
+}
+
+// setCurrent adds fields of the target after the operation.
+func (r *auditRecord) setCurrent(fields map[string]string) {
+	for path, value := range fields {
+		r.current[path] = value
+	}
+}
+
+// changed returns true if any of the recorded fields of the target is different after the operation.
+func (r *auditRecord) changed() bool {
+	previous, current := entities.DiffFields(r.previous, r.current)
+	return len(previous) > 0 || len(current) > 0
+}
+
+// finishAudit completes the audit entry with the changes of the target and the outcome of the operation. The
+// operation has already been performed, so failures to store the entry are only reported.
+func (m *Manager) finishAudit(record *auditRecord, err error) {
+	record.entry.Complete(record.previous, record.current, err)
+	derr := m.auditProvider.AddEntry(*record.entry)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("entry", record.entry).Msg("cannot add audit entry")
+	}
+}
+
+// finishDeviceAudit completes the audit entry of a device targeted by an import or a bulk operation. Devices that
+// the operation did not modify are not recorded, unless the operation failed.
+func (m *Manager) finishDeviceAudit(record *auditRecord, err error) {
+	if err == nil && !record.changed() {
+		return
+	}
+	m.finishAudit(record, err)
+}
+
+// deviceGroupFields returns the fields of a device group recorded in the audit log. The API key is not recorded, and
+// the flags are added explicitly as false values are omitted when the group is flattened.
+func deviceGroupFields(dg *grpc_device_manager_go.DeviceGroup) map[string]string {
+	fields := entities.FlattenFields(&grpc_device_manager_go.DeviceGroup{
+		OrganizationId: dg.OrganizationId,
+		DeviceGroupId:  dg.DeviceGroupId,
+		Name:           dg.Name,
+		Created:        dg.Created,
+		Labels:         dg.Labels,
+	})
+	fields["enabled"] = strconv.FormatBool(dg.Enabled)
+	fields["default_device_connectivity"] = strconv.FormatBool(dg.DefaultDeviceConnectivity)
+	fields["approval_required"] = strconv.FormatBool(dg.ApprovalRequired)
+	return fields
+}
+
+// deviceGroupUpdateFields returns the fields of a device group that an update request sets.
+func deviceGroupUpdateFields(request *grpc_device_manager_go.UpdateDeviceGroupRequest, dg *grpc_device_manager_go.DeviceGroup) map[string]string {
+	fields := make(map[string]string, 0)
+	if request.UpdateEnabled {
+		fields["enabled"] = strconv.FormatBool(dg.Enabled)
+	}
+	if request.UpdateDeviceConnectivity {
+		fields["default_device_connectivity"] = strconv.FormatBool(dg.DefaultDeviceConnectivity)
+	}
+	if request.UpdateApprovalRequired {
+		fields["approval_required"] = strconv.FormatBool(dg.ApprovalRequired)
+	}
+	return fields
+}
+
+// registrationFields returns the fields of a device created by a registration request, including whether its
+// credentials are enabled.
+func registrationFields(request *grpc_device_manager_go.RegisterDeviceRequest, approvalPending bool) map[string]string {
+	fields := entities.FlattenFields(&grpc_device_go.Device{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+		Labels:         request.Labels,
+		AssetInfo:      request.AssetInfo,
+	})
+	fields["enabled"] = strconv.FormatBool(!approvalPending)
+	return fields
+}
+
+// labelFields returns the fields of a set of labels of a device.
+func labelFields(labels map[string]string) map[string]string {
+	return entities.FlattenFields(&grpc_device_go.Device{
+		Labels: labels,
+	})
+}
+
+// locationFields returns the fields of the location of a device.
+func locationFields(location *grpc_inventory_go.InventoryLocation) map[string]string {
+	return entities.FlattenFields(&grpc_device_go.Device{
+		Location: location,
+	})
+}
+
+// assetInfoFields returns the fields of the asset information of a device.
+func assetInfoFields(assetInfo *grpc_inventory_go.AssetInfo) map[string]string {
+	return entities.FlattenFields(&grpc_device_go.Device{
+		AssetInfo: assetInfo,
+	})
+}
+
+// flagFields returns a boolean field of a target, such as whether the credentials of a device are enabled.
+func flagFields(name string, value bool) map[string]string {
+	return map[string]string{
+		name: strconv.FormatBool(value),
+	}
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-authx-go"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/rs/zerolog/log"
+	"sync"
+)
+
+// BulkDeviceOperation applies an operation to a set of devices of a group. The devices are either listed
+// explicitly or selected by their labels. The operation is executed with a bounded number of concurrent
+// requests and the result of each device is reported independently.
+func (m *Manager) BulkDeviceOperation(request *grpc_device_manager_go.BulkDeviceOperationRequest, selector *entities.LabelSelector, actor *entities.Actor) (*grpc_device_manager_go.BulkDeviceOperationResponse, error) {
+	deviceGroupID := &grpc_device_go.DeviceGroupId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+	}
+	devices, err := m.filterGroupDevices(deviceGroupID, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*grpc_device_manager_go.BulkDeviceOperationResult, 0)
+	targets := make([]*grpc_device_go.DeviceId, 0)
+	if len(request.DeviceIds) > 0 {
+		// explicit devices must belong to the group
+		existing := make(map[string]bool, len(devices))
+		for _, d := range devices {
+			existing[d.DeviceId] = true
+		}
+		for _, deviceID := range request.DeviceIds {
+			if existing[deviceID] {
+				targets = append(targets, &grpc_device_go.DeviceId{
+					OrganizationId: request.OrganizationId,
+					DeviceGroupId:  request.DeviceGroupId,
+					DeviceId:       deviceID,
+				})
+			} else {
+				results = append(results, &grpc_device_manager_go.BulkDeviceOperationResult{
+					DeviceGroupId: request.DeviceGroupId,
+					DeviceId:      deviceID,
+					Error:         "device not found in the device group",
+				})
+			}
+		}
+	} else {
+		for _, d := range devices {
+			targets = append(targets, &grpc_device_go.DeviceId{
+				OrganizationId: d.OrganizationId,
+				DeviceGroupId:  d.DeviceGroupId,
+				DeviceId:       d.DeviceId,
+			})
+		}
+	}
+	results = append(results, m.runBulkOperation(actor, "BulkDeviceOperation", request, targets)...)
+
+	response := &grpc_device_manager_go.BulkDeviceOperationResponse{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DryRun:         request.DryRun,
+		Results:        results,
+	}
+	response.Succeeded, response.Failed = countBulkResults(results)
+	return response, nil
+}
+
+// runBulkOperation applies the operation of a bulk request to the target devices with a bounded number of
+// concurrent requests. A dry run checks the same preconditions for each device but does not modify them. The operation
+// on each device is audited under the given name, except in dry runs and for the devices that it did not modify.
+func (m *Manager) runBulkOperation(actor *entities.Actor, operation string, request *grpc_device_manager_go.BulkDeviceOperationRequest, targets []*grpc_device_go.DeviceId) []*grpc_device_manager_go.BulkDeviceOperationResult {
+	log.Debug().Str("operation", request.Operation.String()).Int("devices", len(targets)).Bool("dryRun", request.DryRun).Msg("bulk device operation")
+	results := make([]*grpc_device_manager_go.BulkDeviceOperationResult, len(targets))
+	sem := make(chan struct{}, m.bulkConcurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		result := &grpc_device_manager_go.BulkDeviceOperationResult{
+			DeviceGroupId: target.DeviceGroupId,
+			DeviceId:      target.DeviceId,
+			Success:       true,
+		}
+		results[i] = result
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(target *grpc_device_go.DeviceId, result *grpc_device_manager_go.BulkDeviceOperationResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var audit *auditRecord
+			if !request.DryRun {
+				audit = m.startAudit(actor, operation, target.OrganizationId, target.DeviceGroupId, target.DeviceId)
+			}
+			device, opErr := m.checkBulkOperation(request, target)
+			if opErr == nil && !request.DryRun {
+				opErr = m.applyBulkOperation(request, target)
+				if opErr == nil {
+					auditBulkOperation(audit, request, device)
+				}
+			}
+			if audit != nil {
+				m.finishDeviceAudit(audit, opErr)
+			}
+			if opErr != nil {
+				result.Success = false
+				result.Error = opErr.Error()
+			}
+		}(target, result)
+	}
+	wg.Wait()
+	return results
+}
+
+// countBulkResults returns the number of devices that succeeded and failed.
+func countBulkResults(results []*grpc_device_manager_go.BulkDeviceOperationResult) (int32, int32) {
+	var succeeded, failed int32
+	for _, r := range results {
+		if r.Success {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+	return succeeded, failed
+}
+
+// checkBulkOperation verifies that the operation of a bulk request can be applied to a single device: the device
+// must exist and must not be deleted, and only approved devices can be enabled. The credentials of a deleted device
+// are restored with the device, so they cannot be enabled or disabled. It returns the device before the operation.
+func (m *Manager) checkBulkOperation(request *grpc_device_manager_go.BulkDeviceOperationRequest, deviceID *grpc_device_go.DeviceId) (*grpc_device_go.Device, error) {
+	err := m.checkNotDeleted(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	device, err := m.devicesClient.GetDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if request.Operation == grpc_device_manager_go.BulkOperation_ENABLE {
+		err = m.checkNotPending(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return device, nil
+}
+
+// applyBulkOperation applies the operation of a bulk request to a single device once checkBulkOperation has
+// succeeded. The device identifier includes its group, so the operation can target devices of several groups.
+func (m *Manager) applyBulkOperation(request *grpc_device_manager_go.BulkDeviceOperationRequest, deviceID *grpc_device_go.DeviceId) error {
+	switch request.Operation {
+	case grpc_device_manager_go.BulkOperation_ENABLE:
+		return m.updateDeviceCredentials(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId, true)
+	case grpc_device_manager_go.BulkOperation_DISABLE:
+		return m.updateDeviceCredentials(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId, false)
+	case grpc_device_manager_go.BulkOperation_ADD_LABELS:
+		_, err := m.AddLabelToDevice(&grpc_device_manager_go.DeviceLabelRequest{
+			OrganizationId: deviceID.OrganizationId,
+			DeviceGroupId:  deviceID.DeviceGroupId,
+			DeviceId:       deviceID.DeviceId,
+			Labels:         request.Labels,
+		})
+		return err
+	case grpc_device_manager_go.BulkOperation_REMOVE_LABELS:
+		_, err := m.RemoveLabelFromDevice(&grpc_device_manager_go.DeviceLabelRequest{
+			OrganizationId: deviceID.OrganizationId,
+			DeviceGroupId:  deviceID.DeviceGroupId,
+			DeviceId:       deviceID.DeviceId,
+			Labels:         request.Labels,
+		})
+		return err
+	case grpc_device_manager_go.BulkOperation_REMOVE:
+		_, err := m.RemoveDevice(deviceID)
+		return err
+	case grpc_device_manager_go.BulkOperation_UPDATE_LOCATION:
+		_, err := m.UpdateDeviceLocation(&grpc_device_manager_go.UpdateDeviceLocationRequest{
+			OrganizationId: deviceID.OrganizationId,
+			DeviceGroupId:  deviceID.DeviceGroupId,
+			DeviceId:       deviceID.DeviceId,
+			Location:       request.Location,
+		})
+		return err
+	}
+	return derrors.NewInvalidArgumentError("unsupported bulk operation").WithParams(request.Operation.String())
+}
+
+// auditBulkOperation records the fields of a device changed by the operation of a bulk request. The previous values
+// are taken from the device read by checkBulkOperation; whether its credentials were enabled is not known.
+func auditBulkOperation(audit *auditRecord, request *grpc_device_manager_go.BulkDeviceOperationRequest, device *grpc_device_go.Device) {
+	switch request.Operation {
+	case grpc_device_manager_go.BulkOperation_ENABLE:
+		audit.setCurrent(flagFields("enabled", true))
+	case grpc_device_manager_go.BulkOperation_DISABLE:
+		audit.setCurrent(flagFields("enabled", false))
+	case grpc_device_manager_go.BulkOperation_ADD_LABELS:
+		audit.setPrevious(labelFields(selectLabels(device.Labels, request.Labels)))
+		audit.setCurrent(labelFields(request.Labels))
+	case grpc_device_manager_go.BulkOperation_REMOVE_LABELS:
+		audit.setPrevious(labelFields(selectLabels(device.Labels, request.Labels)))
+	case grpc_device_manager_go.BulkOperation_REMOVE:
+		audit.setPrevious(flagFields("deleted", false))
+		audit.setCurrent(flagFields("deleted", true))
+	case grpc_device_manager_go.BulkOperation_UPDATE_LOCATION:
+		audit.setPrevious(locationFields(device.Location))
+		audit.setCurrent(locationFields(request.Location))
+	}
+}
+
+// selectLabels returns the labels whose keys are also part of the selected labels.
+func selectLabels(labels map[string]string, selected map[string]string) map[string]string {
+	result := make(map[string]string, 0)
+	for key := range selected {
+		if value, exists := labels[key]; exists {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// updateDeviceCredentials enables or disables the credentials of a device.
+func (m *Manager) updateDeviceCredentials(organizationID string, deviceGroupID string, deviceID string, enabled bool) error {
+	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+	defer aCancel()
+	updateRequest := &grpc_authx_go.UpdateDeviceCredentialsRequest{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+		Enabled:        enabled,
+	}
+	_, err := m.authxClient.UpdateDeviceCredentials(aCtx, updateRequest)
+	return err
+}
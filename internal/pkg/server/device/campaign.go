@@ -0,0 +1,447 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// CampaignCheckPeriod is the time between two checks of the progress and the health of the running campaigns.
+const CampaignCheckPeriod = time.Minute
+
+// CampaignUpdateRetries is the number of attempts to update a campaign that is being updated concurrently.
+const CampaignUpdateRetries = 5
+
+// CreateCampaign starts a rollout campaign for the devices of a group that match a label selector. The first batch
+// receives the update command immediately.
+func (m *Manager) CreateCampaign(request *grpc_device_manager_go.CreateCampaignRequest, selector *entities.LabelSelector) (*grpc_device_manager_go.Campaign, error) {
+	devices, err := m.filterGroupDevices(&grpc_device_go.DeviceGroupId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+	}, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, conversions.ToGRPCError(derrors.NewFailedPreconditionError("no devices match the campaign").WithParams(request.LabelSelector))
+	}
+	deviceIDs := make([]string, 0, len(devices))
+	for _, d := range devices {
+		deviceIDs = append(deviceIDs, d.DeviceId)
+	}
+
+	campaign, campaignDevices := entities.NewCampaign(request, deviceIDs, time.Now())
+	// the devices are stored first so that a campaign is never processed without them
+	for _, d := range campaignDevices {
+		derr := m.campaignProvider.SetCampaignDevice(*d)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+	}
+	derr := m.campaignProvider.AddCampaign(*campaign)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	log.Info().Str("organizationID", campaign.OrganizationId).Str("deviceGroupID", campaign.DeviceGroupId).
+		Str("campaignID", campaign.CampaignId).Str("artifact", campaign.Artifact).Int("devices", campaign.Devices).
+		Int("batches", campaign.Batches).Msg("campaign has been created")
+
+	derr = m.progressCampaign(campaign)
+	if derr != nil {
+		// the campaign is checked again periodically
+		log.Warn().Str("trace", derr.DebugReport()).Str("campaignID", campaign.CampaignId).Msg("cannot start campaign")
+	}
+	return m.campaignToGRPC(campaign)
+}
+
+// GetCampaign retrieves a campaign with the number of devices in each status.
+func (m *Manager) GetCampaign(campaignID *grpc_device_manager_go.CampaignId) (*grpc_device_manager_go.Campaign, error) {
+	campaign, derr := m.campaignProvider.GetCampaign(campaignID.OrganizationId, campaignID.DeviceGroupId, campaignID.CampaignId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return m.campaignToGRPC(campaign)
+}
+
+// ListCampaigns retrieves the campaigns of a device group, the most recent first.
+func (m *Manager) ListCampaigns(deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.CampaignList, error) {
+	campaigns, derr := m.campaignProvider.ListCampaigns(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	result := make([]*grpc_device_manager_go.Campaign, 0, len(campaigns))
+	for _, c := range campaigns {
+		converted, err := m.campaignToGRPC(c)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, converted)
+	}
+	return &grpc_device_manager_go.CampaignList{
+		Campaigns: result,
+	}, nil
+}
+
+// ListCampaignDevices retrieves the progress of each device of a campaign.
+func (m *Manager) ListCampaignDevices(campaignID *grpc_device_manager_go.CampaignId) (*grpc_device_manager_go.CampaignDeviceList, error) {
+	_, derr := m.campaignProvider.GetCampaign(campaignID.OrganizationId, campaignID.DeviceGroupId, campaignID.CampaignId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	devices, derr := m.campaignProvider.ListCampaignDevices(campaignID.OrganizationId, campaignID.DeviceGroupId, campaignID.CampaignId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	result := make([]*grpc_device_manager_go.CampaignDevice, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, d.ToGRPC())
+	}
+	return &grpc_device_manager_go.CampaignDeviceList{
+		Devices: result,
+	}, nil
+}
+
+// PauseCampaign stops a running campaign before its next batch. The devices that have received the update continue
+// reporting their progress.
+func (m *Manager) PauseCampaign(campaignID *grpc_device_manager_go.CampaignId) (*grpc_device_manager_go.Campaign, error) {
+	campaign, err := m.updateCampaign(campaignID, func(campaign *entities.Campaign, now time.Time) derrors.Error {
+		return campaign.Pause("paused by an operator", now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Interface("campaignID", campaignID).Msg("campaign has been paused")
+	return m.campaignToGRPC(campaign)
+}
+
+// ResumeCampaign continues a paused or halted campaign. Halted campaigns stop again on the next check if the updated
+// devices are still unhealthy.
+func (m *Manager) ResumeCampaign(campaignID *grpc_device_manager_go.CampaignId) (*grpc_device_manager_go.Campaign, error) {
+	campaign, err := m.updateCampaign(campaignID, func(campaign *entities.Campaign, now time.Time) derrors.Error {
+		return campaign.Resume("resumed by an operator", now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Interface("campaignID", campaignID).Msg("campaign has been resumed")
+	return m.campaignToGRPC(campaign)
+}
+
+// AbortCampaign stops a campaign permanently and cancels the update commands that have not been acknowledged.
+func (m *Manager) AbortCampaign(campaignID *grpc_device_manager_go.CampaignId) (*grpc_device_manager_go.Campaign, error) {
+	campaign, err := m.updateCampaign(campaignID, func(campaign *entities.Campaign, now time.Time) derrors.Error {
+		return campaign.Abort("aborted by an operator", now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	devices, derr := m.campaignProvider.ListCampaignDevices(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	for _, d := range devices {
+		if d.Status != entities.CampaignDeviceUpdating {
+			continue
+		}
+		_, err = m.updateCommand(d.OrganizationId, d.DeviceGroupId, d.DeviceId, d.CommandId,
+			func(command *entities.DeviceCommand, now time.Time) derrors.Error {
+				return command.Cancel(now)
+			})
+		if err != nil {
+			// the device may have acknowledged the update
+			log.Debug().Err(err).Str("deviceID", d.DeviceId).Msg("cannot cancel update command")
+		}
+	}
+	m.refreshCampaignDevices(devices, time.Now())
+	log.Info().Interface("campaignID", campaignID).Msg("campaign has been aborted")
+	return campaign.ToGRPC(devices), nil
+}
+
+// CheckCampaigns updates the progress of the campaigns that have not finished, and starts the next batch of the
+// running campaigns whose updated devices are healthy.
+func (m *Manager) CheckCampaigns() error {
+	campaigns, derr := m.campaignProvider.ListActiveCampaigns()
+	if derr != nil {
+		return conversions.ToGRPCError(derr)
+	}
+	for _, c := range campaigns {
+		derr = m.progressCampaign(c)
+		if derr != nil {
+			log.Warn().Str("trace", derr.DebugReport()).Str("campaignID", c.CampaignId).Msg("cannot check campaign")
+		}
+	}
+	return nil
+}
+
+// RunCampaigns periodically checks the progress of the campaigns.
+func (m *Manager) RunCampaigns(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := m.CheckCampaigns()
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot check campaigns")
+		}
+	}
+}
+
+// progressCampaign updates the progress of the devices of a campaign with the results of their update commands.
+// Running campaigns are halted if too many updated devices are unhealthy, and move to the next batch once all the
+// devices of the current one have finished and the updated devices have been healthy for the observation period.
+func (m *Manager) progressCampaign(campaign *entities.Campaign) derrors.Error {
+	devices, derr := m.campaignProvider.ListCampaignDevices(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+	if derr != nil {
+		return derr
+	}
+	now := time.Now()
+	m.refreshCampaignDevices(devices, now)
+	if campaign.Status != entities.CampaignRunning {
+		return nil
+	}
+	if campaign.BatchStarted == 0 {
+		return m.startCampaignBatch(campaign, devices, now)
+	}
+	if now.Unix() >= campaign.BatchStarted+int64(CampaignCheckPeriod.Seconds()) {
+		// the devices of the batch that did not receive the update, because the instance that started the batch
+		// stopped or could not store their progress, receive it now
+		m.sendCampaignUpdates(campaign, devices, now)
+	}
+
+	unhealthy, checked, derr := m.campaignHealth(campaign, devices)
+	if derr != nil {
+		return derr
+	}
+	if campaign.ExceedsOfflineRate(unhealthy, checked) {
+		campaign.Halt(fmt.Sprintf("%d of %d updated devices are unhealthy", unhealthy, checked), now)
+		applied, derr := m.storeCampaign(campaign)
+		if derr != nil || !applied {
+			return derr
+		}
+		log.Warn().Str("campaignID", campaign.CampaignId).Int("unhealthy", unhealthy).Int("checked", checked).
+			Msg("campaign has been halted")
+		return nil
+	}
+
+	finished := campaign.BatchStarted
+	for _, d := range devices {
+		if d.Batch != campaign.CurrentBatch {
+			continue
+		}
+		if !d.IsFinal() {
+			return nil
+		}
+		if d.Updated > finished {
+			finished = d.Updated
+		}
+	}
+	if now.Unix() < finished+campaign.ObservationPeriod {
+		return nil
+	}
+	campaign.NextBatch(now)
+	applied, derr := m.storeCampaign(campaign)
+	if derr != nil || !applied {
+		return derr
+	}
+	if campaign.Status == entities.CampaignCompleted {
+		log.Info().Str("campaignID", campaign.CampaignId).Msg("campaign has been completed")
+		return nil
+	}
+	return m.startCampaignBatch(campaign, devices, now)
+}
+
+// startCampaignBatch marks the current batch as started and queues the update command for its devices. The batch
+// is marked first, so that only one instance of the device manager sends the commands.
+func (m *Manager) startCampaignBatch(campaign *entities.Campaign, devices []*entities.CampaignDevice, now time.Time) derrors.Error {
+	campaign.StartBatch(now)
+	applied, derr := m.storeCampaign(campaign)
+	if derr != nil || !applied {
+		return derr
+	}
+	started := m.sendCampaignUpdates(campaign, devices, now)
+	log.Info().Str("campaignID", campaign.CampaignId).Int("batch", campaign.CurrentBatch).Int("devices", started).
+		Msg("campaign batch has been started")
+	return nil
+}
+
+// sendCampaignUpdates queues the update command for the devices of the current batch that have not received it,
+// and returns the number of commands queued. The progress of a device may not have been stored after its command was
+// queued, so the existing command is used instead of queuing a second one.
+func (m *Manager) sendCampaignUpdates(campaign *entities.Campaign, devices []*entities.CampaignDevice, now time.Time) int {
+	ttl := time.Duration(campaign.UpdateTimeout) * time.Second
+	sent := 0
+	for _, d := range devices {
+		if d.Batch != campaign.CurrentBatch || d.Status != entities.CampaignDevicePending {
+			continue
+		}
+		existing, derr := m.findCampaignCommand(campaign, d)
+		if derr != nil {
+			log.Warn().Str("trace", derr.DebugReport()).Str("deviceID", d.DeviceId).Msg("cannot list the commands of the device")
+			continue
+		}
+		if existing != nil {
+			d.Start(existing.CommandId, now)
+			m.storeCampaignDevice(d)
+			continue
+		}
+		command := entities.NewDeviceCommand(d.OrganizationId, d.DeviceGroupId, d.DeviceId, entities.FirmwareUpdateCommand,
+			campaign.UpdatePayload(), ttl, now)
+		derr = m.commandProvider.AddCommand(*command)
+		if derr != nil {
+			d.Fail(derr.Error(), now)
+		} else {
+			d.Start(command.CommandId, now)
+			m.commandWatchers.notify(&grpc_device_go.DeviceId{
+				OrganizationId: d.OrganizationId,
+				DeviceGroupId:  d.DeviceGroupId,
+				DeviceId:       d.DeviceId,
+			})
+			sent++
+		}
+		m.storeCampaignDevice(d)
+	}
+	return sent
+}
+
+// findCampaignCommand returns the update command of a campaign queued for a device, or nil if there is none.
+func (m *Manager) findCampaignCommand(campaign *entities.Campaign, d *entities.CampaignDevice) (*entities.DeviceCommand, derrors.Error) {
+	commands, derr := m.commandProvider.ListCommands(d.OrganizationId, d.DeviceGroupId, d.DeviceId)
+	if derr != nil {
+		return nil, derr
+	}
+	payload := campaign.UpdatePayload()
+	for _, command := range commands {
+		if command.Name == entities.FirmwareUpdateCommand && command.Payload == payload {
+			return command, nil
+		}
+	}
+	return nil, nil
+}
+
+// refreshCampaignDevices updates the devices that are being updated with the status of their update commands.
+func (m *Manager) refreshCampaignDevices(devices []*entities.CampaignDevice, now time.Time) {
+	for _, d := range devices {
+		if d.Status != entities.CampaignDeviceUpdating {
+			continue
+		}
+		command, derr := m.commandProvider.GetCommand(d.OrganizationId, d.DeviceGroupId, d.DeviceId, d.CommandId)
+		if derr != nil {
+			if status.Code(conversions.ToGRPCError(derr)) == codes.NotFound {
+				// the commands are removed with the device
+				d.Fail("update command not found", now)
+				m.storeCampaignDevice(d)
+			}
+			continue
+		}
+		previous := command.Status
+		if command.Expire(now) {
+			m.storeExpiredCommand(command, previous)
+		}
+		if d.Complete(command) {
+			m.storeCampaignDevice(d)
+		}
+	}
+}
+
+// campaignHealth checks the devices of the batches that have started. A device is unhealthy if its update failed,
+// or if it has been updated and is offline or exceeds the maximum latency of the campaign.
+func (m *Manager) campaignHealth(campaign *entities.Campaign, devices []*entities.CampaignDevice) (int, int, derrors.Error) {
+	latencies, derr := m.latencyProvider.GetGroupLastLatencies(campaign.OrganizationId, campaign.DeviceGroupId)
+	if derr != nil {
+		return 0, 0, derr
+	}
+	lastLatency := make(map[string]*entities.Latency, len(latencies))
+	for _, l := range latencies {
+		lastLatency[l.DeviceId] = l
+	}
+	unhealthy := 0
+	checked := 0
+	for _, d := range devices {
+		if d.Batch > campaign.CurrentBatch || !d.IsFinal() {
+			continue
+		}
+		checked++
+		if d.Status == entities.CampaignDeviceFailed {
+			unhealthy++
+			continue
+		}
+		latency := lastLatency[d.DeviceId]
+		if m.fillDeviceStatus(latency) != grpc_device_manager_go.DeviceStatus_ONLINE ||
+			(campaign.MaxLatency > 0 && latency.Latency > campaign.MaxLatency) {
+			unhealthy++
+		}
+	}
+	return unhealthy, checked, nil
+}
+
+// updateCampaign applies a change to a campaign, retrying if the campaign is updated concurrently.
+func (m *Manager) updateCampaign(campaignID *grpc_device_manager_go.CampaignId,
+	apply func(campaign *entities.Campaign, now time.Time) derrors.Error) (*entities.Campaign, error) {
+	for attempt := 0; attempt < CampaignUpdateRetries; attempt++ {
+		campaign, derr := m.campaignProvider.GetCampaign(campaignID.OrganizationId, campaignID.DeviceGroupId, campaignID.CampaignId)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		derr = apply(campaign, time.Now())
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		applied, derr := m.storeCampaign(campaign)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		if applied {
+			return campaign, nil
+		}
+	}
+	return nil, conversions.ToGRPCError(derrors.NewUnavailableError("campaign is being updated concurrently").WithParams(campaignID.CampaignId))
+}
+
+// storeCampaign stores a campaign increasing its revision. It returns false if the campaign has been updated since
+// it was read.
+func (m *Manager) storeCampaign(campaign *entities.Campaign) (bool, derrors.Error) {
+	previous := campaign.Revision
+	campaign.Revision++
+	return m.campaignProvider.UpdateCampaign(*campaign, previous)
+}
+
+// storeCampaignDevice stores the progress of a device. Devices whose progress cannot be stored are updated on the
+// next check, so failures are only logged.
+func (m *Manager) storeCampaignDevice(device *entities.CampaignDevice) {
+	err := m.campaignProvider.SetCampaignDevice(*device)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Str("campaignID", device.CampaignId).Str("deviceID", device.DeviceId).
+			Msg("cannot store campaign device")
+	}
+}
+
+// campaignToGRPC converts a campaign including the number of devices in each status.
+func (m *Manager) campaignToGRPC(campaign *entities.Campaign) (*grpc_device_manager_go.Campaign, error) {
+	devices, derr := m.campaignProvider.ListCampaignDevices(campaign.OrganizationId, campaign.DeviceGroupId, campaign.CampaignId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return campaign.ToGRPC(devices), nil
+}
@@ -0,0 +1,375 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// CommandUpdateRetries is the number of attempts to update a command that is being updated concurrently.
+const CommandUpdateRetries = 5
+
+// CommandStreamPollPeriod is the time between two checks of the command queue of a streaming device, so that
+// commands queued by other instances of the device manager are also delivered.
+const CommandStreamPollPeriod = time.Second * 10
+
+// commandWatchers keeps the devices of this instance that receive their commands with a stream. The streams are
+// only signaled when a command is queued, and read the queue again.
+type commandWatchers struct {
+	sync.Mutex
+	// subscriptions indexed by organization_id + device_group_id + device_id
+	subscriptions map[string]map[chan struct{}]bool
+}
+
+func newCommandWatchers() *commandWatchers {
+	return &commandWatchers{
+		subscriptions: make(map[string]map[chan struct{}]bool, 0),
+	}
+}
+
+func (w *commandWatchers) subscribe(deviceID *grpc_device_go.DeviceId) chan struct{} {
+	w.Lock()
+	defer w.Unlock()
+
+	key := watcherKey(deviceID)
+	if _, exists := w.subscriptions[key]; !exists {
+		w.subscriptions[key] = make(map[chan struct{}]bool, 0)
+	}
+	signal := make(chan struct{}, 1)
+	w.subscriptions[key][signal] = true
+	return signal
+}
+
+func (w *commandWatchers) unsubscribe(deviceID *grpc_device_go.DeviceId, signal chan struct{}) {
+	w.Lock()
+	defer w.Unlock()
+
+	key := watcherKey(deviceID)
+	delete(w.subscriptions[key], signal)
+	if len(w.subscriptions[key]) == 0 {
+		delete(w.subscriptions, key)
+	}
+}
+
+func (w *commandWatchers) notify(deviceID *grpc_device_go.DeviceId) {
+	w.Lock()
+	defer w.Unlock()
+
+	for signal := range w.subscriptions[watcherKey(deviceID)] {
+		select {
+		case signal <- struct{}{}:
+		default:
+			// a signal is already pending
+		}
+	}
+}
+
+// EnqueueCommand queues a command for a set of devices of a group. The devices are either listed explicitly or
+// selected by their labels; a request without devices or selector targets the whole group.
+func (m *Manager) EnqueueCommand(request *grpc_device_manager_go.EnqueueCommandRequest, selector *entities.LabelSelector) (*grpc_device_manager_go.EnqueueCommandResponse, error) {
+	deviceGroupID := &grpc_device_go.DeviceGroupId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+	}
+	devices, err := m.filterGroupDevices(deviceGroupID, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*grpc_device_manager_go.EnqueueCommandResult, 0)
+	targets := make([]string, 0)
+	if len(request.DeviceIds) > 0 {
+		// explicit devices must belong to the group
+		existing := make(map[string]bool, len(devices))
+		for _, d := range devices {
+			existing[d.DeviceId] = true
+		}
+		for _, deviceID := range request.DeviceIds {
+			if existing[deviceID] {
+				targets = append(targets, deviceID)
+			} else {
+				results = append(results, &grpc_device_manager_go.EnqueueCommandResult{
+					DeviceId: deviceID,
+					Error:    "device not found in the device group",
+				})
+			}
+		}
+	} else {
+		for _, d := range devices {
+			targets = append(targets, d.DeviceId)
+		}
+	}
+
+	now := time.Now()
+	ttl := time.Duration(request.Ttl) * time.Second
+	for _, target := range targets {
+		command := entities.NewDeviceCommand(request.OrganizationId, request.DeviceGroupId, target, request.Name,
+			request.Payload, ttl, now)
+		result := &grpc_device_manager_go.EnqueueCommandResult{DeviceId: target}
+		results = append(results, result)
+		derr := m.commandProvider.AddCommand(*command)
+		if derr != nil {
+			result.Error = derr.Error()
+			continue
+		}
+		result.CommandId = command.CommandId
+		m.commandWatchers.notify(&grpc_device_go.DeviceId{
+			OrganizationId: command.OrganizationId,
+			DeviceGroupId:  command.DeviceGroupId,
+			DeviceId:       command.DeviceId,
+		})
+	}
+	log.Debug().Str("name", request.Name).Int("devices", len(targets)).Msg("command has been queued")
+
+	response := &grpc_device_manager_go.EnqueueCommandResponse{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		Results:        results,
+	}
+	for _, r := range results {
+		if r.Error == "" {
+			response.Queued++
+		} else {
+			response.Failed++
+		}
+	}
+	return response, nil
+}
+
+// ListCommands retrieves the commands of a device with their status and results, the oldest first.
+func (m *Manager) ListCommands(deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.CommandList, error) {
+	commands, derr := m.commandProvider.ListCommands(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	now := time.Now()
+	result := make([]*grpc_device_manager_go.DeviceCommand, 0, len(commands))
+	for _, c := range commands {
+		previous := c.Status
+		if c.Expire(now) {
+			m.storeExpiredCommand(c, previous)
+		}
+		result = append(result, c.ToGRPC())
+	}
+	return &grpc_device_manager_go.CommandList{
+		Commands: result,
+	}, nil
+}
+
+// CancelCommand prevents a command that has not been acknowledged from being delivered.
+func (m *Manager) CancelCommand(commandID *grpc_device_manager_go.CommandId) (*grpc_common_go.Success, error) {
+	_, err := m.updateCommand(commandID.OrganizationId, commandID.DeviceGroupId, commandID.DeviceId, commandID.CommandId,
+		func(command *entities.DeviceCommand, now time.Time) derrors.Error {
+			return command.Cancel(now)
+		})
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Interface("commandID", commandID).Msg("command has been cancelled")
+	return &grpc_common_go.Success{}, nil
+}
+
+// PollCommands delivers the pending commands of a device, including the ones delivered before that have not been
+// acknowledged. The device is authenticated with its API key.
+func (m *Manager) PollCommands(request *grpc_device_manager_go.PollCommandsRequest) (*grpc_device_manager_go.CommandList, error) {
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+	}
+	err := m.deviceLogin(deviceID, request.DeviceApiKey)
+	if err != nil {
+		return nil, err
+	}
+	commands, err := m.deliverCommands(deviceID, m.pagination.PageSize(int(request.Limit)), nil)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*grpc_device_manager_go.DeviceCommand, 0, len(commands))
+	for _, c := range commands {
+		result = append(result, c.ToGRPC())
+	}
+	return &grpc_device_manager_go.CommandList{
+		Commands: result,
+	}, nil
+}
+
+// StreamCommands sends the commands of a device as they are queued until the context is done. Each command is sent
+// once per stream; commands that are not acknowledged are sent again on the next stream or poll.
+func (m *Manager) StreamCommands(ctx context.Context, request *grpc_device_manager_go.PollCommandsRequest,
+	send func(command *grpc_device_manager_go.DeviceCommand) error) error {
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+	}
+	err := m.deviceLogin(deviceID, request.DeviceApiKey)
+	if err != nil {
+		return err
+	}
+	signal := m.commandWatchers.subscribe(deviceID)
+	defer m.commandWatchers.unsubscribe(deviceID, signal)
+	ticker := time.NewTicker(CommandStreamPollPeriod)
+	defer ticker.Stop()
+
+	sent := make(map[string]bool, 0)
+	limit := m.pagination.PageSize(0)
+	log.Debug().Interface("deviceID", deviceID).Msg("streaming device commands")
+	for {
+		commands, err := m.deliverCommands(deviceID, limit, sent)
+		if err != nil {
+			return err
+		}
+		for _, c := range commands {
+			err = send(c.ToGRPC())
+			if err != nil {
+				return err
+			}
+			sent[c.CommandId] = true
+		}
+		if len(commands) == limit {
+			// there may be more commands in the queue
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-signal:
+		case <-ticker.C:
+		}
+	}
+}
+
+// AcknowledgeCommand records the result of a command executed by a device. The device is authenticated with its
+// API key.
+func (m *Manager) AcknowledgeCommand(request *grpc_device_manager_go.AcknowledgeCommandRequest) (*grpc_common_go.Success, error) {
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+	}
+	err := m.deviceLogin(deviceID, request.DeviceApiKey)
+	if err != nil {
+		return nil, err
+	}
+	command, err := m.updateCommand(request.OrganizationId, request.DeviceGroupId, request.DeviceId, request.CommandId,
+		func(command *entities.DeviceCommand, now time.Time) derrors.Error {
+			return command.Acknowledge(request.Success, request.Result, request.Error, now)
+		})
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Interface("deviceID", deviceID).Str("commandID", command.CommandId).Str("status", string(command.Status)).
+		Msg("command has been acknowledged")
+	return &grpc_common_go.Success{}, nil
+}
+
+// deliverCommands marks as delivered up to limit commands of a device that have not been acknowledged, skipping
+// the given ones. Expired commands are updated and not delivered.
+func (m *Manager) deliverCommands(deviceID *grpc_device_go.DeviceId, limit int, skip map[string]bool) ([]*entities.DeviceCommand, error) {
+	commands, derr := m.commandProvider.ListCommands(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	now := time.Now()
+	result := make([]*entities.DeviceCommand, 0)
+	for _, c := range commands {
+		if len(result) >= limit {
+			break
+		}
+		if c.IsFinal() || skip[c.CommandId] {
+			continue
+		}
+		previous := c.Status
+		if c.Expire(now) {
+			m.storeExpiredCommand(c, previous)
+			continue
+		}
+		derr = c.Deliver(now)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		if previous != c.Status {
+			applied, derr := m.commandProvider.UpdateCommand(*c, previous)
+			if derr != nil {
+				return nil, conversions.ToGRPCError(derr)
+			}
+			if !applied {
+				// the command has been cancelled or acknowledged concurrently
+				continue
+			}
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// updateCommand applies a change to a command, retrying if the command is updated concurrently. Commands that
+// have expired cannot be changed.
+func (m *Manager) updateCommand(organizationID string, deviceGroupID string, deviceID string, commandID string,
+	apply func(command *entities.DeviceCommand, now time.Time) derrors.Error) (*entities.DeviceCommand, error) {
+	for attempt := 0; attempt < CommandUpdateRetries; attempt++ {
+		command, derr := m.commandProvider.GetCommand(organizationID, deviceGroupID, deviceID, commandID)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		previous := command.Status
+		now := time.Now()
+		if command.Expire(now) {
+			m.storeExpiredCommand(command, previous)
+			return nil, conversions.ToGRPCError(derrors.NewFailedPreconditionError("command has expired").WithParams(commandID))
+		}
+		derr = apply(command, now)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		applied, derr := m.commandProvider.UpdateCommand(*command, previous)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		if applied {
+			return command, nil
+		}
+	}
+	return nil, conversions.ToGRPCError(derrors.NewUnavailableError("command is being updated concurrently").WithParams(commandID))
+}
+
+// storeExpiredCommand records that a command has expired. The expiration is checked again on every read, so
+// failures are only logged.
+func (m *Manager) storeExpiredCommand(command *entities.DeviceCommand, previous entities.CommandStatus) {
+	_, err := m.commandProvider.UpdateCommand(*command, previous)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Str("commandID", command.CommandId).Msg("cannot store expired command")
+	}
+}
+
+// removeDeviceCommands removes the command queue of a device.
+func (m *Manager) removeDeviceCommands(deviceID *grpc_device_go.DeviceId) {
+	err := m.commandProvider.RemoveDeviceCommands(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove device commands")
+	}
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// ConfigPublishRetries is the number of attempts to publish a configuration when other versions are being
+// published concurrently.
+const ConfigPublishRetries = 5
+
+// PublishConfig stores a new configuration version of a device group and makes it the active one.
+func (m *Manager) PublishConfig(request *grpc_device_manager_go.PublishConfigRequest) (*grpc_device_manager_go.DeviceConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	_, err := m.devicesClient.GetDeviceGroup(ctx, &grpc_device_go.DeviceGroupId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; attempt < ConfigPublishRetries; attempt++ {
+		configs, derr := m.configProvider.ListConfigs(request.OrganizationId, request.DeviceGroupId)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		version := int64(1)
+		if len(configs) > 0 {
+			version = configs[0].Version + 1
+		}
+		config := entities.NewDeviceConfig(request, version, time.Now().Unix())
+		added, derr := m.configProvider.AddConfig(*config)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		if !added {
+			continue
+		}
+		derr = m.configProvider.SetActiveVersion(request.OrganizationId, request.DeviceGroupId, version)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		log.Debug().Str("organizationID", request.OrganizationId).Str("deviceGroupID", request.DeviceGroupId).
+			Int64("version", version).Msg("configuration has been published")
+		return config.ToGRPC(true), nil
+	}
+	return nil, conversions.ToGRPCError(derrors.NewUnavailableError("configuration is being published concurrently").
+		WithParams(request.OrganizationId, request.DeviceGroupId))
+}
+
+// ListConfigVersions retrieves the configuration versions of a device group, the most recent first.
+func (m *Manager) ListConfigVersions(deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.DeviceConfigList, error) {
+	active, derr := m.configProvider.GetActiveVersion(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	configs, derr := m.configProvider.ListConfigs(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	result := make([]*grpc_device_manager_go.DeviceConfig, 0, len(configs))
+	for _, c := range configs {
+		result = append(result, c.ToGRPC(c.Version == active))
+	}
+	return &grpc_device_manager_go.DeviceConfigList{
+		Configs: result,
+	}, nil
+}
+
+// GetConfigVersion retrieves a configuration version of a device group.
+func (m *Manager) GetConfigVersion(versionID *grpc_device_manager_go.ConfigVersionId) (*grpc_device_manager_go.DeviceConfig, error) {
+	active, derr := m.configProvider.GetActiveVersion(versionID.OrganizationId, versionID.DeviceGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	config, derr := m.configProvider.GetConfig(versionID.OrganizationId, versionID.DeviceGroupId, versionID.Version)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return config.ToGRPC(config.Version == active), nil
+}
+
+// RollbackConfig makes a previous configuration version the active one. The devices receive it the next time
+// they fetch their configuration.
+func (m *Manager) RollbackConfig(versionID *grpc_device_manager_go.ConfigVersionId) (*grpc_device_manager_go.DeviceConfig, error) {
+	config, derr := m.configProvider.GetConfig(versionID.OrganizationId, versionID.DeviceGroupId, versionID.Version)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	derr = m.configProvider.SetActiveVersion(versionID.OrganizationId, versionID.DeviceGroupId, versionID.Version)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	log.Debug().Interface("versionID", versionID).Msg("configuration has been rolled back")
+	return config.ToGRPC(true), nil
+}
+
+// GetEffectiveConfig retrieves the active configuration of a device with the overlays that match its labels. The
+// content is not returned if the device already has the configuration identified by if_none_match. The device is
+// authenticated with its API key.
+func (m *Manager) GetEffectiveConfig(request *grpc_device_manager_go.GetEffectiveConfigRequest) (*grpc_device_manager_go.EffectiveConfig, error) {
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+	}
+	err := m.deviceLogin(deviceID, request.DeviceApiKey)
+	if err != nil {
+		return nil, err
+	}
+	config, err := m.getActiveConfig(request.OrganizationId, request.DeviceGroupId)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, conversions.ToGRPCError(derrors.NewNotFoundError("no configuration has been published").
+			WithParams(request.OrganizationId, request.DeviceGroupId))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	device, err := m.devicesClient.GetDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	content, etag, derr := config.Effective(device.Labels)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	result := &grpc_device_manager_go.EffectiveConfig{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+		Version:        config.Version,
+		Etag:           etag,
+	}
+	if request.IfNoneMatch == etag {
+		result.NotModified = true
+	} else {
+		result.Content = content
+	}
+	return result, nil
+}
+
+// AcknowledgeConfig records the configuration applied by a device. The device is authenticated with its API key.
+func (m *Manager) AcknowledgeConfig(request *grpc_device_manager_go.AcknowledgeConfigRequest) (*grpc_common_go.Success, error) {
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+	}
+	err := m.deviceLogin(deviceID, request.DeviceApiKey)
+	if err != nil {
+		return nil, err
+	}
+	_, derr := m.configProvider.GetConfig(request.OrganizationId, request.DeviceGroupId, request.Version)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	derr = m.configProvider.SetAcknowledgement(entities.ConfigAcknowledgement{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+		Version:        request.Version,
+		Etag:           request.Etag,
+		Acknowledged:   time.Now().Unix(),
+	})
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	log.Debug().Interface("deviceID", deviceID).Int64("version", request.Version).Msg("configuration has been acknowledged")
+	return &grpc_common_go.Success{}, nil
+}
+
+// ListConfigAcknowledgements retrieves the configuration acknowledged by each device of a group, and whether it is
+// the current effective configuration of the device. Devices that have not acknowledged any configuration are
+// reported with version zero.
+func (m *Manager) ListConfigAcknowledgements(deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.ConfigAcknowledgementList, error) {
+	config, err := m.getActiveConfig(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := m.filterGroupDevices(deviceGroupID, nil)
+	if err != nil {
+		return nil, err
+	}
+	acknowledgements, derr := m.configProvider.ListAcknowledgements(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	acknowledged := make(map[string]*entities.ConfigAcknowledgement, len(acknowledgements))
+	for _, a := range acknowledgements {
+		acknowledged[a.DeviceId] = a
+	}
+	result := make([]*grpc_device_manager_go.ConfigAcknowledgement, 0, len(devices))
+	for _, d := range devices {
+		acknowledgement, exists := acknowledged[d.DeviceId]
+		if !exists {
+			acknowledgement = &entities.ConfigAcknowledgement{
+				OrganizationId: d.OrganizationId,
+				DeviceGroupId:  d.DeviceGroupId,
+				DeviceId:       d.DeviceId,
+			}
+		}
+		current := false
+		if config != nil && exists {
+			_, etag, derr := config.Effective(d.Labels)
+			current = derr == nil && etag == acknowledgement.Etag
+		}
+		result = append(result, acknowledgement.ToGRPC(current))
+	}
+	return &grpc_device_manager_go.ConfigAcknowledgementList{
+		Acknowledgements: result,
+	}, nil
+}
+
+// getActiveConfig retrieves the active configuration of a device group, or nil if no configuration has been
+// published.
+func (m *Manager) getActiveConfig(organizationID string, deviceGroupID string) (*entities.DeviceConfig, error) {
+	version, derr := m.configProvider.GetActiveVersion(organizationID, deviceGroupID)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	if version == 0 {
+		return nil, nil
+	}
+	config, derr := m.configProvider.GetConfig(organizationID, deviceGroupID, version)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return config, nil
+}
+
+// removeConfigAcknowledgement removes the configuration acknowledged by a device.
+func (m *Manager) removeConfigAcknowledgement(deviceID *grpc_device_go.DeviceId) {
+	err := m.configProvider.RemoveDeviceAcknowledgement(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove configuration acknowledgement")
+	}
+}
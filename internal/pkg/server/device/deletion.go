@@ -0,0 +1,230 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// DeletedDevicesPurgePeriod is the time between two executions of the purge of deleted devices.
+const DeletedDevicesPurgePeriod = time.Hour
+
+// checkNotDeleted returns a not found error if the device has been deleted.
+func (m *Manager) checkNotDeleted(organizationID string, deviceGroupID string, deviceID string) error {
+	deleted, err := m.deletionProvider.ExistsDeletedDevice(organizationID, deviceGroupID, deviceID)
+	if err != nil {
+		return conversions.ToGRPCError(err)
+	}
+	if deleted {
+		return conversions.ToGRPCError(
+			derrors.NewNotFoundError("device has been deleted").WithParams(organizationID, deviceGroupID, deviceID))
+	}
+	return nil
+}
+
+// getDeletedDevices returns the identifiers of the deleted devices of a group.
+func (m *Manager) getDeletedDevices(deviceGroupID *grpc_device_go.DeviceGroupId) (map[string]bool, error) {
+	list, err := m.deletionProvider.ListDeletedDevices(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	deleted := make(map[string]bool, len(list))
+	for _, d := range list {
+		deleted[d.DeviceId] = true
+	}
+	return deleted, nil
+}
+
+// softDeleteDevice disables the credentials of a device and hides it from the listings. The device is kept until
+// the retention period ends, so that it can be restored.
+func (m *Manager) softDeleteDevice(deviceID *grpc_device_go.DeviceId) error {
+	deleted, derr := m.deletionProvider.ExistsDeletedDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return conversions.ToGRPCError(derr)
+	}
+	if deleted {
+		return nil
+	}
+	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+	defer aCancel()
+	credentials, err := m.authxClient.GetDeviceCredentials(aCtx, deviceID)
+	if err != nil {
+		return err
+	}
+	err = m.newSaga("delete device").
+		addStep(sagaStep{
+			name: "disable device credentials",
+			action: func() error {
+				return m.updateDeviceCredentials(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId, false)
+			},
+			compensation: func() *entities.RepairTask {
+				if !credentials.Enabled {
+					return nil
+				}
+				return entities.NewDeviceRepairTask(entities.EnableDeviceCredentialsOperation,
+					deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+			},
+		}).
+		addStep(sagaStep{
+			name: "add deleted device",
+			action: func() error {
+				record := entities.NewDeletedDevice(deviceID, credentials.Enabled, m.deletedRetention)
+				derr := m.deletionProvider.AddDeletedDevice(*record)
+				if derr != nil {
+					return conversions.ToGRPCError(derr)
+				}
+				return nil
+			},
+		}).
+		run()
+	if err != nil {
+		return err
+	}
+	m.unindexDevice(deviceID)
+	m.unlocateDevice(deviceID)
+	log.Debug().Interface("deviceID", deviceID).Msg("device has been deleted")
+	return nil
+}
+
+// removeDeletedDevice removes the deletion record of a device if it exists.
+func (m *Manager) removeDeletedDevice(deviceID *grpc_device_go.DeviceId) {
+	exists, err := m.deletionProvider.ExistsDeletedDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err == nil && exists {
+		err = m.deletionProvider.RemoveDeletedDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	}
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove deletion record")
+	}
+}
+
+// ListDeletedDevices retrieves the deleted devices of a group that can still be restored.
+func (m *Manager) ListDeletedDevices(deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.DeletedDeviceList, error) {
+	list, err := m.deletionProvider.ListDeletedDevices(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	result := make([]*grpc_device_manager_go.DeletedDevice, 0, len(list))
+	for _, d := range list {
+		result = append(result, d.ToGRPC())
+	}
+	return &grpc_device_manager_go.DeletedDeviceList{
+		Devices: result,
+	}, nil
+}
+
+// RestoreDevice brings back a deleted device. Its credentials are enabled again if they were enabled when the
+// device was deleted and the device is not waiting for approval.
+func (m *Manager) RestoreDevice(deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.Device, error) {
+	deleted, derr := m.deletionProvider.GetDeletedDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	if deleted.IsExpired(time.Now()) {
+		return nil, conversions.ToGRPCError(
+			derrors.NewFailedPreconditionError("device retention period has ended").WithParams(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	device, err := m.devicesClient.GetDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if deleted.CredentialsEnabled {
+		pending, derr := m.approvalProvider.ExistsPendingDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		if !pending {
+			err = m.updateDeviceCredentials(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId, true)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	derr = m.deletionProvider.RemoveDeletedDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	m.indexDevice(device)
+	m.locateDevice(device)
+	log.Debug().Interface("deviceID", deviceID).Msg("device has been restored")
+	return m.GetDevice(deviceID)
+}
+
+// PurgeDevice permanently removes a deleted device without waiting for the end of the retention period.
+func (m *Manager) PurgeDevice(deviceID *grpc_device_go.DeviceId) (*grpc_common_go.Success, error) {
+	exists, derr := m.deletionProvider.ExistsDeletedDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	if !exists {
+		return nil, conversions.ToGRPCError(
+			derrors.NewFailedPreconditionError("only deleted devices can be purged").WithParams(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+	}
+	err := m.removeDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return &grpc_common_go.Success{}, nil
+}
+
+// PurgeExpiredDeletedDevices permanently removes the deleted devices whose retention period has ended.
+func (m *Manager) PurgeExpiredDeletedDevices() (int, error) {
+	expired, err := m.deletionProvider.ListExpiredDeletedDevices(time.Now().Unix())
+	if err != nil {
+		return 0, conversions.ToGRPCError(err)
+	}
+	purged := 0
+	for _, d := range expired {
+		deviceID := &grpc_device_go.DeviceId{
+			OrganizationId: d.OrganizationId,
+			DeviceGroupId:  d.DeviceGroupId,
+			DeviceId:       d.DeviceId,
+		}
+		rErr := m.removeDevice(deviceID)
+		if rErr != nil {
+			log.Warn().Err(rErr).Interface("deviceID", deviceID).Msg("cannot purge deleted device")
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// RunDeletedDevicesPurge periodically removes the deleted devices whose retention period has ended.
+func (m *Manager) RunDeletedDevicesPurge(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for range ticker.C {
+		purged, err := m.PurgeExpiredDeletedDevices()
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot purge deleted devices")
+			continue
+		}
+		if purged > 0 {
+			log.Info().Int("purged", purged).Msg("deleted devices have been purged")
+		}
+	}
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"time"
+)
+
+// AddDynamicGroup creates a dynamic group in an organization.
+func (m *Manager) AddDynamicGroup(request *grpc_device_manager_go.AddDynamicGroupRequest) (*grpc_device_manager_go.DynamicGroup, error) {
+	group := entities.NewDynamicGroup(request, time.Now().Unix())
+	derr := m.dynamicGroupProvider.AddDynamicGroup(*group)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	log.Debug().Str("organizationID", group.OrganizationId).Str("dynamicGroupID", group.DynamicGroupId).
+		Msg("dynamic group has been added")
+	return group.ToGRPC(), nil
+}
+
+// GetDynamicGroup retrieves the definition of a dynamic group.
+func (m *Manager) GetDynamicGroup(dynamicGroupID *grpc_device_manager_go.DynamicGroupId) (*grpc_device_manager_go.DynamicGroup, error) {
+	group, derr := m.dynamicGroupProvider.GetDynamicGroup(dynamicGroupID.OrganizationId, dynamicGroupID.DynamicGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return group.ToGRPC(), nil
+}
+
+// ListDynamicGroups retrieves the dynamic groups of an organization sorted by name.
+func (m *Manager) ListDynamicGroups(organizationID *grpc_organization_go.OrganizationId) (*grpc_device_manager_go.DynamicGroupList, error) {
+	groups, derr := m.dynamicGroupProvider.ListDynamicGroups(organizationID.OrganizationId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Name != groups[j].Name {
+			return groups[i].Name < groups[j].Name
+		}
+		return groups[i].DynamicGroupId < groups[j].DynamicGroupId
+	})
+	result := make([]*grpc_device_manager_go.DynamicGroup, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, g.ToGRPC())
+	}
+	return &grpc_device_manager_go.DynamicGroupList{
+		DynamicGroups: result,
+	}, nil
+}
+
+// UpdateDynamicGroup replaces the name and the criteria of a dynamic group.
+func (m *Manager) UpdateDynamicGroup(request *grpc_device_manager_go.UpdateDynamicGroupRequest) (*grpc_device_manager_go.DynamicGroup, error) {
+	group, derr := m.dynamicGroupProvider.GetDynamicGroup(request.OrganizationId, request.DynamicGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	group.Update(request, time.Now().Unix())
+	derr = m.dynamicGroupProvider.UpdateDynamicGroup(*group)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	log.Debug().Str("organizationID", group.OrganizationId).Str("dynamicGroupID", group.DynamicGroupId).
+		Msg("dynamic group has been updated")
+	return group.ToGRPC(), nil
+}
+
+// RemoveDynamicGroup removes a dynamic group. Its members are not modified.
+func (m *Manager) RemoveDynamicGroup(dynamicGroupID *grpc_device_manager_go.DynamicGroupId) (*grpc_common_go.Success, error) {
+	derr := m.dynamicGroupProvider.RemoveDynamicGroup(dynamicGroupID.OrganizationId, dynamicGroupID.DynamicGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	log.Debug().Interface("dynamicGroupID", dynamicGroupID).Msg("dynamic group has been removed")
+	return &grpc_common_go.Success{}, nil
+}
+
+// ListDynamicGroupDevices retrieves a page of the current members of a dynamic group.
+func (m *Manager) ListDynamicGroupDevices(dynamicGroupID *grpc_device_manager_go.DynamicGroupId, page *entities.PageRequest) (*grpc_device_manager_go.DeviceList, error) {
+	group, derr := m.dynamicGroupProvider.GetDynamicGroup(dynamicGroupID.OrganizationId, dynamicGroupID.DynamicGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	entries, err := m.dynamicGroupMembers(group)
+	if err != nil {
+		return nil, err
+	}
+	return m.getDevicePage(entries, page)
+}
+
+// GetDynamicGroupSummary counts the current members of a dynamic group by status and device group.
+func (m *Manager) GetDynamicGroupSummary(dynamicGroupID *grpc_device_manager_go.DynamicGroupId) (*grpc_device_manager_go.DynamicGroupSummary, error) {
+	group, derr := m.dynamicGroupProvider.GetDynamicGroup(dynamicGroupID.OrganizationId, dynamicGroupID.DynamicGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	entries, err := m.dynamicGroupMembers(group)
+	if err != nil {
+		return nil, err
+	}
+	if !group.FilterByStatus() {
+		m.fillGroupLatencies(entries)
+	}
+
+	summary := &grpc_device_manager_go.DynamicGroupSummary{
+		OrganizationId: group.OrganizationId,
+		DynamicGroupId: group.DynamicGroupId,
+		DeviceGroups:   make([]*grpc_device_manager_go.DynamicGroupDeviceGroupSummary, 0),
+	}
+	deviceGroups := make(map[string]*grpc_device_manager_go.DynamicGroupDeviceGroupSummary, 0)
+	for _, entry := range entries {
+		dgSummary, exists := deviceGroups[entry.device.DeviceGroupId]
+		if !exists {
+			dgSummary = &grpc_device_manager_go.DynamicGroupDeviceGroupSummary{
+				DeviceGroupId: entry.device.DeviceGroupId,
+			}
+			deviceGroups[entry.device.DeviceGroupId] = dgSummary
+			summary.DeviceGroups = append(summary.DeviceGroups, dgSummary)
+		}
+		summary.TotalDevices++
+		dgSummary.TotalDevices++
+		if m.fillDeviceStatus(entry.latency) == grpc_device_manager_go.DeviceStatus_ONLINE {
+			summary.OnlineDevices++
+			dgSummary.OnlineDevices++
+		} else {
+			summary.OfflineDevices++
+			dgSummary.OfflineDevices++
+		}
+	}
+	sort.Slice(summary.DeviceGroups, func(i, j int) bool {
+		return summary.DeviceGroups[i].DeviceGroupId < summary.DeviceGroups[j].DeviceGroupId
+	})
+	return summary, nil
+}
+
+// DynamicGroupBulkOperation applies a label or location operation to the current members of a dynamic group. The
+// members may belong to several device groups; the result of each device is reported independently.
+func (m *Manager) DynamicGroupBulkOperation(request *grpc_device_manager_go.DynamicGroupBulkOperationRequest, actor *entities.Actor) (*grpc_device_manager_go.DynamicGroupBulkOperationResponse, error) {
+	group, derr := m.dynamicGroupProvider.GetDynamicGroup(request.OrganizationId, request.DynamicGroupId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	entries, err := m.dynamicGroupMembers(group)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]*grpc_device_go.DeviceId, 0, len(entries))
+	for _, entry := range entries {
+		targets = append(targets, &grpc_device_go.DeviceId{
+			OrganizationId: entry.device.OrganizationId,
+			DeviceGroupId:  entry.device.DeviceGroupId,
+			DeviceId:       entry.device.DeviceId,
+		})
+	}
+	results := m.runBulkOperation(actor, "DynamicGroupBulkOperation", &grpc_device_manager_go.BulkDeviceOperationRequest{
+		OrganizationId: request.OrganizationId,
+		Operation:      request.Operation,
+		Labels:         request.Labels,
+		Location:       request.Location,
+		DryRun:         request.DryRun,
+	}, targets)
+
+	response := &grpc_device_manager_go.DynamicGroupBulkOperationResponse{
+		OrganizationId: request.OrganizationId,
+		DynamicGroupId: request.DynamicGroupId,
+		DryRun:         request.DryRun,
+		Results:        results,
+	}
+	response.Succeeded, response.Failed = countBulkResults(results)
+	return response, nil
+}
+
+// dynamicGroupMembers evaluates the criteria of a dynamic group. The labels are matched by the device index, which
+// is kept up to date by the operations of the manager, and the attributes and the status are only checked for the
+// devices that match the labels. The entries are partial and the latency is set if the status has been checked.
+func (m *Manager) dynamicGroupMembers(group *entities.DynamicGroup) ([]*deviceEntry, error) {
+	selector, filter, derr := group.Criteria()
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	err := m.checkOrganizationIndex(group.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	found, derr := m.indexProvider.SearchDevices(entities.DeviceSearchQuery{
+		OrganizationId: group.OrganizationId,
+		LabelSelector:  selector,
+	})
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	devices := make([]*grpc_device_go.Device, 0, len(found))
+	for _, f := range found {
+		devices = append(devices, f.ToDevice())
+	}
+	devices, err = m.filterDeviceAttributes(devices, filter)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*deviceEntry, 0, len(devices))
+	for _, d := range devices {
+		entries = append(entries, &deviceEntry{device: d, partial: true})
+	}
+	if !group.FilterByStatus() {
+		return entries, nil
+	}
+	m.fillGroupLatencies(entries)
+	members := make([]*deviceEntry, 0, len(entries))
+	for _, entry := range entries {
+		if group.MatchesStatus(m.fillDeviceStatus(entry.latency)) {
+			members = append(members, entry)
+		}
+	}
+	return members, nil
+}
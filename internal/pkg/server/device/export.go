@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/rs/zerolog/log"
+)
+
+// ExportDevices sends the inventory record of each device of an organization, or of a single group, that
+// matches the selector. The records are sent group by group so that the whole inventory is never kept in memory.
+func (m *Manager) ExportDevices(request *grpc_device_manager_go.ExportDevicesRequest, selector *entities.LabelSelector,
+	send func(record *grpc_device_manager_go.DeviceInventoryRecord) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	dgs, err := m.devicesClient.ListDeviceGroups(ctx, &grpc_organization_go.OrganizationId{
+		OrganizationId: request.OrganizationId,
+	})
+	if err != nil {
+		return err
+	}
+	exported := 0
+	for _, dg := range dgs.Groups {
+		if request.DeviceGroupId != "" && dg.DeviceGroupId != request.DeviceGroupId {
+			continue
+		}
+		count, err := m.exportGroupDevices(dg, selector, request.IncludeApiKeys, send)
+		if err != nil {
+			return err
+		}
+		exported += count
+	}
+	log.Debug().Str("organizationID", request.OrganizationId).Int("devices", exported).Msg("devices exported")
+	return nil
+}
+
+func (m *Manager) exportGroupDevices(dg *grpc_device_go.DeviceGroup, selector *entities.LabelSelector, includeApiKeys bool,
+	send func(record *grpc_device_manager_go.DeviceInventoryRecord) error) (int, error) {
+	deviceGroupID := &grpc_device_go.DeviceGroupId{
+		OrganizationId: dg.OrganizationId,
+		DeviceGroupId:  dg.DeviceGroupId,
+	}
+	devices, err := m.filterGroupDevices(deviceGroupID, selector)
+	if err != nil {
+		return 0, err
+	}
+	entries := newDeviceEntries(devices)
+	m.fillGroupLatencies(entries)
+	m.sortDevices(entries, &entities.PageRequest{SortBy: entities.SortByID})
+	for _, entry := range entries {
+		device, err := m.addAuthInfoToD(entry.device)
+		if err != nil {
+			return 0, err
+		}
+		record := &grpc_device_manager_go.DeviceInventoryRecord{
+			OrganizationId:  device.OrganizationId,
+			DeviceGroupId:   device.DeviceGroupId,
+			DeviceGroupName: dg.Name,
+			DeviceId:        device.DeviceId,
+			RegisterSince:   device.RegisterSince,
+			Labels:          device.Labels,
+			Location:        device.Location,
+			AssetInfo:       device.AssetInfo,
+			Enabled:         device.Enabled,
+			DeviceStatus:    m.fillDeviceStatus(entry.latency),
+			LastLatency:     -1,
+		}
+		if entry.latency != nil && entry.latency.Latency != -1 {
+			record.LastLatency = int32(entry.latency.Latency)
+			record.LastLatencyTimestamp = entry.latency.Inserted
+		}
+		if includeApiKeys {
+			record.DeviceApiKey = device.DeviceApiKey
+		}
+		err = send(record)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
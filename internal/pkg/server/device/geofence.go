@@ -0,0 +1,169 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// ListLocationHistory retrieves the location updates of a device in a time range, the most recent first.
+func (m *Manager) ListLocationHistory(request *grpc_device_manager_go.LocationHistoryRequest) (*grpc_device_manager_go.LocationHistory, error) {
+	timeRange, derr := entities.NewTimeRange(request.From, request.To)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	records, derr := m.historyProvider.ListLocations(request.OrganizationId, request.DeviceGroupId, request.DeviceId,
+		*timeRange, m.pagination.PageSize(int(request.Limit)))
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	result := make([]*grpc_device_manager_go.LocationRecord, 0, len(records))
+	for _, r := range records {
+		result = append(result, r.ToGRPC())
+	}
+	return &grpc_device_manager_go.LocationHistory{
+		Locations: result,
+	}, nil
+}
+
+// AddGeofence creates a geofence in a device group.
+func (m *Manager) AddGeofence(request *grpc_device_manager_go.AddGeofenceRequest) (*grpc_device_manager_go.Geofence, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	_, err := m.devicesClient.GetDeviceGroup(ctx, &grpc_device_go.DeviceGroupId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fence, derr := entities.NewGeofence(request)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	derr = m.geofenceProvider.AddGeofence(*fence)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	log.Debug().Str("organizationID", fence.OrganizationId).Str("deviceGroupID", fence.DeviceGroupId).
+		Str("geofenceID", fence.GeofenceId).Msg("geofence has been added")
+	return fence.ToGRPC(), nil
+}
+
+// ListGeofences retrieves the geofences of a device group.
+func (m *Manager) ListGeofences(deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.GeofenceList, error) {
+	fences, err := m.geofenceProvider.ListGeofences(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	result := make([]*grpc_device_manager_go.Geofence, 0, len(fences))
+	for _, f := range fences {
+		result = append(result, f.ToGRPC())
+	}
+	return &grpc_device_manager_go.GeofenceList{
+		Geofences: result,
+	}, nil
+}
+
+// RemoveGeofence removes a geofence. Its events are kept until the device group is removed.
+func (m *Manager) RemoveGeofence(geofenceID *grpc_device_manager_go.GeofenceId) (*grpc_common_go.Success, error) {
+	err := m.geofenceProvider.RemoveGeofence(geofenceID.OrganizationId, geofenceID.DeviceGroupId, geofenceID.GeofenceId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	log.Debug().Interface("geofenceID", geofenceID).Msg("geofence has been removed")
+	return &grpc_common_go.Success{}, nil
+}
+
+// ListGeofenceEvents retrieves the geofence events of a device group in a time range, the most recent first.
+func (m *Manager) ListGeofenceEvents(request *grpc_device_manager_go.GeofenceEventsRequest) (*grpc_device_manager_go.GeofenceEventList, error) {
+	timeRange, derr := entities.NewTimeRange(request.From, request.To)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	events, derr := m.geofenceProvider.ListEvents(request.OrganizationId, request.DeviceGroupId, *timeRange,
+		m.pagination.PageSize(int(request.Limit)))
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	result := make([]*grpc_device_manager_go.GeofenceEvent, 0, len(events))
+	for _, e := range events {
+		result = append(result, e.ToGRPC())
+	}
+	return &grpc_device_manager_go.GeofenceEventList{
+		Events: result,
+	}, nil
+}
+
+// recordLocation adds the location of a device to its history and checks it against the geofences of its group,
+// comparing it with the previous location of the history. System model holds the current location, so failures
+// are only reported.
+func (m *Manager) recordLocation(device *grpc_device_go.Device) {
+	if device.Location == nil || device.Location.Geolocation == "" {
+		return
+	}
+	point, derr := entities.ParseGeolocation(device.Location.Geolocation)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Str("deviceID", device.DeviceId).Msg("cannot record device location")
+		return
+	}
+	previous, previousErr := m.historyProvider.GetLastLocation(device.OrganizationId, device.DeviceGroupId, device.DeviceId)
+	if previousErr != nil {
+		log.Warn().Str("trace", previousErr.DebugReport()).Str("deviceID", device.DeviceId).Msg("cannot get previous device location")
+	}
+	current := entities.NewLocationRecord(device.OrganizationId, device.DeviceGroupId, device.DeviceId, *point, time.Now().Unix())
+	derr = m.historyProvider.AddLocation(*current)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Str("deviceID", device.DeviceId).Msg("cannot add device location to the history")
+	}
+	if previousErr != nil {
+		// the transitions cannot be determined without the previous location
+		return
+	}
+
+	fences, derr := m.geofenceProvider.ListGeofences(device.OrganizationId, device.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Str("deviceID", device.DeviceId).Msg("cannot check device geofences")
+		return
+	}
+	for _, fence := range fences {
+		for _, event := range entities.NewGeofenceEvents(fence, previous, current) {
+			log.Info().Str("organizationID", event.OrganizationId).Str("deviceGroupID", event.DeviceGroupId).
+				Str("deviceID", event.DeviceId).Str("geofenceID", event.GeofenceId).Str("event", string(event.EventType)).
+				Msg("geofence event")
+			derr = m.geofenceProvider.AddEvent(*event)
+			if derr != nil {
+				log.Warn().Str("trace", derr.DebugReport()).Str("deviceID", device.DeviceId).Msg("cannot add geofence event")
+			}
+		}
+	}
+}
+
+// removeLocationHistory removes the location history of a device.
+func (m *Manager) removeLocationHistory(deviceID *grpc_device_go.DeviceId) {
+	err := m.historyProvider.RemoveDeviceLocations(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove device location history")
+	}
+}
@@ -18,6 +18,8 @@ package device
 
 import (
 	"context"
+	"fmt"
+	"github.com/nalej/derrors"
 	"github.com/nalej/device-manager/internal/pkg/entities"
 	"github.com/nalej/grpc-common-go"
 	"github.com/nalej/grpc-device-go"
@@ -25,16 +27,31 @@ import (
 	"github.com/nalej/grpc-organization-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
+	"time"
 )
 
 // Handler structure for the node requests.
 type Handler struct {
 	Manager Manager
+	// actorSecret is shared with the components that authenticate the users to sign their identity
+	actorSecret string
 }
 
 // NewHandler creates a new Handler with a linked manager.
-func NewHandler(manager Manager) *Handler {
-	return &Handler{manager}
+func NewHandler(manager Manager, actorSecret string) *Handler {
+	return &Handler{manager, actorSecret}
+}
+
+// actor returns the user performing a request. Identities that cannot be verified are ignored and the request is
+// performed by an anonymous actor, so only the operations that require an actor are affected.
+func (h *Handler) actor(ctx context.Context) *entities.Actor {
+	md, _ := metadata.FromIncomingContext(ctx)
+	actor, derr := entities.VerifyActor(h.actorSecret, md, time.Now())
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Msg("ignoring the identity of the request")
+	}
+	return actor
 }
 
 func (h *Handler) AddDeviceGroup(ctx context.Context, request *grpc_device_manager_go.AddDeviceGroupRequest) (*grpc_device_manager_go.DeviceGroup, error) {
@@ -42,7 +59,20 @@ func (h *Handler) AddDeviceGroup(ctx context.Context, request *grpc_device_manag
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.AddDeviceGroup(request)
+	actor := h.actor(ctx)
+	audit := h.Manager.startAudit(actor, "AddDeviceGroup", request.OrganizationId, "", "")
+	err := h.Manager.CheckLabels(request.OrganizationId, request.Labels, actor.IsAdmin())
+	if err != nil {
+		h.Manager.finishAudit(audit, err)
+		return nil, err
+	}
+	added, err := h.Manager.AddDeviceGroup(request)
+	if err == nil {
+		audit.entry.DeviceGroupId = added.DeviceGroupId
+		audit.setCurrent(deviceGroupFields(added))
+	}
+	h.Manager.finishAudit(audit, err)
+	return added, err
 }
 
 func (h *Handler) UpdateDeviceGroup(ctx context.Context, request *grpc_device_manager_go.UpdateDeviceGroupRequest) (*grpc_device_manager_go.DeviceGroup, error) {
@@ -50,7 +80,13 @@ func (h *Handler) UpdateDeviceGroup(ctx context.Context, request *grpc_device_ma
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.UpdateDeviceGroup(request)
+	audit := h.Manager.startAudit(h.actor(ctx), "UpdateDeviceGroup", request.OrganizationId, request.DeviceGroupId, "")
+	updated, err := h.Manager.UpdateDeviceGroup(request)
+	if err == nil {
+		audit.setCurrent(deviceGroupUpdateFields(request, updated))
+	}
+	h.Manager.finishAudit(audit, err)
+	return updated, err
 }
 
 func (h *Handler) RemoveDeviceGroup(ctx context.Context, deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_common_go.Success, error) {
@@ -58,15 +94,25 @@ func (h *Handler) RemoveDeviceGroup(ctx context.Context, deviceGroupID *grpc_dev
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.RemoveDeviceGroup(deviceGroupID)
+	audit := h.Manager.startAudit(h.actor(ctx), "RemoveDeviceGroup", deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId, "")
+	success, err := h.Manager.RemoveDeviceGroup(deviceGroupID)
+	h.Manager.finishAudit(audit, err)
+	return success, err
 }
 
-func (h *Handler) ListDeviceGroups(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*grpc_device_manager_go.DeviceGroupList, error) {
-	vErr := entities.ValidOrganizationID(organizationID)
+func (h *Handler) ListDeviceGroups(ctx context.Context, request *grpc_device_manager_go.ListDeviceGroupsRequest) (*grpc_device_manager_go.DeviceGroupList, error) {
+	vErr := entities.ValidListDeviceGroupsRequest(request)
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.ListDeviceGroups(organizationID)
+	page, vErr := entities.NewPageRequest(request.PageSize, request.PageToken, request.SortBy, request.Descending, request.OrganizationId)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	organizationID := &grpc_organization_go.OrganizationId{
+		OrganizationId: request.OrganizationId,
+	}
+	return h.Manager.ListDeviceGroups(organizationID, page)
 }
 
 func (h *Handler) RegisterDevice(ctx context.Context, request *grpc_device_manager_go.RegisterDeviceRequest) (*grpc_device_manager_go.RegisterResponse, error) {
@@ -74,7 +120,95 @@ func (h *Handler) RegisterDevice(ctx context.Context, request *grpc_device_manag
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.RegisterDevice(request)
+	actor := h.actor(ctx)
+	audit := h.Manager.startAudit(actor, "RegisterDevice", request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	err := h.Manager.CheckLabels(request.OrganizationId, request.Labels, actor.IsAdmin())
+	if err != nil {
+		h.Manager.finishAudit(audit, err)
+		return nil, err
+	}
+	response, err := h.Manager.RegisterDevice(request)
+	if err == nil && !response.AlreadyRegistered {
+		audit.setCurrent(registrationFields(request, response.ApprovalPending))
+	}
+	h.Manager.finishAudit(audit, err)
+	return response, err
+}
+
+// AddRegistrationToken creates a registration token for a device group.
+func (h *Handler) AddRegistrationToken(ctx context.Context, request *grpc_device_manager_go.AddRegistrationTokenRequest) (*grpc_device_manager_go.RegistrationToken, error) {
+	vErr := entities.ValidAddRegistrationTokenRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.AddRegistrationToken(request)
+}
+
+// ListRegistrationTokens retrieves the registration tokens of a device group.
+func (h *Handler) ListRegistrationTokens(ctx context.Context, deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.RegistrationTokenList, error) {
+	vErr := entities.ValidDeviceGroupID(deviceGroupID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListRegistrationTokens(deviceGroupID)
+}
+
+// RevokeRegistrationToken prevents a registration token from being used again.
+func (h *Handler) RevokeRegistrationToken(ctx context.Context, tokenID *grpc_device_manager_go.RegistrationTokenId) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidRegistrationTokenId(tokenID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.RevokeRegistrationToken(tokenID)
+}
+
+// ListPendingDevices retrieves the registrations of a device group waiting for approval.
+func (h *Handler) ListPendingDevices(ctx context.Context, deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.PendingDeviceList, error) {
+	vErr := entities.ValidDeviceGroupID(deviceGroupID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListPendingDevices(deviceGroupID)
+}
+
+// ApproveDevice enables a device waiting for approval.
+func (h *Handler) ApproveDevice(ctx context.Context, deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.Device, error) {
+	vErr := entities.ValidDeviceID(deviceID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	audit := h.Manager.startAudit(h.actor(ctx), "ApproveDevice", deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	device, err := h.Manager.ApproveDevice(deviceID)
+	if err == nil {
+		audit.setPrevious(flagFields("enabled", false))
+		audit.setCurrent(flagFields("enabled", device.Enabled))
+	}
+	h.Manager.finishAudit(audit, err)
+	return device, err
+}
+
+// RejectDevice removes a device waiting for approval.
+func (h *Handler) RejectDevice(ctx context.Context, deviceID *grpc_device_go.DeviceId) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidDeviceID(deviceID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	audit := h.Manager.startAudit(h.actor(ctx), "RejectDevice", deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	success, err := h.Manager.RejectDevice(deviceID)
+	h.Manager.finishAudit(audit, err)
+	return success, err
+}
+
+func (h *Handler) ImportDevices(ctx context.Context, request *grpc_device_manager_go.ImportDevicesRequest) (*grpc_device_manager_go.ImportDevicesResponse, error) {
+	vErr := entities.ValidImportDevicesRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	rows, vErr := entities.ParseDeviceImport(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ImportDevices(request, rows, h.actor(ctx))
 }
 
 func (h *Handler) GetDevice(ctx context.Context, deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.Device, error) {
@@ -85,20 +219,140 @@ func (h *Handler) GetDevice(ctx context.Context, deviceID *grpc_device_go.Device
 	return h.Manager.GetDevice(deviceID)
 }
 
-func (h *Handler) ListDevices(ctx context.Context, deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.DeviceList, error) {
-	vErr := entities.ValidDeviceGroupID(deviceGroupID)
+func (h *Handler) ListDevices(ctx context.Context, request *grpc_device_manager_go.ListDevicesRequest) (*grpc_device_manager_go.DeviceList, error) {
+	vErr := entities.ValidListDevicesRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	selector, vErr := entities.ParseLabelSelector(request.LabelSelector)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	filter, vErr := entities.ParseAttributeFilter(request.AttributeFilter)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	scope := fmt.Sprintf("%s/%s/%s/%s", request.OrganizationId, request.DeviceGroupId, request.LabelSelector, request.AttributeFilter)
+	page, vErr := entities.NewPageRequest(request.PageSize, request.PageToken, request.SortBy, request.Descending, scope)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	deviceGroupID := &grpc_device_go.DeviceGroupId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+	}
+	return h.Manager.ListDevices(deviceGroupID, selector, filter, page)
+}
+
+func (h *Handler) ListOrganizationDevices(ctx context.Context, request *grpc_device_manager_go.ListOrganizationDevicesRequest) (*grpc_device_manager_go.DeviceList, error) {
+	vErr := entities.ValidListOrganizationDevicesRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	selector, vErr := entities.ParseLabelSelector(request.LabelSelector)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	filter, vErr := entities.ParseAttributeFilter(request.AttributeFilter)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	scope := fmt.Sprintf("%s/%s/%s", request.OrganizationId, request.LabelSelector, request.AttributeFilter)
+	page, vErr := entities.NewPageRequest(request.PageSize, request.PageToken, request.SortBy, request.Descending, scope)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	organizationID := &grpc_organization_go.OrganizationId{
+		OrganizationId: request.OrganizationId,
+	}
+	return h.Manager.ListOrganizationDevices(organizationID, selector, filter, page)
+}
+
+func (h *Handler) SearchDevices(ctx context.Context, request *grpc_device_manager_go.SearchDevicesRequest) (*grpc_device_manager_go.DeviceList, error) {
+	vErr := entities.ValidSearchDevicesRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	query, vErr := entities.NewDeviceSearchQuery(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	scope := fmt.Sprintf("%s/%s/%s/%s/%t/%s", request.OrganizationId, request.DeviceIdPrefix, request.LabelSelector,
+		request.AssetInfo, request.FilterByStatus, request.DeviceStatus.String())
+	page, vErr := entities.NewPageRequest(request.PageSize, request.PageToken, request.SortBy, request.Descending, scope)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.SearchDevices(query, page)
+}
+
+func (h *Handler) BulkDeviceOperation(ctx context.Context, request *grpc_device_manager_go.BulkDeviceOperationRequest) (*grpc_device_manager_go.BulkDeviceOperationResponse, error) {
+	vErr := entities.ValidBulkDeviceOperationRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	selector, vErr := entities.ParseLabelSelector(request.LabelSelector)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	actor := h.actor(ctx)
+	if request.Operation == grpc_device_manager_go.BulkOperation_ADD_LABELS {
+		err := h.Manager.CheckLabels(request.OrganizationId, request.Labels, actor.IsAdmin())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h.Manager.BulkDeviceOperation(request, selector, actor)
+}
+
+func (h *Handler) ExportDevices(request *grpc_device_manager_go.ExportDevicesRequest, stream grpc_device_manager_go.Devices_ExportDevicesServer) error {
+	vErr := entities.ValidExportDevicesRequest(request)
+	if vErr != nil {
+		return conversions.ToGRPCError(vErr)
+	}
+	if request.IncludeApiKeys && !h.actor(stream.Context()).IsAdmin() {
+		return conversions.ToGRPCError(derrors.NewPermissionDeniedError("only administrators can export device API keys"))
+	}
+	selector, vErr := entities.ParseLabelSelector(request.LabelSelector)
+	if vErr != nil {
+		return conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ExportDevices(request, selector, stream.Send)
+}
+
+func (h *Handler) ReconcileOrganization(ctx context.Context, request *grpc_device_manager_go.ReconcileRequest) (*grpc_device_manager_go.ReconcileResponse, error) {
+	vErr := entities.ValidReconcileRequest(request)
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.ListDevices(deviceGroupID)
+	if request.Apply && !h.actor(ctx).IsAdmin() {
+		return nil, conversions.ToGRPCError(derrors.NewPermissionDeniedError("only administrators can fix inconsistencies"))
+	}
+	report, err := h.Manager.ReconcileOrganization(request.OrganizationId, request.Apply)
+	if err != nil {
+		return nil, err
+	}
+	return report.ToGRPC(), nil
 }
 
 func (h *Handler) AddLabelToDevice(ctx context.Context, request *grpc_device_manager_go.DeviceLabelRequest) (*grpc_common_go.Success, error) {
-	vErr := entities.ValidDeviceLabelRequest(request)
+	vErr := entities.ValidAddDeviceLabelRequest(request)
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.AddLabelToDevice(request)
+	actor := h.actor(ctx)
+	audit := h.Manager.startAudit(actor, "AddLabelToDevice", request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	err := h.Manager.CheckLabels(request.OrganizationId, request.Labels, actor.IsAdmin())
+	if err != nil {
+		h.Manager.finishAudit(audit, err)
+		return nil, err
+	}
+	success, err := h.Manager.AddLabelToDevice(request)
+	if err == nil {
+		audit.setCurrent(labelFields(request.Labels))
+	}
+	h.Manager.finishAudit(audit, err)
+	return success, err
 }
 
 func (h *Handler) RemoveLabelFromDevice(ctx context.Context, request *grpc_device_manager_go.DeviceLabelRequest) (*grpc_common_go.Success, error) {
@@ -106,7 +360,13 @@ func (h *Handler) RemoveLabelFromDevice(ctx context.Context, request *grpc_devic
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.RemoveLabelFromDevice(request)
+	audit := h.Manager.startAudit(h.actor(ctx), "RemoveLabelFromDevice", request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	success, err := h.Manager.RemoveLabelFromDevice(request)
+	if err == nil {
+		audit.setPrevious(labelFields(request.Labels))
+	}
+	h.Manager.finishAudit(audit, err)
+	return success, err
 }
 
 func (h *Handler) UpdateDevice(ctx context.Context, request *grpc_device_manager_go.UpdateDeviceRequest) (*grpc_device_manager_go.Device, error) {
@@ -114,7 +374,13 @@ func (h *Handler) UpdateDevice(ctx context.Context, request *grpc_device_manager
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.UpdateDevice(request)
+	audit := h.Manager.startAudit(h.actor(ctx), "UpdateDevice", request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	device, err := h.Manager.UpdateDevice(request)
+	if err == nil {
+		audit.setCurrent(flagFields("enabled", device.Enabled))
+	}
+	h.Manager.finishAudit(audit, err)
+	return device, err
 }
 
 func (h *Handler) UpdateDeviceLocation(ctx context.Context, request *grpc_device_manager_go.UpdateDeviceLocationRequest) (*grpc_device_manager_go.Device, error) {
@@ -123,7 +389,13 @@ func (h *Handler) UpdateDeviceLocation(ctx context.Context, request *grpc_device
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.UpdateDeviceLocation(request)
+	audit := h.Manager.startAudit(h.actor(ctx), "UpdateDeviceLocation", request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	device, err := h.Manager.UpdateDeviceLocation(request)
+	if err == nil {
+		audit.setCurrent(locationFields(device.Location))
+	}
+	h.Manager.finishAudit(audit, err)
+	return device, err
 }
 
 func (h *Handler) RemoveDevice(ctx context.Context, deviceID *grpc_device_go.DeviceId) (*grpc_common_go.Success, error) {
@@ -131,5 +403,545 @@ func (h *Handler) RemoveDevice(ctx context.Context, deviceID *grpc_device_go.Dev
 	if vErr != nil {
 		return nil, conversions.ToGRPCError(vErr)
 	}
-	return h.Manager.RemoveDevice(deviceID)
+	audit := h.Manager.startAudit(h.actor(ctx), "RemoveDevice", deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	success, err := h.Manager.RemoveDevice(deviceID)
+	if err == nil {
+		audit.setCurrent(flagFields("deleted", true))
+	}
+	h.Manager.finishAudit(audit, err)
+	return success, err
+}
+
+// ListDeletedDevices retrieves the deleted devices of a group that can still be restored.
+func (h *Handler) ListDeletedDevices(ctx context.Context, deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.DeletedDeviceList, error) {
+	vErr := entities.ValidDeviceGroupID(deviceGroupID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListDeletedDevices(deviceGroupID)
+}
+
+// RestoreDevice brings back a deleted device.
+func (h *Handler) RestoreDevice(ctx context.Context, deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.Device, error) {
+	vErr := entities.ValidDeviceID(deviceID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	audit := h.Manager.startAudit(h.actor(ctx), "RestoreDevice", deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	device, err := h.Manager.RestoreDevice(deviceID)
+	if err == nil {
+		audit.setPrevious(flagFields("deleted", true))
+		audit.setCurrent(flagFields("deleted", false))
+		audit.setCurrent(flagFields("enabled", device.Enabled))
+	}
+	h.Manager.finishAudit(audit, err)
+	return device, err
+}
+
+// PurgeDevice permanently removes a deleted device.
+func (h *Handler) PurgeDevice(ctx context.Context, deviceID *grpc_device_go.DeviceId) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidDeviceID(deviceID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	audit := h.Manager.startAudit(h.actor(ctx), "PurgeDevice", deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	success, err := h.Manager.PurgeDevice(deviceID)
+	if err == nil {
+		audit.setPrevious(flagFields("deleted", true))
+	}
+	h.Manager.finishAudit(audit, err)
+	return success, err
+}
+
+// SetDeviceAttributes adds or updates a set of typed attributes of a device.
+func (h *Handler) SetDeviceAttributes(ctx context.Context, request *grpc_device_manager_go.SetDeviceAttributesRequest) (*grpc_device_manager_go.DeviceAttributeList, error) {
+	vErr := entities.ValidSetDeviceAttributesRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.SetDeviceAttributes(request)
+}
+
+// GetDeviceAttributes retrieves the attributes of a device.
+func (h *Handler) GetDeviceAttributes(ctx context.Context, deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.DeviceAttributeList, error) {
+	vErr := entities.ValidDeviceID(deviceID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.GetDeviceAttributes(deviceID)
+}
+
+// RemoveDeviceAttributes removes a set of attributes of a device.
+func (h *Handler) RemoveDeviceAttributes(ctx context.Context, request *grpc_device_manager_go.RemoveDeviceAttributesRequest) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidRemoveDeviceAttributesRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.RemoveDeviceAttributes(request)
+}
+
+// SetAttributeDefinition adds or updates an attribute in the schema of an organization.
+func (h *Handler) SetAttributeDefinition(ctx context.Context, definition *grpc_device_manager_go.AttributeDefinition) (*grpc_device_manager_go.AttributeDefinition, error) {
+	vErr := entities.ValidAttributeDefinition(definition)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.SetAttributeDefinition(definition)
+}
+
+// ListAttributeDefinitions retrieves the attribute schema of an organization.
+func (h *Handler) ListAttributeDefinitions(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*grpc_device_manager_go.AttributeDefinitionList, error) {
+	vErr := entities.ValidOrganizationID(organizationID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListAttributeDefinitions(organizationID)
+}
+
+// RemoveAttributeDefinition removes an attribute from the schema of an organization.
+func (h *Handler) RemoveAttributeDefinition(ctx context.Context, definitionID *grpc_device_manager_go.AttributeDefinitionId) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidAttributeDefinitionId(definitionID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.RemoveAttributeDefinition(definitionID)
+}
+
+// SetLabelPolicy replaces the label keys allowed in an organization. Only administrators can change the policy.
+func (h *Handler) SetLabelPolicy(ctx context.Context, policy *grpc_device_manager_go.LabelPolicy) (*grpc_device_manager_go.LabelPolicy, error) {
+	vErr := entities.ValidLabelPolicy(policy)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	if !h.actor(ctx).IsAdmin() {
+		return nil, conversions.ToGRPCError(derrors.NewPermissionDeniedError("only administrators can change the label policy"))
+	}
+	return h.Manager.SetLabelPolicy(policy)
+}
+
+// GetLabelPolicy retrieves the label policy of an organization.
+func (h *Handler) GetLabelPolicy(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*grpc_device_manager_go.LabelPolicy, error) {
+	vErr := entities.ValidOrganizationID(organizationID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.GetLabelPolicy(organizationID)
+}
+
+// ListDevicesInRadius retrieves the devices located within a distance of a point.
+func (h *Handler) ListDevicesInRadius(ctx context.Context, request *grpc_device_manager_go.ListDevicesInRadiusRequest) (*grpc_device_manager_go.DeviceLocationList, error) {
+	vErr := entities.ValidListDevicesInRadiusRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListDevicesInRadius(request)
+}
+
+// ListDevicesInBoundingBox retrieves the devices located within a bounding box.
+func (h *Handler) ListDevicesInBoundingBox(ctx context.Context, request *grpc_device_manager_go.ListDevicesInBoundingBoxRequest) (*grpc_device_manager_go.DeviceLocationList, error) {
+	vErr := entities.ValidListDevicesInBoundingBoxRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListDevicesInBoundingBox(request)
+}
+
+// ListDevicesInPolygon retrieves the devices located within a polygon.
+func (h *Handler) ListDevicesInPolygon(ctx context.Context, request *grpc_device_manager_go.ListDevicesInPolygonRequest) (*grpc_device_manager_go.DeviceLocationList, error) {
+	vErr := entities.ValidListDevicesInPolygonRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListDevicesInPolygon(request)
+}
+
+// ListLocationHistory retrieves the location updates of a device in a time range.
+func (h *Handler) ListLocationHistory(ctx context.Context, request *grpc_device_manager_go.LocationHistoryRequest) (*grpc_device_manager_go.LocationHistory, error) {
+	vErr := entities.ValidLocationHistoryRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListLocationHistory(request)
+}
+
+// AddGeofence creates a circle or polygon geofence in a device group.
+func (h *Handler) AddGeofence(ctx context.Context, request *grpc_device_manager_go.AddGeofenceRequest) (*grpc_device_manager_go.Geofence, error) {
+	vErr := entities.ValidAddGeofenceRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.AddGeofence(request)
+}
+
+// ListGeofences retrieves the geofences of a device group.
+func (h *Handler) ListGeofences(ctx context.Context, deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.GeofenceList, error) {
+	vErr := entities.ValidDeviceGroupID(deviceGroupID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListGeofences(deviceGroupID)
+}
+
+// RemoveGeofence removes a geofence.
+func (h *Handler) RemoveGeofence(ctx context.Context, geofenceID *grpc_device_manager_go.GeofenceId) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidGeofenceId(geofenceID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.RemoveGeofence(geofenceID)
+}
+
+// ListGeofenceEvents retrieves the devices that entered or left the geofences of a device group.
+func (h *Handler) ListGeofenceEvents(ctx context.Context, request *grpc_device_manager_go.GeofenceEventsRequest) (*grpc_device_manager_go.GeofenceEventList, error) {
+	vErr := entities.ValidGeofenceEventsRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListGeofenceEvents(request)
+}
+
+// UpdateDeviceAssetInfo updates the OS, hardware, storage or network information of a device.
+func (h *Handler) UpdateDeviceAssetInfo(ctx context.Context, request *grpc_device_manager_go.UpdateDeviceAssetInfoRequest) (*grpc_device_manager_go.Device, error) {
+	vErr := entities.ValidUpdateDeviceAssetInfoRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	audit := h.Manager.startAudit(h.actor(ctx), "UpdateDeviceAssetInfo", request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	device, err := h.Manager.UpdateDeviceAssetInfo(request, audit)
+	h.Manager.finishAudit(audit, err)
+	return device, err
+}
+
+// ListAssetInfoHistory retrieves the changes of the asset information of a device.
+func (h *Handler) ListAssetInfoHistory(ctx context.Context, request *grpc_device_manager_go.AssetInfoHistoryRequest) (*grpc_device_manager_go.AssetInfoHistory, error) {
+	vErr := entities.ValidAssetInfoHistoryRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListAssetInfoHistory(request)
+}
+
+// GetDeviceTwin retrieves the desired and reported documents of a device with their delta.
+func (h *Handler) GetDeviceTwin(ctx context.Context, deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.DeviceTwin, error) {
+	vErr := entities.ValidDeviceID(deviceID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.GetDeviceTwin(deviceID)
+}
+
+// PatchDesiredState applies a patch to the desired document of a device twin.
+func (h *Handler) PatchDesiredState(ctx context.Context, request *grpc_device_manager_go.PatchDesiredStateRequest) (*grpc_device_manager_go.DeviceTwin, error) {
+	vErr := entities.ValidPatchDesiredStateRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.PatchDesiredState(request)
+}
+
+// ReportDeviceState applies a patch sent by a device to the reported document of its twin.
+func (h *Handler) ReportDeviceState(ctx context.Context, request *grpc_device_manager_go.ReportDeviceStateRequest) (*grpc_device_manager_go.DeviceTwin, error) {
+	vErr := entities.ValidReportDeviceStateRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ReportDeviceState(request)
+}
+
+// WatchDeviceTwin sends the changes of a device twin until the client cancels the request.
+func (h *Handler) WatchDeviceTwin(deviceID *grpc_device_go.DeviceId, stream grpc_device_manager_go.Devices_WatchDeviceTwinServer) error {
+	vErr := entities.ValidDeviceID(deviceID)
+	if vErr != nil {
+		return conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.WatchDeviceTwin(stream.Context(), deviceID, stream.Send)
+}
+
+// EnqueueCommand queues a command for a device, a device group or the devices selected by their labels.
+func (h *Handler) EnqueueCommand(ctx context.Context, request *grpc_device_manager_go.EnqueueCommandRequest) (*grpc_device_manager_go.EnqueueCommandResponse, error) {
+	vErr := entities.ValidEnqueueCommandRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	selector, vErr := entities.ParseLabelSelector(request.LabelSelector)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.EnqueueCommand(request, selector)
+}
+
+// ListCommands retrieves the commands of a device.
+func (h *Handler) ListCommands(ctx context.Context, deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.CommandList, error) {
+	vErr := entities.ValidDeviceID(deviceID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListCommands(deviceID)
+}
+
+// CancelCommand prevents a command from being delivered.
+func (h *Handler) CancelCommand(ctx context.Context, commandID *grpc_device_manager_go.CommandId) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidCommandId(commandID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.CancelCommand(commandID)
+}
+
+// PollCommands delivers the pending commands of a device.
+func (h *Handler) PollCommands(ctx context.Context, request *grpc_device_manager_go.PollCommandsRequest) (*grpc_device_manager_go.CommandList, error) {
+	vErr := entities.ValidPollCommandsRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.PollCommands(request)
+}
+
+// StreamCommands delivers the commands of a device as they are queued until the device closes the stream.
+func (h *Handler) StreamCommands(request *grpc_device_manager_go.PollCommandsRequest, stream grpc_device_manager_go.Devices_StreamCommandsServer) error {
+	vErr := entities.ValidPollCommandsRequest(request)
+	if vErr != nil {
+		return conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.StreamCommands(stream.Context(), request, stream.Send)
+}
+
+// AcknowledgeCommand records the result of a command executed by a device.
+func (h *Handler) AcknowledgeCommand(ctx context.Context, request *grpc_device_manager_go.AcknowledgeCommandRequest) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidAcknowledgeCommandRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.AcknowledgeCommand(request)
+}
+
+// PublishConfig stores a new configuration version of a device group.
+func (h *Handler) PublishConfig(ctx context.Context, request *grpc_device_manager_go.PublishConfigRequest) (*grpc_device_manager_go.DeviceConfig, error) {
+	vErr := entities.ValidPublishConfigRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.PublishConfig(request)
+}
+
+// ListConfigVersions retrieves the configuration versions of a device group.
+func (h *Handler) ListConfigVersions(ctx context.Context, deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.DeviceConfigList, error) {
+	vErr := entities.ValidDeviceGroupID(deviceGroupID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListConfigVersions(deviceGroupID)
+}
+
+// GetConfigVersion retrieves a configuration version of a device group.
+func (h *Handler) GetConfigVersion(ctx context.Context, versionID *grpc_device_manager_go.ConfigVersionId) (*grpc_device_manager_go.DeviceConfig, error) {
+	vErr := entities.ValidConfigVersionId(versionID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.GetConfigVersion(versionID)
+}
+
+// RollbackConfig makes a previous configuration version the active one.
+func (h *Handler) RollbackConfig(ctx context.Context, versionID *grpc_device_manager_go.ConfigVersionId) (*grpc_device_manager_go.DeviceConfig, error) {
+	vErr := entities.ValidConfigVersionId(versionID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.RollbackConfig(versionID)
+}
+
+// GetEffectiveConfig retrieves the configuration of a device.
+func (h *Handler) GetEffectiveConfig(ctx context.Context, request *grpc_device_manager_go.GetEffectiveConfigRequest) (*grpc_device_manager_go.EffectiveConfig, error) {
+	vErr := entities.ValidGetEffectiveConfigRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.GetEffectiveConfig(request)
+}
+
+// AcknowledgeConfig records the configuration applied by a device.
+func (h *Handler) AcknowledgeConfig(ctx context.Context, request *grpc_device_manager_go.AcknowledgeConfigRequest) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidAcknowledgeConfigRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.AcknowledgeConfig(request)
+}
+
+// ListConfigAcknowledgements retrieves the configuration acknowledged by each device of a group.
+func (h *Handler) ListConfigAcknowledgements(ctx context.Context, deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.ConfigAcknowledgementList, error) {
+	vErr := entities.ValidDeviceGroupID(deviceGroupID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListConfigAcknowledgements(deviceGroupID)
+}
+
+// CreateCampaign starts a staged rollout of an artifact to the devices of a group.
+func (h *Handler) CreateCampaign(ctx context.Context, request *grpc_device_manager_go.CreateCampaignRequest) (*grpc_device_manager_go.Campaign, error) {
+	vErr := entities.ValidCreateCampaignRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	selector, vErr := entities.ParseLabelSelector(request.LabelSelector)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.CreateCampaign(request, selector)
+}
+
+// GetCampaign retrieves a campaign and its progress.
+func (h *Handler) GetCampaign(ctx context.Context, campaignID *grpc_device_manager_go.CampaignId) (*grpc_device_manager_go.Campaign, error) {
+	vErr := entities.ValidCampaignId(campaignID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.GetCampaign(campaignID)
+}
+
+// ListCampaigns retrieves the campaigns of a device group.
+func (h *Handler) ListCampaigns(ctx context.Context, deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.CampaignList, error) {
+	vErr := entities.ValidDeviceGroupID(deviceGroupID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListCampaigns(deviceGroupID)
+}
+
+// ListCampaignDevices retrieves the progress of each device of a campaign.
+func (h *Handler) ListCampaignDevices(ctx context.Context, campaignID *grpc_device_manager_go.CampaignId) (*grpc_device_manager_go.CampaignDeviceList, error) {
+	vErr := entities.ValidCampaignId(campaignID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListCampaignDevices(campaignID)
+}
+
+// PauseCampaign stops a running campaign.
+func (h *Handler) PauseCampaign(ctx context.Context, campaignID *grpc_device_manager_go.CampaignId) (*grpc_device_manager_go.Campaign, error) {
+	vErr := entities.ValidCampaignId(campaignID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.PauseCampaign(campaignID)
+}
+
+// ResumeCampaign continues a paused or halted campaign.
+func (h *Handler) ResumeCampaign(ctx context.Context, campaignID *grpc_device_manager_go.CampaignId) (*grpc_device_manager_go.Campaign, error) {
+	vErr := entities.ValidCampaignId(campaignID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ResumeCampaign(campaignID)
+}
+
+// AbortCampaign stops a campaign permanently.
+func (h *Handler) AbortCampaign(ctx context.Context, campaignID *grpc_device_manager_go.CampaignId) (*grpc_device_manager_go.Campaign, error) {
+	vErr := entities.ValidCampaignId(campaignID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.AbortCampaign(campaignID)
+}
+
+// ListAuditEntries retrieves the audit entries of an organization, a device group or a device. Only administrators
+// can read the audit log.
+func (h *Handler) ListAuditEntries(ctx context.Context, request *grpc_device_manager_go.AuditEntriesRequest) (*grpc_device_manager_go.AuditEntryList, error) {
+	vErr := entities.ValidAuditEntriesRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	if !h.actor(ctx).IsAdmin() {
+		return nil, conversions.ToGRPCError(derrors.NewPermissionDeniedError("only administrators can read the audit log"))
+	}
+	return h.Manager.ListAuditEntries(request)
+}
+
+// AddDynamicGroup creates a dynamic group defined by a label selector, an attribute filter and a device status.
+func (h *Handler) AddDynamicGroup(ctx context.Context, request *grpc_device_manager_go.AddDynamicGroupRequest) (*grpc_device_manager_go.DynamicGroup, error) {
+	vErr := entities.ValidAddDynamicGroupRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.AddDynamicGroup(request)
+}
+
+// GetDynamicGroup retrieves the definition of a dynamic group.
+func (h *Handler) GetDynamicGroup(ctx context.Context, dynamicGroupID *grpc_device_manager_go.DynamicGroupId) (*grpc_device_manager_go.DynamicGroup, error) {
+	vErr := entities.ValidDynamicGroupId(dynamicGroupID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.GetDynamicGroup(dynamicGroupID)
+}
+
+// ListDynamicGroups retrieves the dynamic groups of an organization.
+func (h *Handler) ListDynamicGroups(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*grpc_device_manager_go.DynamicGroupList, error) {
+	vErr := entities.ValidOrganizationID(organizationID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.ListDynamicGroups(organizationID)
+}
+
+// UpdateDynamicGroup replaces the definition of a dynamic group.
+func (h *Handler) UpdateDynamicGroup(ctx context.Context, request *grpc_device_manager_go.UpdateDynamicGroupRequest) (*grpc_device_manager_go.DynamicGroup, error) {
+	vErr := entities.ValidUpdateDynamicGroupRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.UpdateDynamicGroup(request)
+}
+
+// RemoveDynamicGroup removes a dynamic group without modifying its members.
+func (h *Handler) RemoveDynamicGroup(ctx context.Context, dynamicGroupID *grpc_device_manager_go.DynamicGroupId) (*grpc_common_go.Success, error) {
+	vErr := entities.ValidDynamicGroupId(dynamicGroupID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.RemoveDynamicGroup(dynamicGroupID)
+}
+
+// ListDynamicGroupDevices retrieves a page of the devices that currently match a dynamic group.
+func (h *Handler) ListDynamicGroupDevices(ctx context.Context, request *grpc_device_manager_go.ListDynamicGroupDevicesRequest) (*grpc_device_manager_go.DeviceList, error) {
+	vErr := entities.ValidListDynamicGroupDevicesRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	scope := fmt.Sprintf("%s/%s", request.OrganizationId, request.DynamicGroupId)
+	page, vErr := entities.NewPageRequest(request.PageSize, request.PageToken, request.SortBy, request.Descending, scope)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	dynamicGroupID := &grpc_device_manager_go.DynamicGroupId{
+		OrganizationId: request.OrganizationId,
+		DynamicGroupId: request.DynamicGroupId,
+	}
+	return h.Manager.ListDynamicGroupDevices(dynamicGroupID, page)
+}
+
+// GetDynamicGroupSummary counts the devices that currently match a dynamic group.
+func (h *Handler) GetDynamicGroupSummary(ctx context.Context, dynamicGroupID *grpc_device_manager_go.DynamicGroupId) (*grpc_device_manager_go.DynamicGroupSummary, error) {
+	vErr := entities.ValidDynamicGroupId(dynamicGroupID)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	return h.Manager.GetDynamicGroupSummary(dynamicGroupID)
+}
+
+// DynamicGroupBulkOperation changes the labels or the location of the devices that currently match a dynamic group.
+func (h *Handler) DynamicGroupBulkOperation(ctx context.Context, request *grpc_device_manager_go.DynamicGroupBulkOperationRequest) (*grpc_device_manager_go.DynamicGroupBulkOperationResponse, error) {
+	vErr := entities.ValidDynamicGroupBulkOperationRequest(request)
+	if vErr != nil {
+		return nil, conversions.ToGRPCError(vErr)
+	}
+	actor := h.actor(ctx)
+	if request.Operation == grpc_device_manager_go.BulkOperation_ADD_LABELS {
+		err := h.Manager.CheckLabels(request.OrganizationId, request.Labels, actor.IsAdmin())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h.Manager.DynamicGroupBulkOperation(request, actor)
 }
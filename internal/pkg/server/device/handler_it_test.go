@@ -21,23 +21,49 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/approval"
+	"github.com/nalej/device-manager/internal/pkg/provider/asset"
+	"github.com/nalej/device-manager/internal/pkg/provider/attribute"
+	"github.com/nalej/device-manager/internal/pkg/provider/audit"
+	"github.com/nalej/device-manager/internal/pkg/provider/campaign"
+	"github.com/nalej/device-manager/internal/pkg/provider/command"
+	"github.com/nalej/device-manager/internal/pkg/provider/configuration"
+	"github.com/nalej/device-manager/internal/pkg/provider/deletion"
+	"github.com/nalej/device-manager/internal/pkg/provider/dynamicgroup"
+	"github.com/nalej/device-manager/internal/pkg/provider/geo"
+	"github.com/nalej/device-manager/internal/pkg/provider/geofence"
+	"github.com/nalej/device-manager/internal/pkg/provider/history"
+	"github.com/nalej/device-manager/internal/pkg/provider/index"
+	"github.com/nalej/device-manager/internal/pkg/provider/label"
 	"github.com/nalej/device-manager/internal/pkg/provider/latency"
+	"github.com/nalej/device-manager/internal/pkg/provider/metrics"
+	"github.com/nalej/device-manager/internal/pkg/provider/repair"
+	"github.com/nalej/device-manager/internal/pkg/provider/token"
+	"github.com/nalej/device-manager/internal/pkg/provider/twin"
 	"github.com/nalej/grpc-application-go"
 	"github.com/nalej/grpc-authx-go"
 	"github.com/nalej/grpc-device-go"
 	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-inventory-go"
 	"github.com/nalej/grpc-organization-go"
 	"github.com/nalej/grpc-utils/pkg/test"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"io"
 	"math/rand"
 	"os"
 	"time"
 )
 
+// testActorSecret is the secret used to sign the identity of the administrators in the tests.
+const testActorSecret = "test-actor-secret"
+
 func GetConnection(address string) *grpc.ClientConn {
 	conn, err := grpc.Dial(address, grpc.WithInsecure())
 	gomega.Expect(err).To(gomega.Succeed())
@@ -100,6 +126,26 @@ var _ = ginkgo.Describe("Device service", func() {
 	var authxClient grpc_authx_go.AuthxClient
 	var authxConn *grpc.ClientConn
 	var latencyProvider *latency.MockupProvider
+	var indexProvider *index.MockupProvider
+	var approvalProvider *approval.MockupProvider
+	var tokenProvider *token.MockupProvider
+	var repairProvider *repair.MockupProvider
+	var deletionProvider *deletion.MockupProvider
+	var attributeProvider *attribute.MockupProvider
+	var labelProvider *label.MockupProvider
+	var geoProvider *geo.MockupProvider
+	var historyProvider *history.MockupProvider
+	var geofenceProvider *geofence.MockupProvider
+	var assetProvider *asset.MockupProvider
+	var twinProvider *twin.MockupProvider
+	var commandProvider *command.MockupProvider
+	var configProvider *configuration.MockupProvider
+	var campaignProvider *campaign.MockupProvider
+	var metricsProvider *metrics.MockupProvider
+	var auditProvider *audit.MockupProvider
+	var dynamicGroupProvider *dynamicgroup.MockupProvider
+	// manager is used to run the periodic tasks
+	var manager Manager
 
 	// Target organization.
 	var targetOrganization *grpc_organization_go.Organization
@@ -118,12 +164,58 @@ var _ = ginkgo.Describe("Device service", func() {
 
 		// provider
 		latencyProvider = latency.NewMockupProvider()
+		indexProvider = index.NewMockupProvider()
+		approvalProvider = approval.NewMockupProvider()
+		tokenProvider = token.NewMockupProvider()
+		repairProvider = repair.NewMockupProvider()
+		deletionProvider = deletion.NewMockupProvider()
+		attributeProvider = attribute.NewMockupProvider()
+		labelProvider = label.NewMockupProvider()
+		geoProvider = geo.NewMockupProvider()
+		historyProvider = history.NewMockupProvider()
+		geofenceProvider = geofence.NewMockupProvider()
+		assetProvider = asset.NewMockupProvider()
+		twinProvider = twin.NewMockupProvider()
+		commandProvider = command.NewMockupProvider()
+		configProvider = configuration.NewMockupProvider()
+		campaignProvider = campaign.NewMockupProvider()
+		metricsProvider = metrics.NewMockupProvider()
+		auditProvider = audit.NewMockupProvider()
+		dynamicGroupProvider = dynamicgroup.NewMockupProvider()
 
 		// Register the service
 		d, _ := time.ParseDuration("3m")
 
-		manager := NewManager(authxClient, deviceClient, appClient, latencyProvider, d)
-		handler := NewHandler(manager)
+		pagination := entities.PaginationConfig{DefaultPageSize: 100, MaxPageSize: 1000}
+		manager = NewManager(authxClient, deviceClient, appClient, Providers{
+			Latency:       latencyProvider,
+			Index:         indexProvider,
+			Approval:      approvalProvider,
+			Token:         tokenProvider,
+			Repair:        repairProvider,
+			Deletion:      deletionProvider,
+			Attribute:     attributeProvider,
+			Label:         labelProvider,
+			Geo:           geoProvider,
+			History:       historyProvider,
+			Geofence:      geofenceProvider,
+			Asset:         assetProvider,
+			Twin:          twinProvider,
+			Command:       commandProvider,
+			Configuration: configProvider,
+			Campaign:      campaignProvider,
+			Metrics:       metricsProvider,
+			Audit:         auditProvider,
+			DynamicGroup:  dynamicGroupProvider,
+		}, ManagerConfig{
+			Threshold:             d,
+			Pagination:            pagination,
+			BulkConcurrency:       5,
+			PendingExpiration:     time.Hour,
+			DeletedRetention:      time.Hour,
+			ReservedLabelPrefixes: []string{"nalej.com/"},
+		})
+		handler := NewHandler(manager, testActorSecret)
 		grpc_device_manager_go.RegisterDevicesServer(server, handler)
 		test.LaunchServer(server, listener)
 
@@ -169,10 +261,10 @@ var _ = ginkgo.Describe("Device service", func() {
 			gomega.Expect(err).To(gomega.Succeed())
 			gomega.Expect(added).ShouldNot(gomega.BeNil())
 
-			orgID := &grpc_organization_go.OrganizationId{
+			listRequest := &grpc_device_manager_go.ListDeviceGroupsRequest{
 				OrganizationId: targetOrganization.OrganizationId,
 			}
-			list, err := client.ListDeviceGroups(context.Background(), orgID)
+			list, err := client.ListDeviceGroups(context.Background(), listRequest)
 			gomega.Expect(err).To(gomega.Succeed())
 			gomega.Expect(len(list.Groups)).Should(gomega.Equal(1))
 			retrieved := list.Groups[0]
@@ -240,6 +332,49 @@ var _ = ginkgo.Describe("Device service", func() {
 			gomega.Expect(added).ShouldNot(gomega.BeNil())
 			gomega.Expect(added.DeviceApiKey).ShouldNot(gomega.BeNil())
 		})
+		ginkgo.It("should return the same credentials if a device is registered twice", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, rand.Int()),
+				Labels:            map[string]string{"env": "prod"},
+			}
+			added, err := client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(added.AlreadyRegistered).Should(gomega.BeFalse())
+
+			again, err := client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(again.AlreadyRegistered).Should(gomega.BeTrue())
+			gomega.Expect(again.DeviceApiKey).Should(gomega.Equal(added.DeviceApiKey))
+
+			registerRequest.Labels = map[string]string{"env": "dev"}
+			_, err = client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should complete the registration of a device without credentials", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			deviceID := fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, rand.Int())
+			_, err := deviceClient.AddDevice(context.Background(), &grpc_device_go.AddDeviceRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       deviceID,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+
+			registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          deviceID,
+			}
+			added, err := client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(added.AlreadyRegistered).Should(gomega.BeFalse())
+			gomega.Expect(added.DeviceApiKey).ShouldNot(gomega.BeEmpty())
+		})
 		ginkgo.It("new devices should follow the device group policy", func() {
 			// first try with default connectivity disabled
 			dgF := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, false)
@@ -323,16 +458,120 @@ var _ = ginkgo.Describe("Device service", func() {
 			gomega.Expect(err).To(gomega.Succeed())
 			gomega.Expect(added).ShouldNot(gomega.BeNil())
 
-			deviceGroupID := &grpc_device_go.DeviceGroupId{
+			listRequest := &grpc_device_manager_go.ListDevicesRequest{
 				OrganizationId: dg.OrganizationId,
 				DeviceGroupId:  dg.DeviceGroupId,
 			}
-			list, err := client.ListDevices(context.Background(), deviceGroupID)
+			list, err := client.ListDevices(context.Background(), listRequest)
 			gomega.Expect(err).To(gomega.Succeed())
 			gomega.Expect(len(list.Devices)).Should(gomega.Equal(1))
 			retrieved := list.Devices[0]
 			gomega.Expect(retrieved.DeviceApiKey).Should(gomega.Equal(added.DeviceApiKey))
 		})
+		ginkgo.It("should be able to list devices filtered by a label selector", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			labels := []map[string]string{
+				{"env": "prod", "tier": "edge"},
+				{"env": "prod", "tier": "core", "deprecated": "true"},
+				{"env": "dev", "tier": "edge"},
+			}
+			for _, l := range labels {
+				registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+					OrganizationId:    dg.OrganizationId,
+					DeviceGroupId:     dg.DeviceGroupId,
+					DeviceGroupApiKey: dg.DeviceGroupApiKey,
+					DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, rand.Int()),
+					Labels:            l,
+				}
+				_, err := client.RegisterDevice(context.Background(), registerRequest)
+				gomega.Expect(err).To(gomega.Succeed())
+			}
+
+			listRequest := &grpc_device_manager_go.ListDevicesRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				LabelSelector:  "env=prod,tier in (edge,core),!deprecated",
+			}
+			list, err := client.ListDevices(context.Background(), listRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(list.Devices)).Should(gomega.Equal(1))
+			gomega.Expect(list.Devices[0].Labels["tier"]).Should(gomega.Equal("edge"))
+
+			orgRequest := &grpc_device_manager_go.ListOrganizationDevicesRequest{
+				OrganizationId: dg.OrganizationId,
+				LabelSelector:  "tier=edge",
+			}
+			orgList, err := client.ListOrganizationDevices(context.Background(), orgRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(orgList.Devices)).Should(gomega.Equal(2))
+		})
+		ginkgo.It("should be able to paginate the list of devices", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			numDevices := 5
+			for i := 0; i < numDevices; i++ {
+				registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+					OrganizationId:    dg.OrganizationId,
+					DeviceGroupId:     dg.DeviceGroupId,
+					DeviceGroupApiKey: dg.DeviceGroupApiKey,
+					DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, i),
+				}
+				_, err := client.RegisterDevice(context.Background(), registerRequest)
+				gomega.Expect(err).To(gomega.Succeed())
+			}
+
+			listRequest := &grpc_device_manager_go.ListDevicesRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				PageSize:       2,
+				SortBy:         string(entities.SortByID),
+				Descending:     true,
+			}
+			retrieved := make([]string, 0)
+			for {
+				list, err := client.ListDevices(context.Background(), listRequest)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(len(list.Devices)).Should(gomega.BeNumerically("<=", 2))
+				for _, d := range list.Devices {
+					retrieved = append(retrieved, d.DeviceId)
+				}
+				if list.NextPageToken == "" {
+					break
+				}
+				listRequest.PageToken = list.NextPageToken
+			}
+			gomega.Expect(len(retrieved)).Should(gomega.Equal(numDevices))
+			gomega.Expect(retrieved[0]).Should(gomega.Equal(fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, numDevices-1)))
+		})
+		ginkgo.It("should be able to search devices in the organization", func() {
+			dg1 := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			dg2 := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			prefix := fmt.Sprintf("search-%d", rand.Int())
+			for i, dg := range []*grpc_device_manager_go.DeviceGroup{dg1, dg2} {
+				registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+					OrganizationId:    dg.OrganizationId,
+					DeviceGroupId:     dg.DeviceGroupId,
+					DeviceGroupApiKey: dg.DeviceGroupApiKey,
+					DeviceId:          fmt.Sprintf("%s-%d", prefix, i),
+					Labels:            map[string]string{"position": fmt.Sprintf("%d", i)},
+				}
+				_, err := client.RegisterDevice(context.Background(), registerRequest)
+				gomega.Expect(err).To(gomega.Succeed())
+			}
+
+			searchRequest := &grpc_device_manager_go.SearchDevicesRequest{
+				OrganizationId: targetOrganization.OrganizationId,
+				DeviceIdPrefix: prefix,
+			}
+			list, err := client.SearchDevices(context.Background(), searchRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(list.Devices)).Should(gomega.Equal(2))
+
+			searchRequest.LabelSelector = "position=1"
+			list, err = client.SearchDevices(context.Background(), searchRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(list.Devices)).Should(gomega.Equal(1))
+			gomega.Expect(list.Devices[0].DeviceGroupId).Should(gomega.Equal(dg2.DeviceGroupId))
+		})
 		ginkgo.It("should be able to add a label to a device", func() {
 			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
 			registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
@@ -435,126 +674,1830 @@ var _ = ginkgo.Describe("Device service", func() {
 		})
 	})
 
-	ginkgo.Context("interaction device group and device", func() {
-		ginkgo.PIt("should remove devices on device group removal", func() {
+	ginkgo.Context("bulk operations", func() {
+		ginkgo.It("should be able to disable the devices selected by their labels", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			for i := 0; i < 4; i++ {
+				registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+					OrganizationId:    dg.OrganizationId,
+					DeviceGroupId:     dg.DeviceGroupId,
+					DeviceGroupApiKey: dg.DeviceGroupApiKey,
+					DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, i),
+					Labels:            map[string]string{"even": fmt.Sprintf("%t", i%2 == 0)},
+				}
+				_, err := client.RegisterDevice(context.Background(), registerRequest)
+				gomega.Expect(err).To(gomega.Succeed())
+			}
+			bulkRequest := &grpc_device_manager_go.BulkDeviceOperationRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				LabelSelector:  "even=true",
+				Operation:      grpc_device_manager_go.BulkOperation_DISABLE,
+				DryRun:         true,
+			}
+			response, err := client.BulkDeviceOperation(context.Background(), bulkRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(response.Succeeded).Should(gomega.Equal(int32(2)))
 
-		})
-	})
+			bulkRequest.DryRun = false
+			response, err = client.BulkDeviceOperation(context.Background(), bulkRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(response.Succeeded).Should(gomega.Equal(int32(2)))
+			gomega.Expect(response.Failed).Should(gomega.Equal(int32(0)))
 
-	ginkgo.Context("Checking the device status", func() {
-		ginkgo.It("should be able to get the device (Status OFFLINE)", func() {
+			retrieved, err := client.GetDevice(context.Background(), &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       fmt.Sprintf("d-%s-0", dg.DeviceGroupId),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.Enabled).Should(gomega.BeFalse())
+		})
+		ginkgo.It("should report the devices that do not belong to the group", func() {
 			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
 			registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
 				OrganizationId:    dg.OrganizationId,
 				DeviceGroupId:     dg.DeviceGroupId,
 				DeviceGroupApiKey: dg.DeviceGroupApiKey,
 				DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, rand.Int()),
-				Labels:            nil,
 			}
 			added, err := client.RegisterDevice(context.Background(), registerRequest)
 			gomega.Expect(err).To(gomega.Succeed())
-			gomega.Expect(added).ShouldNot(gomega.BeNil())
-			gomega.Expect(added.DeviceApiKey).ShouldNot(gomega.BeNil())
 
-			// adding a ping
-			ping := entities.Latency{
+			bulkRequest := &grpc_device_manager_go.BulkDeviceOperationRequest{
 				OrganizationId: dg.OrganizationId,
 				DeviceGroupId:  dg.DeviceGroupId,
-				DeviceId:       registerRequest.DeviceId,
-				Latency:        30,
-				Inserted:       time.Now().Add(-time.Duration(4) * time.Minute).Unix(),
+				DeviceIds:      []string{added.DeviceId, uuid.New().String()},
+				Operation:      grpc_device_manager_go.BulkOperation_ADD_LABELS,
+				Labels:         map[string]string{"bulk": "true"},
 			}
-			err = latencyProvider.AddPingLatency(ping)
+			response, err := client.BulkDeviceOperation(context.Background(), bulkRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(response.Succeeded).Should(gomega.Equal(int32(1)))
+			gomega.Expect(response.Failed).Should(gomega.Equal(int32(1)))
+		})
+	})
+
+	ginkgo.Context("device import", func() {
+		ginkgo.It("should be able to import devices twice", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			content := fmt.Sprintf("device_id,labels\nd-%[1]s-1,env=prod\nd-%[1]s-2,env=dev\n,env=prod\n", dg.DeviceGroupId)
+			importRequest := &grpc_device_manager_go.ImportDevicesRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				Format:            grpc_device_manager_go.ImportFormat_CSV,
+				Content:           []byte(content),
+			}
+			response, err := client.ImportDevices(context.Background(), importRequest)
 			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(response.Created).Should(gomega.Equal(int32(2)))
+			gomega.Expect(response.Failed).Should(gomega.Equal(int32(1)))
 
-			toRetrieve := &grpc_device_go.DeviceId{
+			again, err := client.ImportDevices(context.Background(), importRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(again.Created).Should(gomega.Equal(int32(0)))
+			gomega.Expect(again.Existing).Should(gomega.Equal(int32(2)))
+			gomega.Expect(again.Results[0].DeviceApiKey).Should(gomega.Equal(response.Results[0].DeviceApiKey))
+		})
+	})
+
+	ginkgo.Context("export", func() {
+		exportApiKeys := func(ctx context.Context, dg *grpc_device_manager_go.DeviceGroup) error {
+			stream, err := client.ExportDevices(ctx, &grpc_device_manager_go.ExportDevicesRequest{
 				OrganizationId: dg.OrganizationId,
 				DeviceGroupId:  dg.DeviceGroupId,
-				DeviceId:       registerRequest.DeviceId,
+				IncludeApiKeys: true,
+			})
+			if err != nil {
+				return err
 			}
-			retrieved, err := client.GetDevice(context.Background(), toRetrieve)
+			for {
+				_, err = stream.Recv()
+				if err != nil {
+					break
+				}
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		ginkgo.It("should only export the API keys to signed administrators", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			admin := []string{grpc_authx_go.AccessPrimitive_ORG.String()}
+
+			md := entities.NewActorMetadata(testActorSecret, "admin", admin, time.Now())
+			err := exportApiKeys(metadata.NewOutgoingContext(context.Background(), md), dg)
 			gomega.Expect(err).To(gomega.Succeed())
-			gomega.Expect(retrieved.DeviceStatus).Should(gomega.Equal(grpc_device_manager_go.DeviceStatus_OFFLINE))
+
+			// unsigned identities are performed as anonymous
+			md = metadata.Pairs(entities.UserIdMetadataKey, "admin", entities.PrimitivesMetadataKey, admin[0])
+			err = exportApiKeys(metadata.NewOutgoingContext(context.Background(), md), dg)
+			gomega.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
+			md = entities.NewActorMetadata("other-secret", "admin", admin, time.Now())
+			err = exportApiKeys(metadata.NewOutgoingContext(context.Background(), md), dg)
+			gomega.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
 		})
-		ginkgo.It("should be able to get the device (Status ONLINE)", func() {
-			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+	})
+
+	ginkgo.Context("registration approval", func() {
+		var dg *grpc_device_manager_go.DeviceGroup
+		ginkgo.BeforeEach(func() {
+			addDGRequest := &grpc_device_manager_go.AddDeviceGroupRequest{
+				OrganizationId:            targetOrganization.OrganizationId,
+				Name:                      fmt.Sprintf("dg-%d", rand.Int()),
+				Enabled:                   true,
+				DefaultDeviceConnectivity: true,
+				ApprovalRequired:          true,
+			}
+			added, err := client.AddDeviceGroup(context.Background(), addDGRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(added.ApprovalRequired).Should(gomega.BeTrue())
+			dg = added
+		})
+		registerPending := func() *grpc_device_go.DeviceId {
 			registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
 				OrganizationId:    dg.OrganizationId,
 				DeviceGroupId:     dg.DeviceGroupId,
 				DeviceGroupApiKey: dg.DeviceGroupApiKey,
 				DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, rand.Int()),
-				Labels:            nil,
 			}
 			added, err := client.RegisterDevice(context.Background(), registerRequest)
 			gomega.Expect(err).To(gomega.Succeed())
-			gomega.Expect(added).ShouldNot(gomega.BeNil())
-			gomega.Expect(added.DeviceApiKey).ShouldNot(gomega.BeNil())
-
-			// adding a ping
-			ping := entities.Latency{
+			gomega.Expect(added.ApprovalPending).Should(gomega.BeTrue())
+			deviceID := &grpc_device_go.DeviceId{
 				OrganizationId: dg.OrganizationId,
 				DeviceGroupId:  dg.DeviceGroupId,
-				DeviceId:       registerRequest.DeviceId,
-				Latency:        30,
-				Inserted:       time.Now().Add(-time.Duration(2) * time.Minute).Unix(),
+				DeviceId:       added.DeviceId,
 			}
-			err = latencyProvider.AddPingLatency(ping)
+			retrieved, err := client.GetDevice(context.Background(), deviceID)
 			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.Enabled).Should(gomega.BeFalse())
+			return deviceID
+		}
+		ginkgo.It("should list and approve pending devices", func() {
+			deviceID := registerPending()
+			groupID := &grpc_device_go.DeviceGroupId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+			}
+			pending, err := client.ListPendingDevices(context.Background(), groupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(pending.Devices)).Should(gomega.Equal(1))
 
-			toRetrieve := &grpc_device_go.DeviceId{
+			approved, err := client.ApproveDevice(context.Background(), deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(approved.Enabled).Should(gomega.BeTrue())
+			pending, err = client.ListPendingDevices(context.Background(), groupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(pending.Devices).Should(gomega.BeEmpty())
+		})
+		ginkgo.It("should not enable a pending device through an update", func() {
+			deviceID := registerPending()
+			updateRequest := &grpc_device_manager_go.UpdateDeviceRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				Enabled:        true,
+			}
+			_, err := client.UpdateDevice(context.Background(), updateRequest)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should report pending devices in a dry run", func() {
+			deviceID := registerPending()
+			bulkRequest := &grpc_device_manager_go.BulkDeviceOperationRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceIds:      []string{deviceID.DeviceId},
+				Operation:      grpc_device_manager_go.BulkOperation_ENABLE,
+				DryRun:         true,
+			}
+			response, err := client.BulkDeviceOperation(context.Background(), bulkRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(response.Succeeded).Should(gomega.Equal(int32(0)))
+			gomega.Expect(response.Failed).Should(gomega.Equal(int32(1)))
+			gomega.Expect(response.Results[0].Error).ShouldNot(gomega.BeEmpty())
+		})
+		ginkgo.It("should not enable imported devices", func() {
+			content := fmt.Sprintf("device_id\nd-%s-import\n", dg.DeviceGroupId)
+			importRequest := &grpc_device_manager_go.ImportDevicesRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				Format:            grpc_device_manager_go.ImportFormat_CSV,
+				Content:           []byte(content),
+			}
+			response, err := client.ImportDevices(context.Background(), importRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(response.Created).Should(gomega.Equal(int32(1)))
+			gomega.Expect(response.Results[0].ApprovalPending).Should(gomega.BeTrue())
+
+			deviceID := &grpc_device_go.DeviceId{
 				OrganizationId: dg.OrganizationId,
 				DeviceGroupId:  dg.DeviceGroupId,
-				DeviceId:       registerRequest.DeviceId,
+				DeviceId:       response.Results[0].DeviceId,
 			}
-			retrieved, err := client.GetDevice(context.Background(), toRetrieve)
+			retrieved, err := client.GetDevice(context.Background(), deviceID)
 			gomega.Expect(err).To(gomega.Succeed())
-			gomega.Expect(retrieved.DeviceStatus).Should(gomega.Equal(grpc_device_manager_go.DeviceStatus_ONLINE))
+			gomega.Expect(retrieved.Enabled).Should(gomega.BeFalse())
+			pending, err := client.ListPendingDevices(context.Background(), &grpc_device_go.DeviceGroupId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(pending.Devices)).Should(gomega.Equal(1))
+
+			again, err := client.ImportDevices(context.Background(), importRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(again.Existing).Should(gomega.Equal(int32(1)))
+			gomega.Expect(again.Results[0].ApprovalPending).Should(gomega.BeTrue())
 		})
-		ginkgo.It("should be able to list devices with the correct status (ONLINE/OFFLINE)", func() {
+		ginkgo.It("should remove rejected devices", func() {
+			deviceID := registerPending()
+			success, err := client.RejectDevice(context.Background(), deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(success).ShouldNot(gomega.BeNil())
+			_, err = client.GetDevice(context.Background(), deviceID)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("registration tokens", func() {
+		ginkgo.It("should register devices with a token", func() {
 			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
-			for i := 1; i <= 2; i++ {
-				registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
-					OrganizationId:    dg.OrganizationId,
-					DeviceGroupId:     dg.DeviceGroupId,
-					DeviceGroupApiKey: dg.DeviceGroupApiKey,
-					DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, i),
-					Labels:            nil,
-				}
-				added, err := client.RegisterDevice(context.Background(), registerRequest)
-				gomega.Expect(err).To(gomega.Succeed())
-				gomega.Expect(added).ShouldNot(gomega.BeNil())
+			tokenRequest := &grpc_device_manager_go.AddRegistrationTokenRequest{
+				OrganizationId:  dg.OrganizationId,
+				DeviceGroupId:   dg.DeviceGroupId,
+				Expires:         time.Now().Add(time.Hour).Unix(),
+				MaxUses:         1,
+				DeviceIdPattern: "sensor-.*",
 			}
+			registrationToken, err := client.AddRegistrationToken(context.Background(), tokenRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(registrationToken.Token).ShouldNot(gomega.BeEmpty())
 
-			// add some pings (device1)
-			for i := 0; i <= 5; i++ {
-				ping := entities.Latency{
-					OrganizationId: dg.OrganizationId,
-					DeviceGroupId:  dg.DeviceGroupId,
-					DeviceId:       fmt.Sprintf("d-%s-1", dg.DeviceGroupId),
-					Latency:        30,
-					Inserted:       time.Now().Unix() + int64(i),
-				}
-				errLat := latencyProvider.AddPingLatency(ping)
-				gomega.Expect(errLat).To(gomega.Succeed())
+			registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				RegistrationToken: registrationToken.Token,
+				DeviceId:          fmt.Sprintf("camera-%d", rand.Int()),
 			}
-			// add a ping (expired ping for device2)
-			ping := entities.Latency{
+			_, err = client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+
+			registerRequest.DeviceId = fmt.Sprintf("sensor-%d", rand.Int())
+			added, err := client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(added.RegistrationTokenId).Should(gomega.Equal(registrationToken.TokenId))
+			retrieved, err := client.GetDevice(context.Background(), &grpc_device_go.DeviceId{
 				OrganizationId: dg.OrganizationId,
 				DeviceGroupId:  dg.DeviceGroupId,
-				DeviceId:       fmt.Sprintf("d-%s-2", dg.DeviceGroupId),
-				Latency:        30,
-				Inserted:       time.Now().Add(-time.Duration(5) * time.Hour).Unix(),
+				DeviceId:       added.DeviceId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.RegistrationTokenId).Should(gomega.Equal(registrationToken.TokenId))
+
+			// the token has been used the maximum number of times
+			registerRequest.DeviceId = fmt.Sprintf("sensor-%d", rand.Int())
+			_, err = client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should only return existing devices to the token that registered them", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			addToken := func() *grpc_device_manager_go.RegistrationToken {
+				registrationToken, err := client.AddRegistrationToken(context.Background(), &grpc_device_manager_go.AddRegistrationTokenRequest{
+					OrganizationId: dg.OrganizationId,
+					DeviceGroupId:  dg.DeviceGroupId,
+					Expires:        time.Now().Add(time.Hour).Unix(),
+					MaxUses:        1,
+				})
+				gomega.Expect(err).To(gomega.Succeed())
+				return registrationToken
 			}
-			errLat := latencyProvider.AddPingLatency(ping)
-			gomega.Expect(errLat).To(gomega.Succeed())
+			first := addToken()
+			second := addToken()
 
-			// get devices
+			registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				RegistrationToken: first.Token,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			}
+			added, err := client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			again, err := client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(again.AlreadyRegistered).Should(gomega.BeTrue())
+			gomega.Expect(again.DeviceApiKey).Should(gomega.Equal(added.DeviceApiKey))
+
+			// another token cannot obtain the credentials of the device
+			registerRequest.RegistrationToken = second.Token
+			_, err = client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should not register devices with a revoked token", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			tokenRequest := &grpc_device_manager_go.AddRegistrationTokenRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				Expires:        time.Now().Add(time.Hour).Unix(),
+			}
+			registrationToken, err := client.AddRegistrationToken(context.Background(), tokenRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = client.RevokeRegistrationToken(context.Background(), &grpc_device_manager_go.RegistrationTokenId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				TokenId:        registrationToken.TokenId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+
+			list, err := client.ListRegistrationTokens(context.Background(), &grpc_device_go.DeviceGroupId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(list.Tokens)).Should(gomega.Equal(1))
+			gomega.Expect(list.Tokens[0].Revoked).Should(gomega.BeTrue())
+			gomega.Expect(list.Tokens[0].Token).Should(gomega.BeEmpty())
+
+			registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				RegistrationToken: registrationToken.Token,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			}
+			_, err = client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("device deletion", func() {
+		var dg *grpc_device_manager_go.DeviceGroup
+		var deviceID *grpc_device_go.DeviceId
+		ginkgo.BeforeEach(func() {
+			dg = CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			deviceID = &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+			}
+			_, err = client.RemoveDevice(context.Background(), deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should hide deleted devices", func() {
+			_, err := client.GetDevice(context.Background(), deviceID)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			list, err := client.ListDevices(context.Background(), &grpc_device_manager_go.ListDevicesRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(list.Devices).Should(gomega.BeEmpty())
+			deleted, err := client.ListDeletedDevices(context.Background(), &grpc_device_go.DeviceGroupId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(deleted.Devices)).Should(gomega.Equal(1))
+		})
+		ginkgo.It("should not modify deleted devices", func() {
+			_, err := client.AddLabelToDevice(context.Background(), &grpc_device_manager_go.DeviceLabelRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				Labels:         map[string]string{"env": "prod"},
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			_, err = client.UpdateDeviceLocation(context.Background(), &grpc_device_manager_go.UpdateDeviceLocationRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				Location:       &grpc_inventory_go.InventoryLocation{Geolocation: "40.4168,-3.7038"},
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			response, err := client.BulkDeviceOperation(context.Background(), &grpc_device_manager_go.BulkDeviceOperationRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceIds:      []string{deviceID.DeviceId},
+				Operation:      grpc_device_manager_go.BulkOperation_ENABLE,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(response.Failed).Should(gomega.Equal(int32(1)))
+		})
+		ginkgo.It("should restore deleted devices", func() {
+			restored, err := client.RestoreDevice(context.Background(), deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(restored.Enabled).Should(gomega.BeTrue())
+			_, err = client.GetDevice(context.Background(), deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should purge deleted devices", func() {
+			derr := metricsProvider.AddSamples([]*entities.MetricSample{{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				Name:           "temperature",
+				Timestamp:      time.Now().Unix(),
+				Value:          21.5,
+			}})
+			gomega.Expect(derr).To(gomega.Succeed())
+			_, err := client.PurgeDevice(context.Background(), deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = client.RestoreDevice(context.Background(), deviceID)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			_, err = deviceClient.GetDevice(context.Background(), deviceID)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			last, derr := metricsProvider.GetLastValues(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId, nil)
+			gomega.Expect(derr).To(gomega.Succeed())
+			gomega.Expect(last).Should(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("device attributes", func() {
+		var dg *grpc_device_manager_go.DeviceGroup
+		var deviceID *grpc_device_go.DeviceId
+		ginkgo.BeforeEach(func() {
+			dg = CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			deviceID = &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+			}
+		})
+		ginkgo.It("should set, get and remove the attributes of a device", func() {
+			attributes, err := client.SetDeviceAttributes(context.Background(), &grpc_device_manager_go.SetDeviceAttributesRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				Attributes: []*grpc_device_manager_go.DeviceAttribute{
+					{Name: "battery_level", Type: grpc_device_manager_go.AttributeType_NUMBER, NumberValue: 15},
+					{Name: "outdoor", Type: grpc_device_manager_go.AttributeType_BOOL, BoolValue: true},
+				},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(attributes.Attributes)).Should(gomega.Equal(2))
+
+			retrieved, err := client.GetDevice(context.Background(), deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(retrieved.Attributes)).Should(gomega.Equal(2))
+
+			_, err = client.RemoveDeviceAttributes(context.Background(), &grpc_device_manager_go.RemoveDeviceAttributesRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				Names:          []string{"outdoor"},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			attributes, err = client.GetDeviceAttributes(context.Background(), deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(attributes.Attributes)).Should(gomega.Equal(1))
+		})
+		ginkgo.It("should reject attributes that do not follow the organization schema", func() {
+			_, err := client.SetAttributeDefinition(context.Background(), &grpc_device_manager_go.AttributeDefinition{
+				OrganizationId: targetOrganization.OrganizationId,
+				Name:           "battery_level",
+				Type:           grpc_device_manager_go.AttributeType_NUMBER,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			request := &grpc_device_manager_go.SetDeviceAttributesRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				Attributes: []*grpc_device_manager_go.DeviceAttribute{
+					{Name: "battery_level", Type: grpc_device_manager_go.AttributeType_STRING, StringValue: "low"},
+				},
+			}
+			_, err = client.SetDeviceAttributes(context.Background(), request)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			request.Attributes[0].Name = "owner"
+			_, err = client.SetDeviceAttributes(context.Background(), request)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+
+			_, err = client.RemoveAttributeDefinition(context.Background(), &grpc_device_manager_go.AttributeDefinitionId{
+				OrganizationId: targetOrganization.OrganizationId,
+				Name:           "battery_level",
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = client.SetDeviceAttributes(context.Background(), request)
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should filter the device listings by attributes", func() {
+			_, err := client.SetDeviceAttributes(context.Background(), &grpc_device_manager_go.SetDeviceAttributesRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				Attributes: []*grpc_device_manager_go.DeviceAttribute{
+					{Name: "battery_level", Type: grpc_device_manager_go.AttributeType_NUMBER, NumberValue: 15},
+				},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+
+			listRequest := &grpc_device_manager_go.ListDevicesRequest{
+				OrganizationId:  dg.OrganizationId,
+				DeviceGroupId:   dg.DeviceGroupId,
+				AttributeFilter: "battery_level<20",
+			}
+			list, err := client.ListDevices(context.Background(), listRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(list.Devices)).Should(gomega.Equal(1))
+			gomega.Expect(list.Devices[0].DeviceId).Should(gomega.Equal(deviceID.DeviceId))
+
+			listRequest.AttributeFilter = "!battery_level"
+			list, err = client.ListDevices(context.Background(), listRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(list.Devices)).Should(gomega.Equal(1))
+			gomega.Expect(list.Devices[0].DeviceId).ShouldNot(gomega.Equal(deviceID.DeviceId))
+
+			listRequest.AttributeFilter = "battery_level<"
+			_, err = client.ListDevices(context.Background(), listRequest)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("label validation", func() {
+		var dg *grpc_device_manager_go.DeviceGroup
+		var adminCtx context.Context
+		ginkgo.BeforeEach(func() {
+			dg = CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			md := entities.NewActorMetadata(testActorSecret, "admin",
+				[]string{grpc_authx_go.AccessPrimitive_ORG.String()}, time.Now())
+			adminCtx = metadata.NewOutgoingContext(context.Background(), md)
+		})
+		ginkgo.It("should reject labels with an invalid syntax", func() {
+			_, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+				Labels:            map[string]string{"": "value"},
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			_, err = client.AddDeviceGroup(context.Background(), &grpc_device_manager_go.AddDeviceGroupRequest{
+				OrganizationId: targetOrganization.OrganizationId,
+				Name:           fmt.Sprintf("dg-%d", rand.Int()),
+				Labels:         map[string]string{"env": "prod env"},
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should only allow administrators to set reserved labels", func() {
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			request := &grpc_device_manager_go.DeviceLabelRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+				Labels:         map[string]string{"nalej.com/managed-by": "operator"},
+			}
+			_, err = client.AddLabelToDevice(context.Background(), request)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			_, err = client.AddLabelToDevice(adminCtx, request)
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should only accept the label keys allowed in the organization", func() {
+			policy := &grpc_device_manager_go.LabelPolicy{
+				OrganizationId: targetOrganization.OrganizationId,
+				AllowedKeys:    []string{"env"},
+			}
+			_, err := client.SetLabelPolicy(context.Background(), policy)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			_, err = client.SetLabelPolicy(adminCtx, policy)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			request := &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+				Labels:            map[string]string{"tier": "edge"},
+			}
+			_, err = client.RegisterDevice(context.Background(), request)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			request.Labels = map[string]string{"env": "prod"}
+			_, err = client.RegisterDevice(context.Background(), request)
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("geospatial queries", func() {
+		var dg *grpc_device_manager_go.DeviceGroup
+		locate := func(geolocation string) *grpc_device_manager_go.Device {
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			updated, err := client.UpdateDeviceLocation(context.Background(), &grpc_device_manager_go.UpdateDeviceLocationRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+				Location:       &grpc_inventory_go.InventoryLocation{Geolocation: geolocation},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			return updated
+		}
+		ginkgo.BeforeEach(func() {
+			dg = CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+		})
+		ginkgo.It("should reject invalid coordinates", func() {
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = client.UpdateDeviceLocation(context.Background(), &grpc_device_manager_go.UpdateDeviceLocationRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+				Location:       &grpc_inventory_go.InventoryLocation{Geolocation: "Madrid"},
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should list the devices of a group by location", func() {
+			near := locate("40.4168,-3.7038")
+			far := locate("40.4500,-3.6900")
+			locate("48.8566,2.3522")
+
+			radius, err := client.ListDevicesInRadius(context.Background(), &grpc_device_manager_go.ListDevicesInRadiusRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				Center:         &grpc_device_manager_go.GeoPoint{Latitude: 40.4170, Longitude: -3.7040},
+				RadiusMeters:   5000,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(radius.Devices)).Should(gomega.Equal(2))
+			gomega.Expect(radius.Devices[0].DeviceId).Should(gomega.Equal(near.DeviceId))
+			gomega.Expect(radius.Devices[1].DeviceId).Should(gomega.Equal(far.DeviceId))
+
+			box, err := client.ListDevicesInBoundingBox(context.Background(), &grpc_device_manager_go.ListDevicesInBoundingBoxRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				SouthWest:      &grpc_device_manager_go.GeoPoint{Latitude: 40, Longitude: -4},
+				NorthEast:      &grpc_device_manager_go.GeoPoint{Latitude: 40.43, Longitude: -3.5},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(box.Devices)).Should(gomega.Equal(1))
+			gomega.Expect(box.Devices[0].DeviceId).Should(gomega.Equal(near.DeviceId))
+
+			polygon, err := client.ListDevicesInPolygon(context.Background(), &grpc_device_manager_go.ListDevicesInPolygonRequest{
+				OrganizationId: dg.OrganizationId,
+				Vertices: []*grpc_device_manager_go.GeoPoint{
+					{Latitude: 40, Longitude: -4}, {Latitude: 41, Longitude: -4}, {Latitude: 41, Longitude: -3}, {Latitude: 40, Longitude: -3},
+				},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			found := make(map[string]bool, 0)
+			for _, d := range polygon.Devices {
+				found[d.DeviceId] = true
+			}
+			gomega.Expect(found[near.DeviceId]).Should(gomega.BeTrue())
+			gomega.Expect(found[far.DeviceId]).Should(gomega.BeTrue())
+		})
+		ginkgo.It("should not list removed devices", func() {
+			located := locate("40.4168,-3.7038")
+			_, err := client.RemoveDevice(context.Background(), &grpc_device_go.DeviceId{
+				OrganizationId: located.OrganizationId,
+				DeviceGroupId:  located.DeviceGroupId,
+				DeviceId:       located.DeviceId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			radius, err := client.ListDevicesInRadius(context.Background(), &grpc_device_manager_go.ListDevicesInRadiusRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				Center:         &grpc_device_manager_go.GeoPoint{Latitude: 40.4168, Longitude: -3.7038},
+				RadiusMeters:   100,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(radius.Devices).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("location history and geofences", func() {
+		var dg *grpc_device_manager_go.DeviceGroup
+		var deviceID string
+		move := func(geolocation string) {
+			_, err := client.UpdateDeviceLocation(context.Background(), &grpc_device_manager_go.UpdateDeviceLocationRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       deviceID,
+				Location:       &grpc_inventory_go.InventoryLocation{Geolocation: geolocation},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			// history entries are stored with a precision of seconds
+			time.Sleep(time.Second)
+		}
+		ginkgo.BeforeEach(func() {
+			dg = CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			deviceID = added.DeviceId
+		})
+		ginkgo.It("should store the location history of a device", func() {
+			move("40.4168,-3.7038")
+			move("48.8566,2.3522")
+			history, err := client.ListLocationHistory(context.Background(), &grpc_device_manager_go.LocationHistoryRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       deviceID,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(history.Locations)).Should(gomega.Equal(2))
+			gomega.Expect(history.Locations[0].Location.Latitude).Should(gomega.Equal(48.8566))
+		})
+		ginkgo.It("should produce events when a device enters or leaves a geofence", func() {
+			fence, err := client.AddGeofence(context.Background(), &grpc_device_manager_go.AddGeofenceRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				Name:           "madrid",
+				Shape:          grpc_device_manager_go.GeofenceShape_CIRCLE,
+				Center:         &grpc_device_manager_go.GeoPoint{Latitude: 40.4168, Longitude: -3.7038},
+				RadiusMeters:   10000,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			fences, err := client.ListGeofences(context.Background(), &grpc_device_go.DeviceGroupId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(fences.Geofences)).Should(gomega.Equal(1))
+
+			move("48.8566,2.3522")
+			move("40.4170,-3.7040")
+			move("40.4500,-3.6900")
+			move("48.8566,2.3522")
+			events, err := client.ListGeofenceEvents(context.Background(), &grpc_device_manager_go.GeofenceEventsRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(events.Events)).Should(gomega.Equal(2))
+			gomega.Expect(events.Events[0].EventType).Should(gomega.Equal(grpc_device_manager_go.GeofenceEventType_EXIT))
+			gomega.Expect(events.Events[1].EventType).Should(gomega.Equal(grpc_device_manager_go.GeofenceEventType_ENTER))
+			gomega.Expect(events.Events[1].GeofenceId).Should(gomega.Equal(fence.GeofenceId))
+
+			_, err = client.RemoveGeofence(context.Background(), &grpc_device_manager_go.GeofenceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				GeofenceId:     fence.GeofenceId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("asset info updates", func() {
+		ginkgo.It("should update the asset info of a device and record the changes", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+				AssetInfo: &grpc_inventory_go.AssetInfo{
+					Os:      &grpc_inventory_go.OperatingSystemInfo{Name: "linux", Version: "4.19"},
+					Storage: []*grpc_inventory_go.StorageHardwareInfo{{Type: "ssd", TotalCapacity: 32}},
+				},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = client.UpdateDeviceAssetInfo(context.Background(), &grpc_device_manager_go.UpdateDeviceAssetInfoRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+
+			updated, err := client.UpdateDeviceAssetInfo(context.Background(), &grpc_device_manager_go.UpdateDeviceAssetInfoRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+				UpdateOs:       true,
+				Os:             &grpc_inventory_go.OperatingSystemInfo{Name: "linux", Version: "5.4"},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(updated.AssetInfo.Os.Version).Should(gomega.Equal("5.4"))
+			gomega.Expect(updated.AssetInfo.Storage).To(gomega.HaveLen(1))
+
+			history, err := client.ListAssetInfoHistory(context.Background(), &grpc_device_manager_go.AssetInfoHistoryRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(history.Changes)).Should(gomega.Equal(1))
+			gomega.Expect(history.Changes[0].Previous["os.version"]).Should(gomega.Equal("4.19"))
+			gomega.Expect(history.Changes[0].Current["os.version"]).Should(gomega.Equal("5.4"))
+		})
+	})
+
+	ginkgo.Context("device twins", func() {
+		ginkgo.It("should compute the delta between the desired and reported state", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			deviceID := &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+			}
+
+			twin, err := client.PatchDesiredState(context.Background(), &grpc_device_manager_go.PatchDesiredStateRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				Patch:          `{"firmware": "2.0", "led": true}`,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(twin.DesiredVersion).Should(gomega.Equal(int64(1)))
+			gomega.Expect(twin.Delta).Should(gomega.MatchJSON(`{"firmware": "2.0", "led": true}`))
+
+			_, err = client.ReportDeviceState(context.Background(), &grpc_device_manager_go.ReportDeviceStateRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				DeviceApiKey:   uuid.New().String(),
+				Patch:          `{"firmware": "2.0"}`,
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+
+			twin, err = client.ReportDeviceState(context.Background(), &grpc_device_manager_go.ReportDeviceStateRequest{
+				OrganizationId: deviceID.OrganizationId,
+				DeviceGroupId:  deviceID.DeviceGroupId,
+				DeviceId:       deviceID.DeviceId,
+				DeviceApiKey:   added.DeviceApiKey,
+				Patch:          `{"firmware": "2.0", "uptime": 10}`,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(twin.ReportedVersion).Should(gomega.Equal(int64(1)))
+			gomega.Expect(twin.Delta).Should(gomega.MatchJSON(`{"led": true}`))
+
+			retrieved, err := client.GetDeviceTwin(context.Background(), deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.Reported).Should(gomega.MatchJSON(`{"firmware": "2.0", "uptime": 10}`))
+		})
+		ginkgo.It("should notify the changes to the watchers", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			deviceID := &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			stream, err := client.WatchDeviceTwin(ctx, deviceID)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			go func() {
+				defer ginkgo.GinkgoRecover()
+				// wait until the watcher is subscribed
+				time.Sleep(200 * time.Millisecond)
+				_, err := client.PatchDesiredState(context.Background(), &grpc_device_manager_go.PatchDesiredStateRequest{
+					OrganizationId: deviceID.OrganizationId,
+					DeviceGroupId:  deviceID.DeviceGroupId,
+					DeviceId:       deviceID.DeviceId,
+					Patch:          `{"led": true}`,
+				})
+				gomega.Expect(err).To(gomega.Succeed())
+			}()
+			change, err := stream.Recv()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(change.ChangeType).Should(gomega.Equal(grpc_device_manager_go.DeviceTwinChangeType_DESIRED))
+			gomega.Expect(change.Twin.Desired).Should(gomega.MatchJSON(`{"led": true}`))
+		})
+	})
+
+	ginkgo.Context("command queue", func() {
+		ginkgo.It("should deliver commands and record their results", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			devices := make([]*grpc_device_manager_go.RegisterResponse, 0)
+			for i := 0; i < 2; i++ {
+				added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+					OrganizationId:    dg.OrganizationId,
+					DeviceGroupId:     dg.DeviceGroupId,
+					DeviceGroupApiKey: dg.DeviceGroupApiKey,
+					DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+				})
+				gomega.Expect(err).To(gomega.Succeed())
+				devices = append(devices, added)
+			}
+
+			queued, err := client.EnqueueCommand(context.Background(), &grpc_device_manager_go.EnqueueCommandRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				Name:           "reboot",
+				Payload:        `{"delay": 10}`,
+				Ttl:            3600,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(queued.Queued).Should(gomega.Equal(int32(2)))
+
+			_, err = client.PollCommands(context.Background(), &grpc_device_manager_go.PollCommandsRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       devices[0].DeviceId,
+				DeviceApiKey:   uuid.New().String(),
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+
+			polled, err := client.PollCommands(context.Background(), &grpc_device_manager_go.PollCommandsRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       devices[0].DeviceId,
+				DeviceApiKey:   devices[0].DeviceApiKey,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(polled.Commands)).Should(gomega.Equal(1))
+			gomega.Expect(polled.Commands[0].Status).Should(gomega.Equal(grpc_device_manager_go.CommandStatus_DELIVERED))
+
+			_, err = client.AcknowledgeCommand(context.Background(), &grpc_device_manager_go.AcknowledgeCommandRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       devices[0].DeviceId,
+				DeviceApiKey:   devices[0].DeviceApiKey,
+				CommandId:      polled.Commands[0].CommandId,
+				Success:        true,
+				Result:         "rebooted",
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			commands, err := client.ListCommands(context.Background(), &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       devices[0].DeviceId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(commands.Commands[0].Status).Should(gomega.Equal(grpc_device_manager_go.CommandStatus_SUCCEEDED))
+			gomega.Expect(commands.Commands[0].Result).Should(gomega.Equal("rebooted"))
+		})
+		ginkgo.It("should not deliver cancelled commands", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			queued, err := client.EnqueueCommand(context.Background(), &grpc_device_manager_go.EnqueueCommandRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceIds:      []string{added.DeviceId, "unknown"},
+				Name:           "rotate-key",
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(queued.Failed).Should(gomega.Equal(int32(1)))
+
+			commandID := &grpc_device_manager_go.CommandId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+			}
+			for _, r := range queued.Results {
+				if r.DeviceId == added.DeviceId {
+					commandID.CommandId = r.CommandId
+				}
+			}
+			_, err = client.CancelCommand(context.Background(), commandID)
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = client.CancelCommand(context.Background(), commandID)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+
+			polled, err := client.PollCommands(context.Background(), &grpc_device_manager_go.PollCommandsRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+				DeviceApiKey:   added.DeviceApiKey,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(polled.Commands).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("configuration distribution", func() {
+		ginkgo.It("should deliver the effective configuration and track the acknowledgements", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+				Labels:            map[string]string{"env": "dev"},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
 			deviceGroupID := &grpc_device_go.DeviceGroupId{
 				OrganizationId: dg.OrganizationId,
 				DeviceGroupId:  dg.DeviceGroupId,
 			}
+			fetch := &grpc_device_manager_go.GetEffectiveConfigRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+				DeviceApiKey:   added.DeviceApiKey,
+			}
+			_, err = client.GetEffectiveConfig(context.Background(), fetch)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+
+			published, err := client.PublishConfig(context.Background(), &grpc_device_manager_go.PublishConfigRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				Content:        `{"interval": 60, "log": "info"}`,
+				Overlays: []*grpc_device_manager_go.ConfigOverlay{
+					{LabelSelector: "env=dev", Content: `{"log": "debug"}`},
+				},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(published.Version).Should(gomega.Equal(int64(1)))
+
+			effective, err := client.GetEffectiveConfig(context.Background(), fetch)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(effective.Content).Should(gomega.MatchJSON(`{"interval": 60, "log": "debug"}`))
+			fetch.IfNoneMatch = effective.Etag
+			cached, err := client.GetEffectiveConfig(context.Background(), fetch)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(cached.NotModified).To(gomega.BeTrue())
+			gomega.Expect(cached.Content).Should(gomega.BeEmpty())
+
+			_, err = client.AcknowledgeConfig(context.Background(), &grpc_device_manager_go.AcknowledgeConfigRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+				DeviceApiKey:   added.DeviceApiKey,
+				Version:        effective.Version,
+				Etag:           effective.Etag,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			acknowledgements, err := client.ListConfigAcknowledgements(context.Background(), deviceGroupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(acknowledgements.Acknowledgements)).Should(gomega.Equal(1))
+			gomega.Expect(acknowledgements.Acknowledgements[0].Current).To(gomega.BeTrue())
+
+			_, err = client.PublishConfig(context.Background(), &grpc_device_manager_go.PublishConfigRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				Content:        `{"interval": 30}`,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			acknowledgements, err = client.ListConfigAcknowledgements(context.Background(), deviceGroupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(acknowledgements.Acknowledgements[0].Current).To(gomega.BeFalse())
+
+			rolledBack, err := client.RollbackConfig(context.Background(), &grpc_device_manager_go.ConfigVersionId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				Version:        1,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(rolledBack.Active).To(gomega.BeTrue())
+			cached, err = client.GetEffectiveConfig(context.Background(), fetch)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(cached.NotModified).To(gomega.BeTrue())
+
+			versions, err := client.ListConfigVersions(context.Background(), deviceGroupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(versions.Configs)).Should(gomega.Equal(2))
+			gomega.Expect(versions.Configs[1].Active).To(gomega.BeTrue())
+		})
+	})
+
+	ginkgo.Context("rollout campaigns", func() {
+		// registerDevices registers a number of devices in a device group
+		registerDevices := func(dg *grpc_device_manager_go.DeviceGroup, number int) map[string]*grpc_device_manager_go.RegisterResponse {
+			devices := make(map[string]*grpc_device_manager_go.RegisterResponse, 0)
+			for i := 0; i < number; i++ {
+				added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+					OrganizationId:    dg.OrganizationId,
+					DeviceGroupId:     dg.DeviceGroupId,
+					DeviceGroupApiKey: dg.DeviceGroupApiKey,
+					DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+				})
+				gomega.Expect(err).To(gomega.Succeed())
+				devices[added.DeviceId] = added
+			}
+			return devices
+		}
+		// acknowledgeUpdate polls the update command of a device and reports its result
+		acknowledgeUpdate := func(device *grpc_device_manager_go.RegisterResponse, success bool) {
+			polled, err := client.PollCommands(context.Background(), &grpc_device_manager_go.PollCommandsRequest{
+				OrganizationId: device.OrganizationId,
+				DeviceGroupId:  device.DeviceGroupId,
+				DeviceId:       device.DeviceId,
+				DeviceApiKey:   device.DeviceApiKey,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(polled.Commands)).Should(gomega.Equal(1))
+			gomega.Expect(polled.Commands[0].Name).Should(gomega.Equal(entities.FirmwareUpdateCommand))
+			_, err = client.AcknowledgeCommand(context.Background(), &grpc_device_manager_go.AcknowledgeCommandRequest{
+				OrganizationId: device.OrganizationId,
+				DeviceGroupId:  device.DeviceGroupId,
+				DeviceId:       device.DeviceId,
+				DeviceApiKey:   device.DeviceApiKey,
+				CommandId:      polled.Commands[0].CommandId,
+				Success:        success,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		// forgetCampaignDevice creates a campaign for a device group with a single device, and then marks the device as
+		// pending as if its progress had not been stored after queuing its command. It returns the forgotten command.
+		forgetCampaignDevice := func(dg *grpc_device_manager_go.DeviceGroup) (*grpc_device_manager_go.Campaign, string) {
+			created, err := client.CreateCampaign(context.Background(), &grpc_device_manager_go.CreateCampaignRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				Artifact:       "registry.nalej.com/firmware:1.2",
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			// the batch started a check period ago
+			stored, derr := campaignProvider.GetCampaign(created.OrganizationId, created.DeviceGroupId, created.CampaignId)
+			gomega.Expect(derr).To(gomega.Succeed())
+			stored.BatchStarted -= int64(CampaignCheckPeriod.Seconds())
+			applied, derr := campaignProvider.UpdateCampaign(*stored, stored.Revision)
+			gomega.Expect(derr).To(gomega.Succeed())
+			gomega.Expect(applied).Should(gomega.BeTrue())
+			progress, derr := campaignProvider.ListCampaignDevices(created.OrganizationId, created.DeviceGroupId, created.CampaignId)
+			gomega.Expect(derr).To(gomega.Succeed())
+			gomega.Expect(len(progress)).Should(gomega.Equal(1))
+			commandID := progress[0].CommandId
+			progress[0].Status = entities.CampaignDevicePending
+			progress[0].CommandId = ""
+			gomega.Expect(campaignProvider.SetCampaignDevice(*progress[0])).To(gomega.Succeed())
+			return created, commandID
+		}
+		// expectCampaignCommand checks that a device has a single command and that it is the one of the campaign
+		expectCampaignCommand := func(campaign *grpc_device_manager_go.Campaign, device *grpc_device_manager_go.RegisterResponse) string {
+			commands, err := client.ListCommands(context.Background(), &grpc_device_go.DeviceId{
+				OrganizationId: device.OrganizationId,
+				DeviceGroupId:  device.DeviceGroupId,
+				DeviceId:       device.DeviceId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(commands.Commands)).Should(gomega.Equal(1))
+			progress, err := client.ListCampaignDevices(context.Background(), &grpc_device_manager_go.CampaignId{
+				OrganizationId: campaign.OrganizationId,
+				DeviceGroupId:  campaign.DeviceGroupId,
+				CampaignId:     campaign.CampaignId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(progress.Devices)).Should(gomega.Equal(1))
+			gomega.Expect(progress.Devices[0].Status).Should(gomega.Equal(grpc_device_manager_go.CampaignDeviceStatus_UPDATING))
+			gomega.Expect(progress.Devices[0].CommandId).Should(gomega.Equal(commands.Commands[0].CommandId))
+			return commands.Commands[0].CommandId
+		}
+
+		ginkgo.It("should update the devices in batches while they are healthy", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			devices := registerDevices(dg, 2)
+			created, err := client.CreateCampaign(context.Background(), &grpc_device_manager_go.CreateCampaignRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				Name:              "firmware 1.2",
+				Artifact:          "registry.nalej.com/firmware:1.2",
+				BatchSize:         1,
+				ObservationPeriod: 1,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(created.Batches).Should(gomega.Equal(int32(2)))
+			gomega.Expect(created.Updating).Should(gomega.Equal(int32(1)))
+			campaignID := &grpc_device_manager_go.CampaignId{
+				OrganizationId: created.OrganizationId,
+				DeviceGroupId:  created.DeviceGroupId,
+				CampaignId:     created.CampaignId,
+			}
+
+			progress, err := client.ListCampaignDevices(context.Background(), campaignID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(progress.Devices)).Should(gomega.Equal(2))
+			first := progress.Devices[0]
+			gomega.Expect(first.Status).Should(gomega.Equal(grpc_device_manager_go.CampaignDeviceStatus_UPDATING))
+			acknowledgeUpdate(devices[first.DeviceId], true)
+			derr := latencyProvider.AddLastLatency(entities.Latency{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       first.DeviceId,
+				Latency:        10,
+				Inserted:       time.Now().Unix(),
+			})
+			gomega.Expect(derr).To(gomega.Succeed())
+
+			// wait for the observation period
+			time.Sleep(2 * time.Second)
+			gomega.Expect(manager.CheckCampaigns()).To(gomega.Succeed())
+			retrieved, err := client.GetCampaign(context.Background(), campaignID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.Status).Should(gomega.Equal(grpc_device_manager_go.CampaignStatus_RUNNING))
+			gomega.Expect(retrieved.CurrentBatch).Should(gomega.Equal(int32(1)))
+			gomega.Expect(retrieved.Succeeded).Should(gomega.Equal(int32(1)))
+			gomega.Expect(retrieved.Updating).Should(gomega.Equal(int32(1)))
+		})
+		ginkgo.It("should use the update already queued for a device", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			devices := registerDevices(dg, 1)
+			created, commandID := forgetCampaignDevice(dg)
+
+			gomega.Expect(manager.CheckCampaigns()).To(gomega.Succeed())
+			for _, device := range devices {
+				gomega.Expect(expectCampaignCommand(created, device)).Should(gomega.Equal(commandID))
+			}
+		})
+		ginkgo.It("should queue the update of a device without it", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			devices := registerDevices(dg, 1)
+			created, commandID := forgetCampaignDevice(dg)
+			for _, device := range devices {
+				derr := commandProvider.RemoveDeviceCommands(device.OrganizationId, device.DeviceGroupId, device.DeviceId)
+				gomega.Expect(derr).To(gomega.Succeed())
+			}
+
+			gomega.Expect(manager.CheckCampaigns()).To(gomega.Succeed())
+			for _, device := range devices {
+				gomega.Expect(expectCampaignCommand(created, device)).ShouldNot(gomega.Equal(commandID))
+			}
+		})
+		ginkgo.It("should halt campaigns with unhealthy devices", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			devices := registerDevices(dg, 1)
+			created, err := client.CreateCampaign(context.Background(), &grpc_device_manager_go.CreateCampaignRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				Artifact:       "registry.nalej.com/firmware:1.2",
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			campaignID := &grpc_device_manager_go.CampaignId{
+				OrganizationId: created.OrganizationId,
+				DeviceGroupId:  created.DeviceGroupId,
+				CampaignId:     created.CampaignId,
+			}
+			for _, device := range devices {
+				acknowledgeUpdate(device, false)
+			}
+
+			gomega.Expect(manager.CheckCampaigns()).To(gomega.Succeed())
+			retrieved, err := client.GetCampaign(context.Background(), campaignID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.Status).Should(gomega.Equal(grpc_device_manager_go.CampaignStatus_HALTED))
+			gomega.Expect(retrieved.Failed).Should(gomega.Equal(int32(1)))
+
+			_, err = client.PauseCampaign(context.Background(), campaignID)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			resumed, err := client.ResumeCampaign(context.Background(), campaignID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(resumed.Status).Should(gomega.Equal(grpc_device_manager_go.CampaignStatus_RUNNING))
+			aborted, err := client.AbortCampaign(context.Background(), campaignID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(aborted.Status).Should(gomega.Equal(grpc_device_manager_go.CampaignStatus_ABORTED))
+			_, err = client.AbortCampaign(context.Background(), campaignID)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("audit log", func() {
+		var adminCtx context.Context
+		ginkgo.BeforeEach(func() {
+			md := entities.NewActorMetadata(testActorSecret, "auditor",
+				[]string{grpc_authx_go.AccessPrimitive_ORG.String()}, time.Now())
+			adminCtx = metadata.NewOutgoingContext(context.Background(), md)
+		})
+		ginkgo.It("should record the changes of a device and its actor", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = client.AddLabelToDevice(adminCtx, &grpc_device_manager_go.DeviceLabelRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+				Labels:         map[string]string{"env": "prod"},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+
+			entries, err := client.ListAuditEntries(adminCtx, &grpc_device_manager_go.AuditEntriesRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(entries.Entries)).Should(gomega.Equal(2))
+			labelEntry := entries.Entries[0]
+			if labelEntry.Operation != "AddLabelToDevice" {
+				labelEntry = entries.Entries[1]
+			}
+			gomega.Expect(labelEntry.Operation).Should(gomega.Equal("AddLabelToDevice"))
+			gomega.Expect(labelEntry.Actor).Should(gomega.Equal("auditor"))
+			gomega.Expect(labelEntry.Outcome).Should(gomega.Equal(grpc_device_manager_go.AuditOutcome_SUCCESS))
+			gomega.Expect(labelEntry.Current).Should(gomega.HaveKeyWithValue("labels.env", "prod"))
+			for _, value := range labelEntry.Current {
+				gomega.Expect(value).ShouldNot(gomega.Equal(added.DeviceApiKey))
+			}
+		})
+		ginkgo.It("should record the failed operations", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			_, err := client.UpdateDevice(adminCtx, &grpc_device_manager_go.UpdateDeviceRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       fmt.Sprintf("d-%d", rand.Int()),
+				Enabled:        true,
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+
+			entries, err := client.ListAuditEntries(adminCtx, &grpc_device_manager_go.AuditEntriesRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(entries.Entries)).Should(gomega.Equal(2))
+			gomega.Expect(entries.Entries[0].Outcome).Should(gomega.Equal(grpc_device_manager_go.AuditOutcome_FAILURE))
+			gomega.Expect(entries.Entries[0].Error).ShouldNot(gomega.BeEmpty())
+		})
+		ginkgo.It("should record an entry for each device of imports and bulk operations", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			deviceIDs := []string{fmt.Sprintf("d-%d", rand.Int()), fmt.Sprintf("d-%d", rand.Int())}
+			content := fmt.Sprintf("device_id\n%s\n%s\n", deviceIDs[0], deviceIDs[1])
+			_, err := client.ImportDevices(adminCtx, &grpc_device_manager_go.ImportDevicesRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				Format:            grpc_device_manager_go.ImportFormat_CSV,
+				Content:           []byte(content),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = client.BulkDeviceOperation(adminCtx, &grpc_device_manager_go.BulkDeviceOperationRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceIds:      deviceIDs,
+				Operation:      grpc_device_manager_go.BulkOperation_ADD_LABELS,
+				Labels:         map[string]string{"env": "prod"},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+
+			for _, deviceID := range deviceIDs {
+				entries, err := client.ListAuditEntries(adminCtx, &grpc_device_manager_go.AuditEntriesRequest{
+					OrganizationId: dg.OrganizationId,
+					DeviceGroupId:  dg.DeviceGroupId,
+					DeviceId:       deviceID,
+				})
+				gomega.Expect(err).To(gomega.Succeed())
+				operations := make([]string, 0, len(entries.Entries))
+				for _, entry := range entries.Entries {
+					gomega.Expect(entry.Actor).Should(gomega.Equal("auditor"))
+					gomega.Expect(entry.Outcome).Should(gomega.Equal(grpc_device_manager_go.AuditOutcome_SUCCESS))
+					operations = append(operations, entry.Operation)
+				}
+				gomega.Expect(operations).Should(gomega.ConsistOf("ImportDevices", "BulkDeviceOperation"))
+			}
+		})
+		ginkgo.It("should not record the devices that imports and bulk operations do not modify", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			deviceID := fmt.Sprintf("d-%d", rand.Int())
+			for i := 0; i < 2; i++ {
+				_, err := client.ImportDevices(adminCtx, &grpc_device_manager_go.ImportDevicesRequest{
+					OrganizationId:    dg.OrganizationId,
+					DeviceGroupId:     dg.DeviceGroupId,
+					DeviceGroupApiKey: dg.DeviceGroupApiKey,
+					Format:            grpc_device_manager_go.ImportFormat_CSV,
+					Content:           []byte(fmt.Sprintf("device_id\n%s\n", deviceID)),
+				})
+				gomega.Expect(err).To(gomega.Succeed())
+				_, err = client.BulkDeviceOperation(adminCtx, &grpc_device_manager_go.BulkDeviceOperationRequest{
+					OrganizationId: dg.OrganizationId,
+					DeviceGroupId:  dg.DeviceGroupId,
+					DeviceIds:      []string{deviceID},
+					Operation:      grpc_device_manager_go.BulkOperation_ADD_LABELS,
+					Labels:         map[string]string{"env": "prod"},
+				})
+				gomega.Expect(err).To(gomega.Succeed())
+			}
+
+			entries, err := client.ListAuditEntries(adminCtx, &grpc_device_manager_go.AuditEntriesRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       deviceID,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			operations := make([]string, 0, len(entries.Entries))
+			for _, entry := range entries.Entries {
+				operations = append(operations, entry.Operation)
+			}
+			gomega.Expect(operations).Should(gomega.ConsistOf("ImportDevices", "BulkDeviceOperation"))
+		})
+		ginkgo.It("should only allow administrators to read the audit log", func() {
+			_, err := client.ListAuditEntries(context.Background(), &grpc_device_manager_go.AuditEntriesRequest{
+				OrganizationId: targetOrganization.OrganizationId,
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			// unsigned identities are performed as anonymous
+			md := metadata.Pairs(entities.UserIdMetadataKey, "auditor",
+				entities.PrimitivesMetadataKey, grpc_authx_go.AccessPrimitive_ORG.String())
+			_, err = client.ListAuditEntries(metadata.NewOutgoingContext(context.Background(), md), &grpc_device_manager_go.AuditEntriesRequest{
+				OrganizationId: targetOrganization.OrganizationId,
+			})
+			gomega.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
+		})
+	})
+
+	ginkgo.Context("dynamic groups", func() {
+		// registerLabeledDevice registers a device in a group with a label that identifies the test
+		registerLabeledDevice := func(dg *grpc_device_manager_go.DeviceGroup, value string) *grpc_device_manager_go.RegisterResponse {
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%d", rand.Int()),
+				Labels:            map[string]string{"fleet": value},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			return added
+		}
+		ginkgo.It("should list the devices of several groups that match the selector", func() {
+			value := fmt.Sprintf("f%d", rand.Int())
+			first := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			second := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			registerLabeledDevice(first, value)
+			registerLabeledDevice(second, value)
+			registerLabeledDevice(second, "other")
+
+			group, err := client.AddDynamicGroup(context.Background(), &grpc_device_manager_go.AddDynamicGroupRequest{
+				OrganizationId: targetOrganization.OrganizationId,
+				Name:           "fleet",
+				LabelSelector:  "fleet=" + value,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(group.DynamicGroupId).ShouldNot(gomega.BeEmpty())
+
+			devices, err := client.ListDynamicGroupDevices(context.Background(), &grpc_device_manager_go.ListDynamicGroupDevicesRequest{
+				OrganizationId: group.OrganizationId,
+				DynamicGroupId: group.DynamicGroupId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(devices.Devices)).Should(gomega.Equal(2))
+
+			summary, err := client.GetDynamicGroupSummary(context.Background(), &grpc_device_manager_go.DynamicGroupId{
+				OrganizationId: group.OrganizationId,
+				DynamicGroupId: group.DynamicGroupId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(summary.TotalDevices).Should(gomega.Equal(int32(2)))
+			gomega.Expect(summary.OfflineDevices).Should(gomega.Equal(int32(2)))
+			gomega.Expect(len(summary.DeviceGroups)).Should(gomega.Equal(2))
+		})
+		ginkgo.It("should follow the label changes of the devices", func() {
+			value := fmt.Sprintf("f%d", rand.Int())
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added := registerLabeledDevice(dg, "other")
+			group, err := client.AddDynamicGroup(context.Background(), &grpc_device_manager_go.AddDynamicGroupRequest{
+				OrganizationId: targetOrganization.OrganizationId,
+				Name:           "fleet",
+				LabelSelector:  "fleet=" + value,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			dynamicGroupID := &grpc_device_manager_go.DynamicGroupId{
+				OrganizationId: group.OrganizationId,
+				DynamicGroupId: group.DynamicGroupId,
+			}
+
+			summary, err := client.GetDynamicGroupSummary(context.Background(), dynamicGroupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(summary.TotalDevices).Should(gomega.Equal(int32(0)))
+
+			_, err = client.AddLabelToDevice(context.Background(), &grpc_device_manager_go.DeviceLabelRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+				Labels:         map[string]string{"fleet": value},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			summary, err = client.GetDynamicGroupSummary(context.Background(), dynamicGroupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(summary.TotalDevices).Should(gomega.Equal(int32(1)))
+		})
+		ginkgo.It("should apply label operations to the members but not credential operations", func() {
+			value := fmt.Sprintf("f%d", rand.Int())
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added := registerLabeledDevice(dg, value)
+			group, err := client.AddDynamicGroup(context.Background(), &grpc_device_manager_go.AddDynamicGroupRequest{
+				OrganizationId: targetOrganization.OrganizationId,
+				Name:           "fleet",
+				LabelSelector:  "fleet=" + value,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+
+			response, err := client.DynamicGroupBulkOperation(context.Background(), &grpc_device_manager_go.DynamicGroupBulkOperationRequest{
+				OrganizationId: group.OrganizationId,
+				DynamicGroupId: group.DynamicGroupId,
+				Operation:      grpc_device_manager_go.BulkOperation_ADD_LABELS,
+				Labels:         map[string]string{"tier": "gold"},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(response.Succeeded).Should(gomega.Equal(int32(1)))
+			gomega.Expect(response.Results[0].DeviceGroupId).Should(gomega.Equal(dg.DeviceGroupId))
+
+			device, err := client.GetDevice(context.Background(), &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(device.Labels).Should(gomega.HaveKeyWithValue("tier", "gold"))
+
+			_, err = client.DynamicGroupBulkOperation(context.Background(), &grpc_device_manager_go.DynamicGroupBulkOperationRequest{
+				OrganizationId: group.OrganizationId,
+				DynamicGroupId: group.DynamicGroupId,
+				Operation:      grpc_device_manager_go.BulkOperation_DISABLE,
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should update and remove a dynamic group", func() {
+			group, err := client.AddDynamicGroup(context.Background(), &grpc_device_manager_go.AddDynamicGroupRequest{
+				OrganizationId: targetOrganization.OrganizationId,
+				Name:           "online",
+				FilterByStatus: true,
+				DeviceStatus:   grpc_device_manager_go.DeviceStatus_ONLINE,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			updated, err := client.UpdateDynamicGroup(context.Background(), &grpc_device_manager_go.UpdateDynamicGroupRequest{
+				OrganizationId: group.OrganizationId,
+				DynamicGroupId: group.DynamicGroupId,
+				Name:           "offline",
+				FilterByStatus: true,
+				DeviceStatus:   grpc_device_manager_go.DeviceStatus_OFFLINE,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(updated.DeviceStatus).Should(gomega.Equal(grpc_device_manager_go.DeviceStatus_OFFLINE))
+			gomega.Expect(updated.Created).Should(gomega.Equal(group.Created))
+
+			dynamicGroupID := &grpc_device_manager_go.DynamicGroupId{
+				OrganizationId: group.OrganizationId,
+				DynamicGroupId: group.DynamicGroupId,
+			}
+			_, err = client.RemoveDynamicGroup(context.Background(), dynamicGroupID)
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = client.GetDynamicGroup(context.Background(), dynamicGroupID)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should reject a dynamic group without criteria", func() {
+			_, err := client.AddDynamicGroup(context.Background(), &grpc_device_manager_go.AddDynamicGroupRequest{
+				OrganizationId: targetOrganization.OrganizationId,
+				Name:           "all",
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("reconciliation", func() {
+		ginkgo.It("should find and fix the credentials and latencies of removed devices", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			// a device that only exists in authx and in the latency store
+			deviceID := fmt.Sprintf("d-%d", rand.Int())
+			_, err := authxClient.AddDeviceCredentials(context.Background(), &grpc_authx_go.AddDeviceCredentialsRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       deviceID,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			derr := latencyProvider.AddLastLatency(entities.Latency{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       deviceID,
+				Latency:        10,
+				Inserted:       time.Now().Unix(),
+			})
+			gomega.Expect(derr).To(gomega.Succeed())
+
+			request := &grpc_device_manager_go.ReconcileRequest{OrganizationId: dg.OrganizationId}
+			report, err := client.ReconcileOrganization(context.Background(), request)
+			gomega.Expect(err).To(gomega.Succeed())
+			kinds := make([]grpc_device_manager_go.ReconcileIssueKind, 0)
+			for _, issue := range report.Issues {
+				if issue.DeviceId == deviceID {
+					gomega.Expect(issue.Fixed).Should(gomega.BeFalse())
+					kinds = append(kinds, issue.Kind)
+				}
+			}
+			gomega.Expect(kinds).Should(gomega.ConsistOf(grpc_device_manager_go.ReconcileIssueKind_DANGLING_DEVICE_CREDENTIALS,
+				grpc_device_manager_go.ReconcileIssueKind_ORPHAN_LATENCY))
+
+			// fixing the inconsistencies requires administrator privileges
+			request.Apply = true
+			_, err = client.ReconcileOrganization(context.Background(), request)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			md := entities.NewActorMetadata(testActorSecret, "admin",
+				[]string{grpc_authx_go.AccessPrimitive_ORG.String()}, time.Now())
+			report, err = client.ReconcileOrganization(metadata.NewOutgoingContext(context.Background(), md), request)
+			gomega.Expect(err).To(gomega.Succeed())
+			for _, issue := range report.Issues {
+				if issue.DeviceId == deviceID {
+					gomega.Expect(issue.Fixed).Should(gomega.BeTrue())
+				}
+			}
+			_, err = authxClient.GetDeviceCredentials(context.Background(), &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       deviceID,
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			latencies, derr := latencyProvider.GetGroupLastLatencies(dg.OrganizationId, dg.DeviceGroupId)
+			gomega.Expect(derr).To(gomega.Succeed())
+			gomega.Expect(latencies).Should(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("interaction device group and device", func() {
+		ginkgo.PIt("should remove devices on device group removal", func() {
+
+		})
+	})
+
+	ginkgo.Context("Checking the device status", func() {
+		ginkgo.It("should be able to get the device (Status OFFLINE)", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, rand.Int()),
+				Labels:            nil,
+			}
+			added, err := client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(added).ShouldNot(gomega.BeNil())
+			gomega.Expect(added.DeviceApiKey).ShouldNot(gomega.BeNil())
+
+			// adding a ping
+			ping := entities.Latency{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       registerRequest.DeviceId,
+				Latency:        30,
+				Inserted:       time.Now().Add(-time.Duration(4) * time.Minute).Unix(),
+			}
+			err = latencyProvider.AddPingLatency(ping)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			toRetrieve := &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       registerRequest.DeviceId,
+			}
+			retrieved, err := client.GetDevice(context.Background(), toRetrieve)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.DeviceStatus).Should(gomega.Equal(grpc_device_manager_go.DeviceStatus_OFFLINE))
+		})
+		ginkgo.It("should be able to get the device (Status ONLINE)", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, rand.Int()),
+				Labels:            nil,
+			}
+			added, err := client.RegisterDevice(context.Background(), registerRequest)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(added).ShouldNot(gomega.BeNil())
+			gomega.Expect(added.DeviceApiKey).ShouldNot(gomega.BeNil())
+
+			// adding a ping
+			ping := entities.Latency{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       registerRequest.DeviceId,
+				Latency:        30,
+				Inserted:       time.Now().Add(-time.Duration(2) * time.Minute).Unix(),
+			}
+			err = latencyProvider.AddPingLatency(ping)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			toRetrieve := &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       registerRequest.DeviceId,
+			}
+			retrieved, err := client.GetDevice(context.Background(), toRetrieve)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.DeviceStatus).Should(gomega.Equal(grpc_device_manager_go.DeviceStatus_ONLINE))
+		})
+		ginkgo.It("should return the health metrics of the last heartbeat", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			added, err := client.RegisterDevice(context.Background(), &grpc_device_manager_go.RegisterDeviceRequest{
+				OrganizationId:    dg.OrganizationId,
+				DeviceGroupId:     dg.DeviceGroupId,
+				DeviceGroupApiKey: dg.DeviceGroupApiKey,
+				DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, rand.Int()),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			toRetrieve := &grpc_device_go.DeviceId{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+			}
+			retrieved, err := client.GetDevice(context.Background(), toRetrieve)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.LastHeartbeat).Should(gomega.BeNil())
+
+			err = latencyProvider.AddLastLatency(entities.Latency{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       added.DeviceId,
+				Latency:        30,
+				Inserted:       time.Now().Unix(),
+				Metrics:        map[string]float64{string(entities.CPUUsage): 12.5},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			retrieved, err = client.GetDevice(context.Background(), toRetrieve)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(retrieved.LastHeartbeat.Latency).Should(gomega.Equal(int32(30)))
+			gomega.Expect(retrieved.LastHeartbeat.Metrics[0].Type).Should(gomega.Equal(grpc_device_manager_go.HealthMetricType_CPU_USAGE))
+		})
+		ginkgo.It("should be able to list devices with the correct status (ONLINE/OFFLINE)", func() {
+			dg := CreateDeviceGroup(client, targetOrganization.OrganizationId, true, true)
+			for i := 1; i <= 2; i++ {
+				registerRequest := &grpc_device_manager_go.RegisterDeviceRequest{
+					OrganizationId:    dg.OrganizationId,
+					DeviceGroupId:     dg.DeviceGroupId,
+					DeviceGroupApiKey: dg.DeviceGroupApiKey,
+					DeviceId:          fmt.Sprintf("d-%s-%d", dg.DeviceGroupId, i),
+					Labels:            nil,
+				}
+				added, err := client.RegisterDevice(context.Background(), registerRequest)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(added).ShouldNot(gomega.BeNil())
+			}
+
+			// add some pings (device1)
+			for i := 0; i <= 5; i++ {
+				ping := entities.Latency{
+					OrganizationId: dg.OrganizationId,
+					DeviceGroupId:  dg.DeviceGroupId,
+					DeviceId:       fmt.Sprintf("d-%s-1", dg.DeviceGroupId),
+					Latency:        30,
+					Inserted:       time.Now().Unix() + int64(i),
+				}
+				errLat := latencyProvider.AddPingLatency(ping)
+				gomega.Expect(errLat).To(gomega.Succeed())
+			}
+			// add a ping (expired ping for device2)
+			ping := entities.Latency{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+				DeviceId:       fmt.Sprintf("d-%s-2", dg.DeviceGroupId),
+				Latency:        30,
+				Inserted:       time.Now().Add(-time.Duration(5) * time.Hour).Unix(),
+			}
+			errLat := latencyProvider.AddPingLatency(ping)
+			gomega.Expect(errLat).To(gomega.Succeed())
+
+			// get devices
+			listRequest := &grpc_device_manager_go.ListDevicesRequest{
+				OrganizationId: dg.OrganizationId,
+				DeviceGroupId:  dg.DeviceGroupId,
+			}
 
-			list, err := client.ListDevices(context.Background(), deviceGroupID)
+			list, err := client.ListDevices(context.Background(), listRequest)
 			gomega.Expect(err).To(gomega.Succeed())
 			gomega.Expect(list).NotTo(gomega.BeNil())
 			for _, device := range list.Devices {
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/rs/zerolog/log"
+	"sync"
+)
+
+// ImportDevices registers the devices of an import file. The rows have been parsed and validated before, so
+// rows with errors are only reported. Devices that already exist in the group are not registered again and
+// their current credentials are returned, so that an import can be safely repeated. New devices follow the approval
+// policy of the group like any other registration. The labels of the rows are checked against the label policy of
+// the organization using the privileges of the actor, and each valid row of a new device is audited as a registration
+// of the device. Devices that already exist are not modified, so they are not audited.
+func (m *Manager) ImportDevices(request *grpc_device_manager_go.ImportDevicesRequest, rows []*entities.DeviceImportRow, actor *entities.Actor) (*grpc_device_manager_go.ImportDevicesResponse, error) {
+	err := m.deviceGroupLogin(request.OrganizationId, request.DeviceGroupApiKey)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := m.getLabelPolicy(request.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	admin := actor.IsAdmin()
+	deviceGroupID := &grpc_device_go.DeviceGroupId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+	}
+	devices, err := m.filterGroupDevices(deviceGroupID, nil)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		existing[d.DeviceId] = true
+	}
+
+	log.Debug().Int("rows", len(rows)).Msg("importing devices")
+	results := make([]*grpc_device_manager_go.ImportDeviceResult, len(rows))
+	sem := make(chan struct{}, m.bulkConcurrency)
+	var wg sync.WaitGroup
+	for i, row := range rows {
+		result := &grpc_device_manager_go.ImportDeviceResult{Line: int32(row.Line)}
+		results[i] = result
+		if row.Request != nil {
+			result.DeviceId = row.Request.DeviceId
+		}
+		if row.Error != nil {
+			result.Error = row.Error.Error()
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(row *entities.DeviceImportRow, exists bool, result *grpc_device_manager_go.ImportDeviceResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			audit := m.startAudit(actor, "ImportDevices", row.Request.OrganizationId, row.Request.DeviceGroupId, row.Request.DeviceId)
+			err := m.importDevice(row, exists, policy, admin, result)
+			if !exists {
+				if result.Created {
+					audit.setCurrent(registrationFields(row.Request, result.ApprovalPending))
+				}
+				m.finishDeviceAudit(audit, err)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}(row, existing[row.Request.DeviceId], result)
+	}
+	wg.Wait()
+
+	response := &grpc_device_manager_go.ImportDevicesResponse{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		Results:        results,
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			response.Failed++
+		} else if r.Created {
+			response.Created++
+		} else {
+			response.Existing++
+		}
+	}
+	return response, nil
+}
+
+// importDevice registers the device of a valid row, or retrieves the credentials of the device if it already exists.
+func (m *Manager) importDevice(row *entities.DeviceImportRow, exists bool, policy *entities.LabelPolicy, admin bool, result *grpc_device_manager_go.ImportDeviceResult) error {
+	derr := policy.Check(row.Request.Labels, m.reservedLabelPrefixes, admin)
+	if derr != nil {
+		return derr
+	}
+	if exists {
+		apiKey, err := m.getDeviceApiKey(row.Request.OrganizationId, row.Request.DeviceGroupId, row.Request.DeviceId)
+		if err != nil {
+			return err
+		}
+		pending, derr := m.approvalProvider.ExistsPendingDevice(row.Request.OrganizationId, row.Request.DeviceGroupId, row.Request.DeviceId)
+		if derr != nil {
+			return derr
+		}
+		result.DeviceApiKey = apiKey
+		result.ApprovalPending = pending
+		return nil
+	}
+	registered, err := m.registerDevice(row.Request)
+	if err != nil {
+		return err
+	}
+	result.Created = !registered.AlreadyRegistered
+	result.DeviceApiKey = registered.DeviceApiKey
+	result.ApprovalPending = registered.ApprovalPending
+	return nil
+}
+
+// getDeviceApiKey retrieves the API key of an existing device.
+func (m *Manager) getDeviceApiKey(organizationID string, deviceGroupID string, deviceID string) (string, error) {
+	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+	defer aCancel()
+	credentials, err := m.authxClient.GetDeviceCredentials(aCtx, &grpc_device_go.DeviceId{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+		DeviceId:       deviceID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return credentials.DeviceApiKey, nil
+}
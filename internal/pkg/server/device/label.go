@@ -0,0 +1,71 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+)
+
+// CheckLabels verifies that the labels set by an actor follow the label policy of the organization and the
+// reserved prefixes.
+func (m *Manager) CheckLabels(organizationID string, labels map[string]string, admin bool) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	policy, err := m.getLabelPolicy(organizationID)
+	if err != nil {
+		return err
+	}
+	derr := policy.Check(labels, m.reservedLabelPrefixes, admin)
+	if derr != nil {
+		return conversions.ToGRPCError(derr)
+	}
+	return nil
+}
+
+func (m *Manager) getLabelPolicy(organizationID string) (*entities.LabelPolicy, error) {
+	policy, derr := m.labelProvider.GetLabelPolicy(organizationID)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return policy, nil
+}
+
+// SetLabelPolicy replaces the label keys allowed in an organization. The labels already set are not modified.
+func (m *Manager) SetLabelPolicy(request *grpc_device_manager_go.LabelPolicy) (*grpc_device_manager_go.LabelPolicy, error) {
+	policy, derr := entities.NewLabelPolicy(request)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	derr = m.labelProvider.SetLabelPolicy(*policy)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return policy.ToGRPC(), nil
+}
+
+// GetLabelPolicy retrieves the label policy of an organization.
+func (m *Manager) GetLabelPolicy(organizationID *grpc_organization_go.OrganizationId) (*grpc_device_manager_go.LabelPolicy, error) {
+	policy, err := m.getLabelPolicy(organizationID.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	return policy.ToGRPC(), nil
+}
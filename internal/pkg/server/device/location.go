@@ -0,0 +1,161 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"time"
+)
+
+// ListDevicesInRadius retrieves the devices of an organization or a group located within a distance of a point,
+// sorted by distance.
+func (m *Manager) ListDevicesInRadius(request *grpc_device_manager_go.ListDevicesInRadiusRequest) (*grpc_device_manager_go.DeviceLocationList, error) {
+	circle, derr := entities.NewCircle(request.Center, request.RadiusMeters)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return m.searchLocations(request.OrganizationId, request.DeviceGroupId, circle, &circle.Center, request.Limit)
+}
+
+// ListDevicesInBoundingBox retrieves the devices of an organization or a group located within a bounding box.
+func (m *Manager) ListDevicesInBoundingBox(request *grpc_device_manager_go.ListDevicesInBoundingBoxRequest) (*grpc_device_manager_go.DeviceLocationList, error) {
+	box, derr := entities.NewBoundingBox(request.SouthWest, request.NorthEast)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return m.searchLocations(request.OrganizationId, request.DeviceGroupId, box, nil, request.Limit)
+}
+
+// ListDevicesInPolygon retrieves the devices of an organization or a group located within a polygon.
+func (m *Manager) ListDevicesInPolygon(request *grpc_device_manager_go.ListDevicesInPolygonRequest) (*grpc_device_manager_go.DeviceLocationList, error) {
+	polygon, derr := entities.NewPolygon(request.Vertices)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	return m.searchLocations(request.OrganizationId, request.DeviceGroupId, polygon, nil, request.Limit)
+}
+
+// searchLocations reads the cells of the spatial index that cover the region and returns the devices that are
+// inside it. Results are sorted by distance to the center if there is one, and by device otherwise, and
+// truncated to the page size of the limit.
+func (m *Manager) searchLocations(organizationID string, deviceGroupID string, region entities.GeoRegion, center *entities.GeoPoint, limit int32) (*grpc_device_manager_go.DeviceLocationList, error) {
+	err := m.checkOrganizationLocationIndex(organizationID)
+	if err != nil {
+		return nil, err
+	}
+	found, derr := m.geoProvider.SearchLocations(organizationID, entities.GeohashCover(region))
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	locations := make([]*grpc_device_manager_go.DeviceLocation, 0)
+	for _, f := range found {
+		if deviceGroupID != "" && f.DeviceGroupId != deviceGroupID {
+			continue
+		}
+		if region.Contains(f.Point()) {
+			locations = append(locations, f.ToGRPC(center))
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if center != nil && locations[i].DistanceMeters != locations[j].DistanceMeters {
+			return locations[i].DistanceMeters < locations[j].DistanceMeters
+		}
+		if locations[i].DeviceGroupId != locations[j].DeviceGroupId {
+			return locations[i].DeviceGroupId < locations[j].DeviceGroupId
+		}
+		return locations[i].DeviceId < locations[j].DeviceId
+	})
+	size := m.pagination.PageSize(int(limit))
+	if len(locations) > size {
+		locations = locations[:size]
+	}
+	return &grpc_device_manager_go.DeviceLocationList{
+		Devices: locations,
+	}, nil
+}
+
+// checkOrganizationLocationIndex builds the spatial index of an organization from the system model information
+// the first time it is required, as checkOrganizationIndex does with the device index.
+func (m *Manager) checkOrganizationLocationIndex(organizationID string) error {
+	indexed, derr := m.geoProvider.IsOrganizationIndexed(organizationID)
+	if derr != nil {
+		return conversions.ToGRPCError(derr)
+	}
+	if indexed {
+		return nil
+	}
+	log.Debug().Str("organizationID", organizationID).Msg("building device location index")
+	devices, err := m.filterOrganizationDevices(&grpc_organization_go.OrganizationId{OrganizationId: organizationID}, nil)
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		if d.Location == nil || d.Location.Geolocation == "" {
+			continue
+		}
+		point, derr := entities.ParseGeolocation(d.Location.Geolocation)
+		if derr != nil {
+			// locations stored before they were validated are not indexed
+			log.Debug().Str("deviceID", d.DeviceId).Str("geolocation", d.Location.Geolocation).Msg("skipping invalid device location")
+			continue
+		}
+		derr = m.geoProvider.SetDeviceLocation(*entities.NewDeviceLocation(d.OrganizationId, d.DeviceGroupId, d.DeviceId, *point, time.Now().Unix()))
+		if derr != nil {
+			return conversions.ToGRPCError(derr)
+		}
+	}
+	derr = m.geoProvider.SetOrganizationIndexed(organizationID)
+	if derr != nil {
+		return conversions.ToGRPCError(derr)
+	}
+	return nil
+}
+
+// locateDevice updates the location of a device in the spatial index. Devices without a valid location are
+// removed from it. As with the device index, failures are only reported.
+func (m *Manager) locateDevice(device *grpc_device_go.Device) {
+	if device.Location == nil || device.Location.Geolocation == "" {
+		m.unlocateDevice(&grpc_device_go.DeviceId{
+			OrganizationId: device.OrganizationId,
+			DeviceGroupId:  device.DeviceGroupId,
+			DeviceId:       device.DeviceId,
+		})
+		return
+	}
+	point, err := entities.ParseGeolocation(device.Location.Geolocation)
+	if err == nil {
+		err = m.geoProvider.SetDeviceLocation(*entities.NewDeviceLocation(device.OrganizationId, device.DeviceGroupId,
+			device.DeviceId, *point, time.Now().Unix()))
+	}
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Str("deviceID", device.DeviceId).Msg("cannot update device location index")
+	}
+}
+
+// unlocateDevice removes the location of a device from the spatial index.
+func (m *Manager) unlocateDevice(deviceID *grpc_device_go.DeviceId) {
+	err := m.geoProvider.RemoveDeviceLocation(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove device from the location index")
+	}
+}
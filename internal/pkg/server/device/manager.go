@@ -18,9 +18,28 @@ package device
 
 import (
 	"context"
+	"fmt"
 	"github.com/nalej/derrors"
 	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/approval"
+	"github.com/nalej/device-manager/internal/pkg/provider/asset"
+	"github.com/nalej/device-manager/internal/pkg/provider/attribute"
+	"github.com/nalej/device-manager/internal/pkg/provider/audit"
+	"github.com/nalej/device-manager/internal/pkg/provider/campaign"
+	"github.com/nalej/device-manager/internal/pkg/provider/command"
+	"github.com/nalej/device-manager/internal/pkg/provider/configuration"
+	"github.com/nalej/device-manager/internal/pkg/provider/deletion"
+	"github.com/nalej/device-manager/internal/pkg/provider/dynamicgroup"
+	"github.com/nalej/device-manager/internal/pkg/provider/geo"
+	"github.com/nalej/device-manager/internal/pkg/provider/geofence"
+	"github.com/nalej/device-manager/internal/pkg/provider/history"
+	"github.com/nalej/device-manager/internal/pkg/provider/index"
+	"github.com/nalej/device-manager/internal/pkg/provider/label"
 	"github.com/nalej/device-manager/internal/pkg/provider/latency"
+	"github.com/nalej/device-manager/internal/pkg/provider/metrics"
+	"github.com/nalej/device-manager/internal/pkg/provider/repair"
+	"github.com/nalej/device-manager/internal/pkg/provider/token"
+	"github.com/nalej/device-manager/internal/pkg/provider/twin"
 	"github.com/nalej/grpc-application-go"
 	"github.com/nalej/grpc-authx-go"
 	"github.com/nalej/grpc-common-go"
@@ -29,6 +48,8 @@ import (
 	"github.com/nalej/grpc-organization-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"time"
 )
 
@@ -37,22 +58,116 @@ const AuthxClientTimeout = time.Second * 5
 
 // Manager structure with the required clients for node operations.
 type Manager struct {
-	authxClient     grpc_authx_go.AuthxClient
-	devicesClient   grpc_device_go.DevicesClient
-	appsClient      grpc_application_go.ApplicationsClient
-	threshold       time.Duration
-	latencyProvider latency.Provider
+	authxClient       grpc_authx_go.AuthxClient
+	devicesClient     grpc_device_go.DevicesClient
+	appsClient        grpc_application_go.ApplicationsClient
+	threshold         time.Duration
+	pagination        entities.PaginationConfig
+	bulkConcurrency   int
+	pendingExpiration time.Duration
+	latencyProvider   latency.Provider
+	indexProvider     index.Provider
+	approvalProvider  approval.Provider
+	tokenProvider     token.Provider
+	repairProvider    repair.Provider
+	deletionProvider  deletion.Provider
+	attributeProvider attribute.Provider
+	labelProvider     label.Provider
+	geoProvider       geo.Provider
+	historyProvider   history.Provider
+	geofenceProvider  geofence.Provider
+	assetProvider     asset.Provider
+	twinProvider      twin.Provider
+	// twinWatchers contains the subscriptions to the changes of the device twins
+	twinWatchers    *twinWatchers
+	commandProvider command.Provider
+	// commandWatchers contains the devices that receive their commands with a stream
+	commandWatchers  *commandWatchers
+	configProvider   configuration.Provider
+	campaignProvider campaign.Provider
+	metricsProvider  metrics.Provider
+	auditProvider    audit.Provider
+	// dynamicGroupProvider contains the definitions of the dynamic groups, their members are evaluated on demand
+	dynamicGroupProvider dynamicgroup.Provider
+	// deletedRetention is the time a deleted device can be restored before it is purged
+	deletedRetention time.Duration
+	// reservedLabelPrefixes contains the prefixes of the label keys that only administrators can set
+	reservedLabelPrefixes []string
 }
 
-// NewManager creates a Manager using a set of clients.
+// Providers contains the storage used by the manager.
+type Providers struct {
+	Latency       latency.Provider
+	Index         index.Provider
+	Approval      approval.Provider
+	Token         token.Provider
+	Repair        repair.Provider
+	Deletion      deletion.Provider
+	Attribute     attribute.Provider
+	Label         label.Provider
+	Geo           geo.Provider
+	History       history.Provider
+	Geofence      geofence.Provider
+	Asset         asset.Provider
+	Twin          twin.Provider
+	Command       command.Provider
+	Configuration configuration.Provider
+	Campaign      campaign.Provider
+	Metrics       metrics.Provider
+	Audit         audit.Provider
+	DynamicGroup  dynamicgroup.Provider
+}
+
+// ManagerConfig contains the settings of the manager.
+type ManagerConfig struct {
+	// Threshold is the time without a ping after which a device is considered offline
+	Threshold time.Duration
+	// Pagination contains the page sizes of the listings
+	Pagination entities.PaginationConfig
+	// BulkConcurrency is the number of devices modified concurrently by bulk operations
+	BulkConcurrency int
+	// PendingExpiration is the time a device waits for approval before it is removed
+	PendingExpiration time.Duration
+	// DeletedRetention is the time a deleted device can be restored before it is purged
+	DeletedRetention time.Duration
+	// ReservedLabelPrefixes contains the prefixes of the label keys that only administrators can set
+	ReservedLabelPrefixes []string
+}
+
+// NewManager creates a Manager using a set of clients and providers.
 func NewManager(authxClient grpc_authx_go.AuthxClient, deviceClient grpc_device_go.DevicesClient,
-	appsClient grpc_application_go.ApplicationsClient, lProvider latency.Provider, threshold time.Duration) Manager {
+	appsClient grpc_application_go.ApplicationsClient, providers Providers, config ManagerConfig) Manager {
 	return Manager{
-		authxClient:     authxClient,
-		devicesClient:   deviceClient,
-		appsClient:      appsClient,
-		latencyProvider: lProvider,
-		threshold:       threshold,
+		authxClient:           authxClient,
+		devicesClient:         deviceClient,
+		appsClient:            appsClient,
+		latencyProvider:       providers.Latency,
+		indexProvider:         providers.Index,
+		approvalProvider:      providers.Approval,
+		tokenProvider:         providers.Token,
+		repairProvider:        providers.Repair,
+		deletionProvider:      providers.Deletion,
+		attributeProvider:     providers.Attribute,
+		labelProvider:         providers.Label,
+		geoProvider:           providers.Geo,
+		historyProvider:       providers.History,
+		geofenceProvider:      providers.Geofence,
+		assetProvider:         providers.Asset,
+		twinProvider:          providers.Twin,
+		twinWatchers:          newTwinWatchers(),
+		commandProvider:       providers.Command,
+		commandWatchers:       newCommandWatchers(),
+		configProvider:        providers.Configuration,
+		campaignProvider:      providers.Campaign,
+		metricsProvider:       providers.Metrics,
+		auditProvider:         providers.Audit,
+		dynamicGroupProvider:  providers.DynamicGroup,
+		deletedRetention:      config.DeletedRetention,
+		reservedLabelPrefixes: config.ReservedLabelPrefixes,
+		threshold:             config.Threshold,
+		pagination:            config.Pagination,
+		bulkConcurrency:       config.BulkConcurrency,
+		pendingExpiration:     config.PendingExpiration,
 	}
 }
 
@@ -70,6 +185,10 @@ func (m *Manager) GetDeviceGroup(deviceGroupID *grpc_device_go.DeviceGroupId) (*
 	if err != nil {
 		return nil, err
 	}
+	approvalRequired, err := m.isApprovalRequired(dg.OrganizationId, dg.DeviceGroupId)
+	if err != nil {
+		return nil, err
+	}
 	return &grpc_device_manager_go.DeviceGroup{
 		OrganizationId:            dg.OrganizationId,
 		DeviceGroupId:             dg.DeviceGroupId,
@@ -79,6 +198,7 @@ func (m *Manager) GetDeviceGroup(deviceGroupID *grpc_device_go.DeviceGroupId) (*
 		Enabled:                   dgc.Enabled,
 		DefaultDeviceConnectivity: dgc.DefaultDeviceConnectivity,
 		DeviceGroupApiKey:         dgc.DeviceGroupApiKey,
+		ApprovalRequired:          approvalRequired,
 	}, nil
 }
 
@@ -93,6 +213,10 @@ func (m *Manager) addAuthInfoToDG(dg *grpc_device_go.DeviceGroup) (*grpc_device_
 	if err != nil {
 		return nil, err
 	}
+	approvalRequired, err := m.isApprovalRequired(dg.OrganizationId, dg.DeviceGroupId)
+	if err != nil {
+		return nil, err
+	}
 	return &grpc_device_manager_go.DeviceGroup{
 		OrganizationId:            dg.OrganizationId,
 		DeviceGroupId:             dg.DeviceGroupId,
@@ -102,30 +226,62 @@ func (m *Manager) addAuthInfoToDG(dg *grpc_device_go.DeviceGroup) (*grpc_device_
 		Enabled:                   dgc.Enabled,
 		DefaultDeviceConnectivity: dgc.DefaultDeviceConnectivity,
 		DeviceGroupApiKey:         dgc.DeviceGroupApiKey,
+		ApprovalRequired:          approvalRequired,
 	}, nil
 }
 
+// AddDeviceGroup creates a device group in system model and its credentials in authx. If the credentials cannot be
+// created, the device group is removed.
 func (m *Manager) AddDeviceGroup(request *grpc_device_manager_go.AddDeviceGroupRequest) (*grpc_device_manager_go.DeviceGroup, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
-	defer cancel()
-	addDGRequest := &grpc_device_go.AddDeviceGroupRequest{
-		OrganizationId: request.OrganizationId,
-		Name:           request.Name,
-		Labels:         nil,
-	}
-	added, err := m.devicesClient.AddDeviceGroup(ctx, addDGRequest)
-	if err != nil {
-		return nil, err
-	}
-	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
-	defer aCancel()
-	addDGCredentialsRequest := &grpc_authx_go.AddDeviceGroupCredentialsRequest{
-		OrganizationId:            request.OrganizationId,
-		DeviceGroupId:             added.DeviceGroupId,
-		Enabled:                   request.Enabled,
-		DefaultDeviceConnectivity: request.DefaultDeviceConnectivity,
+	var added *grpc_device_go.DeviceGroup
+	var credentials *grpc_authx_go.DeviceGroupCredentials
+	s := m.newSaga("add device group")
+	s.addStep(sagaStep{
+		name: "add device group",
+		action: func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+			defer cancel()
+			addDGRequest := &grpc_device_go.AddDeviceGroupRequest{
+				OrganizationId: request.OrganizationId,
+				Name:           request.Name,
+				Labels:         request.Labels,
+			}
+			var err error
+			added, err = m.devicesClient.AddDeviceGroup(ctx, addDGRequest)
+			return err
+		},
+		compensation: func() *entities.RepairTask {
+			return entities.NewDeviceGroupRepairTask(entities.RemoveDeviceGroupOperation, added.OrganizationId, added.DeviceGroupId)
+		},
+	})
+	s.addStep(sagaStep{
+		name: "add device group credentials",
+		action: func() error {
+			aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+			defer aCancel()
+			addDGCredentialsRequest := &grpc_authx_go.AddDeviceGroupCredentialsRequest{
+				OrganizationId:            request.OrganizationId,
+				DeviceGroupId:             added.DeviceGroupId,
+				Enabled:                   request.Enabled,
+				DefaultDeviceConnectivity: request.DefaultDeviceConnectivity,
+			}
+			var err error
+			credentials, err = m.authxClient.AddDeviceGroupCredentials(aCtx, addDGCredentialsRequest)
+			return err
+		},
+		compensation: func() *entities.RepairTask {
+			return entities.NewDeviceGroupRepairTask(entities.RemoveDeviceGroupCredentialsOperation, added.OrganizationId, added.DeviceGroupId)
+		},
+	})
+	if request.ApprovalRequired {
+		s.addStep(sagaStep{
+			name: "set approval policy",
+			action: func() error {
+				return m.setApprovalRequired(added.OrganizationId, added.DeviceGroupId, true)
+			},
+		})
 	}
-	credentials, err := m.authxClient.AddDeviceGroupCredentials(aCtx, addDGCredentialsRequest)
+	err := s.run()
 	if err != nil {
 		return nil, err
 	}
@@ -139,6 +295,7 @@ func (m *Manager) AddDeviceGroup(request *grpc_device_manager_go.AddDeviceGroupR
 		Enabled:                   credentials.Enabled,
 		DefaultDeviceConnectivity: credentials.DefaultDeviceConnectivity,
 		DeviceGroupApiKey:         credentials.DeviceGroupApiKey,
+		ApprovalRequired:          request.ApprovalRequired,
 	}, nil
 }
 
@@ -157,6 +314,12 @@ func (m *Manager) UpdateDeviceGroup(request *grpc_device_manager_go.UpdateDevice
 	if err != nil {
 		return nil, err
 	}
+	if request.UpdateApprovalRequired {
+		err = m.setApprovalRequired(request.OrganizationId, request.DeviceGroupId, request.ApprovalRequired)
+		if err != nil {
+			return nil, err
+		}
+	}
 	dgID := &grpc_device_go.DeviceGroupId{
 		OrganizationId: request.OrganizationId,
 		DeviceGroupId:  request.DeviceGroupId,
@@ -210,60 +373,134 @@ func (m *Manager) deviceGroupHasApps(deviceGroupID *grpc_device_go.DeviceGroupId
 	return false, nil
 }
 
+// deviceGroupHasDevices checks if a device group has devices that have not been deleted.
 func (m *Manager) deviceGroupHasDevices(deviceGroupID *grpc_device_go.DeviceGroupId) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
-	defer cancel()
-
-	devices, err := m.devicesClient.ListDevices(ctx, deviceGroupID)
+	devices, err := m.filterGroupDevices(deviceGroupID, nil)
 	if err != nil {
 		return false, err
 	}
 
-	if devices != nil && len(devices.Devices) > 0 {
+	if len(devices) > 0 {
 		return true, nil
 	}
 
 	return false, nil
 }
 
+// removeDevice removes the credentials, the latencies and the system model entity of a device. Once the
+// credentials are removed the device cannot be used, so the rest of the steps are queued for repair if they fail
+// instead of aborting the removal. Removing a device that does not exist is not an error, so that a removal can be
+// retried.
 func (m *Manager) removeDevice(deviceID *grpc_device_go.DeviceId) error {
-	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
-	defer aCancel()
-	_, err := m.authxClient.RemoveDeviceCredentials(aCtx, deviceID)
-	if err != nil {
-		return err
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
-	defer cancel()
-	removeRequest := &grpc_device_go.RemoveDeviceRequest{
-		OrganizationId: deviceID.OrganizationId,
-		DeviceGroupId:  deviceID.DeviceGroupId,
-		DeviceId:       deviceID.DeviceId,
-	}
-	_, err = m.devicesClient.RemoveDevice(ctx, removeRequest)
+	err := m.newSaga("remove device").
+		addStep(sagaStep{
+			name: "remove device credentials",
+			action: func() error {
+				return m.executeRepair(entities.NewDeviceRepairTask(entities.RemoveDeviceCredentialsOperation,
+					deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+			},
+		}).
+		addStep(sagaStep{
+			name: "remove device latencies",
+			action: func() error {
+				return m.executeRepair(entities.NewDeviceRepairTask(entities.RemoveDeviceLatencyOperation,
+					deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+			},
+			repair: entities.NewDeviceRepairTask(entities.RemoveDeviceLatencyOperation,
+				deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId),
+		}).
+		addStep(sagaStep{
+			name: "remove device",
+			action: func() error {
+				return m.executeRepair(entities.NewDeviceRepairTask(entities.RemoveDeviceOperation,
+					deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+			},
+			repair: entities.NewDeviceRepairTask(entities.RemoveDeviceOperation,
+				deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId),
+		}).
+		run()
 	if err != nil {
 		return err
 	}
+	m.unindexDevice(deviceID)
+	m.unlocateDevice(deviceID)
+	m.removeLocationHistory(deviceID)
+	m.removeDeviceMetrics(deviceID)
+	m.removeAssetInfoHistory(deviceID)
+	m.removeDeviceTwin(deviceID)
+	m.removeDeviceCommands(deviceID)
+	m.removeConfigAcknowledgement(deviceID)
+	m.removePendingDevice(deviceID)
+	m.removeDeviceToken(deviceID)
+	m.removeDeletedDevice(deviceID)
+	m.removeAllDeviceAttributes(deviceID)
 	log.Debug().Interface("deviceID", deviceID).Msg("device has been removed")
 	return nil
 }
 
+// removeDeviceGroupEntity removes the credentials and the system model entity of a device group, following the
+// same approach as removeDevice.
 func (m *Manager) removeDeviceGroupEntity(deviceGroupID *grpc_device_go.DeviceGroupId) error {
-	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
-	defer aCancel()
-	_, err := m.authxClient.RemoveDeviceGroupCredentials(aCtx, deviceGroupID)
+	err := m.newSaga("remove device group").
+		addStep(sagaStep{
+			name: "remove device group credentials",
+			action: func() error {
+				return m.executeRepair(entities.NewDeviceGroupRepairTask(entities.RemoveDeviceGroupCredentialsOperation,
+					deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId))
+			},
+		}).
+		addStep(sagaStep{
+			name: "remove device group",
+			action: func() error {
+				return m.executeRepair(entities.NewDeviceGroupRepairTask(entities.RemoveDeviceGroupOperation,
+					deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId))
+			},
+			repair: entities.NewDeviceGroupRepairTask(entities.RemoveDeviceGroupOperation,
+				deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId),
+		}).
+		run()
 	if err != nil {
 		return err
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
-	defer cancel()
-	removeRequest := &grpc_device_go.RemoveDeviceGroupRequest{
-		OrganizationId: deviceGroupID.OrganizationId,
-		DeviceGroupId:  deviceGroupID.DeviceGroupId,
+	derr := m.indexProvider.RemoveDeviceGroup(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceGroupID", deviceGroupID).Msg("cannot remove device group from the index")
 	}
-	_, err = m.devicesClient.RemoveDeviceGroup(ctx, removeRequest)
-	if err != nil {
-		return err
+	derr = m.geoProvider.RemoveDeviceGroup(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceGroupID", deviceGroupID).Msg("cannot remove device group from the location index")
+	}
+	derr = m.geofenceProvider.RemoveGroupGeofences(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceGroupID", deviceGroupID).Msg("cannot remove device group geofences")
+	}
+	derr = m.twinProvider.RemoveGroupTwins(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceGroupID", deviceGroupID).Msg("cannot remove device group twins")
+	}
+	derr = m.commandProvider.RemoveGroupCommands(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceGroupID", deviceGroupID).Msg("cannot remove device group commands")
+	}
+	derr = m.configProvider.RemoveGroupConfigs(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceGroupID", deviceGroupID).Msg("cannot remove device group configurations")
+	}
+	derr = m.campaignProvider.RemoveGroupCampaigns(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceGroupID", deviceGroupID).Msg("cannot remove device group campaigns")
+	}
+	derr = m.metricsProvider.RemoveGroupMetrics(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceGroupID", deviceGroupID).Msg("cannot remove device group metrics")
+	}
+	derr = m.approvalProvider.RemoveApprovalPolicy(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceGroupID", deviceGroupID).Msg("cannot remove device group approval policy")
+	}
+	derr = m.tokenProvider.RemoveGroupTokens(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if derr != nil {
+		log.Warn().Str("trace", derr.DebugReport()).Interface("deviceGroupID", deviceGroupID).Msg("cannot remove device group registration tokens")
 	}
 	log.Debug().Interface("deviceGroupID", deviceGroupID).Msg("device group entity has been removed")
 	return nil
@@ -294,13 +531,14 @@ func (m *Manager) RemoveDeviceGroup(deviceGroupID *grpc_device_go.DeviceGroupId)
 		log.Debug().Msg("cannot disable device group")
 		return nil, err
 	}
-	devices, err := m.ListDevices(deviceGroupID)
+	// deleted devices are hidden from the listings but must be removed too
+	devices, err := m.listGroupDevices(deviceGroupID)
 	if err != nil {
 		log.Debug().Msg("cannot retrieve the list of devices to be removed")
 		return nil, err
 	}
 	log.Debug().Msg("removing devices")
-	for _, d := range devices.Devices {
+	for _, d := range devices {
 		dID := &grpc_device_go.DeviceId{
 			OrganizationId: d.OrganizationId,
 			DeviceGroupId:  d.DeviceGroupId,
@@ -320,15 +558,20 @@ func (m *Manager) RemoveDeviceGroup(deviceGroupID *grpc_device_go.DeviceGroupId)
 	return &grpc_common_go.Success{}, nil
 }
 
-func (m *Manager) ListDeviceGroups(organizationID *grpc_organization_go.OrganizationId) (*grpc_device_manager_go.DeviceGroupList, error) {
+// ListDeviceGroups retrieves a page of the device groups of an organization. Only the groups in the page
+// are completed with the authx information.
+func (m *Manager) ListDeviceGroups(organizationID *grpc_organization_go.OrganizationId, page *entities.PageRequest) (*grpc_device_manager_go.DeviceGroupList, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
 	defer cancel()
 	dgs, err := m.devicesClient.ListDeviceGroups(ctx, organizationID)
 	if err != nil {
 		return nil, err
 	}
+	groups := dgs.Groups
+	sortDeviceGroups(groups, page)
+	start, end := page.Bounds(m.pagination.PageSize(page.Size), len(groups))
 	result := make([]*grpc_device_manager_go.DeviceGroup, 0)
-	for _, dg := range dgs.Groups {
+	for _, dg := range groups[start:end] {
 		toAdd, err := m.addAuthInfoToDG(dg)
 		if err != nil {
 			return nil, err
@@ -336,61 +579,204 @@ func (m *Manager) ListDeviceGroups(organizationID *grpc_organization_go.Organiza
 		result = append(result, toAdd)
 	}
 	return &grpc_device_manager_go.DeviceGroupList{
-		Groups: result,
+		Groups:        result,
+		NextPageToken: page.NextToken(end, len(groups)),
 	}, nil
 }
 
+// addDeviceEntity creates a device and its credentials. The operation is idempotent: if the device already exists
+// with the same data, its current credentials are returned, and if a previous attempt created the device without
+// credentials, the credentials are created. A device that exists with different data is reported as a conflict.
+// If the credentials of a new device cannot be created, the device is removed.
 func (m *Manager) addDeviceEntity(request *grpc_device_manager_go.RegisterDeviceRequest) (*grpc_device_manager_go.RegisterResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
-	defer cancel()
-	addRequest := &grpc_device_go.AddDeviceRequest{
-		OrganizationId: request.OrganizationId,
-		DeviceGroupId:  request.DeviceGroupId,
-		DeviceId:       request.DeviceId,
-		Labels:         request.Labels,
-		AssetInfo:      request.AssetInfo,
+	var added *grpc_device_go.Device
+	existing := false
+	response := &grpc_device_manager_go.RegisterResponse{
+		DeviceId: request.DeviceId,
 	}
-	added, err := m.devicesClient.AddDevice(ctx, addRequest)
+	err := m.newSaga("add device").
+		addStep(sagaStep{
+			name: "add device",
+			action: func() error {
+				ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+				defer cancel()
+				addRequest := &grpc_device_go.AddDeviceRequest{
+					OrganizationId: request.OrganizationId,
+					DeviceGroupId:  request.DeviceGroupId,
+					DeviceId:       request.DeviceId,
+					Labels:         request.Labels,
+					AssetInfo:      request.AssetInfo,
+				}
+				var err error
+				added, err = m.devicesClient.AddDevice(ctx, addRequest)
+				if err != nil {
+					if status.Code(err) != codes.AlreadyExists {
+						return err
+					}
+					added, err = m.getExistingDevice(request)
+					if err != nil {
+						return err
+					}
+					existing = true
+				}
+				return nil
+			},
+			compensation: func() *entities.RepairTask {
+				if existing {
+					// keep the entity of a previous registration so that it can be completed
+					return nil
+				}
+				return entities.NewDeviceRepairTask(entities.RemoveDeviceOperation,
+					request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+			},
+		}).
+		addStep(sagaStep{
+			name: "add device credentials",
+			action: func() error {
+				aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+				defer aCancel()
+				addCredentialsRequest := &grpc_authx_go.AddDeviceCredentialsRequest{
+					OrganizationId: request.OrganizationId,
+					DeviceGroupId:  request.DeviceGroupId,
+					DeviceId:       request.DeviceId,
+				}
+				credentials, err := m.authxClient.AddDeviceCredentials(aCtx, addCredentialsRequest)
+				if err == nil {
+					response.DeviceApiKey = credentials.DeviceApiKey
+					return nil
+				}
+				if !existing || status.Code(err) != codes.AlreadyExists {
+					return err
+				}
+				// the device was completely registered before
+				apiKey, err := m.getDeviceApiKey(request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+				if err != nil {
+					return err
+				}
+				response.DeviceApiKey = apiKey
+				response.AlreadyRegistered = true
+				return nil
+			},
+		}).
+		run()
 	if err != nil {
 		return nil, err
 	}
-	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
-	defer aCancel()
-	addCredentialsRequest := &grpc_authx_go.AddDeviceCredentialsRequest{
+	if response.AlreadyRegistered {
+		log.Debug().Str("deviceID", request.DeviceId).Msg("device was already registered")
+		return response, nil
+	}
+	m.indexDevice(added)
+	if existing {
+		log.Info().Str("deviceID", request.DeviceId).Msg("credentials of a partially registered device have been added")
+	} else {
+		log.Debug().Interface("device", added).Msg("device has been added")
+	}
+	return response, nil
+}
+
+// getExistingDevice retrieves a device that already exists and checks that it matches the registration request.
+func (m *Manager) getExistingDevice(request *grpc_device_manager_go.RegisterDeviceRequest) (*grpc_device_go.Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	device, err := m.devicesClient.GetDevice(ctx, &grpc_device_go.DeviceId{
 		OrganizationId: request.OrganizationId,
 		DeviceGroupId:  request.DeviceGroupId,
 		DeviceId:       request.DeviceId,
-	}
-	credentials, err := m.authxClient.AddDeviceCredentials(aCtx, addCredentialsRequest)
+	})
 	if err != nil {
 		return nil, err
 	}
-	log.Debug().Interface("device", added).Msg("device has been added")
-	return &grpc_device_manager_go.RegisterResponse{
-		DeviceId:     credentials.DeviceId,
-		DeviceApiKey: credentials.DeviceApiKey,
-	}, nil
+	deleted, derr := m.deletionProvider.ExistsDeletedDevice(request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	if deleted {
+		return nil, conversions.ToGRPCError(derrors.NewFailedPreconditionError(
+			"device has been deleted, it must be restored or purged before registering it again").WithParams(request.DeviceId))
+	}
+	if !entities.MatchesRegistration(device, request) {
+		return nil, conversions.ToGRPCError(derrors.NewAlreadyExistsError(
+			"device already exists with different labels or asset information").WithParams(request.DeviceId))
+	}
+	return device, nil
 }
 
-func (m *Manager) RegisterDevice(request *grpc_device_manager_go.RegisterDeviceRequest) (*grpc_device_manager_go.RegisterResponse, error) {
-	// Check that the device group is usable
-	log.Debug().Interface("request", request).Msg("adding device")
+// deviceGroupLogin checks that the device group API key is valid and the group accepts new devices.
+func (m *Manager) deviceGroupLogin(organizationID string, deviceGroupApiKey string) error {
 	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
 	defer aCancel()
 	dgLoginRequest := &grpc_authx_go.DeviceGroupLoginRequest{
-		OrganizationId:    request.OrganizationId,
-		DeviceGroupApiKey: request.DeviceGroupApiKey,
+		OrganizationId:    organizationID,
+		DeviceGroupApiKey: deviceGroupApiKey,
 	}
 	_, err := m.authxClient.DeviceGroupLogin(aCtx, dgLoginRequest)
+	return err
+}
+
+// RegisterDevice adds a device using either the device group API key or a registration token.
+func (m *Manager) RegisterDevice(request *grpc_device_manager_go.RegisterDeviceRequest) (*grpc_device_manager_go.RegisterResponse, error) {
+	// Check that the device group is usable
+	log.Debug().Str("organizationID", request.OrganizationId).Str("deviceGroupID", request.DeviceGroupId).
+		Str("deviceID", request.DeviceId).Msg("adding device")
+	tokenID := ""
+	var err error
+	if request.DeviceGroupApiKey != "" {
+		err = m.deviceGroupLogin(request.OrganizationId, request.DeviceGroupApiKey)
+	} else {
+		tokenID, err = m.registrationTokenLogin(request)
+		if err == nil {
+			err = m.deviceGroupCredentialsLogin(request.OrganizationId, request.DeviceGroupId)
+			if err != nil {
+				m.releaseTokenUse(request.OrganizationId, request.DeviceGroupId, tokenID)
+			}
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 	log.Debug().Str("deviceID", request.DeviceId).Msg("device group is valid")
+	response, err := m.registerDevice(request)
+	if tokenID != "" {
+		if err != nil || response.AlreadyRegistered {
+			// repeated registrations do not consume uses of the token
+			m.releaseTokenUse(request.OrganizationId, request.DeviceGroupId, tokenID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if response.AlreadyRegistered {
+			// the credentials of a device are only returned again to the token that registered it
+			err = m.checkDeviceToken(request.OrganizationId, request.DeviceGroupId, request.DeviceId, tokenID)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			m.recordDeviceToken(request.OrganizationId, request.DeviceGroupId, request.DeviceId, tokenID)
+		}
+		response.RegistrationTokenId = tokenID
+	}
+	return response, err
+}
+
+// registerDevice adds a device once the registration credentials have been checked.
+func (m *Manager) registerDevice(request *grpc_device_manager_go.RegisterDeviceRequest) (*grpc_device_manager_go.RegisterResponse, error) {
+	approvalRequired, err := m.isApprovalRequired(request.OrganizationId, request.DeviceGroupId)
+	if err != nil {
+		return nil, err
+	}
+	if approvalRequired {
+		return m.registerPendingDevice(request)
+	}
 	// Add the device
 	return m.addDeviceEntity(request)
 }
 
 func (m *Manager) GetDevice(deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.Device, error) {
+	err := m.checkNotDeleted(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
 	defer cancel()
 	d, err := m.devicesClient.GetDevice(ctx, deviceID)
@@ -398,7 +784,20 @@ func (m *Manager) GetDevice(deviceID *grpc_device_go.DeviceId) (*grpc_device_man
 		return nil, err
 	}
 
-	return m.addAuthLatencyInfoToDevice(d)
+	device, err := m.addAuthLatencyInfoToDevice(d)
+	if err != nil {
+		return nil, err
+	}
+	tokenID, derr := m.tokenProvider.GetDeviceToken(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	device.RegistrationTokenId = tokenID
+	device.Attributes, err = m.getDeviceAttributes(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
 }
 
 func (m *Manager) fillDeviceStatus(latency *entities.Latency) grpc_device_manager_go.DeviceStatus { //(OrganizationId string, DeviceGroupId string, DeviceId string) grpc_device_manager_go.DeviceStatus  {
@@ -449,60 +848,183 @@ func (m *Manager) addAuthLatencyInfoToDevice(dg *grpc_device_go.Device) (*grpc_d
 		return nil, conversions.ToGRPCError(derr)
 	}
 	withAuthx.DeviceStatus = m.fillDeviceStatus(latency)
+	if latency.Latency != -1 {
+		withAuthx.LastHeartbeat = latency.ToHeartbeatGRPC()
+	}
 	return withAuthx, nil
 
 }
 
-func (m *Manager) updateStatus(devices []*grpc_device_manager_go.Device, latency entities.Latency) {
-	for i := 0; i < len(devices); i++ {
-		if devices[i].DeviceId == latency.DeviceId {
-			devices[i].DeviceStatus = m.fillDeviceStatus(&latency)
-			//timeCalculated := time.Unix(latency.Inserted, 0).Add(m.threshold).Unix()
-			//if timeCalculated > time.Now().Unix(){
-			//		devices[i].DeviceStatus = grpc_device_manager_go.DeviceStatus_ONLINE
-			//	}
-		}
+// ListDevices retrieves a page of the devices of a group whose labels match the selector and whose attributes
+// match the filter.
+func (m *Manager) ListDevices(deviceGroupID *grpc_device_go.DeviceGroupId, selector *entities.LabelSelector, filter *entities.AttributeFilter, page *entities.PageRequest) (*grpc_device_manager_go.DeviceList, error) {
+	devices, err := m.filterGroupDevices(deviceGroupID, selector)
+	if err != nil {
+		return nil, err
+	}
+	devices, err = m.filterDeviceAttributes(devices, filter)
+	if err != nil {
+		return nil, err
 	}
+	return m.getDevicePage(newDeviceEntries(devices), page)
 }
 
-func (m *Manager) ListDevices(deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.DeviceList, error) {
+// ListOrganizationDevices retrieves a page of the devices of all the groups of an organization whose labels
+// match the selector and whose attributes match the filter.
+func (m *Manager) ListOrganizationDevices(organizationID *grpc_organization_go.OrganizationId, selector *entities.LabelSelector, filter *entities.AttributeFilter, page *entities.PageRequest) (*grpc_device_manager_go.DeviceList, error) {
+	devices, err := m.filterOrganizationDevices(organizationID, selector)
+	if err != nil {
+		return nil, err
+	}
+	devices, err = m.filterDeviceAttributes(devices, filter)
+	if err != nil {
+		return nil, err
+	}
+	return m.getDevicePage(newDeviceEntries(devices), page)
+}
+
+// filterOrganizationDevices retrieves the devices of all the groups of an organization that match the selector.
+func (m *Manager) filterOrganizationDevices(organizationID *grpc_organization_go.OrganizationId, selector *entities.LabelSelector) ([]*grpc_device_go.Device, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
 	defer cancel()
-	devices, err := m.devicesClient.ListDevices(ctx, deviceGroupID)
+	dgs, err := m.devicesClient.ListDeviceGroups(ctx, organizationID)
 	if err != nil {
 		return nil, err
 	}
-	result := make([]*grpc_device_manager_go.Device, 0)
-	for _, d := range devices.Devices {
-		toAdd, err := m.addAuthInfoToD(d)
+	result := make([]*grpc_device_go.Device, 0)
+	for _, dg := range dgs.Groups {
+		deviceGroupID := &grpc_device_go.DeviceGroupId{
+			OrganizationId: dg.OrganizationId,
+			DeviceGroupId:  dg.DeviceGroupId,
+		}
+		devices, err := m.filterGroupDevices(deviceGroupID, selector)
 		if err != nil {
 			return nil, err
 		}
-		result = append(result, toAdd)
+		result = append(result, devices...)
+	}
+	return result, nil
+}
+
+// listGroupDevices retrieves all the devices of a group from system model, including the deleted ones.
+func (m *Manager) listGroupDevices(deviceGroupID *grpc_device_go.DeviceGroupId) ([]*grpc_device_go.Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	devices, err := m.devicesClient.ListDevices(ctx, deviceGroupID)
+	if err != nil {
+		return nil, err
+	}
+	return devices.Devices, nil
+}
+
+// filterGroupDevices retrieves the devices of a group that match the selector, excluding the deleted ones. The
+// devices are filtered before adding the authx information so that discarded devices do not require extra
+// requests.
+func (m *Manager) filterGroupDevices(deviceGroupID *grpc_device_go.DeviceGroupId, selector *entities.LabelSelector) ([]*grpc_device_go.Device, error) {
+	devices, err := m.listGroupDevices(deviceGroupID)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := m.getDeletedDevices(deviceGroupID)
+	if err != nil {
+		return nil, err
 	}
+	result := make([]*grpc_device_go.Device, 0)
+	for _, d := range devices {
+		if !deleted[d.DeviceId] && selector.Matches(d.Labels) {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
 
-	if len(result) > 0 {
-		latencies, err := m.latencyProvider.GetGroupLastLatencies(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+// getDevicePage sorts the devices and completes the ones in the requested page with the authx and latency
+// information.
+func (m *Manager) getDevicePage(entries []*deviceEntry, page *entities.PageRequest) (*grpc_device_manager_go.DeviceList, error) {
+	// Sorting by status or latency requires the last latency of all the devices, it is retrieved by group.
+	if page.SortBy == entities.SortByStatus || page.SortBy == entities.SortByLatency {
+		m.fillGroupLatencies(entries)
+	}
+	m.sortDevices(entries, page)
+
+	start, end := page.Bounds(m.pagination.PageSize(page.Size), len(entries))
+	result := make([]*grpc_device_manager_go.Device, 0)
+	for _, entry := range entries[start:end] {
+		device := entry.device
+		if entry.partial {
+			ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+			retrieved, err := m.devicesClient.GetDevice(ctx, &grpc_device_go.DeviceId{
+				OrganizationId: device.OrganizationId,
+				DeviceGroupId:  device.DeviceGroupId,
+				DeviceId:       device.DeviceId,
+			})
+			cancel()
+			if err != nil {
+				return nil, err
+			}
+			device = retrieved
+		}
+		toAdd, err := m.addAuthInfoToD(device)
 		if err != nil {
-			log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("error getting group latencies")
-		} else {
-			for _, latency := range latencies {
-				m.updateStatus(result, *latency)
+			return nil, err
+		}
+		if entry.latency == nil {
+			latency, err := m.latencyProvider.GetLastLatency(device.OrganizationId, device.DeviceGroupId, device.DeviceId)
+			if err != nil {
+				log.Error().Str("trace", err.DebugReport()).Msg("error getting device latency")
 			}
+			entry.latency = latency
 		}
+		toAdd.DeviceStatus = m.fillDeviceStatus(entry.latency)
+		result = append(result, toAdd)
 	}
 
 	return &grpc_device_manager_go.DeviceList{
-		Devices: result,
+		Devices:       result,
+		NextPageToken: page.NextToken(end, len(entries)),
 	}, nil
+}
 
+// fillGroupLatencies sets the last latency of the devices using one request per device group.
+func (m *Manager) fillGroupLatencies(entries []*deviceEntry) {
+	// latencies indexed by organization_id/device_group_id, nil if the latencies of the group cannot be retrieved
+	groups := make(map[string]map[string]*entities.Latency, 0)
+	for _, entry := range entries {
+		groupKey := fmt.Sprintf("%s/%s", entry.device.OrganizationId, entry.device.DeviceGroupId)
+		latencies, retrieved := groups[groupKey]
+		if !retrieved {
+			list, err := m.latencyProvider.GetGroupLastLatencies(entry.device.OrganizationId, entry.device.DeviceGroupId)
+			if err != nil {
+				log.Error().Str("trace", err.DebugReport()).Msg("error getting group latencies")
+			} else {
+				latencies = make(map[string]*entities.Latency, len(list))
+				for _, l := range list {
+					latencies[l.DeviceId] = l
+				}
+			}
+			groups[groupKey] = latencies
+		}
+		if latencies == nil {
+			continue
+		}
+		latency, exists := latencies[entry.device.DeviceId]
+		if !exists {
+			latency = entities.NewEmptyLatency()
+		}
+		entry.latency = latency
+	}
 }
 
 func (m *Manager) AddLabelToDevice(request *grpc_device_manager_go.DeviceLabelRequest) (*grpc_common_go.Success, error) {
+	// deleted devices must not be added back to the index
+	err := m.checkNotDeleted(request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	if err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
 	defer cancel()
 
-	_, err := m.devicesClient.UpdateDevice(ctx, &grpc_device_go.UpdateDeviceRequest{
+	updated, err := m.devicesClient.UpdateDevice(ctx, &grpc_device_go.UpdateDeviceRequest{
 		OrganizationId: request.OrganizationId,
 		DeviceGroupId:  request.DeviceGroupId,
 		DeviceId:       request.DeviceId,
@@ -513,14 +1035,20 @@ func (m *Manager) AddLabelToDevice(request *grpc_device_manager_go.DeviceLabelRe
 	if err != nil {
 		return nil, err
 	}
+	m.indexDevice(updated)
 	return &grpc_common_go.Success{}, nil
 }
 
 func (m *Manager) RemoveLabelFromDevice(request *grpc_device_manager_go.DeviceLabelRequest) (*grpc_common_go.Success, error) {
+	// deleted devices must not be added back to the index
+	err := m.checkNotDeleted(request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	if err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
 	defer cancel()
 
-	_, err := m.devicesClient.UpdateDevice(ctx, &grpc_device_go.UpdateDeviceRequest{
+	updated, err := m.devicesClient.UpdateDevice(ctx, &grpc_device_go.UpdateDeviceRequest{
 		OrganizationId: request.OrganizationId,
 		DeviceGroupId:  request.DeviceGroupId,
 		DeviceId:       request.DeviceId,
@@ -531,19 +1059,22 @@ func (m *Manager) RemoveLabelFromDevice(request *grpc_device_manager_go.DeviceLa
 	if err != nil {
 		return nil, err
 	}
+	m.indexDevice(updated)
 	return &grpc_common_go.Success{}, nil
 }
 
 func (m *Manager) UpdateDevice(request *grpc_device_manager_go.UpdateDeviceRequest) (*grpc_device_manager_go.Device, error) {
-	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
-	defer aCancel()
-	updateRequest := &grpc_authx_go.UpdateDeviceCredentialsRequest{
-		OrganizationId: request.OrganizationId,
-		DeviceGroupId:  request.DeviceGroupId,
-		DeviceId:       request.DeviceId,
-		Enabled:        request.Enabled,
+	err := m.checkNotDeleted(request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	if err != nil {
+		return nil, err
 	}
-	_, err := m.authxClient.UpdateDeviceCredentials(aCtx, updateRequest)
+	if request.Enabled {
+		err = m.checkNotPending(request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = m.updateDeviceCredentials(request.OrganizationId, request.DeviceGroupId, request.DeviceId, request.Enabled)
 	if err != nil {
 		return nil, err
 	}
@@ -559,6 +1090,11 @@ func (m *Manager) UpdateDevice(request *grpc_device_manager_go.UpdateDeviceReque
 }
 
 func (m *Manager) UpdateDeviceLocation(request *grpc_device_manager_go.UpdateDeviceLocationRequest) (*grpc_device_manager_go.Device, error) {
+	// deleted devices must not be added back to the index
+	err := m.checkNotDeleted(request.OrganizationId, request.DeviceGroupId, request.DeviceId)
+	if err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
 	defer cancel()
 
@@ -576,6 +1112,9 @@ func (m *Manager) UpdateDeviceLocation(request *grpc_device_manager_go.UpdateDev
 	if err != nil {
 		return nil, err
 	}
+	m.indexDevice(updated)
+	m.locateDevice(updated)
+	m.recordLocation(updated)
 
 	device, err := m.addAuthLatencyInfoToDevice(updated)
 
@@ -583,28 +1122,83 @@ func (m *Manager) UpdateDeviceLocation(request *grpc_device_manager_go.UpdateDev
 
 }
 
+// RemoveDevice deletes a device. The device can be restored until the retention period ends.
 func (m *Manager) RemoveDevice(deviceID *grpc_device_go.DeviceId) (*grpc_common_go.Success, error) {
-	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
-	defer aCancel()
-
-	_, err := m.authxClient.RemoveDeviceCredentials(aCtx, deviceID)
+	err := m.softDeleteDevice(deviceID)
 	if err != nil {
-		log.Warn().Interface("deviceID", deviceID).Msg("Device may be partially removed. Cannot remove auth information")
+		return nil, err
 	}
+	return &grpc_common_go.Success{}, nil
+}
 
-	err = m.latencyProvider.RemoveLatency(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+// SearchDevices retrieves a page of the devices of an organization that match the query using the device index.
+func (m *Manager) SearchDevices(query *entities.DeviceSearchQuery, page *entities.PageRequest) (*grpc_device_manager_go.DeviceList, error) {
+	err := m.checkOrganizationIndex(query.OrganizationId)
 	if err != nil {
-		log.Warn().Interface("deviceID", deviceID).Msg("Device may be partially removed. Cannot remove device latencies")
+		return nil, err
+	}
+	found, derr := m.indexProvider.SearchDevices(*query)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	entries := make([]*deviceEntry, 0, len(found))
+	for _, f := range found {
+		entries = append(entries, &deviceEntry{device: f.ToDevice(), partial: true})
 	}
+	if query.FilterByStatus {
+		m.fillGroupLatencies(entries)
+		filtered := make([]*deviceEntry, 0, len(entries))
+		for _, entry := range entries {
+			if m.fillDeviceStatus(entry.latency) == query.DeviceStatus {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+	return m.getDevicePage(entries, page)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
-	defer cancel()
+// checkOrganizationIndex builds the index of an organization from the system model information the first time
+// it is required. Afterwards, the index is updated by the operations of the manager.
+func (m *Manager) checkOrganizationIndex(organizationID string) error {
+	indexed, derr := m.indexProvider.IsOrganizationIndexed(organizationID)
+	if derr != nil {
+		return conversions.ToGRPCError(derr)
+	}
+	if indexed {
+		return nil
+	}
+	log.Debug().Str("organizationID", organizationID).Msg("building device index")
+	devices, err := m.filterOrganizationDevices(&grpc_organization_go.OrganizationId{OrganizationId: organizationID}, nil)
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		derr = m.indexProvider.AddDevice(*entities.NewDeviceIndexEntry(d))
+		if derr != nil {
+			return conversions.ToGRPCError(derr)
+		}
+	}
+	derr = m.indexProvider.SetOrganizationIndexed(organizationID)
+	if derr != nil {
+		return conversions.ToGRPCError(derr)
+	}
+	return nil
+}
 
-	removeRequest := &grpc_device_go.RemoveDeviceRequest{
-		OrganizationId: deviceID.OrganizationId,
-		DeviceGroupId:  deviceID.DeviceGroupId,
-		DeviceId:       deviceID.DeviceId,
+// indexDevice updates the entry of a device in the index. The index is not the source of truth, so failures
+// are only reported.
+func (m *Manager) indexDevice(device *grpc_device_go.Device) {
+	err := m.indexProvider.AddDevice(*entities.NewDeviceIndexEntry(device))
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Str("deviceID", device.DeviceId).Msg("cannot update device index")
 	}
+}
 
-	return m.devicesClient.RemoveDevice(ctx, removeRequest)
+// unindexDevice removes the entry of a device from the index.
+func (m *Manager) unindexDevice(deviceID *grpc_device_go.DeviceId) {
+	err := m.indexProvider.RemoveDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove device from the index")
+	}
 }
@@ -0,0 +1,307 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-authx-go"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// ReconcileGracePeriod is the time after the creation of a device or device group during which its missing
+// credentials are not reported, so that registrations in progress are not considered inconsistent.
+const ReconcileGracePeriod = time.Minute * 10
+
+// ReconcileOrganization compares the devices and device groups of an organization in system model with their
+// credentials in authx and with the latencies stored by the device manager. Authx cannot list the credentials of
+// an organization, so dangling credentials are searched among the devices known by the device index and the
+// latency store. If apply is set, the inconsistencies are fixed: missing credentials are created, dangling ones
+// are removed and the latencies of removed devices are purged.
+func (m *Manager) ReconcileOrganization(organizationID string, apply bool) (*entities.ReconcileReport, error) {
+	report := entities.NewReconcileReport(organizationID, apply)
+
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	dgs, err := m.devicesClient.ListDeviceGroups(ctx, &grpc_organization_go.OrganizationId{OrganizationId: organizationID})
+	if err != nil {
+		return nil, err
+	}
+	createdBefore := time.Now().Add(-ReconcileGracePeriod).Unix()
+	groups := make(map[string]bool, len(dgs.Groups))
+	devices := make(map[string]bool, 0)
+	for _, dg := range dgs.Groups {
+		groups[dg.DeviceGroupId] = true
+		deviceGroupID := &grpc_device_go.DeviceGroupId{
+			OrganizationId: dg.OrganizationId,
+			DeviceGroupId:  dg.DeviceGroupId,
+		}
+		if dg.Created < createdBefore {
+			err = m.reconcileDeviceGroupCredentials(report, deviceGroupID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// deleted devices are still in system model and keep their credentials
+		groupDevices, err := m.listGroupDevices(deviceGroupID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range groupDevices {
+			devices[deviceKey(d.DeviceGroupId, d.DeviceId)] = true
+			if d.RegisterSince >= createdBefore {
+				continue
+			}
+			err = m.reconcileDeviceCredentials(report, &grpc_device_go.DeviceId{
+				OrganizationId: d.OrganizationId,
+				DeviceGroupId:  d.DeviceGroupId,
+				DeviceId:       d.DeviceId,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	candidates, latencies, err := m.getKnownDevices(organizationID)
+	if err != nil {
+		return nil, err
+	}
+	checkedGroups := make(map[string]bool, 0)
+	for _, candidate := range candidates {
+		if !groups[candidate.DeviceGroupId] && !checkedGroups[candidate.DeviceGroupId] {
+			checkedGroups[candidate.DeviceGroupId] = true
+			err = m.reconcileDanglingDeviceGroup(report, &grpc_device_go.DeviceGroupId{
+				OrganizationId: organizationID,
+				DeviceGroupId:  candidate.DeviceGroupId,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if devices[deviceKey(candidate.DeviceGroupId, candidate.DeviceId)] {
+			continue
+		}
+		err = m.reconcileDanglingDevice(report, candidate, latencies[deviceKey(candidate.DeviceGroupId, candidate.DeviceId)])
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Debug().Str("organizationID", organizationID).Bool("apply", apply).Int("issues", len(report.Issues)).
+		Int("fixed", report.Fixed()).Msg("organization has been reconciled")
+	return report, nil
+}
+
+// deviceKey identifies a device inside an organization.
+func deviceKey(deviceGroupID string, deviceID string) string {
+	return deviceGroupID + "/" + deviceID
+}
+
+// getKnownDevices returns the devices of an organization found in the device index and in the latency store,
+// together with the devices that have latencies.
+func (m *Manager) getKnownDevices(organizationID string) ([]*grpc_device_go.DeviceId, map[string]bool, error) {
+	entries, derr := m.indexProvider.SearchDevices(entities.DeviceSearchQuery{OrganizationId: organizationID})
+	if derr != nil {
+		return nil, nil, conversions.ToGRPCError(derr)
+	}
+	lastLatencies, derr := m.latencyProvider.GetOrganizationLastLatencies(organizationID)
+	if derr != nil {
+		return nil, nil, conversions.ToGRPCError(derr)
+	}
+	known := make(map[string]bool, 0)
+	result := make([]*grpc_device_go.DeviceId, 0)
+	add := func(deviceGroupID string, deviceID string) {
+		key := deviceKey(deviceGroupID, deviceID)
+		if !known[key] {
+			known[key] = true
+			result = append(result, &grpc_device_go.DeviceId{
+				OrganizationId: organizationID,
+				DeviceGroupId:  deviceGroupID,
+				DeviceId:       deviceID,
+			})
+		}
+	}
+	for _, entry := range entries {
+		add(entry.DeviceGroupId, entry.DeviceId)
+	}
+	latencies := make(map[string]bool, len(lastLatencies))
+	for _, latency := range lastLatencies {
+		add(latency.DeviceGroupId, latency.DeviceId)
+		latencies[deviceKey(latency.DeviceGroupId, latency.DeviceId)] = true
+	}
+	return result, latencies, nil
+}
+
+// reconcileDeviceGroupCredentials checks that a device group of system model has credentials. Missing
+// credentials are created disabled, so that an operator reviews the group before it is used again.
+func (m *Manager) reconcileDeviceGroupCredentials(report *entities.ReconcileReport, deviceGroupID *grpc_device_go.DeviceGroupId) error {
+	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+	defer aCancel()
+	_, err := m.authxClient.GetDeviceGroupCredentials(aCtx, deviceGroupID)
+	if err == nil {
+		return nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+	report.AddIssue(entities.MissingDeviceGroupCredentials, deviceGroupID.DeviceGroupId, "", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+		defer cancel()
+		_, err := m.authxClient.AddDeviceGroupCredentials(ctx, &grpc_authx_go.AddDeviceGroupCredentialsRequest{
+			OrganizationId:            deviceGroupID.OrganizationId,
+			DeviceGroupId:             deviceGroupID.DeviceGroupId,
+			Enabled:                   false,
+			DefaultDeviceConnectivity: false,
+		})
+		return err
+	})
+	return nil
+}
+
+// reconcileDeviceCredentials checks that a device of system model has credentials. The credentials of devices
+// waiting for approval are disabled after they are created.
+func (m *Manager) reconcileDeviceCredentials(report *entities.ReconcileReport, deviceID *grpc_device_go.DeviceId) error {
+	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+	defer aCancel()
+	_, err := m.authxClient.GetDeviceCredentials(aCtx, deviceID)
+	if err == nil {
+		return nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+	report.AddIssue(entities.MissingDeviceCredentials, deviceID.DeviceGroupId, deviceID.DeviceId, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+		defer cancel()
+		_, err := m.authxClient.AddDeviceCredentials(ctx, &grpc_authx_go.AddDeviceCredentialsRequest{
+			OrganizationId: deviceID.OrganizationId,
+			DeviceGroupId:  deviceID.DeviceGroupId,
+			DeviceId:       deviceID.DeviceId,
+		})
+		if err != nil {
+			return err
+		}
+		pending, derr := m.approvalProvider.ExistsPendingDevice(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+		if derr != nil {
+			return conversions.ToGRPCError(derr)
+		}
+		if pending {
+			return m.updateDeviceCredentials(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId, false)
+		}
+		return nil
+	})
+	return nil
+}
+
+// reconcileDanglingDeviceGroup checks if a device group that is not in system model still has credentials.
+func (m *Manager) reconcileDanglingDeviceGroup(report *entities.ReconcileReport, deviceGroupID *grpc_device_go.DeviceGroupId) error {
+	// the group may have been created after system model was listed
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	_, err := m.devicesClient.GetDeviceGroup(ctx, deviceGroupID)
+	if err == nil {
+		return nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+	defer aCancel()
+	_, err = m.authxClient.GetDeviceGroupCredentials(aCtx, deviceGroupID)
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	report.AddIssue(entities.DanglingDeviceGroupCredentials, deviceGroupID.DeviceGroupId, "", func() error {
+		return m.executeRepair(entities.NewDeviceGroupRepairTask(entities.RemoveDeviceGroupCredentialsOperation,
+			deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId))
+	})
+	return nil
+}
+
+// reconcileDanglingDevice checks if a device that is not in system model still has credentials or latencies.
+// The index entry of the device is also removed when the inconsistencies are fixed.
+func (m *Manager) reconcileDanglingDevice(report *entities.ReconcileReport, deviceID *grpc_device_go.DeviceId, hasLatency bool) error {
+	// the device may have been registered after system model was listed
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	_, err := m.devicesClient.GetDevice(ctx, deviceID)
+	if err == nil {
+		return nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+	defer aCancel()
+	_, err = m.authxClient.GetDeviceCredentials(aCtx, deviceID)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	if err == nil {
+		report.AddIssue(entities.DanglingDeviceCredentials, deviceID.DeviceGroupId, deviceID.DeviceId, func() error {
+			return m.executeRepair(entities.NewDeviceRepairTask(entities.RemoveDeviceCredentialsOperation,
+				deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+		})
+	}
+	if hasLatency {
+		report.AddIssue(entities.OrphanLatency, deviceID.DeviceGroupId, deviceID.DeviceId, func() error {
+			return m.executeRepair(entities.NewDeviceRepairTask(entities.RemoveDeviceLatencyOperation,
+				deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+		})
+	}
+	if report.Apply {
+		m.unindexDevice(deviceID)
+		m.unlocateDevice(deviceID)
+	}
+	return nil
+}
+
+// RunReconciler periodically reconciles all the organizations of system model. In dry-run mode the
+// inconsistencies are only logged.
+func (m *Manager) RunReconciler(orgClient grpc_organization_go.OrganizationsClient, period time.Duration, apply bool) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+		orgs, err := orgClient.ListOrganizations(ctx, &grpc_common_go.Empty{})
+		cancel()
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot list organizations to reconcile")
+			continue
+		}
+		for _, org := range orgs.Organizations {
+			report, err := m.ReconcileOrganization(org.OrganizationId, apply)
+			if err != nil {
+				log.Warn().Err(err).Str("organizationID", org.OrganizationId).Msg("cannot reconcile organization")
+				continue
+			}
+			for _, issue := range report.Issues {
+				log.Warn().Str("organizationID", org.OrganizationId).Interface("issue", issue).Msg("inconsistency found")
+			}
+		}
+	}
+}
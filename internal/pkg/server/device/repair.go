@@ -0,0 +1,152 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// RepairQueuePeriod is the time between two executions of the repair queue.
+const RepairQueuePeriod = time.Minute
+
+// ignoreNotFound considers the removal of an entity that does not exist as successful, so that removals can be
+// retried.
+func ignoreNotFound(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return err
+}
+
+// executeRepair runs the operation of a repair task. All the operations are idempotent.
+func (m *Manager) executeRepair(task *entities.RepairTask) error {
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: task.OrganizationId,
+		DeviceGroupId:  task.DeviceGroupId,
+		DeviceId:       task.DeviceId,
+	}
+	deviceGroupID := &grpc_device_go.DeviceGroupId{
+		OrganizationId: task.OrganizationId,
+		DeviceGroupId:  task.DeviceGroupId,
+	}
+	switch task.Operation {
+	case entities.RemoveDeviceOperation:
+		ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+		defer cancel()
+		_, err := m.devicesClient.RemoveDevice(ctx, &grpc_device_go.RemoveDeviceRequest{
+			OrganizationId: task.OrganizationId,
+			DeviceGroupId:  task.DeviceGroupId,
+			DeviceId:       task.DeviceId,
+		})
+		return ignoreNotFound(err)
+	case entities.RemoveDeviceCredentialsOperation:
+		aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+		defer aCancel()
+		_, err := m.authxClient.RemoveDeviceCredentials(aCtx, deviceID)
+		return ignoreNotFound(err)
+	case entities.RemoveDeviceLatencyOperation:
+		err := m.latencyProvider.RemoveLatency(task.OrganizationId, task.DeviceGroupId, task.DeviceId)
+		if err != nil {
+			return conversions.ToGRPCError(err)
+		}
+		err = m.latencyProvider.RemoveLastLatency(task.OrganizationId, task.DeviceGroupId, task.DeviceId)
+		if err != nil {
+			return conversions.ToGRPCError(err)
+		}
+		return nil
+	case entities.EnableDeviceCredentialsOperation:
+		err := m.updateDeviceCredentials(task.OrganizationId, task.DeviceGroupId, task.DeviceId, true)
+		return err
+	case entities.RemoveDeviceGroupOperation:
+		ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+		defer cancel()
+		_, err := m.devicesClient.RemoveDeviceGroup(ctx, &grpc_device_go.RemoveDeviceGroupRequest{
+			OrganizationId: task.OrganizationId,
+			DeviceGroupId:  task.DeviceGroupId,
+		})
+		return ignoreNotFound(err)
+	case entities.RemoveDeviceGroupCredentialsOperation:
+		aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+		defer aCancel()
+		_, err := m.authxClient.RemoveDeviceGroupCredentials(aCtx, deviceGroupID)
+		return ignoreNotFound(err)
+	}
+	return conversions.ToGRPCError(derrors.NewInvalidArgumentError("unsupported repair operation").WithParams(task.Operation))
+}
+
+// enqueueRepair stores a task in the repair queue.
+func (m *Manager) enqueueRepair(task *entities.RepairTask, cause error) {
+	task.Queued(cause, time.Now())
+	err := m.repairProvider.AddTask(*task)
+	if err != nil {
+		log.Error().Str("trace", err.DebugReport()).Interface("task", task).Msg("cannot queue repair task, the components may be inconsistent")
+		return
+	}
+	log.Info().Str("taskID", task.TaskId).Str("operation", string(task.Operation)).Msg("repair task has been queued")
+}
+
+// ProcessRepairQueue executes the repair tasks that are due. It returns the number of completed tasks.
+func (m *Manager) ProcessRepairQueue() (int, error) {
+	now := time.Now()
+	tasks, err := m.repairProvider.ListDueTasks(now.Unix())
+	if err != nil {
+		return 0, conversions.ToGRPCError(err)
+	}
+	completed := 0
+	for _, task := range tasks {
+		rErr := m.executeRepair(task)
+		if rErr != nil {
+			task.Failed(rErr, now)
+			uErr := m.repairProvider.UpdateTask(*task)
+			if uErr != nil {
+				log.Warn().Str("trace", uErr.DebugReport()).Str("taskID", task.TaskId).Msg("cannot update repair task")
+			}
+			continue
+		}
+		dErr := m.repairProvider.RemoveTask(task.TaskId)
+		if dErr != nil {
+			log.Warn().Str("trace", dErr.DebugReport()).Str("taskID", task.TaskId).Msg("cannot remove completed repair task")
+			continue
+		}
+		completed++
+	}
+	return completed, nil
+}
+
+// RunRepairQueue periodically executes the repair tasks that are due.
+func (m *Manager) RunRepairQueue(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for range ticker.C {
+		completed, err := m.ProcessRepairQueue()
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot process repair queue")
+			continue
+		}
+		if completed > 0 {
+			log.Info().Int("completed", completed).Msg("repair tasks have been completed")
+		}
+	}
+}
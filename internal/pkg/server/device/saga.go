@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// sagaStep is one of the writes of an operation that involves several components.
+type sagaStep struct {
+	// name of the step, used in the logs
+	name string
+	// action performed by the step
+	action func() error
+	// compensation returns the task that undoes the action if a later step fails. It may be nil, or return nil,
+	// if the action does not need to be undone.
+	compensation func() *entities.RepairTask
+	// repair is queued if the action fails instead of aborting the operation. It is used by the steps that complete
+	// an operation that cannot be undone, such as the removal of an entity.
+	repair *entities.RepairTask
+}
+
+// saga executes a sequence of steps. If a step fails, the completed steps are compensated in reverse order, and
+// the compensations that cannot be executed are stored in the repair queue.
+type saga struct {
+	// name of the operation, used in the logs
+	name string
+	// steps of the operation
+	steps []sagaStep
+	// execute runs a repair task
+	execute func(task *entities.RepairTask) error
+	// enqueue stores a repair task that will be retried in the background
+	enqueue func(task *entities.RepairTask, cause error)
+}
+
+// newSaga creates a saga whose compensations are executed by the manager.
+func (m *Manager) newSaga(name string) *saga {
+	return &saga{
+		name:    name,
+		steps:   make([]sagaStep, 0),
+		execute: m.executeRepair,
+		enqueue: m.enqueueRepair,
+	}
+}
+
+// addStep appends a step to the saga.
+func (s *saga) addStep(step sagaStep) *saga {
+	s.steps = append(s.steps, step)
+	return s
+}
+
+// run executes the steps of the saga. It returns the error of the step that aborted the saga.
+func (s *saga) run() error {
+	for i, step := range s.steps {
+		err := step.action()
+		if err == nil {
+			continue
+		}
+		if step.repair != nil {
+			log.Warn().Err(err).Str("saga", s.name).Str("step", step.name).Msg("step failed, queued for repair")
+			s.enqueue(step.repair, err)
+			continue
+		}
+		log.Warn().Err(err).Str("saga", s.name).Str("step", step.name).Msg("step failed, compensating previous steps")
+		s.compensate(i)
+		return err
+	}
+	return nil
+}
+
+// compensate undoes the steps executed before the failed one.
+func (s *saga) compensate(failed int) {
+	for i := failed - 1; i >= 0; i-- {
+		if s.steps[i].compensation == nil {
+			continue
+		}
+		task := s.steps[i].compensation()
+		if task == nil {
+			continue
+		}
+		err := s.execute(task)
+		if err != nil {
+			log.Warn().Err(err).Str("saga", s.name).Str("step", s.steps[i].name).Msg("compensation failed, queued for repair")
+			s.enqueue(task, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"fmt"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Saga", func() {
+
+	var executed []entities.RepairOperation
+	var queued []entities.RepairOperation
+	var failCompensation bool
+
+	newTestSaga := func() *saga {
+		return &saga{
+			name:  "test",
+			steps: make([]sagaStep, 0),
+			execute: func(task *entities.RepairTask) error {
+				if failCompensation {
+					return fmt.Errorf("unavailable")
+				}
+				executed = append(executed, task.Operation)
+				return nil
+			},
+			enqueue: func(task *entities.RepairTask, cause error) {
+				queued = append(queued, task.Operation)
+			},
+		}
+	}
+	succeed := func() error { return nil }
+	fail := func() error { return fmt.Errorf("failed") }
+	compensateWith := func(operation entities.RepairOperation) func() *entities.RepairTask {
+		return func() *entities.RepairTask {
+			return entities.NewDeviceRepairTask(operation, "org", "dg", "device")
+		}
+	}
+
+	ginkgo.BeforeEach(func() {
+		executed = make([]entities.RepairOperation, 0)
+		queued = make([]entities.RepairOperation, 0)
+		failCompensation = false
+	})
+
+	ginkgo.It("should not compensate a successful saga", func() {
+		err := newTestSaga().
+			addStep(sagaStep{name: "first", action: succeed, compensation: compensateWith(entities.RemoveDeviceOperation)}).
+			addStep(sagaStep{name: "second", action: succeed}).
+			run()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(executed).Should(gomega.BeEmpty())
+		gomega.Expect(queued).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should compensate the completed steps in reverse order", func() {
+		err := newTestSaga().
+			addStep(sagaStep{name: "first", action: succeed, compensation: compensateWith(entities.RemoveDeviceOperation)}).
+			addStep(sagaStep{name: "second", action: succeed, compensation: compensateWith(entities.RemoveDeviceCredentialsOperation)}).
+			addStep(sagaStep{name: "third", action: fail, compensation: compensateWith(entities.RemoveDeviceLatencyOperation)}).
+			run()
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(executed).Should(gomega.Equal([]entities.RepairOperation{
+			entities.RemoveDeviceCredentialsOperation, entities.RemoveDeviceOperation}))
+		gomega.Expect(queued).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should queue the compensations that fail", func() {
+		failCompensation = true
+		err := newTestSaga().
+			addStep(sagaStep{name: "first", action: succeed, compensation: compensateWith(entities.RemoveDeviceOperation)}).
+			addStep(sagaStep{name: "second", action: fail}).
+			run()
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(queued).Should(gomega.Equal([]entities.RepairOperation{entities.RemoveDeviceOperation}))
+	})
+
+	ginkgo.It("should queue the repair of a failed step and continue", func() {
+		secondExecuted := false
+		err := newTestSaga().
+			addStep(sagaStep{name: "first", action: fail,
+				repair: entities.NewDeviceRepairTask(entities.RemoveDeviceLatencyOperation, "org", "dg", "device")}).
+			addStep(sagaStep{name: "second", action: func() error {
+				secondExecuted = true
+				return nil
+			}}).
+			run()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(secondExecuted).Should(gomega.BeTrue())
+		gomega.Expect(queued).Should(gomega.Equal([]entities.RepairOperation{entities.RemoveDeviceLatencyOperation}))
+	})
+})
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-device-go"
+	"sort"
+	"strings"
+)
+
+// deviceEntry links a device retrieved from system model with its last latency when it is known.
+type deviceEntry struct {
+	device  *grpc_device_go.Device
+	latency *entities.Latency
+	// partial is set when the device has been built from the index and must be retrieved from system model
+	partial bool
+}
+
+func newDeviceEntries(devices []*grpc_device_go.Device) []*deviceEntry {
+	entries := make([]*deviceEntry, 0, len(devices))
+	for _, d := range devices {
+		entries = append(entries, &deviceEntry{device: d})
+	}
+	return entries
+}
+
+// sortDevices sorts the devices by the field of the page request. Ties are resolved using the device
+// and group identifiers so that consecutive pages are consistent.
+func (m *Manager) sortDevices(entries []*deviceEntry, page *entities.PageRequest) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return m.compareDevices(entries[i], entries[j], page) < 0
+	})
+}
+
+func (m *Manager) compareDevices(a *deviceEntry, b *deviceEntry, page *entities.PageRequest) int {
+	result := 0
+	switch page.SortBy {
+	case entities.SortByRegistration:
+		result = compareInt64(a.device.RegisterSince, b.device.RegisterSince)
+	case entities.SortByStatus:
+		result = compareInt64(int64(m.fillDeviceStatus(a.latency)), int64(m.fillDeviceStatus(b.latency)))
+	case entities.SortByLatency:
+		// devices without measures are always at the end of the list
+		aMissing := a.latency == nil || a.latency.Latency == -1
+		bMissing := b.latency == nil || b.latency.Latency == -1
+		if aMissing != bMissing {
+			if aMissing {
+				return 1
+			}
+			return -1
+		}
+		if !aMissing {
+			result = compareInt64(int64(a.latency.Latency), int64(b.latency.Latency))
+		}
+	}
+	if result == 0 {
+		result = strings.Compare(a.device.DeviceId, b.device.DeviceId)
+	}
+	if result == 0 {
+		result = strings.Compare(a.device.DeviceGroupId, b.device.DeviceGroupId)
+	}
+	if page.Descending {
+		return -result
+	}
+	return result
+}
+
+// sortDeviceGroups sorts the device groups by the field of the page request.
+func sortDeviceGroups(groups []*grpc_device_go.DeviceGroup, page *entities.PageRequest) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		result := 0
+		if page.SortBy == entities.SortByRegistration {
+			result = compareInt64(groups[i].Created, groups[j].Created)
+		}
+		if result == 0 {
+			result = strings.Compare(groups[i].DeviceGroupId, groups[j].DeviceGroupId)
+		}
+		if page.Descending {
+			return result > 0
+		}
+		return result < 0
+	})
+}
+
+func compareInt64(a int64, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// TokenUpdateRetries is the number of attempts to update the uses of a token that is being used concurrently.
+const TokenUpdateRetries = 5
+
+// AddRegistrationToken creates a registration token for a device group. The token value is only returned here.
+func (m *Manager) AddRegistrationToken(request *grpc_device_manager_go.AddRegistrationTokenRequest) (*grpc_device_manager_go.RegistrationToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DeviceClientTimeout)
+	defer cancel()
+	_, err := m.devicesClient.GetDeviceGroup(ctx, &grpc_device_go.DeviceGroupId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	registrationToken, value, derr := entities.NewRegistrationToken(request)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	derr = m.tokenProvider.AddToken(*registrationToken)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	log.Debug().Str("organizationID", request.OrganizationId).Str("deviceGroupID", request.DeviceGroupId).
+		Str("tokenID", registrationToken.TokenId).Msg("registration token has been added")
+	result := registrationToken.ToGRPC()
+	result.Token = value
+	return result, nil
+}
+
+// ListRegistrationTokens retrieves the registration tokens of a device group.
+func (m *Manager) ListRegistrationTokens(deviceGroupID *grpc_device_go.DeviceGroupId) (*grpc_device_manager_go.RegistrationTokenList, error) {
+	tokens, err := m.tokenProvider.ListTokens(deviceGroupID.OrganizationId, deviceGroupID.DeviceGroupId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	result := make([]*grpc_device_manager_go.RegistrationToken, 0, len(tokens))
+	for _, t := range tokens {
+		result = append(result, t.ToGRPC())
+	}
+	return &grpc_device_manager_go.RegistrationTokenList{
+		Tokens: result,
+	}, nil
+}
+
+// RevokeRegistrationToken prevents a token from being used again. The token is kept so that the devices
+// registered with it can still be traced.
+func (m *Manager) RevokeRegistrationToken(tokenID *grpc_device_manager_go.RegistrationTokenId) (*grpc_common_go.Success, error) {
+	err := m.tokenProvider.RevokeToken(tokenID.OrganizationId, tokenID.DeviceGroupId, tokenID.TokenId)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	log.Debug().Interface("tokenID", tokenID).Msg("registration token has been revoked")
+	return &grpc_common_go.Success{}, nil
+}
+
+// registrationTokenLogin checks that the token of a registration request is valid and reserves one of its uses.
+// It returns the identifier of the token.
+func (m *Manager) registrationTokenLogin(request *grpc_device_manager_go.RegisterDeviceRequest) (string, error) {
+	tokenID, secret, derr := entities.ParseRegistrationToken(request.RegistrationToken)
+	if derr != nil {
+		return "", conversions.ToGRPCError(derr)
+	}
+	for attempt := 0; attempt < TokenUpdateRetries; attempt++ {
+		registrationToken, derr := m.tokenProvider.GetToken(request.OrganizationId, request.DeviceGroupId, tokenID)
+		if derr != nil {
+			return "", conversions.ToGRPCError(derrors.NewUnauthenticatedError("registration token is not valid", derr))
+		}
+		derr = registrationToken.CanRegister(secret, request.DeviceId, time.Now())
+		if derr != nil {
+			return "", conversions.ToGRPCError(derr)
+		}
+		applied, derr := m.tokenProvider.UpdateTokenUses(request.OrganizationId, request.DeviceGroupId, tokenID,
+			registrationToken.Uses, registrationToken.Uses+1)
+		if derr != nil {
+			return "", conversions.ToGRPCError(derr)
+		}
+		if applied {
+			return tokenID, nil
+		}
+	}
+	return "", conversions.ToGRPCError(derrors.NewUnavailableError("registration token is being used concurrently").WithParams(tokenID))
+}
+
+// releaseTokenUse returns the use reserved by a registration that failed.
+func (m *Manager) releaseTokenUse(organizationID string, deviceGroupID string, tokenID string) {
+	for attempt := 0; attempt < TokenUpdateRetries; attempt++ {
+		registrationToken, err := m.tokenProvider.GetToken(organizationID, deviceGroupID, tokenID)
+		if err == nil && registrationToken.Uses > 0 {
+			applied, uErr := m.tokenProvider.UpdateTokenUses(organizationID, deviceGroupID, tokenID,
+				registrationToken.Uses, registrationToken.Uses-1)
+			if uErr == nil && applied {
+				return
+			}
+		}
+	}
+	log.Warn().Str("tokenID", tokenID).Msg("cannot release the use of a registration token")
+}
+
+// deviceGroupCredentialsLogin checks that the device group accepts new devices when the registration does not
+// include the device group API key.
+func (m *Manager) deviceGroupCredentialsLogin(organizationID string, deviceGroupID string) error {
+	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+	defer aCancel()
+	dgc, err := m.authxClient.GetDeviceGroupCredentials(aCtx, &grpc_device_go.DeviceGroupId{
+		OrganizationId: organizationID,
+		DeviceGroupId:  deviceGroupID,
+	})
+	if err != nil {
+		return err
+	}
+	return m.deviceGroupLogin(organizationID, dgc.DeviceGroupApiKey)
+}
+
+// recordDeviceToken stores the token used to register a device.
+func (m *Manager) recordDeviceToken(organizationID string, deviceGroupID string, deviceID string, tokenID string) {
+	err := m.tokenProvider.SetDeviceToken(organizationID, deviceGroupID, deviceID, tokenID)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Str("deviceID", deviceID).Str("tokenID", tokenID).Msg("cannot record device registration token")
+	}
+}
+
+// checkDeviceToken checks that an existing device was registered with the given token.
+func (m *Manager) checkDeviceToken(organizationID string, deviceGroupID string, deviceID string, tokenID string) error {
+	recorded, err := m.tokenProvider.GetDeviceToken(organizationID, deviceGroupID, deviceID)
+	if err != nil {
+		return conversions.ToGRPCError(err)
+	}
+	if recorded != tokenID {
+		return conversions.ToGRPCError(derrors.NewAlreadyExistsError(
+			"device was not registered with this registration token").WithParams(deviceID))
+	}
+	return nil
+}
+
+// removeDeviceToken removes the token record of a device.
+func (m *Manager) removeDeviceToken(deviceID *grpc_device_go.DeviceId) {
+	err := m.tokenProvider.RemoveDeviceToken(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove device registration token")
+	}
+}
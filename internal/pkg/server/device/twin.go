@@ -0,0 +1,257 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"crypto/subtle"
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-device-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// TwinUpdateRetries is the number of attempts to update a device twin that is being updated concurrently.
+const TwinUpdateRetries = 5
+
+// TwinWatcherBuffer is the number of changes that can be queued for a watcher before new changes are dropped.
+const TwinWatcherBuffer = 16
+
+// twinWatchers keeps the subscriptions to the changes of the device twins of this instance.
+type twinWatchers struct {
+	sync.Mutex
+	// subscriptions indexed by organization_id + device_group_id + device_id
+	subscriptions map[string]map[chan *grpc_device_manager_go.DeviceTwinChange]bool
+}
+
+// watcherKey identifies the device of a subscription.
+func watcherKey(deviceID *grpc_device_go.DeviceId) string {
+	return deviceID.OrganizationId + "/" + deviceID.DeviceGroupId + "/" + deviceID.DeviceId
+}
+
+func newTwinWatchers() *twinWatchers {
+	return &twinWatchers{
+		subscriptions: make(map[string]map[chan *grpc_device_manager_go.DeviceTwinChange]bool, 0),
+	}
+}
+
+func (w *twinWatchers) subscribe(deviceID *grpc_device_go.DeviceId) chan *grpc_device_manager_go.DeviceTwinChange {
+	w.Lock()
+	defer w.Unlock()
+
+	key := watcherKey(deviceID)
+	if _, exists := w.subscriptions[key]; !exists {
+		w.subscriptions[key] = make(map[chan *grpc_device_manager_go.DeviceTwinChange]bool, 0)
+	}
+	changes := make(chan *grpc_device_manager_go.DeviceTwinChange, TwinWatcherBuffer)
+	w.subscriptions[key][changes] = true
+	return changes
+}
+
+func (w *twinWatchers) unsubscribe(deviceID *grpc_device_go.DeviceId, changes chan *grpc_device_manager_go.DeviceTwinChange) {
+	w.Lock()
+	defer w.Unlock()
+
+	key := watcherKey(deviceID)
+	delete(w.subscriptions[key], changes)
+	if len(w.subscriptions[key]) == 0 {
+		delete(w.subscriptions, key)
+	}
+}
+
+// notify sends a change to the watchers of a twin. Watchers that do not keep up lose the change, which they can
+// detect with the versions of the documents.
+func (w *twinWatchers) notify(deviceID *grpc_device_go.DeviceId, change *grpc_device_manager_go.DeviceTwinChange) {
+	w.Lock()
+	defer w.Unlock()
+
+	for changes := range w.subscriptions[watcherKey(deviceID)] {
+		select {
+		case changes <- change:
+		default:
+			log.Warn().Interface("deviceID", deviceID).Msg("device twin watcher is full, dropping change")
+		}
+	}
+}
+
+// GetDeviceTwin retrieves the twin of a device. Devices whose twin has not been updated have empty documents.
+func (m *Manager) GetDeviceTwin(deviceID *grpc_device_go.DeviceId) (*grpc_device_manager_go.DeviceTwin, error) {
+	err := m.checkDeviceExists(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	twin, derr := m.twinProvider.GetTwin(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	if twin == nil {
+		twin = entities.NewDeviceTwin(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	}
+	return twin.ToGRPC(), nil
+}
+
+// PatchDesiredState applies a JSON merge patch to the desired document of a device twin.
+func (m *Manager) PatchDesiredState(request *grpc_device_manager_go.PatchDesiredStateRequest) (*grpc_device_manager_go.DeviceTwin, error) {
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+	}
+	err := m.checkDeviceExists(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return m.updateTwin(deviceID, grpc_device_manager_go.DeviceTwinChangeType_DESIRED,
+		func(twin *entities.DeviceTwin) (bool, int64, derrors.Error) {
+			previous := twin.DesiredVersion
+			changed, derr := twin.PatchDesired(request.Patch, time.Now().Unix())
+			return changed, previous, derr
+		}, m.twinProvider.UpdateDesired)
+}
+
+// ReportDeviceState applies a JSON merge patch sent by a device to the reported document of its twin. The device
+// is authenticated with its API key.
+func (m *Manager) ReportDeviceState(request *grpc_device_manager_go.ReportDeviceStateRequest) (*grpc_device_manager_go.DeviceTwin, error) {
+	deviceID := &grpc_device_go.DeviceId{
+		OrganizationId: request.OrganizationId,
+		DeviceGroupId:  request.DeviceGroupId,
+		DeviceId:       request.DeviceId,
+	}
+	err := m.deviceLogin(deviceID, request.DeviceApiKey)
+	if err != nil {
+		return nil, err
+	}
+	return m.updateTwin(deviceID, grpc_device_manager_go.DeviceTwinChangeType_REPORTED,
+		func(twin *entities.DeviceTwin) (bool, int64, derrors.Error) {
+			previous := twin.ReportedVersion
+			changed, derr := twin.PatchReported(request.Patch, time.Now().Unix())
+			return changed, previous, derr
+		}, m.twinProvider.UpdateReported)
+}
+
+// WatchDeviceTwin sends the changes of a device twin received by this instance until the context is done.
+func (m *Manager) WatchDeviceTwin(ctx context.Context, deviceID *grpc_device_go.DeviceId,
+	send func(change *grpc_device_manager_go.DeviceTwinChange) error) error {
+	err := m.checkDeviceExists(deviceID)
+	if err != nil {
+		return err
+	}
+	changes := m.twinWatchers.subscribe(deviceID)
+	defer m.twinWatchers.unsubscribe(deviceID, changes)
+	log.Debug().Interface("deviceID", deviceID).Msg("watching device twin")
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change := <-changes:
+			err := send(change)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// updateTwin applies a change to one of the documents of a device twin, creating the twin if it does not exist.
+// The change is retried if the document is updated concurrently, and notified to the watchers once stored.
+func (m *Manager) updateTwin(deviceID *grpc_device_go.DeviceId, changeType grpc_device_manager_go.DeviceTwinChangeType,
+	apply func(twin *entities.DeviceTwin) (bool, int64, derrors.Error),
+	update func(twin entities.DeviceTwin, previousVersion int64) (bool, derrors.Error)) (*grpc_device_manager_go.DeviceTwin, error) {
+	for attempt := 0; attempt < TwinUpdateRetries; attempt++ {
+		twin, err := m.getOrCreateTwin(deviceID)
+		if err != nil {
+			return nil, err
+		}
+		changed, previous, derr := apply(twin)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		if !changed {
+			return twin.ToGRPC(), nil
+		}
+		applied, derr := update(*twin, previous)
+		if derr != nil {
+			return nil, conversions.ToGRPCError(derr)
+		}
+		if applied {
+			result := twin.ToGRPC()
+			m.twinWatchers.notify(deviceID, &grpc_device_manager_go.DeviceTwinChange{
+				ChangeType: changeType,
+				Twin:       result,
+			})
+			log.Debug().Interface("deviceID", deviceID).Str("document", changeType.String()).
+				Int64("desiredVersion", twin.DesiredVersion).Int64("reportedVersion", twin.ReportedVersion).
+				Msg("device twin has been updated")
+			return result, nil
+		}
+	}
+	return nil, conversions.ToGRPCError(derrors.NewUnavailableError("device twin is being updated concurrently").
+		WithParams(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+}
+
+// getOrCreateTwin retrieves the twin of a device, creating it with empty documents the first time.
+func (m *Manager) getOrCreateTwin(deviceID *grpc_device_go.DeviceId) (*entities.DeviceTwin, error) {
+	twin, derr := m.twinProvider.GetTwin(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	if twin != nil {
+		return twin, nil
+	}
+	// the twin may be created concurrently, so it is read again after adding it
+	_, derr = m.twinProvider.AddTwin(*entities.NewDeviceTwin(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	twin, derr = m.twinProvider.GetTwin(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if derr != nil {
+		return nil, conversions.ToGRPCError(derr)
+	}
+	if twin == nil {
+		return nil, conversions.ToGRPCError(derrors.NewInternalError("cannot create device twin").
+			WithParams(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+	}
+	return twin, nil
+}
+
+// deviceLogin checks that an API key belongs to a device and that its credentials are enabled.
+func (m *Manager) deviceLogin(deviceID *grpc_device_go.DeviceId, deviceApiKey string) error {
+	aCtx, aCancel := context.WithTimeout(context.Background(), AuthxClientTimeout)
+	defer aCancel()
+	credentials, err := m.authxClient.GetDeviceCredentials(aCtx, deviceID)
+	if err != nil || subtle.ConstantTimeCompare([]byte(credentials.DeviceApiKey), []byte(deviceApiKey)) != 1 {
+		return conversions.ToGRPCError(derrors.NewUnauthenticatedError("device credentials are not valid").
+			WithParams(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+	}
+	if !credentials.Enabled {
+		return conversions.ToGRPCError(derrors.NewUnauthenticatedError("device credentials are disabled").
+			WithParams(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId))
+	}
+	return nil
+}
+
+// removeDeviceTwin removes the twin of a device.
+func (m *Manager) removeDeviceTwin(deviceID *grpc_device_go.DeviceId) {
+	err := m.twinProvider.RemoveTwin(deviceID.OrganizationId, deviceID.DeviceGroupId, deviceID.DeviceId)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Interface("deviceID", deviceID).Msg("cannot remove device twin")
+	}
+}
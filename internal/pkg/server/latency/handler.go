@@ -49,6 +49,34 @@ func (h *Handler) RegisterLatency(ctx context.Context, request *grpc_device_cont
 	return &grpc_common_go.Success{}, nil
 }
 
+// RegisterHeartbeat stores the latency and the health metrics reported by a device.
+func (h *Handler) RegisterHeartbeat(ctx context.Context, request *grpc_device_manager_go.RegisterHeartbeatRequest) (*grpc_common_go.Success, error) {
+	err := entities.ValidRegisterHeartbeatRequest(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+
+	err = h.Manager.RegisterHeartbeat(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return &grpc_common_go.Success{}, nil
+}
+
+// ListHeartbeats retrieves the heartbeats of a device in a time range.
+func (h *Handler) ListHeartbeats(ctx context.Context, request *grpc_device_manager_go.HeartbeatHistoryRequest) (*grpc_device_manager_go.HeartbeatList, error) {
+	err := entities.ValidHeartbeatHistoryRequest(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+
+	list, err := h.Manager.ListHeartbeats(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return list, nil
+}
+
 // TODO: change getLatency to GetDeviceLatencies
 func (h *Handler) GetLatency(ctx context.Context, device *grpc_device_go.DeviceId) (*grpc_device_manager_go.LatencyMeasure, error) {
 	err := entities.ValidDeviceID(device)
@@ -18,6 +18,7 @@ package latency
 import (
 	"context"
 	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
 	"github.com/nalej/device-manager/internal/pkg/provider/latency"
 	"github.com/nalej/grpc-device-controller-go"
 	"github.com/nalej/grpc-device-manager-go"
@@ -48,7 +49,7 @@ var _ = ginkgo.Describe("Latency Register", func() {
 		// Create providers
 		lProvider = latency.NewMockupProvider()
 
-		manager := NewManager(lProvider)
+		manager := NewManager(lProvider, entities.PaginationConfig{DefaultPageSize: 100, MaxPageSize: 1000})
 		handler := NewHandler(manager)
 		grpc_device_manager_go.RegisterLatencyServer(server, handler)
 
@@ -77,4 +78,33 @@ var _ = ginkgo.Describe("Latency Register", func() {
 		gomega.Expect(success).ShouldNot(gomega.BeNil())
 	})
 
+	ginkgo.It("should be able to register heartbeats and list them", func() {
+		toAdd := &grpc_device_manager_go.RegisterHeartbeatRequest{
+			OrganizationId: uuid.New().String(),
+			DeviceGroupId:  uuid.New().String(),
+			DeviceId:       uuid.New().String(),
+			Latency:        rand.Int31n(1000) + 1,
+			Metrics: []*grpc_device_manager_go.HealthMetric{
+				{Type: grpc_device_manager_go.HealthMetricType_BATTERY_LEVEL, Value: 75},
+				{Type: grpc_device_manager_go.HealthMetricType_SIGNAL_STRENGTH, Value: -67},
+			},
+		}
+		_, err := client.RegisterHeartbeat(context.Background(), toAdd)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		toAdd.Metrics[0].Value = 120
+		_, err = client.RegisterHeartbeat(context.Background(), toAdd)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		heartbeats, err := client.ListHeartbeats(context.Background(), &grpc_device_manager_go.HeartbeatHistoryRequest{
+			OrganizationId: toAdd.OrganizationId,
+			DeviceGroupId:  toAdd.DeviceGroupId,
+			DeviceId:       toAdd.DeviceId,
+		})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(heartbeats.Heartbeats)).Should(gomega.Equal(1))
+		gomega.Expect(heartbeats.Heartbeats[0].Latency).Should(gomega.Equal(toAdd.Latency))
+		gomega.Expect(len(heartbeats.Heartbeats[0].Metrics)).Should(gomega.Equal(2))
+	})
+
 })
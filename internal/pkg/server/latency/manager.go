@@ -27,20 +27,51 @@ import (
 )
 
 type Manager struct {
-	pProvider latency.Provider
+	pProvider  latency.Provider
+	pagination entities.PaginationConfig
 }
 
 // NewManager creates a Manager using a set of clients.
-func NewManager(provider latency.Provider) Manager {
+func NewManager(provider latency.Provider, pagination entities.PaginationConfig) Manager {
 	return Manager{
-		pProvider: provider,
+		pProvider:  provider,
+		pagination: pagination,
 	}
 }
 
 func (m *Manager) RegisterLatency(request *grpc_device_controller_go.RegisterLatencyRequest) derrors.Error {
+	return m.addLatency(entities.NewPingLatencyFromGRPC(request))
+}
+
+// RegisterHeartbeat stores the latency and the health metrics reported by a device.
+func (m *Manager) RegisterHeartbeat(request *grpc_device_manager_go.RegisterHeartbeatRequest) derrors.Error {
+	return m.addLatency(entities.NewHeartbeatFromGRPC(request))
+}
+
+// ListHeartbeats retrieves the heartbeats of a device in a time range, the most recent first.
+func (m *Manager) ListHeartbeats(request *grpc_device_manager_go.HeartbeatHistoryRequest) (*grpc_device_manager_go.HeartbeatList, derrors.Error) {
+	timeRange, err := entities.NewTimeRange(request.From, request.To)
+	if err != nil {
+		return nil, err
+	}
+	latencies, err := m.pProvider.ListLatencies(request.OrganizationId, request.DeviceGroupId, request.DeviceId,
+		*timeRange, m.pagination.PageSize(int(request.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*grpc_device_manager_go.Heartbeat, 0, len(latencies))
+	for _, l := range latencies {
+		result = append(result, l.ToHeartbeatGRPC())
+	}
+	return &grpc_device_manager_go.HeartbeatList{
+		Heartbeats: result,
+	}, nil
+}
+
+// addLatency stores a latency measure in the history and as the last latency of the device.
+func (m *Manager) addLatency(toAdd *entities.Latency) derrors.Error {
 
 	// AddLatency
-	toAdd := entities.NewPingLatencyFromGRPC(request)
 	err := m.pProvider.AddPingLatency(*toAdd)
 	if err != nil {
 		return err
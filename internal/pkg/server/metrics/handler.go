@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"context"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+)
+
+// Handler structure for the metrics requests.
+type Handler struct {
+	Manager Manager
+}
+
+// NewHandler creates a new Handler with a linked manager.
+func NewHandler(manager Manager) *Handler {
+	return &Handler{manager}
+}
+
+// AddMetricSamples stores the samples of the custom metrics of a device.
+func (h *Handler) AddMetricSamples(ctx context.Context, request *grpc_device_manager_go.AddMetricSamplesRequest) (*grpc_common_go.Success, error) {
+	err := entities.ValidAddMetricSamplesRequest(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+
+	err = h.Manager.AddMetricSamples(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return &grpc_common_go.Success{}, nil
+}
+
+// ListMetricSamples retrieves the samples of a metric of a device in a time range.
+func (h *Handler) ListMetricSamples(ctx context.Context, request *grpc_device_manager_go.MetricSamplesRequest) (*grpc_device_manager_go.MetricSampleList, error) {
+	err := entities.ValidMetricSamplesRequest(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+
+	list, err := h.Manager.ListMetricSamples(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return list, nil
+}
+
+// GetLastMetricValues retrieves the last values of the metrics of a device.
+func (h *Handler) GetLastMetricValues(ctx context.Context, request *grpc_device_manager_go.LastMetricValuesRequest) (*grpc_device_manager_go.MetricSampleList, error) {
+	err := entities.ValidLastMetricValuesRequest(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+
+	list, err := h.Manager.GetLastMetricValues(request)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	return list, nil
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/metrics"
+	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-utils/pkg/test"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var _ = ginkgo.Describe("Metrics", func() {
+
+	// gRPC server
+	var server *grpc.Server
+	// grpc test listener
+	var listener *bufconn.Listener
+	// client
+	var client grpc_device_manager_go.MetricsClient
+
+	// Provider
+	var mProvider metrics.Provider
+
+	ginkgo.BeforeSuite(func() {
+		listener = test.GetDefaultListener()
+		server = grpc.NewServer()
+
+		// Create providers
+		mProvider = metrics.NewMockupProvider()
+
+		manager := NewManager(mProvider, entities.PaginationConfig{DefaultPageSize: 100, MaxPageSize: 1000})
+		handler := NewHandler(manager)
+		grpc_device_manager_go.RegisterMetricsServer(server, handler)
+
+		test.LaunchServer(server, listener)
+
+		conn, err := test.GetConn(*listener)
+		gomega.Expect(err).Should(gomega.Succeed())
+		client = grpc_device_manager_go.NewMetricsClient(conn)
+	})
+
+	ginkgo.AfterSuite(func() {
+		server.Stop()
+		listener.Close()
+	})
+
+	ginkgo.It("should be able to add metric samples and list them", func() {
+		toAdd := &grpc_device_manager_go.AddMetricSamplesRequest{
+			OrganizationId: uuid.New().String(),
+			DeviceGroupId:  uuid.New().String(),
+			DeviceId:       uuid.New().String(),
+			Samples: []*grpc_device_manager_go.MetricValue{
+				{Name: "engine.temperature", Value: 80, Timestamp: 1000},
+				{Name: "engine.temperature", Value: 85, Timestamp: 2000},
+				{Name: "engine.rpm", Value: 1200},
+			},
+		}
+		_, err := client.AddMetricSamples(context.Background(), toAdd)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		list, err := client.ListMetricSamples(context.Background(), &grpc_device_manager_go.MetricSamplesRequest{
+			OrganizationId: toAdd.OrganizationId,
+			DeviceGroupId:  toAdd.DeviceGroupId,
+			DeviceId:       toAdd.DeviceId,
+			Name:           "engine.temperature",
+		})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(list.Samples)).Should(gomega.Equal(2))
+		gomega.Expect(list.Samples[0].Value).Should(gomega.Equal(float64(85)))
+
+		list, err = client.ListMetricSamples(context.Background(), &grpc_device_manager_go.MetricSamplesRequest{
+			OrganizationId: toAdd.OrganizationId,
+			DeviceGroupId:  toAdd.DeviceGroupId,
+			DeviceId:       toAdd.DeviceId,
+			Name:           "engine.temperature",
+			From:           1500,
+		})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(list.Samples)).Should(gomega.Equal(1))
+	})
+
+	ginkgo.It("should be able to get the last values of the metrics of a device", func() {
+		toAdd := &grpc_device_manager_go.AddMetricSamplesRequest{
+			OrganizationId: uuid.New().String(),
+			DeviceGroupId:  uuid.New().String(),
+			DeviceId:       uuid.New().String(),
+			Samples: []*grpc_device_manager_go.MetricValue{
+				{Name: "engine.temperature", Value: 85, Timestamp: 2000},
+				{Name: "engine.temperature", Value: 80, Timestamp: 1000},
+				{Name: "engine.rpm", Value: 1200},
+			},
+		}
+		_, err := client.AddMetricSamples(context.Background(), toAdd)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		last, err := client.GetLastMetricValues(context.Background(), &grpc_device_manager_go.LastMetricValuesRequest{
+			OrganizationId: toAdd.OrganizationId,
+			DeviceGroupId:  toAdd.DeviceGroupId,
+			DeviceId:       toAdd.DeviceId,
+		})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(last.Samples)).Should(gomega.Equal(2))
+		gomega.Expect(last.Samples[0].Name).Should(gomega.Equal("engine.rpm"))
+		gomega.Expect(last.Samples[0].Timestamp).ShouldNot(gomega.BeZero())
+		gomega.Expect(last.Samples[1].Value).Should(gomega.Equal(float64(85)))
+
+		last, err = client.GetLastMetricValues(context.Background(), &grpc_device_manager_go.LastMetricValuesRequest{
+			OrganizationId: toAdd.OrganizationId,
+			DeviceGroupId:  toAdd.DeviceGroupId,
+			DeviceId:       toAdd.DeviceId,
+			Names:          []string{"engine.temperature"},
+		})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(last.Samples)).Should(gomega.Equal(1))
+	})
+
+	ginkgo.It("should reject invalid metric samples", func() {
+		_, err := client.AddMetricSamples(context.Background(), &grpc_device_manager_go.AddMetricSamplesRequest{
+			OrganizationId: uuid.New().String(),
+			DeviceGroupId:  uuid.New().String(),
+			DeviceId:       uuid.New().String(),
+			Samples:        []*grpc_device_manager_go.MetricValue{{Name: "engine temperature", Value: 80}},
+		})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+})
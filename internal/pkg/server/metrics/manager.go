@@ -0,0 +1,76 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/metrics"
+	"github.com/nalej/grpc-device-manager-go"
+	"time"
+)
+
+type Manager struct {
+	mProvider  metrics.Provider
+	pagination entities.PaginationConfig
+}
+
+// NewManager creates a Manager using a set of clients.
+func NewManager(provider metrics.Provider, pagination entities.PaginationConfig) Manager {
+	return Manager{
+		mProvider:  provider,
+		pagination: pagination,
+	}
+}
+
+// AddMetricSamples stores the samples of the custom metrics of a device.
+func (m *Manager) AddMetricSamples(request *grpc_device_manager_go.AddMetricSamplesRequest) derrors.Error {
+	return m.mProvider.AddSamples(entities.NewMetricSamplesFromGRPC(request, time.Now().Unix()))
+}
+
+// ListMetricSamples retrieves the samples of a metric of a device in a time range, the most recent first.
+func (m *Manager) ListMetricSamples(request *grpc_device_manager_go.MetricSamplesRequest) (*grpc_device_manager_go.MetricSampleList, derrors.Error) {
+	timeRange, err := entities.NewTimeRange(request.From, request.To)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := m.mProvider.ListSamples(request.OrganizationId, request.DeviceGroupId, request.DeviceId,
+		request.Name, *timeRange, m.pagination.PageSize(int(request.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	return toSampleList(samples), nil
+}
+
+// GetLastMetricValues retrieves the last sample of the requested metrics of a device, or of all its metrics.
+func (m *Manager) GetLastMetricValues(request *grpc_device_manager_go.LastMetricValuesRequest) (*grpc_device_manager_go.MetricSampleList, derrors.Error) {
+	samples, err := m.mProvider.GetLastValues(request.OrganizationId, request.DeviceGroupId, request.DeviceId, request.Names)
+	if err != nil {
+		return nil, err
+	}
+	return toSampleList(samples), nil
+}
+
+func toSampleList(samples []*entities.MetricSample) *grpc_device_manager_go.MetricSampleList {
+	result := make([]*grpc_device_manager_go.MetricSample, 0, len(samples))
+	for _, s := range samples {
+		result = append(result, s.ToGRPC())
+	}
+	return &grpc_device_manager_go.MetricSampleList{
+		Samples: result,
+	}
+}
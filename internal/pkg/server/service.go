@@ -18,14 +18,37 @@ package server
 
 import (
 	"fmt"
+	"github.com/gocql/gocql"
 	"github.com/nalej/derrors"
+	"github.com/nalej/device-manager/internal/pkg/entities"
+	"github.com/nalej/device-manager/internal/pkg/provider/approval"
+	"github.com/nalej/device-manager/internal/pkg/provider/asset"
+	"github.com/nalej/device-manager/internal/pkg/provider/attribute"
+	"github.com/nalej/device-manager/internal/pkg/provider/audit"
+	"github.com/nalej/device-manager/internal/pkg/provider/campaign"
+	"github.com/nalej/device-manager/internal/pkg/provider/command"
+	"github.com/nalej/device-manager/internal/pkg/provider/configuration"
+	"github.com/nalej/device-manager/internal/pkg/provider/deletion"
+	"github.com/nalej/device-manager/internal/pkg/provider/dynamicgroup"
+	"github.com/nalej/device-manager/internal/pkg/provider/geo"
+	"github.com/nalej/device-manager/internal/pkg/provider/geofence"
+	"github.com/nalej/device-manager/internal/pkg/provider/history"
+	"github.com/nalej/device-manager/internal/pkg/provider/index"
+	"github.com/nalej/device-manager/internal/pkg/provider/label"
 	"github.com/nalej/device-manager/internal/pkg/provider/latency"
+	"github.com/nalej/device-manager/internal/pkg/provider/metrics"
+	"github.com/nalej/device-manager/internal/pkg/provider/repair"
+	"github.com/nalej/device-manager/internal/pkg/provider/token"
+	"github.com/nalej/device-manager/internal/pkg/provider/twin"
 	"github.com/nalej/device-manager/internal/pkg/server/device"
 	lat "github.com/nalej/device-manager/internal/pkg/server/latency"
+	met "github.com/nalej/device-manager/internal/pkg/server/metrics"
 	"github.com/nalej/grpc-application-go"
 	"github.com/nalej/grpc-authx-go"
 	"github.com/nalej/grpc-device-go"
 	"github.com/nalej/grpc-device-manager-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
@@ -44,28 +67,67 @@ func NewService(conf Config) *Service {
 	}
 }
 
-// Providers structure with all the providers in the system.
-type Providers struct {
-	pProvider latency.Provider
-}
-
 // CreateInMemoryProviders returns a set of in-memory providers.
-func (s *Service) CreateInMemoryProviders() *Providers {
-	return &Providers{
-		pProvider: latency.NewMockupProvider(),
+func (s *Service) CreateInMemoryProviders() *device.Providers {
+	return &device.Providers{
+		Latency:       latency.NewMockupProvider(),
+		Index:         index.NewMockupProvider(),
+		Approval:      approval.NewMockupProvider(),
+		Token:         token.NewMockupProvider(),
+		Repair:        repair.NewMockupProvider(),
+		Deletion:      deletion.NewMockupProvider(),
+		Attribute:     attribute.NewMockupProvider(),
+		Label:         label.NewMockupProvider(),
+		Geo:           geo.NewMockupProvider(),
+		History:       history.NewMockupProvider(),
+		Geofence:      geofence.NewMockupProvider(),
+		Asset:         asset.NewMockupProvider(),
+		Twin:          twin.NewMockupProvider(),
+		Command:       command.NewMockupProvider(),
+		Configuration: configuration.NewMockupProvider(),
+		Campaign:      campaign.NewMockupProvider(),
+		Metrics:       metrics.NewMockupProvider(),
+		Audit:         audit.NewMockupProvider(),
+		DynamicGroup:  dynamicgroup.NewMockupProvider(),
 	}
 }
 
-// CreateDBScyllaProviders returns a set of in-memory providers.
-func (s *Service) CreateDBScyllaProviders() *Providers {
-	return &Providers{
-		pProvider: latency.NewScyllaProvider(
-			s.Configuration.ScyllaDBAddress, s.Configuration.ScyllaDBPort, s.Configuration.KeySpace),
+// CreateDBScyllaProviders returns a set of providers backed by ScyllaDB that share a single session. The service cannot
+// work without the database, so it stops if the session cannot be created.
+func (s *Service) CreateDBScyllaProviders() *device.Providers {
+	address, port, keyspace := s.Configuration.ScyllaDBAddress, s.Configuration.ScyllaDBPort, s.Configuration.KeySpace
+	conf := gocql.NewCluster(address)
+	conf.Keyspace = keyspace
+	conf.Port = port
+	session, err := conf.CreateSession()
+	if err != nil {
+		log.Fatal().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("unable to connect to ScyllaDB")
+	}
+	return &device.Providers{
+		Latency:       latency.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Index:         index.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Approval:      approval.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Token:         token.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Repair:        repair.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Deletion:      deletion.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Attribute:     attribute.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Label:         label.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Geo:           geo.NewScyllaProviderWithSession(address, port, keyspace, session),
+		History:       history.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Geofence:      geofence.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Asset:         asset.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Twin:          twin.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Command:       command.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Configuration: configuration.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Campaign:      campaign.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Metrics:       metrics.NewScyllaProviderWithSession(address, port, keyspace, session),
+		Audit:         audit.NewScyllaProviderWithSession(address, port, keyspace, session),
+		DynamicGroup:  dynamicgroup.NewScyllaProviderWithSession(address, port, keyspace, session),
 	}
 }
 
 // GetProviders builds the providers according to the selected backend.
-func (s *Service) GetProviders() *Providers {
+func (s *Service) GetProviders() *device.Providers {
 	if s.Configuration.UseInMemoryProviders {
 		return s.CreateInMemoryProviders()
 	} else if s.Configuration.UseDBScyllaProviders {
@@ -80,6 +142,7 @@ type Clients struct {
 	AuthxClient   grpc_authx_go.AuthxClient
 	DevicesClient grpc_device_go.DevicesClient
 	AppsClient    grpc_application_go.ApplicationsClient
+	OrgsClient    grpc_organization_go.OrganizationsClient
 }
 
 // GetClients creates the required connections with the remote clients.
@@ -97,8 +160,9 @@ func (s *Service) GetClients() (*Clients, derrors.Error) {
 	aClient := grpc_authx_go.NewAuthxClient(authxConn)
 	dClient := grpc_device_go.NewDevicesClient(smConn)
 	appsClient := grpc_application_go.NewApplicationsClient(smConn)
+	orgsClient := grpc_organization_go.NewOrganizationsClient(smConn)
 
-	return &Clients{aClient, dClient, appsClient}, nil
+	return &Clients{aClient, dClient, appsClient, orgsClient}, nil
 }
 
 // Run the service, launch the REST service handler.
@@ -121,16 +185,38 @@ func (s *Service) Run() error {
 	prov := s.GetProviders()
 
 	// Create handlers
-	manager := device.NewManager(clients.AuthxClient, clients.DevicesClient, clients.AppsClient, prov.pProvider, s.Configuration.Threshold)
-	handler := device.NewHandler(manager)
+	pagination := entities.PaginationConfig{
+		DefaultPageSize: s.Configuration.DefaultPageSize,
+		MaxPageSize:     s.Configuration.MaxPageSize,
+	}
+	manager := device.NewManager(clients.AuthxClient, clients.DevicesClient, clients.AppsClient, *prov, device.ManagerConfig{
+		Threshold:             s.Configuration.Threshold,
+		Pagination:            pagination,
+		BulkConcurrency:       s.Configuration.BulkConcurrency,
+		PendingExpiration:     s.Configuration.PendingDeviceExpiration,
+		DeletedRetention:      s.Configuration.DeletedDeviceRetention,
+		ReservedLabelPrefixes: s.Configuration.ReservedLabelPrefixes,
+	})
+	handler := device.NewHandler(manager, s.Configuration.ActorSecret)
+	go manager.RunPendingDevicesCleanup(device.PendingDevicesCleanupPeriod)
+	go manager.RunRepairQueue(device.RepairQueuePeriod)
+	go manager.RunDeletedDevicesPurge(device.DeletedDevicesPurgePeriod)
+	go manager.RunCampaigns(device.CampaignCheckPeriod)
+	if s.Configuration.ReconcilePeriod > 0 {
+		go manager.RunReconciler(clients.OrgsClient, s.Configuration.ReconcilePeriod, s.Configuration.ReconcileApply)
+	}
 
-	pManager := lat.NewManager(prov.pProvider)
+	pManager := lat.NewManager(prov.Latency, pagination)
 	pHandler := lat.NewHandler(pManager)
 
+	mManager := met.NewManager(prov.Metrics, pagination)
+	mHandler := met.NewHandler(mManager)
+
 	grpcServer := grpc.NewServer()
 
 	grpc_device_manager_go.RegisterDevicesServer(grpcServer, handler)
 	grpc_device_manager_go.RegisterLatencyServer(grpcServer, pHandler)
+	grpc_device_manager_go.RegisterMetricsServer(grpcServer, mHandler)
 
 	// Register reflection service on gRPC server.
 	reflection.Register(grpcServer)
@@ -16,9 +16,39 @@
 
 package utils
 
-import "os"
+import (
+	"github.com/nalej/derrors"
+	"os"
+	"strconv"
+)
 
 func RunIntegrationTests() bool {
 	var runIntegration = os.Getenv("RUN_INTEGRATION_TEST")
 	return runIntegration == "true"
 }
+
+// ScyllaTestSettings contains the ScyllaDB keyspace used by the integration tests of the providers.
+type ScyllaTestSettings struct {
+	Address  string
+	Port     int
+	Keyspace string
+}
+
+// GetScyllaTestSettings reads the settings of the integration tests of the providers from the environment:
+//
+//	RUN_INTEGRATION_TEST=true
+//	IT_SCYLLA_HOST=127.0.0.1
+//	IT_SCYLLA_PORT=9042
+//	IT_NALEJ_KEYSPACE=measure
+//
+// A local ScyllaDB can be launched with docker run --name scylla -p 9042:9042 -d scylladb/scylla, and the keyspace and
+// the tables of the providers are created with the statements of scripts/database.cql.
+func GetScyllaTestSettings() (*ScyllaTestSettings, derrors.Error) {
+	address := os.Getenv("IT_SCYLLA_HOST")
+	keyspace := os.Getenv("IT_NALEJ_KEYSPACE")
+	port, _ := strconv.Atoi(os.Getenv("IT_SCYLLA_PORT"))
+	if address == "" || keyspace == "" || port <= 0 {
+		return nil, derrors.NewFailedPreconditionError("missing environment variables")
+	}
+	return &ScyllaTestSettings{Address: address, Port: port, Keyspace: keyspace}, nil
+}